@@ -0,0 +1,68 @@
+package api
+
+import "time"
+
+// Holds all admin related api request and response structs
+
+type AdminUserResp struct {
+	ID        uint      `json:"id"`
+	Email     string    `json:"email"`
+	Name      string    `json:"name"`
+	Picture   string    `json:"picture"`
+	Status    string    `json:"status"`
+	Role      string    `json:"role"`
+	Disabled  bool      `json:"disabled"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Admin User Search
+
+type AdminUserSearchResp struct {
+	Users []AdminUserResp `json:"users"`
+	Total int64           `json:"total"`
+}
+
+// Admin User Pages
+
+type AdminUserPagesResp struct {
+	User  AdminUserResp `json:"user"`
+	Pages []PageResp    `json:"pages"`
+}
+
+// Admin User Status
+
+type AdminUserStatusRequest struct {
+	UserID uint   `json:"user_id"`
+	Status string `json:"status"`
+}
+
+type AdminUserStatusResp struct{}
+
+// Admin User Disable
+
+type AdminUserDisableRequest struct {
+	UserID   uint `json:"user_id"`
+	Disabled bool `json:"disabled"`
+}
+
+type AdminUserDisableResp struct{}
+
+// Admin Page Unpublish
+
+type AdminPageUnpublishRequest struct {
+	PageUUID string `json:"page_uuid"`
+	Reason   string `json:"reason,omitempty"`
+}
+
+type AdminPageUnpublishResp struct{}
+
+// Admin Page Transfer
+
+type AdminPageTransferRequest struct {
+	PageUUID string `json:"page_uuid"`
+	UserID   uint   `json:"user_id"` // New owner
+}
+
+type AdminPageTransferResp struct {
+	PageUUIDs []string `json:"page_uuids"` // The page and its sub-pages
+}
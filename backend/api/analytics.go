@@ -0,0 +1,95 @@
+package api
+
+import "time"
+
+// Holds all analytics related api request and response structs
+
+// Page Analytics
+
+type PageAnalyticsRequest struct {
+	From        string `form:"from"`        // RFC 3339 or YYYY-MM-DD, defaults to 30 days before to
+	To          string `form:"to"`          // RFC 3339 or YYYY-MM-DD (exclusive), defaults to now
+	Granularity string `form:"granularity"` // hour, day or week, defaults to day
+}
+
+type PageAnalyticsResp struct {
+	PageUUID       string                   `json:"page_uuid"`
+	From           time.Time                `json:"from"`
+	To             time.Time                `json:"to"`
+	Granularity    string                   `json:"granularity"`
+	Views          int64                    `json:"views"`
+	UniqueVisitors int64                    `json:"unique_visitors"`
+	ExcludedViews  int64                    `json:"excluded_views"` // by bots, the owner, collaborators and repeat visitors
+	Series         []AnalyticsPointResp     `json:"series"`
+	TopReferrers   []AnalyticsBreakdownResp `json:"top_referrers"`
+	Devices        []AnalyticsBreakdownResp `json:"devices"`
+	Countries      []AnalyticsBreakdownResp `json:"countries"`
+	Excluded       []AnalyticsBreakdownResp `json:"excluded"` // excluded views by reason
+}
+
+type AnalyticsPointResp struct {
+	Start          time.Time `json:"start"`
+	Views          int64     `json:"views"`
+	UniqueVisitors int64     `json:"unique_visitors"`
+	ExcludedViews  int64     `json:"excluded_views"`
+}
+
+type AnalyticsBreakdownResp struct {
+	Value          string `json:"value"`
+	Views          int64  `json:"views"`
+	UniqueVisitors int64  `json:"unique_visitors"`
+}
+
+// Page Analytics Export
+
+type PageAnalyticsExportRequest struct {
+	PageUUID string `form:"page_uuid"` // all of the user's public pages if empty
+	From     string `form:"from"`      // RFC 3339 or YYYY-MM-DD, defaults to 30 days before to
+	To       string `form:"to"`        // RFC 3339 or YYYY-MM-DD (exclusive), defaults to now
+	Format   string `form:"format"`    // csv or json, defaults to csv
+}
+
+type AnalyticsExportRow struct {
+	Date           string                  `json:"date"`
+	PageUUID       string                  `json:"page_uuid"`
+	PageName       string                  `json:"page_name"`
+	Views          int64                   `json:"views"`
+	UniqueVisitors int64                   `json:"unique_visitors"`
+	ExcludedViews  int64                   `json:"excluded_views"`
+	Referrers      []AnalyticsReferrerResp `json:"referrers"`
+}
+
+type AnalyticsReferrerResp struct {
+	Referrer string `json:"referrer"`
+	Views    int64  `json:"views"`
+}
+
+// Analytics Dashboard
+
+type AnalyticsDashboardRequest struct {
+	RootPageUUID string `form:"root_page_uuid"` // only the page and its sub-pages if set
+	Period       int    `form:"period"`         // days to rank pages over, 7 or 30, defaults to 7
+}
+
+type AnalyticsDashboardResp struct {
+	PeriodDays  int                      `json:"period_days"`
+	TotalViews  int64                    `json:"total_views"`
+	PeriodViews int64                    `json:"period_views"`
+	ThisWeek    int64                    `json:"this_week"`
+	LastWeek    int64                    `json:"last_week"`
+	WeekChange  *float64                 `json:"week_change"` // relative change from last week (0.5 is +50%), null without views last week
+	Trending    []AnalyticsPageStatsResp `json:"trending"`
+	LeastViewed []AnalyticsPageStatsResp `json:"least_viewed"`
+	Pages       []AnalyticsPageStatsResp `json:"pages"`
+}
+
+type AnalyticsPageStatsResp struct {
+	PageUUID    string   `json:"page_uuid"`
+	PageName    string   `json:"page_name"`
+	ViewCount   int64    `json:"view_count"`
+	PeriodViews int64    `json:"period_views"`
+	Sparkline   []int64  `json:"sparkline"` // views by day over the period, oldest first
+	ThisWeek    int64    `json:"this_week"`
+	LastWeek    int64    `json:"last_week"`
+	WeekChange  *float64 `json:"week_change"`
+}
@@ -0,0 +1,64 @@
+package api
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Holds all audit related api request and response structs
+
+type AuditActorResp struct {
+	ID      uint   `json:"id,omitempty"` // only for the viewer's own actions in the audit log
+	Name    string `json:"name"`
+	Picture string `json:"picture,omitempty"` // only for the viewer's own actions in the audit log
+}
+
+type AuditEventResp struct {
+	ID         uint            `json:"id"`
+	CreatedAt  time.Time       `json:"created_at"`
+	Actor      *AuditActorResp `json:"actor"` // null for system actions and deleted users
+	Action     string          `json:"action"`
+	TargetType string          `json:"target_type"`
+	TargetID   string          `json:"target_id"`
+	Details    json.RawMessage `json:"details"`
+	IP         string          `json:"ip,omitempty"`         // only for the viewer's own actions in the audit log
+	UserAgent  string          `json:"user_agent,omitempty"` // only for the viewer's own actions in the audit log
+}
+
+// Page Activity
+
+type PageActivityRequest struct {
+	From   string   `form:"from"`   // RFC 3339 or YYYY-MM-DD
+	To     string   `form:"to"`     // RFC 3339 or YYYY-MM-DD (exclusive)
+	Action []string `form:"action"` // any action if empty
+	Limit  int      `form:"limit"`  // defaults to 20, at most 100
+	Offset int      `form:"offset"`
+}
+
+type PageActivityResp struct {
+	Events []AuditEventResp `json:"events"`
+	Total  int64            `json:"total"`
+}
+
+// Audit Log
+
+type AuditLogRequest struct {
+	From   string   `form:"from"`   // RFC 3339 or YYYY-MM-DD
+	To     string   `form:"to"`     // RFC 3339 or YYYY-MM-DD (exclusive)
+	Action []string `form:"action"` // any action if empty
+	Limit  int      `form:"limit"`  // defaults to 20, at most 100
+	Offset int      `form:"offset"`
+}
+
+type AuditLogResp struct {
+	Events []AuditEventResp `json:"events"`
+	Total  int64            `json:"total"`
+}
+
+// Audit Log Export
+
+type AuditLogExportRequest struct {
+	From   string   `form:"from"`   // RFC 3339 or YYYY-MM-DD
+	To     string   `form:"to"`     // RFC 3339 or YYYY-MM-DD (exclusive)
+	Action []string `form:"action"` // any action if empty
+}
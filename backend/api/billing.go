@@ -0,0 +1,12 @@
+package api
+
+// Holds all billing related api request and response structs
+
+// Billing Webhook
+
+type BillingWebhookResp struct {
+	Received  bool `json:"received"`
+	Duplicate bool `json:"duplicate,omitempty"`
+	// Stale is true if the event is older than the last applied event of its subscription
+	Stale bool `json:"stale,omitempty"`
+}
@@ -1,52 +1,48 @@
 package caching
 
 import (
+	"context"
+	"encoding"
+	"encoding/json"
 	"errors"
-
-	"github.com/gin-gonic/gin"
-	"github.com/redis/go-redis/v9"
+	"time"
 )
 
-var RDB *redis.Client
-
-// InitializeClient initializes the Redis client.
-func InitializeClient(addr string, passwd string, db int) error {
-	RDB = redis.NewClient(&redis.Options{
-		Addr:     addr,
-		Password: passwd,
-		DB:       db,
-	})
-
-	return nil
-}
-
-// Store stores the response in the cache.
-func Store(c *gin.Context, request string, response interface{}) error {
-	// Store the response in the cache
-	err := RDB.Set(c, request, response, 0).Err()
-	if err != nil {
-		return err
-	}
-	return nil
+// ErrMiss is returned by Cache.Get when the key is not cached.
+var ErrMiss = errors.New("cache miss")
+
+// NoExpiration stores a value until it is deleted or evicted.
+const NoExpiration time.Duration = 0
+
+// Cache stores responses by key.
+// Implementations must be safe for concurrent use.
+type Cache interface {
+	// Get returns the value stored under key, or ErrMiss if there is none.
+	Get(ctx context.Context, key string) ([]byte, error)
+	// Set stores value under key for ttl, NoExpiration to keep it until deleted or evicted.
+	// value is stored as is if it is a []byte or string, encoded with its MarshalBinary method
+	// if it implements encoding.BinaryMarshaler, and JSON encoded otherwise.
+	Set(ctx context.Context, key string, value interface{}, ttl time.Duration) error
+	// SetNX stores value under key for ttl like Set, unless the key is already cached.
+	// Returns true if the value was stored. The check and the store are atomic.
+	SetNX(ctx context.Context, key string, value interface{}, ttl time.Duration) (bool, error)
+	// Delete removes the keys, keys that are not cached are ignored.
+	Delete(ctx context.Context, keys ...string) error
 }
 
-// Check checks if the response is already cached.
-// request: the request string to be used as the key for the cache
-// returns the cached response if it exists, otherwise returns an error
-func Check(c *gin.Context, request string) (interface{}, error) {
-	// Check if the response is already cached
-	cachedResponse, err := RDB.Get(c, request).Result()
-	if err == nil {
-		// Return the cached response
-		return cachedResponse, nil
+// Default is the cache used by the handlers, set by initializers.InitializeCache.
+// Until then nothing is cached.
+var Default Cache = NewNoop()
+
+// encode converts a value passed to Cache.Set to the bytes to store.
+func encode(value interface{}) ([]byte, error) {
+	switch v := value.(type) {
+	case []byte:
+		return v, nil
+	case string:
+		return []byte(v), nil
+	case encoding.BinaryMarshaler:
+		return v.MarshalBinary()
 	}
-	// Response is not cached
-	return nil, errors.New("Response for " + request + " not found in cache")
-}
-
-// Invalidate deletes a key from the cache
-// request: the request string to be used as the key for the cache
-// returns an error if the key could not be deleted
-func Invalidate(c *gin.Context, request string) error {
-	return RDB.Del(c, request).Err()
+	return json.Marshal(value)
 }
@@ -0,0 +1,173 @@
+package caching
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Batch holds the counts drained from a Counter, to be persisted before being acknowledged.
+type Batch struct {
+	// ID is unique to the batch and stays the same if it is drained again, so it can be persisted at most once.
+	ID     string
+	Counts map[string]int64
+}
+
+// Counter accumulates increments of named fields until they are drained in batches.
+// Counts are never lost between Incr and Ack: a batch that isn't acknowledged is drained again.
+// Implementations must be safe for concurrent use.
+type Counter interface {
+	// Incr adds delta to field.
+	Incr(ctx context.Context, field string, delta int64) error
+	// Drain moves the accumulated counts to a batch and returns it, an empty batch if there is nothing to drain.
+	// Batches drained but not acknowledged, e.g. because persisting them failed, are returned first.
+	Drain(ctx context.Context) (Batch, error)
+	// Ack discards a drained batch once it has been persisted.
+	Ack(ctx context.Context, batch Batch) error
+}
+
+// DefaultCounter is the counter page views are recorded in, set by initializers.InitializeCache.
+var DefaultCounter Counter = NewMemoryCounter()
+
+// newBatchID returns a random batch ID, unique across instances of the app.
+func newBatchID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic("failed to generate batch ID: " + err.Error())
+	}
+	return hex.EncodeToString(b)
+}
+
+// MemoryCounter is an in-process Counter.
+// Counts not yet drained are lost if the process exits without draining them.
+type MemoryCounter struct {
+	mu      sync.Mutex
+	counts  map[string]int64
+	drained []Batch
+}
+
+// NewMemoryCounter returns an in-process Counter.
+func NewMemoryCounter() *MemoryCounter {
+	return &MemoryCounter{counts: make(map[string]int64)}
+}
+
+func (m *MemoryCounter) Incr(ctx context.Context, field string, delta int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.counts[field] += delta
+	return nil
+}
+
+func (m *MemoryCounter) Drain(ctx context.Context) (Batch, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if len(m.drained) > 0 {
+		return m.drained[0], nil
+	}
+	if len(m.counts) == 0 {
+		return Batch{}, nil
+	}
+
+	batch := Batch{ID: newBatchID(), Counts: m.counts}
+	m.counts = make(map[string]int64)
+	m.drained = append(m.drained, batch)
+	return batch, nil
+}
+
+func (m *MemoryCounter) Ack(ctx context.Context, batch Batch) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, drained := range m.drained {
+		if drained.ID == batch.ID {
+			m.drained = append(m.drained[:i], m.drained[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+// RedisCounter is a Counter shared by every instance of the app, counting in a Redis hash.
+// While Redis is unreachable increments are counted in memory instead, and drained before the Redis counts.
+type RedisCounter struct {
+	client   *redis.Client
+	name     string
+	fallback *MemoryCounter
+}
+
+// NewRedisCounter returns a Counter storing its counts under keys prefixed with "counter:<name>:".
+func NewRedisCounter(client *redis.Client, name string) *RedisCounter {
+	return &RedisCounter{client: client, name: name, fallback: NewMemoryCounter()}
+}
+
+// pendingKey is the hash increments are added to.
+func (r *RedisCounter) pendingKey() string {
+	return "counter:" + r.name + ":pending"
+}
+
+// batchKey is the hash holding the counts of a drained batch until it is acknowledged.
+func (r *RedisCounter) batchKey(id string) string {
+	return "counter:" + r.name + ":batch:" + id
+}
+
+func (r *RedisCounter) Incr(ctx context.Context, field string, delta int64) error {
+	if err := r.client.HIncrBy(ctx, r.pendingKey(), field, delta).Err(); err != nil {
+		log.Printf("Failed to increment %s in Redis, counting in memory: %v", field, err)
+		return r.fallback.Incr(ctx, field, delta)
+	}
+	return nil
+}
+
+func (r *RedisCounter) Drain(ctx context.Context) (Batch, error) {
+	if batch, _ := r.fallback.Drain(ctx); batch.ID != "" {
+		return batch, nil
+	}
+
+	// Batches left over by a failed persist or a crashed instance come first
+	var id string
+	leftover := r.client.Scan(ctx, 0, r.batchKey("*"), 100).Iterator()
+	if leftover.Next(ctx) {
+		id = strings.TrimPrefix(leftover.Val(), r.batchKey(""))
+	} else if err := leftover.Err(); err != nil {
+		return Batch{}, err
+	} else {
+		// Renaming is atomic, increments made from now on start a new pending hash
+		id = newBatchID()
+		err := r.client.Rename(ctx, r.pendingKey(), r.batchKey(id)).Err()
+		if err != nil && strings.Contains(err.Error(), "no such key") {
+			return Batch{}, nil
+		}
+		if err != nil {
+			return Batch{}, err
+		}
+	}
+
+	values, err := r.client.HGetAll(ctx, r.batchKey(id)).Result()
+	if err != nil {
+		return Batch{}, err
+	}
+	batch := Batch{ID: id, Counts: make(map[string]int64, len(values))}
+	for field, value := range values {
+		count, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return Batch{}, errors.New("invalid count of " + field + ": " + value)
+		}
+		batch.Counts[field] = count
+	}
+	return batch, nil
+}
+
+func (r *RedisCounter) Ack(ctx context.Context, batch Batch) error {
+	if err := r.fallback.Ack(ctx, batch); err != nil {
+		return err
+	}
+	return r.client.Del(ctx, r.batchKey(batch.ID)).Err()
+}
@@ -0,0 +1,103 @@
+package caching
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// testCounter runs the Drain and Ack contract against a Counter.
+func testCounter(t *testing.T, counter Counter) {
+	t.Helper()
+	ctx := context.Background()
+
+	if batch, err := counter.Drain(ctx); err != nil || batch.ID != "" {
+		t.Fatalf("Drain() of an empty counter = %+v, %v, want an empty batch", batch, err)
+	}
+
+	counter.Incr(ctx, "a", 1)
+	counter.Incr(ctx, "a", 2)
+	counter.Incr(ctx, "b", 1)
+	first, err := counter.Drain(ctx)
+	if err != nil || first.ID == "" {
+		t.Fatalf("Drain() = %+v, %v, want a batch", first, err)
+	}
+	if len(first.Counts) != 2 || first.Counts["a"] != 3 || first.Counts["b"] != 1 {
+		t.Errorf("Drain() counts = %v, want a:3 b:1", first.Counts)
+	}
+
+	// Increments after a drain go to the next batch, the unacknowledged batch is drained again first
+	counter.Incr(ctx, "c", 1)
+	again, err := counter.Drain(ctx)
+	if err != nil || again.ID != first.ID || again.Counts["a"] != 3 || again.Counts["b"] != 1 {
+		t.Errorf("Drain() of an unacknowledged batch = %+v, %v, want %+v", again, err, first)
+	}
+
+	if err := counter.Ack(ctx, first); err != nil {
+		t.Fatalf("Ack() = %v", err)
+	}
+	second, err := counter.Drain(ctx)
+	if err != nil || second.ID == "" || second.ID == first.ID {
+		t.Fatalf("Drain() after Ack = %+v, %v, want a new batch", second, err)
+	}
+	if len(second.Counts) != 1 || second.Counts["c"] != 1 {
+		t.Errorf("Drain() after Ack counts = %v, want c:1", second.Counts)
+	}
+	if err := counter.Ack(ctx, second); err != nil {
+		t.Fatalf("Ack() = %v", err)
+	}
+	if batch, err := counter.Drain(ctx); err != nil || batch.ID != "" {
+		t.Errorf("Drain() after acknowledging every batch = %+v, %v, want an empty batch", batch, err)
+	}
+}
+
+func TestMemoryCounter(t *testing.T) {
+	testCounter(t, NewMemoryCounter())
+}
+
+// TestRedisCounter needs a Redis server at REDIS_ADDR.
+func TestRedisCounter(t *testing.T) {
+	addr := os.Getenv("REDIS_ADDR")
+	if addr == "" {
+		t.Skip("REDIS_ADDR not set")
+	}
+	client := redis.NewClient(&redis.Options{Addr: addr, Password: os.Getenv("REDIS_PASSWORD")})
+	defer client.Close()
+	if err := client.Ping(context.Background()).Err(); err != nil {
+		t.Skipf("Redis unreachable: %v", err)
+	}
+
+	name := fmt.Sprintf("test-%d", time.Now().UnixNano())
+	t.Cleanup(func() {
+		keys, _ := client.Keys(context.Background(), "counter:"+name+":*").Result()
+		if len(keys) > 0 {
+			client.Del(context.Background(), keys...)
+		}
+	})
+	testCounter(t, NewRedisCounter(client, name))
+}
+
+func TestRedisCounterFallsBackToMemory(t *testing.T) {
+	ctx := context.Background()
+	// Nothing listens on port 1, so every command fails
+	client := redis.NewClient(&redis.Options{Addr: "127.0.0.1:1", MaxRetries: -1, DialTimeout: 100 * time.Millisecond})
+	defer client.Close()
+	counter := NewRedisCounter(client, "unreachable")
+
+	if err := counter.Incr(ctx, "a", 2); err != nil {
+		t.Fatalf("Incr() = %v, want the increment counted in memory", err)
+	}
+	batch, err := counter.Drain(ctx)
+	if err != nil || batch.ID == "" || batch.Counts["a"] != 2 {
+		t.Fatalf("Drain() = %+v, %v, want the increments counted in memory", batch, err)
+	}
+	// Deleting the Redis batch fails, but the batch is acknowledged in memory
+	counter.Ack(ctx, batch)
+	if batch, _ := counter.fallback.Drain(ctx); batch.ID != "" {
+		t.Errorf("in-memory batch %+v left after Ack", batch)
+	}
+}
@@ -0,0 +1,169 @@
+package caching
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+)
+
+// maxPendingDeletes bounds the keys remembered while the primary cache is unreachable.
+const maxPendingDeletes = 10000
+
+// Primary is a shared Cache that can be health-checked, e.g. a RedisCache.
+type Primary interface {
+	Cache
+	// Ping checks that the cache is reachable.
+	Ping(ctx context.Context) error
+}
+
+// FallbackCache uses a Redis cache while it is reachable and degrades to an in-process cache when it is not.
+// The primary is health-checked in the background and used again once it recovers.
+// Keys deleted while degraded are deleted from the primary on recovery, so it doesn't serve stale entries.
+type FallbackCache struct {
+	primary  Primary
+	fallback *MemoryCache
+
+	mu             sync.Mutex
+	degraded       bool
+	pendingDeletes map[string]struct{}
+}
+
+// NewFallback returns a Cache using primary, degrading to fallback while primary is unreachable.
+// The primary is checked every interval until ctx is cancelled.
+func NewFallback(ctx context.Context, primary Primary, fallback *MemoryCache, interval time.Duration) *FallbackCache {
+	f := &FallbackCache{
+		primary:        primary,
+		fallback:       fallback,
+		pendingDeletes: make(map[string]struct{}),
+	}
+
+	// Start degraded if the primary is unreachable from the start
+	pingCtx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+	if err := primary.Ping(pingCtx); err != nil {
+		f.degrade(err)
+	}
+
+	go f.healthCheck(ctx, interval)
+	return f
+}
+
+// Degraded returns true while the fallback cache is in use.
+func (f *FallbackCache) Degraded() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.degraded
+}
+
+// degrade switches to the fallback cache after the primary failed with err.
+func (f *FallbackCache) degrade(err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if !f.degraded {
+		log.Printf("Redis cache unreachable, using in-memory cache: %v", err)
+		f.degraded = true
+	}
+}
+
+// healthCheck pings the primary every interval while degraded and switches back to it once it recovers.
+func (f *FallbackCache) healthCheck(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if !f.Degraded() {
+			continue
+		}
+		pingCtx, cancel := context.WithTimeout(ctx, 2*time.Second)
+		err := f.primary.Ping(pingCtx)
+		cancel()
+		if err != nil {
+			continue
+		}
+		f.recover(ctx)
+	}
+}
+
+// recover switches back to the primary after deleting the keys deleted while degraded.
+func (f *FallbackCache) recover(ctx context.Context) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	keys := make([]string, 0, len(f.pendingDeletes))
+	for key := range f.pendingDeletes {
+		keys = append(keys, key)
+	}
+	if err := f.primary.Delete(ctx, keys...); err != nil {
+		// Stay degraded and retry on the next health check
+		return
+	}
+
+	f.pendingDeletes = make(map[string]struct{})
+	// Entries of the fallback would be stale by the next time it is used
+	f.fallback.Clear()
+	f.degraded = false
+	log.Println("Redis cache reachable again")
+}
+
+func (f *FallbackCache) Get(ctx context.Context, key string) ([]byte, error) {
+	if !f.Degraded() {
+		value, err := f.primary.Get(ctx, key)
+		if err == nil || errors.Is(err, ErrMiss) {
+			return value, err
+		}
+		f.degrade(err)
+	}
+	return f.fallback.Get(ctx, key)
+}
+
+func (f *FallbackCache) Set(ctx context.Context, key string, value interface{}, ttl time.Duration) error {
+	if !f.Degraded() {
+		err := f.primary.Set(ctx, key, value, ttl)
+		if err == nil {
+			return nil
+		}
+		f.degrade(err)
+	}
+	return f.fallback.Set(ctx, key, value, ttl)
+}
+
+func (f *FallbackCache) SetNX(ctx context.Context, key string, value interface{}, ttl time.Duration) (bool, error) {
+	if !f.Degraded() {
+		stored, err := f.primary.SetNX(ctx, key, value, ttl)
+		if err == nil {
+			return stored, nil
+		}
+		f.degrade(err)
+	}
+	return f.fallback.SetNX(ctx, key, value, ttl)
+}
+
+func (f *FallbackCache) Delete(ctx context.Context, keys ...string) error {
+	if !f.Degraded() {
+		err := f.primary.Delete(ctx, keys...)
+		if err == nil {
+			return nil
+		}
+		f.degrade(err)
+	}
+
+	f.mu.Lock()
+	if len(f.pendingDeletes)+len(keys) <= maxPendingDeletes {
+		for _, key := range keys {
+			f.pendingDeletes[key] = struct{}{}
+		}
+	} else {
+		log.Printf("Too many cache deletions while Redis is unreachable, %d keys may be stale on recovery", len(keys))
+	}
+	f.mu.Unlock()
+
+	return f.fallback.Delete(ctx, keys...)
+}
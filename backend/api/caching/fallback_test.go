@@ -0,0 +1,181 @@
+package caching
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+var errUnreachable = errors.New("connection refused")
+
+// fakePrimary is an in-memory Primary that fails every call while it is down.
+type fakePrimary struct {
+	cache *MemoryCache
+
+	mu      sync.Mutex
+	down    bool
+	deleted []string
+}
+
+func newFakePrimary(down bool) *fakePrimary {
+	return &fakePrimary{cache: NewMemory(100), down: down}
+}
+
+func (p *fakePrimary) setDown(down bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.down = down
+}
+
+func (p *fakePrimary) err() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.down {
+		return errUnreachable
+	}
+	return nil
+}
+
+func (p *fakePrimary) Ping(ctx context.Context) error {
+	return p.err()
+}
+
+func (p *fakePrimary) Get(ctx context.Context, key string) ([]byte, error) {
+	if err := p.err(); err != nil {
+		return nil, err
+	}
+	return p.cache.Get(ctx, key)
+}
+
+func (p *fakePrimary) Set(ctx context.Context, key string, value interface{}, ttl time.Duration) error {
+	if err := p.err(); err != nil {
+		return err
+	}
+	return p.cache.Set(ctx, key, value, ttl)
+}
+
+func (p *fakePrimary) SetNX(ctx context.Context, key string, value interface{}, ttl time.Duration) (bool, error) {
+	if err := p.err(); err != nil {
+		return false, err
+	}
+	return p.cache.SetNX(ctx, key, value, ttl)
+}
+
+func (p *fakePrimary) Delete(ctx context.Context, keys ...string) error {
+	if err := p.err(); err != nil {
+		return err
+	}
+	p.mu.Lock()
+	p.deleted = append(p.deleted, keys...)
+	p.mu.Unlock()
+	return p.cache.Delete(ctx, keys...)
+}
+
+// waitFor polls cond until it is true or a second has passed.
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met within a second")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestFallbackCacheUsesPrimary(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	primary, fallback := newFakePrimary(false), NewMemory(100)
+	cache := NewFallback(ctx, primary, fallback, time.Hour)
+
+	if cache.Degraded() {
+		t.Fatal("Degraded() = true with a reachable primary")
+	}
+	cache.Set(ctx, "key", "value", NoExpiration)
+	if value, err := primary.cache.Get(ctx, "key"); err != nil || string(value) != "value" {
+		t.Errorf("primary Get() = %q, %v, want the value set", value, err)
+	}
+	if _, err := fallback.Get(ctx, "key"); !errors.Is(err, ErrMiss) {
+		t.Errorf("fallback Get() = %v, want ErrMiss", err)
+	}
+	if _, err := cache.Get(ctx, "missing"); !errors.Is(err, ErrMiss) {
+		t.Errorf("Get(missing) = %v, want ErrMiss", err)
+	}
+	if cache.Degraded() {
+		t.Error("Degraded() = true after a miss")
+	}
+}
+
+func TestFallbackCacheStartsDegraded(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	cache := NewFallback(ctx, newFakePrimary(true), NewMemory(100), time.Hour)
+
+	if !cache.Degraded() {
+		t.Fatal("Degraded() = false with an unreachable primary")
+	}
+	cache.Set(ctx, "key", "value", NoExpiration)
+	if value, err := cache.Get(ctx, "key"); err != nil || string(value) != "value" {
+		t.Errorf("Get() = %q, %v, want the value from the fallback", value, err)
+	}
+}
+
+func TestFallbackCacheDegradesAndRecovers(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	primary, fallback := newFakePrimary(false), NewMemory(100)
+	cache := NewFallback(ctx, primary, fallback, 10*time.Millisecond)
+
+	cache.Set(ctx, "stale", "old", NoExpiration)
+	primary.setDown(true)
+
+	// The first failed call switches to the fallback
+	if _, err := cache.Get(ctx, "stale"); !errors.Is(err, ErrMiss) {
+		t.Fatalf("Get() while degrading = %v, want a miss from the fallback", err)
+	}
+	if !cache.Degraded() {
+		t.Fatal("Degraded() = false after the primary failed")
+	}
+	cache.Set(ctx, "degraded", "value", NoExpiration)
+	if err := cache.Delete(ctx, "stale", "other"); err != nil {
+		t.Fatalf("Delete() while degraded = %v", err)
+	}
+
+	primary.setDown(false)
+	waitFor(t, func() bool { return !cache.Degraded() })
+
+	// Keys deleted while degraded are deleted from the primary on recovery
+	primary.mu.Lock()
+	deleted := append([]string(nil), primary.deleted...)
+	primary.mu.Unlock()
+	sort.Strings(deleted)
+	if len(deleted) != 2 || deleted[0] != "other" || deleted[1] != "stale" {
+		t.Errorf("primary deleted %v, want [other stale]", deleted)
+	}
+	if _, err := cache.Get(ctx, "stale"); !errors.Is(err, ErrMiss) {
+		t.Errorf("Get(stale) after recovery = %v, want ErrMiss", err)
+	}
+	// Entries set while degraded are dropped with the fallback
+	if _, err := fallback.Get(ctx, "degraded"); !errors.Is(err, ErrMiss) {
+		t.Errorf("fallback Get() after recovery = %v, want ErrMiss", err)
+	}
+	cache.Set(ctx, "recovered", "value", NoExpiration)
+	if _, err := primary.cache.Get(ctx, "recovered"); err != nil {
+		t.Errorf("primary Get() after recovery = %v, want a hit", err)
+	}
+}
+
+func TestFallbackCacheStaysDegradedWhileUnreachable(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	cache := NewFallback(ctx, newFakePrimary(true), NewMemory(100), 5*time.Millisecond)
+
+	time.Sleep(30 * time.Millisecond)
+	if !cache.Degraded() {
+		t.Error("Degraded() = false while the primary is unreachable")
+	}
+}
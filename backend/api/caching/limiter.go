@@ -0,0 +1,100 @@
+package caching
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Limiter counts requests in fixed windows to rate limit them.
+// Implementations must be safe for concurrent use.
+type Limiter interface {
+	// Allow counts a request under key and returns true if it is one of the first limit requests of the current window.
+	// retryAfter is the time left until the window ends.
+	Allow(ctx context.Context, key string, limit int64, window time.Duration) (allowed bool, retryAfter time.Duration, err error)
+}
+
+// DefaultLimiter is the limiter rate limited routes use, set by initializers.InitializeCache.
+var DefaultLimiter Limiter = NewMemoryLimiter()
+
+// memoryWindow is the count of requests of a key in the window ending at end.
+type memoryWindow struct {
+	count int64
+	end   time.Time
+}
+
+// MemoryLimiter is an in-process Limiter, each instance of the app limits requests separately.
+type MemoryLimiter struct {
+	mu        sync.Mutex
+	windows   map[string]*memoryWindow
+	lastPrune time.Time
+}
+
+// NewMemoryLimiter returns an in-process Limiter.
+func NewMemoryLimiter() *MemoryLimiter {
+	return &MemoryLimiter{windows: make(map[string]*memoryWindow)}
+}
+
+func (m *MemoryLimiter) Allow(ctx context.Context, key string, limit int64, window time.Duration) (bool, time.Duration, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	// Drop ended windows now and then so keys of past clients don't pile up
+	if now.Sub(m.lastPrune) > time.Minute {
+		for k, w := range m.windows {
+			if !now.Before(w.end) {
+				delete(m.windows, k)
+			}
+		}
+		m.lastPrune = now
+	}
+
+	w, ok := m.windows[key]
+	if !ok || !now.Before(w.end) {
+		w = &memoryWindow{end: now.Add(window)}
+		m.windows[key] = w
+	}
+	w.count++
+	return w.count <= limit, w.end.Sub(now), nil
+}
+
+// RedisLimiter is a Limiter shared by every instance of the app, counting requests under keys prefixed with "limit:".
+// While Redis is unreachable requests are limited in memory instead.
+type RedisLimiter struct {
+	client   *redis.Client
+	fallback *MemoryLimiter
+}
+
+// NewRedisLimiter returns a Limiter counting requests in Redis.
+func NewRedisLimiter(client *redis.Client) *RedisLimiter {
+	return &RedisLimiter{client: client, fallback: NewMemoryLimiter()}
+}
+
+func (r *RedisLimiter) Allow(ctx context.Context, key string, limit int64, window time.Duration) (bool, time.Duration, error) {
+	redisKey := "limit:" + key
+	var incr *redis.IntCmd
+	var ttl *redis.DurationCmd
+	_, err := r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		incr = pipe.Incr(ctx, redisKey)
+		ttl = pipe.PTTL(ctx, redisKey)
+		return nil
+	})
+	if err != nil {
+		log.Printf("Failed to count request %s in Redis, limiting in memory: %v", key, err)
+		return r.fallback.Allow(ctx, key, limit, window)
+	}
+
+	// The first request of a window starts it, a key left without expiry by a failed Expire is restarted too
+	retryAfter := ttl.Val()
+	if incr.Val() == 1 || retryAfter < 0 {
+		if err := r.client.PExpire(ctx, redisKey, window).Err(); err != nil {
+			log.Printf("Failed to start rate limit window of %s in Redis: %v", key, err)
+		}
+		retryAfter = window
+	}
+	return incr.Val() <= limit, retryAfter, nil
+}
@@ -0,0 +1,132 @@
+package caching
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// generationTTL is how long the generation of an invalidated key is kept, longer than any load takes.
+const generationTTL = time.Hour
+
+// call is a load in progress, shared by concurrent misses on the same key.
+type call struct {
+	wg    sync.WaitGroup
+	value []byte
+	err   error
+}
+
+var (
+	loadsMu sync.Mutex
+	loads   = make(map[string]*call)
+)
+
+// generationKey returns the key the generation of key is stored under, changed by each Invalidate of key.
+func generationKey(key string) string {
+	return "generation:" + key
+}
+
+// generation returns the generation of key, empty if it was not invalidated recently.
+func generation(ctx context.Context, cache Cache, key string) (string, error) {
+	value, err := cache.Get(ctx, generationKey(key))
+	if errors.Is(err, ErrMiss) {
+		return "", nil
+	}
+	return string(value), err
+}
+
+// Invalidate deletes the keys from cache, including values being loaded by GetOrLoad.
+// Loads in progress, in this or another instance of the app sharing the cache, don't store their value,
+// as it may have been read before the change the keys are invalidated for.
+func Invalidate(ctx context.Context, cache Cache, keys ...string) error {
+	token := make([]byte, 8)
+	if _, err := rand.Read(token); err != nil {
+		return err
+	}
+	for _, key := range keys {
+		if err := cache.Set(ctx, generationKey(key), hex.EncodeToString(token), generationTTL); err != nil {
+			return err
+		}
+	}
+
+	// Later misses in this instance load again instead of sharing the loads in progress
+	loadsMu.Lock()
+	for _, key := range keys {
+		delete(loads, key)
+	}
+	loadsMu.Unlock()
+
+	return cache.Delete(ctx, keys...)
+}
+
+// GetOrLoad returns the value cached under key in cache.
+// On a miss the value is loaded with load, stored for ttl and returned encoded like Cache.Set encodes it.
+// Concurrent misses on the same key share a single load, so many requests for a key that just expired
+// or was just invalidated don't all hit the database at once.
+// The value isn't stored if the key is invalidated with Invalidate while it is loaded.
+func GetOrLoad(ctx context.Context, cache Cache, key string, ttl time.Duration, load func() (interface{}, error)) ([]byte, error) {
+	value, err := cache.Get(ctx, key)
+	if err == nil {
+		return value, nil
+	}
+	if !errors.Is(err, ErrMiss) {
+		fmt.Printf("Failed to get %s from cache: %s\n", key, err)
+	}
+
+	loadsMu.Lock()
+	if inFlight, ok := loads[key]; ok {
+		loadsMu.Unlock()
+		inFlight.wg.Wait()
+		return inFlight.value, inFlight.err
+	}
+	current := &call{}
+	current.wg.Add(1)
+	loads[key] = current
+	loadsMu.Unlock()
+
+	defer func() {
+		loadsMu.Lock()
+		if loads[key] == current {
+			delete(loads, key)
+		}
+		loadsMu.Unlock()
+		current.wg.Done()
+	}()
+
+	before, err := generation(ctx, cache, key)
+	if err != nil {
+		fmt.Printf("Failed to get generation of %s from cache: %s\n", key, err)
+	}
+
+	loaded, err := load()
+	if err != nil {
+		current.err = err
+		return nil, err
+	}
+	if current.value, current.err = encode(loaded); current.err != nil {
+		return nil, current.err
+	}
+	if after, err := generation(ctx, cache, key); err != nil || after != before {
+		// Invalidated while loading, the value may be stale
+		return current.value, nil
+	}
+	if err := cache.Set(ctx, key, current.value, ttl); err != nil {
+		// Not critical, the next request loads it again
+		fmt.Printf("Failed to store %s in cache: %s\n", key, err)
+		return current.value, nil
+	}
+
+	// Checked again after storing the value, as Invalidate changes the generation before deleting the key,
+	// so a value stored while the key is invalidated is deleted either here or by the invalidation
+	if after, err := generation(ctx, cache, key); err != nil || after != before {
+		if err := cache.Delete(ctx, key); err != nil {
+			fmt.Printf("Failed to delete invalidated %s from cache: %s\n", key, err)
+		}
+	}
+
+	return current.value, nil
+}
@@ -0,0 +1,169 @@
+package caching
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestGetOrLoadCoalescesConcurrentMisses(t *testing.T) {
+	ctx := context.Background()
+	cache := NewMemory(10)
+
+	var loadCount atomic.Int32
+	release := make(chan struct{})
+	load := func() (interface{}, error) {
+		loadCount.Add(1)
+		<-release
+		return map[string]string{"title": "Page"}, nil
+	}
+
+	const callers = 20
+	var wg sync.WaitGroup
+	results := make([]string, callers)
+	errs := make([]error, callers)
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			value, err := GetOrLoad(ctx, cache, "page", time.Minute, load)
+			results[i], errs[i] = string(value), err
+		}(i)
+	}
+	// Let every caller miss before the load completes
+	waitFor(t, func() bool { return loadCount.Load() == 1 })
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if n := loadCount.Load(); n != 1 {
+		t.Errorf("load called %d times, want 1", n)
+	}
+	for i := range results {
+		if errs[i] != nil || results[i] != `{"title":"Page"}` {
+			t.Errorf("caller %d got %q, %v", i, results[i], errs[i])
+		}
+	}
+	if value, err := cache.Get(ctx, "page"); err != nil || string(value) != `{"title":"Page"}` {
+		t.Errorf("cached value = %q, %v, want the loaded value", value, err)
+	}
+}
+
+func TestGetOrLoadHit(t *testing.T) {
+	ctx := context.Background()
+	cache := NewMemory(10)
+	cache.Set(ctx, "page", "cached", time.Minute)
+
+	value, err := GetOrLoad(ctx, cache, "page", time.Minute, func() (interface{}, error) {
+		t.Error("load called on a hit")
+		return nil, nil
+	})
+	if err != nil || string(value) != "cached" {
+		t.Errorf("GetOrLoad() = %q, %v, want the cached value", value, err)
+	}
+}
+
+func TestGetOrLoadErrorIsNotCached(t *testing.T) {
+	ctx := context.Background()
+	cache := NewMemory(10)
+	errLoad := errors.New("load failed")
+
+	if _, err := GetOrLoad(ctx, cache, "page", time.Minute, func() (interface{}, error) {
+		return nil, errLoad
+	}); !errors.Is(err, errLoad) {
+		t.Fatalf("GetOrLoad() = %v, want the load error", err)
+	}
+	if _, err := cache.Get(ctx, "page"); !errors.Is(err, ErrMiss) {
+		t.Errorf("Get() after a failed load = %v, want ErrMiss", err)
+	}
+
+	// The next miss loads again
+	value, err := GetOrLoad(ctx, cache, "page", time.Minute, func() (interface{}, error) {
+		return "loaded", nil
+	})
+	if err != nil || string(value) != "loaded" {
+		t.Errorf("GetOrLoad() after a failed load = %q, %v, want the loaded value", value, err)
+	}
+}
+
+func TestGetOrLoadInvalidatedDuringLoad(t *testing.T) {
+	ctx := context.Background()
+	cache := NewMemory(10)
+
+	var loadCount atomic.Int32
+	release := make(chan struct{})
+	stale := make(chan []byte)
+	go func() {
+		value, _ := GetOrLoad(ctx, cache, "page", time.Minute, func() (interface{}, error) {
+			loadCount.Add(1)
+			<-release
+			return "stale", nil
+		})
+		stale <- value
+	}()
+	waitFor(t, func() bool { return loadCount.Load() == 1 })
+
+	// The page changes while the stale version is loaded
+	if err := Invalidate(ctx, cache, "page"); err != nil {
+		t.Fatalf("Invalidate() = %v", err)
+	}
+
+	// A miss after the invalidation loads again instead of waiting for the stale load
+	fresh, err := GetOrLoad(ctx, cache, "page", time.Minute, func() (interface{}, error) {
+		loadCount.Add(1)
+		return "fresh", nil
+	})
+	if err != nil || string(fresh) != "fresh" {
+		t.Errorf("GetOrLoad() after Invalidate() = %q, %v, want the fresh value", fresh, err)
+	}
+
+	close(release)
+	if value := <-stale; string(value) != "stale" {
+		t.Errorf("GetOrLoad() of the invalidated load = %q, want the stale value", value)
+	}
+	if value, err := cache.Get(ctx, "page"); err != nil || string(value) != "fresh" {
+		t.Errorf("cached value = %q, %v, want the fresh value", value, err)
+	}
+}
+
+// invalidatingCache invalidates a key right after it is stored, before GetOrLoad checks its generation.
+type invalidatingCache struct {
+	Cache
+	key string
+}
+
+func (c *invalidatingCache) Set(ctx context.Context, key string, value interface{}, ttl time.Duration) error {
+	if err := c.Cache.Set(ctx, key, value, ttl); err != nil {
+		return err
+	}
+	if key == c.key {
+		c.key = ""
+		return Invalidate(ctx, c.Cache, key)
+	}
+	return nil
+}
+
+func TestGetOrLoadInvalidatedWhileStored(t *testing.T) {
+	ctx := context.Background()
+	cache := &invalidatingCache{Cache: NewMemory(10), key: "page"}
+
+	value, err := GetOrLoad(ctx, cache, "page", time.Minute, func() (interface{}, error) {
+		return "stale", nil
+	})
+	if err != nil || string(value) != "stale" {
+		t.Fatalf("GetOrLoad() = %q, %v, want the loaded value", value, err)
+	}
+	if _, err := cache.Get(ctx, "page"); !errors.Is(err, ErrMiss) {
+		t.Errorf("Get() after an invalidated load = %v, want ErrMiss", err)
+	}
+}
+
+func TestPageKey(t *testing.T) {
+	owner, public := PageKey("uuid", PageViewOwner), PageKey("uuid", PageViewPublic)
+	if owner == public {
+		t.Errorf("owner and public views share the key %q", owner)
+	}
+}
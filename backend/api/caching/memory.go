@@ -0,0 +1,137 @@
+package caching
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryCache is an in-process LRU Cache.
+// It is not shared between instances of the app, so it is only suitable for a single instance
+// or as a fallback while Redis is unreachable.
+type MemoryCache struct {
+	mu         sync.Mutex
+	maxEntries int
+	entries    map[string]*list.Element
+	// Most recently used entries are at the front
+	order *list.List
+}
+
+type memoryEntry struct {
+	key       string
+	value     []byte
+	expiresAt time.Time // zero if the entry doesn't expire
+}
+
+// expired returns true if the entry is past its expiry.
+func (e *memoryEntry) expired() bool {
+	return !e.expiresAt.IsZero() && time.Now().After(e.expiresAt)
+}
+
+// NewMemory returns an in-process Cache holding at most maxEntries entries,
+// evicting the least recently used entry when full.
+func NewMemory(maxEntries int) *MemoryCache {
+	if maxEntries < 1 {
+		maxEntries = 1
+	}
+	return &MemoryCache{
+		maxEntries: maxEntries,
+		entries:    make(map[string]*list.Element),
+		order:      list.New(),
+	}
+}
+
+func (m *MemoryCache) Get(ctx context.Context, key string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	element, ok := m.entries[key]
+	if !ok {
+		return nil, ErrMiss
+	}
+	entry := element.Value.(*memoryEntry)
+	if entry.expired() {
+		m.removeElement(element)
+		return nil, ErrMiss
+	}
+
+	m.order.MoveToFront(element)
+	return entry.value, nil
+}
+
+func (m *MemoryCache) Set(ctx context.Context, key string, value interface{}, ttl time.Duration) error {
+	bytes, err := encode(value)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.set(key, bytes, ttl)
+	return nil
+}
+
+func (m *MemoryCache) SetNX(ctx context.Context, key string, value interface{}, ttl time.Duration) (bool, error) {
+	bytes, err := encode(value)
+	if err != nil {
+		return false, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if element, ok := m.entries[key]; ok && !element.Value.(*memoryEntry).expired() {
+		return false, nil
+	}
+	m.set(key, bytes, ttl)
+	return true, nil
+}
+
+func (m *MemoryCache) Delete(ctx context.Context, keys ...string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, key := range keys {
+		if element, ok := m.entries[key]; ok {
+			m.removeElement(element)
+		}
+	}
+	return nil
+}
+
+// Clear removes every entry.
+func (m *MemoryCache) Clear() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.entries = make(map[string]*list.Element)
+	m.order.Init()
+}
+
+// set stores bytes under key for ttl, evicting the least recently used entries when full.
+// The caller must hold the lock.
+func (m *MemoryCache) set(key string, bytes []byte, ttl time.Duration) {
+	var expiresAt time.Time
+	if ttl > 0 {
+		expiresAt = time.Now().Add(ttl)
+	}
+
+	if element, ok := m.entries[key]; ok {
+		entry := element.Value.(*memoryEntry)
+		entry.value = bytes
+		entry.expiresAt = expiresAt
+		m.order.MoveToFront(element)
+		return
+	}
+
+	m.entries[key] = m.order.PushFront(&memoryEntry{key: key, value: bytes, expiresAt: expiresAt})
+	for m.order.Len() > m.maxEntries {
+		m.removeElement(m.order.Back())
+	}
+}
+
+// removeElement removes an entry, the caller must hold the lock.
+func (m *MemoryCache) removeElement(element *list.Element) {
+	m.order.Remove(element)
+	delete(m.entries, element.Value.(*memoryEntry).key)
+}
@@ -0,0 +1,139 @@
+package caching
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestMemoryCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	ctx := context.Background()
+	cache := NewMemory(2)
+
+	cache.Set(ctx, "a", "1", NoExpiration)
+	cache.Set(ctx, "b", "2", NoExpiration)
+	// Using "a" makes "b" the least recently used entry
+	if _, err := cache.Get(ctx, "a"); err != nil {
+		t.Fatalf("Get(a) = %v", err)
+	}
+	cache.Set(ctx, "c", "3", NoExpiration)
+
+	if _, err := cache.Get(ctx, "b"); !errors.Is(err, ErrMiss) {
+		t.Errorf("Get(b) = %v, want ErrMiss", err)
+	}
+	for key, want := range map[string]string{"a": "1", "c": "3"} {
+		value, err := cache.Get(ctx, key)
+		if err != nil || string(value) != want {
+			t.Errorf("Get(%s) = %q, %v, want %q", key, value, err, want)
+		}
+	}
+}
+
+func TestMemoryCacheOverwriteDoesNotEvict(t *testing.T) {
+	ctx := context.Background()
+	cache := NewMemory(2)
+
+	cache.Set(ctx, "a", "1", NoExpiration)
+	cache.Set(ctx, "b", "2", NoExpiration)
+	cache.Set(ctx, "a", "3", NoExpiration)
+
+	for key, want := range map[string]string{"a": "3", "b": "2"} {
+		value, err := cache.Get(ctx, key)
+		if err != nil || string(value) != want {
+			t.Errorf("Get(%s) = %q, %v, want %q", key, value, err, want)
+		}
+	}
+}
+
+func TestMemoryCacheExpiresEntries(t *testing.T) {
+	ctx := context.Background()
+	cache := NewMemory(10)
+
+	cache.Set(ctx, "short", "1", 10*time.Millisecond)
+	cache.Set(ctx, "long", "2", time.Hour)
+	cache.Set(ctx, "forever", "3", NoExpiration)
+	time.Sleep(20 * time.Millisecond)
+
+	if _, err := cache.Get(ctx, "short"); !errors.Is(err, ErrMiss) {
+		t.Errorf("Get(short) = %v, want ErrMiss", err)
+	}
+	for _, key := range []string{"long", "forever"} {
+		if _, err := cache.Get(ctx, key); err != nil {
+			t.Errorf("Get(%s) = %v, want a hit", key, err)
+		}
+	}
+}
+
+func TestMemoryCacheDeleteAndClear(t *testing.T) {
+	ctx := context.Background()
+	cache := NewMemory(10)
+
+	cache.Set(ctx, "a", "1", NoExpiration)
+	cache.Set(ctx, "b", "2", NoExpiration)
+	cache.Set(ctx, "c", "3", NoExpiration)
+	if err := cache.Delete(ctx, "a", "missing"); err != nil {
+		t.Fatalf("Delete() = %v", err)
+	}
+	if _, err := cache.Get(ctx, "a"); !errors.Is(err, ErrMiss) {
+		t.Errorf("Get(a) after Delete = %v, want ErrMiss", err)
+	}
+
+	cache.Clear()
+	for _, key := range []string{"b", "c"} {
+		if _, err := cache.Get(ctx, key); !errors.Is(err, ErrMiss) {
+			t.Errorf("Get(%s) after Clear = %v, want ErrMiss", key, err)
+		}
+	}
+}
+
+func TestEncode(t *testing.T) {
+	tests := []struct {
+		name  string
+		value interface{}
+		want  string
+	}{
+		{"bytes", []byte("raw"), "raw"},
+		{"string", "text", "text"},
+		{"binary marshaler", time.Unix(0, 0).UTC(), string(mustMarshalBinary(t, time.Unix(0, 0).UTC()))},
+		{"json", map[string]int{"a": 1}, `{"a":1}`},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := encode(tc.value)
+			if err != nil || string(got) != tc.want {
+				t.Errorf("encode() = %q, %v, want %q", got, err, tc.want)
+			}
+		})
+	}
+}
+
+func mustMarshalBinary(t *testing.T, value time.Time) []byte {
+	t.Helper()
+	bytes, err := value.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bytes
+}
+
+func TestMemoryCacheSetNX(t *testing.T) {
+	ctx := context.Background()
+	cache := NewMemory(10)
+
+	if stored, err := cache.SetNX(ctx, "key", "first", 10*time.Millisecond); err != nil || !stored {
+		t.Fatalf("SetNX() of a missing key = %v, %v, want true", stored, err)
+	}
+	if stored, err := cache.SetNX(ctx, "key", "second", time.Hour); err != nil || stored {
+		t.Errorf("SetNX() of a cached key = %v, %v, want false", stored, err)
+	}
+	if value, _ := cache.Get(ctx, "key"); string(value) != "first" {
+		t.Errorf("Get() = %q, want the first value", value)
+	}
+
+	// Expired entries don't count as cached
+	time.Sleep(20 * time.Millisecond)
+	if stored, err := cache.SetNX(ctx, "key", "third", time.Hour); err != nil || !stored {
+		t.Errorf("SetNX() of an expired key = %v, %v, want true", stored, err)
+	}
+}
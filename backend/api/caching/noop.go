@@ -0,0 +1,30 @@
+package caching
+
+import (
+	"context"
+	"time"
+)
+
+// noopCache caches nothing, used when caching is disabled.
+type noopCache struct{}
+
+// NewNoop returns a Cache that caches nothing, every Get is a miss.
+func NewNoop() Cache {
+	return noopCache{}
+}
+
+func (noopCache) Get(ctx context.Context, key string) ([]byte, error) {
+	return nil, ErrMiss
+}
+
+func (noopCache) Set(ctx context.Context, key string, value interface{}, ttl time.Duration) error {
+	return nil
+}
+
+func (noopCache) SetNX(ctx context.Context, key string, value interface{}, ttl time.Duration) (bool, error) {
+	return true, nil
+}
+
+func (noopCache) Delete(ctx context.Context, keys ...string) error {
+	return nil
+}
@@ -0,0 +1,39 @@
+package caching
+
+import (
+	"context"
+	"fmt"
+)
+
+// Views of a page that are cached separately, as they hold different content.
+const (
+	// PageViewOwner is the page as its owner sees it.
+	PageViewOwner = "owner"
+	// PageViewPublic is the page as visitors and shared users see it.
+	PageViewPublic = "public"
+)
+
+// PageKey returns the key a view of a page is cached under.
+func PageKey(pageUUID string, view string) string {
+	return fmt.Sprintf("/page-get/%s/%s", pageUUID, view)
+}
+
+// InvalidatePages deletes every cached view of the pages from the default cache.
+// Empty UUIDs are ignored, so optional parent UUIDs can be passed as is.
+// Failures are logged rather than returned, as stale entries expire on their own.
+func InvalidatePages(ctx context.Context, pageUUIDs ...string) {
+	keys := make([]string, 0, 2*len(pageUUIDs))
+	for _, pageUUID := range pageUUIDs {
+		if pageUUID == "" {
+			continue
+		}
+		keys = append(keys, PageKey(pageUUID, PageViewOwner), PageKey(pageUUID, PageViewPublic))
+	}
+	if len(keys) == 0 {
+		return
+	}
+
+	if err := Invalidate(ctx, Default, keys...); err != nil {
+		fmt.Printf("Failed to invalidate pages %v in cache: %s\n", pageUUIDs, err)
+	}
+}
@@ -0,0 +1,59 @@
+package caching
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisCache is a Cache backed by a Redis server, shared by every instance of the app.
+type RedisCache struct {
+	Client *redis.Client
+}
+
+// NewRedis returns a Cache backed by the Redis server at addr.
+func NewRedis(addr string, passwd string, db int) *RedisCache {
+	return &RedisCache{Client: redis.NewClient(&redis.Options{
+		Addr:     addr,
+		Password: passwd,
+		DB:       db,
+	})}
+}
+
+// Ping checks that the Redis server is reachable.
+func (r *RedisCache) Ping(ctx context.Context) error {
+	return r.Client.Ping(ctx).Err()
+}
+
+func (r *RedisCache) Get(ctx context.Context, key string) ([]byte, error) {
+	value, err := r.Client.Get(ctx, key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrMiss
+	}
+	return value, err
+}
+
+func (r *RedisCache) Set(ctx context.Context, key string, value interface{}, ttl time.Duration) error {
+	bytes, err := encode(value)
+	if err != nil {
+		return err
+	}
+	return r.Client.Set(ctx, key, bytes, ttl).Err()
+}
+
+func (r *RedisCache) SetNX(ctx context.Context, key string, value interface{}, ttl time.Duration) (bool, error) {
+	bytes, err := encode(value)
+	if err != nil {
+		return false, err
+	}
+	return r.Client.SetNX(ctx, key, bytes, ttl).Result()
+}
+
+func (r *RedisCache) Delete(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	return r.Client.Del(ctx, keys...).Err()
+}
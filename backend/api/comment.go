@@ -0,0 +1,88 @@
+package api
+
+import "time"
+
+// Holds all comment related api request and response structs
+
+type CommentResp struct {
+	ID          uint              `json:"id"`
+	ElementUUID string            `json:"element_uuid,omitempty"` // empty for comments on the page itself
+	ParentID    *uint             `json:"parent_id,omitempty"`
+	Author      CommentAuthorResp `json:"author"`
+	Body        string            `json:"body"`
+	CreatedAt   time.Time         `json:"created_at"`
+	EditedAt    *time.Time        `json:"edited_at,omitempty"`
+	ResolvedAt  *time.Time        `json:"resolved_at,omitempty"`
+	ResolvedBy  *uint             `json:"resolved_by,omitempty"`
+}
+
+type CommentAuthorResp struct {
+	ID      uint   `json:"id"`
+	Name    string `json:"name"`
+	Picture string `json:"picture"`
+}
+
+type CommentThreadResp struct {
+	CommentResp
+	Replies []CommentResp `json:"replies"`
+}
+
+// Listed in api.PageGetResp for the owner and users the page is shared with
+type PageCommentsResp struct {
+	Threads             []CommentThreadResp `json:"threads"` // unresolved threads
+	Unresolved          int64               `json:"unresolved"`
+	UnresolvedByElement map[string]int64    `json:"unresolved_by_element"`
+}
+
+// Comment Create
+
+type CommentCreateRequest struct {
+	PageUUID    string `json:"page_uuid" binding:"required"`
+	ElementUUID string `json:"element_uuid,omitempty"` // comment on an element rather than the page
+	ParentID    *uint  `json:"parent_id,omitempty"`    // reply to a thread
+	Body        string `json:"body" binding:"required"`
+}
+
+type CommentCreateResp struct {
+	Comment CommentResp `json:"comment"`
+}
+
+// Comment Update
+
+type CommentUpdateRequest struct {
+	CommentID uint   `json:"comment_id" binding:"required"`
+	Body      string `json:"body" binding:"required"`
+}
+
+type CommentUpdateResp struct {
+	Comment CommentResp `json:"comment"`
+}
+
+// Comment Resolve
+
+type CommentResolveRequest struct {
+	CommentID uint `json:"comment_id" binding:"required"`
+	Resolved  bool `json:"resolved"` // false to reopen the thread
+}
+
+type CommentResolveResp struct {
+	Comment CommentResp `json:"comment"` // top-level comment of the thread
+}
+
+// Comment Delete
+
+type CommentDeleteRequest struct {
+	CommentID uint `json:"comment_id" binding:"required"`
+}
+
+type CommentDeleteResp struct{}
+
+// Comment List
+
+type CommentListRequest struct {
+	IncludeResolved bool `form:"include_resolved"`
+}
+
+type CommentListResp struct {
+	Threads []CommentThreadResp `json:"threads"`
+}
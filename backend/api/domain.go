@@ -0,0 +1,52 @@
+package api
+
+import "time"
+
+// Holds all custom domain related api request and response structs
+
+type CustomDomainResp struct {
+	ID       uint   `json:"id"`
+	PageUUID string `json:"page_uuid"`
+	Hostname string `json:"hostname"`
+	// TXT record to create to prove the ownership of the domain
+	RecordName  string     `json:"record_name"`
+	RecordValue string     `json:"record_value"`
+	Verified    bool       `json:"verified"`
+	VerifiedAt  *time.Time `json:"verified_at"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+// Domain Create
+
+type DomainCreateRequest struct {
+	PageUUID string `json:"page_uuid" binding:"required"`
+	Hostname string `json:"hostname" binding:"required"`
+}
+
+type DomainCreateResp struct {
+	Domain CustomDomainResp `json:"domain"`
+}
+
+// Domain Verify
+
+type DomainVerifyRequest struct {
+	DomainID uint `json:"domain_id" binding:"required"`
+}
+
+type DomainVerifyResp struct {
+	Domain CustomDomainResp `json:"domain"`
+}
+
+// Domain Delete
+
+type DomainDeleteRequest struct {
+	DomainID uint `json:"domain_id" binding:"required"`
+}
+
+type DomainDeleteResp struct{}
+
+// Domain List
+
+type DomainListResp struct {
+	Domains []CustomDomainResp `json:"domains"`
+}
@@ -0,0 +1,40 @@
+package api
+
+import "time"
+
+// Holds all draft related api request and response structs
+
+// Page Publish
+
+type PagePublishRequest struct {
+	PageUUID string `json:"page_uuid" binding:"required"`
+}
+
+type PagePublishResp struct {
+	PublishedAt time.Time `json:"published_at"`
+}
+
+// Page Discard Draft
+
+type PageDiscardDraftRequest struct {
+	PageUUID string `json:"page_uuid" binding:"required"`
+}
+
+type PageDiscardDraftResp struct{}
+
+// Page Draft Diff
+
+type ElementChangeResp struct {
+	ElementUUID string                 `json:"element_uuid"`
+	Published   ElementsResponseObject `json:"published"`
+	Draft       ElementsResponseObject `json:"draft"`
+}
+
+type PageDraftDiffResp struct {
+	PublishedAt *time.Time               `json:"published_at"` // null if never published, all elements are then added
+	HasChanges  bool                     `json:"has_changes"`
+	Added       []ElementsResponseObject `json:"added"`
+	Removed     []ElementsResponseObject `json:"removed"`
+	Changed     []ElementChangeResp      `json:"changed"`
+	Reordered   bool                     `json:"reordered"`
+}
@@ -0,0 +1,50 @@
+package api
+
+import "time"
+
+// Holds all email related api request and response structs
+
+// Email Preferences
+
+type EmailPreferencesResp struct {
+	Notifications bool       `json:"notifications"` // email notifications still unread after a few minutes
+	Digest        bool       `json:"digest"`        // daily digest of changes to followed pages
+	DigestSentAt  *time.Time `json:"digest_sent_at"`
+}
+
+// Email Preferences Update
+
+type EmailPreferencesUpdateRequest struct {
+	Notifications *bool `json:"notifications,omitempty"`
+	Digest        *bool `json:"digest,omitempty"`
+}
+
+type EmailPreferencesUpdateResp struct {
+	EmailPreferencesResp
+}
+
+// Email Unsubscribe
+
+type EmailUnsubscribeRequest struct {
+	Token string `form:"token" binding:"required"`
+}
+
+type EmailUnsubscribeResp struct {
+	Scope string `json:"scope"` // notifications or digest
+}
+
+// Page Follow
+
+type PageFollowRequest struct {
+	PageUUID string `json:"page_uuid" binding:"required"`
+}
+
+type PageFollowResp struct{}
+
+// Page Unfollow
+
+type PageUnfollowRequest struct {
+	PageUUID string `json:"page_uuid" binding:"required"`
+}
+
+type PageUnfollowResp struct{}
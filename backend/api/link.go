@@ -0,0 +1,19 @@
+package api
+
+// Holds all page link related api request and response structs
+
+type BacklinkResp struct {
+	PageUUID       string `json:"page_uuid"` // page linking to the target
+	PageName       string `json:"page_name"`
+	ElementUUID    string `json:"element_uuid"`
+	Kind           string `json:"kind"` // "nested" for Nested Page elements, "link" for links in text
+	TargetPageUUID string `json:"target_page_uuid"`
+}
+
+// Page Backlinks
+
+type PageBacklinksResp struct {
+	Backlinks []BacklinkResp `json:"backlinks"`
+	// Total counts links from pages the user may not see too, only for the owner of the page
+	Total int64 `json:"total"`
+}
@@ -0,0 +1,70 @@
+package api
+
+import "time"
+
+// Holds all notification related api request and response structs
+
+type NotificationResp struct {
+	ID          uint                  `json:"id"`
+	Category    string                `json:"category"` // mention, task, reply or share
+	CreatedAt   time.Time             `json:"created_at"`
+	ReadAt      *time.Time            `json:"read_at"`
+	Actor       NotificationActorResp `json:"actor"`
+	PageUUID    string                `json:"page_uuid"`
+	PageName    string                `json:"page_name"`
+	ElementUUID string                `json:"element_uuid,omitempty"`
+	CommentID   *uint                 `json:"comment_id,omitempty"`
+}
+
+type NotificationActorResp struct {
+	ID      uint   `json:"id"`
+	Name    string `json:"name"`
+	Picture string `json:"picture"`
+}
+
+// Notification List
+
+type NotificationListRequest struct {
+	Unread bool `form:"unread"`
+	Limit  int  `form:"limit"`
+	Offset int  `form:"offset"`
+}
+
+type NotificationListResp struct {
+	Notifications []NotificationResp `json:"notifications"`
+	Unread        int64              `json:"unread"`
+}
+
+// Notification Read
+
+type NotificationReadRequest struct {
+	NotificationIDs []uint `json:"notification_ids" binding:"required,min=1,max=100"`
+}
+
+type NotificationReadResp struct {
+	Updated int64 `json:"updated"`
+	Unread  int64 `json:"unread"`
+}
+
+// Notification Read All
+
+type NotificationReadAllResp struct {
+	Updated int64 `json:"updated"`
+}
+
+// Notification Preferences
+
+type NotificationPreferencesResp struct {
+	Categories []string `json:"categories"`
+	Muted      []string `json:"muted"`
+}
+
+// Notification Preferences Update
+
+type NotificationPreferencesUpdateRequest struct {
+	Muted []string `json:"muted" binding:"max=10"`
+}
+
+type NotificationPreferencesUpdateResp struct {
+	NotificationPreferencesResp
+}
@@ -38,31 +38,38 @@ type PageGetResp struct {
 	Page     PageResp                 `json:"page"`
 	Elements []ElementsResponseObject `json:"elements"` // Should be in order
 	SubPages map[string]string        `json:"sub_pages,omitempty"`
+	// Comments holds the unresolved comment threads, only for the owner and shared users
+	Comments *PageCommentsResp `json:"comments,omitempty"`
 }
 
 type PageGetRespOwner struct {
 	Page     PageRespOwner            `json:"page"`
 	Elements []ElementsResponseObject `json:"elements"` // Should be in order
 	SubPages map[string]string        `json:"sub_pages,omitempty"`
+	// Comments holds the unresolved comment threads, only for the owner and shared users
+	Comments *PageCommentsResp `json:"comments,omitempty"`
 }
 
 type PageRespOwner struct {
-	ID               uint                   `json:"id"`
-	CreatedAt        time.Time              `json:"created_at"`
-	UpdatedAt        time.Time              `json:"updated_at"`
-	DeletedAt        time.Time              `json:"deleted_at,omitempty"`
-	PageUUID         string                 `json:"page_uuid"`
-	PageName         string                 `json:"page_name"`
-	IsRoot           bool                   `json:"is_root"`
-	ElementPositions []string               `json:"element_positions,omitempty"`
-	ParentPageUUID   string                 `json:"parent_page_uuid,omitempty"`
-	PublicPage       bool                   `json:"public_page"`
-	PageUUIDURL      string                 `json:"page_uuid_url,omitempty"`
-	IsFavourite      bool                   `json:"is_favourite"`
-	LastUpdatedAt    time.Time              `json:"last_updated_at"`
-	ViewCount        uint                   `json:"view_count"`
-	DateViewCount    map[string]int         `json:"date_view_count"`
-	Etc              map[string]interface{} `json:"etc"`
+	ID                uint                   `json:"id"`
+	CreatedAt         time.Time              `json:"created_at"`
+	UpdatedAt         time.Time              `json:"updated_at"`
+	DeletedAt         time.Time              `json:"deleted_at,omitempty"`
+	PageUUID          string                 `json:"page_uuid"`
+	PageName          string                 `json:"page_name"`
+	IsRoot            bool                   `json:"is_root"`
+	ElementPositions  []string               `json:"element_positions,omitempty"`
+	ParentPageUUID    string                 `json:"parent_page_uuid,omitempty"`
+	PublicPage        bool                   `json:"public_page"`
+	PageUUIDURL       string                 `json:"page_uuid_url,omitempty"`
+	Slug              string                 `json:"slug,omitempty"`
+	IsFavourite       bool                   `json:"is_favourite"`
+	LastUpdatedAt     time.Time              `json:"last_updated_at"`
+	ViewCount         uint                   `json:"view_count"`
+	ExcludedViewCount uint                   `json:"excluded_view_count"`
+	DateViewCount     map[string]int         `json:"date_view_count"`
+	Etc               map[string]interface{} `json:"etc"`
+	PublishedAt       *time.Time             `json:"published_at"` // when the elements served to visitors were published, null if never
 }
 
 // Implement encoding.BinaryMarshaler to store api.PageGetResp in the cache
@@ -78,8 +85,26 @@ func (p PageGetRespOwner) MarshalBinary() ([]byte, error) {
 }
 
 // Page List
+type PageListRequest struct {
+	Root           bool   `form:"root"`             // only list root pages
+	ParentPageUUID string `form:"parent_page_uuid"` // only list the children of this page
+	Public         bool   `form:"public"`           // only list public pages
+	Favourite      bool   `form:"favourite"`        // only list favourites
+	UpdatedSince   string `form:"updated_since"`    // RFC 3339 time or date
+	Name           string `form:"name"`             // only list pages whose name contains this, case-insensitively
+	TagIDs         []uint `form:"tag_id"`           // only list pages with these tags
+	TagMatch       string `form:"tag_match"`        // "all" (default) to list pages with every tag, "any" with at least one
+	Sort           string `form:"sort"`             // default, name, created, updated or views
+	Order          string `form:"order"`            // asc or desc, defaults to the natural order of the sort
+	Limit          int    `form:"limit"`            // at most 200, every page is listed without a limit
+	Cursor         string `form:"cursor"`           // next_cursor of the previous response
+}
+
+// Total and NextCursor are only set when paginating with a limit
 type PageListResp struct {
-	Pages []PageResp `json:"pages"`
+	Pages      []PageResp `json:"pages"`
+	Total      *int64     `json:"total,omitempty"`
+	NextCursor string     `json:"next_cursor,omitempty"`
 }
 
 type PageResp struct {
@@ -93,10 +118,12 @@ type PageResp struct {
 	ParentPageUUID   string                 `json:"parent_page_uuid,omitempty"`
 	PublicPage       bool                   `json:"public_page"`
 	PageUUIDURL      string                 `json:"page_uuid_url,omitempty"`
+	Slug             string                 `json:"slug,omitempty"`
 	IsFavourite      bool                   `json:"is_favourite"`
 	LastUpdatedAt    time.Time              `json:"last_updated_at"`
 	ViewCount        uint                   `json:"view_count"`
 	Etc              map[string]interface{} `json:"etc"`
+	Tags             []TagResp              `json:"tags,omitempty"` // only listed to the owner
 }
 
 // Page Update
@@ -106,12 +133,13 @@ type PageUpdateRequest struct {
 }
 
 type PageUpdateObject struct {
-	PageUUID       string `json:"page_uuid"`
-	PageName       string `json:"page_name"`
-	IsRoot         *bool  `json:"is_root"`
-	ParentPageUUID string `json:"parent_page_uuid,omitempty"`
-	PublicPage     *bool  `json:"public_page"`
-	IsFavourite    *bool  `json:"is_favourite,omitempty"`
+	PageUUID       string  `json:"page_uuid"`
+	PageName       string  `json:"page_name"`
+	IsRoot         *bool   `json:"is_root"`
+	ParentPageUUID string  `json:"parent_page_uuid,omitempty"`
+	PublicPage     *bool   `json:"public_page"`
+	IsFavourite    *bool   `json:"is_favourite,omitempty"`
+	Slug           *string `json:"slug,omitempty"` // empty to remove the slug
 }
 
 type ElementsUpdateObject struct {
@@ -122,12 +150,21 @@ type ElementsUpdateObject struct {
 	Size        string       `json:"size,omitempty"`
 }
 
-type PageUpdateResp struct{}
+type PageUpdateResp struct {
+	// Backlinks warns about the pages linking to a moved page, e.g. a Nested Page element in its previous parent
+	Backlinks []BacklinkResp `json:"backlinks,omitempty"`
+}
 
 // Page Delete
 
 type PageDeleteReq struct {
 	PageUUID string `json:"page_uuid"`
+	// Pages with inbound links from other pages are only deleted with Force or RedirectLinksTo
+	Force bool `json:"force,omitempty"`
+	// RedirectLinksTo rewrites the links to the deleted pages in the user's other pages to link to this page
+	RedirectLinksTo string `json:"redirect_links_to,omitempty"`
 }
 
-type PageDeleteResp struct{}
+type PageDeleteResp struct {
+	RedirectedPageUUIDs []string `json:"redirected_page_uuids,omitempty"` // pages whose links were rewritten
+}
@@ -0,0 +1,26 @@
+package api
+
+// Holds all plan related api request and response structs
+
+// Plan Usage
+
+type PlanUsageResp struct {
+	Status string          `json:"status"`
+	Limits []PlanLimitResp `json:"limits"`
+}
+
+type PlanLimitResp struct {
+	Limit string `json:"limit"`
+	Used  int64  `json:"used"`
+	Max   int64  `json:"max"` // -1 if unlimited
+}
+
+// Plan Limit Exceeded
+
+type PlanLimitErrorResp struct {
+	Error   string `json:"error"`
+	Limit   string `json:"limit"`
+	Max     int64  `json:"max"`
+	Current int64  `json:"current"`
+	Status  string `json:"status"`
+}
@@ -0,0 +1,48 @@
+package api
+
+import "time"
+
+// Holds all publishing related api request and response structs
+
+type PublishScheduleResp struct {
+	ID              uint       `json:"id"`
+	Public          bool       `json:"public"`
+	IncludeSubPages bool       `json:"include_sub_pages"`
+	RunAt           time.Time  `json:"run_at"`
+	Status          string     `json:"status"` // pending, done, failed or cancelled
+	Attempts        int        `json:"attempts"`
+	NextAttemptAt   *time.Time `json:"next_attempt_at"` // set while a failed execution is retried
+	ExecutedAt      *time.Time `json:"executed_at"`
+	PagesChanged    int        `json:"pages_changed"`
+	Error           string     `json:"error,omitempty"`
+	CreatedAt       time.Time  `json:"created_at"`
+}
+
+// Page Schedule
+
+type PageScheduleRequest struct {
+	PageUUID        string    `json:"page_uuid" binding:"required"`
+	Public          bool      `json:"public"`
+	IncludeSubPages bool      `json:"include_sub_pages"`
+	RunAt           time.Time `json:"run_at" binding:"required"`
+}
+
+type PageScheduleResp struct {
+	Schedule PublishScheduleResp `json:"schedule"`
+}
+
+// Page Schedule Cancel
+
+type PageScheduleCancelRequest struct {
+	ScheduleID uint `json:"schedule_id" binding:"required"`
+}
+
+type PageScheduleCancelResp struct {
+	Schedule PublishScheduleResp `json:"schedule"`
+}
+
+// Page Schedule List
+
+type PageScheduleListResp struct {
+	Schedules []PublishScheduleResp `json:"schedules"`
+}
@@ -0,0 +1,57 @@
+package api
+
+// Holds all search related api request and response structs
+
+// Page Search
+
+type PageSearchRequest struct {
+	Query          string  `form:"q" binding:"required"`
+	Public         *bool   `form:"public"`
+	Favourite      *bool   `form:"favourite"`
+	ParentPageUUID *string `form:"parent_page_uuid"`
+	TagIDs         []uint  `form:"tag_id"`    // only search pages with these tags
+	TagMatch       string  `form:"tag_match"` // "all" (default) or "any" of the tags
+	Limit          int     `form:"limit"`     // defaults to 20, at most 100
+	Offset         int     `form:"offset"`    // defaults to 0
+}
+
+type PageSearchResp struct {
+	Results []PageSearchResult `json:"results"`
+}
+
+type PageSearchResult struct {
+	PageUUID       string            `json:"page_uuid"`
+	PageName       string            `json:"page_name"`
+	ParentPageUUID string            `json:"parent_page_uuid,omitempty"`
+	PublicPage     bool              `json:"public_page"`
+	IsFavourite    bool              `json:"is_favourite"`
+	Rank           float64           `json:"rank"`
+	Matches        []PageSearchMatch `json:"matches"` // empty if only the page name matches
+}
+
+type PageSearchMatch struct {
+	ElementUUID string `json:"element_uuid"`
+	Type        string `json:"type"`
+	Snippet     string `json:"snippet"` // HTML escaped, matches are wrapped in <mark> tags
+}
+
+// Public Page Search
+
+type PublicPageSearchRequest struct {
+	Root   string `form:"root" binding:"required"` // page_uuid or slug of the public page to search under
+	Query  string `form:"q" binding:"required"`
+	Limit  int    `form:"limit"`  // defaults to 20, at most 100
+	Offset int    `form:"offset"` // defaults to 0
+}
+
+type PublicPageSearchResp struct {
+	Results []PublicPageSearchResult `json:"results"`
+}
+
+type PublicPageSearchResult struct {
+	PageUUID       string            `json:"page_uuid"`
+	PageName       string            `json:"page_name"`
+	ParentPageUUID string            `json:"parent_page_uuid,omitempty"` // empty for the root page
+	Rank           float64           `json:"rank"`
+	Matches        []PageSearchMatch `json:"matches"`
+}
@@ -0,0 +1,34 @@
+package api
+
+// Holds all page sharing related api request and response structs
+
+// Page Share
+
+type PageShareRequest struct {
+	PageUUID string `json:"page_uuid"`
+	Email    string `json:"email"`
+}
+
+type PageShareResp struct{}
+
+// Page Unshare
+
+type PageUnshareRequest struct {
+	PageUUID string `json:"page_uuid"`
+	Email    string `json:"email"`
+}
+
+type PageUnshareResp struct{}
+
+// Page Share List
+
+type PageShareListResp struct {
+	Users []SharedUserResp `json:"users"`
+}
+
+type SharedUserResp struct {
+	ID      uint   `json:"id"`
+	Email   string `json:"email"`
+	Name    string `json:"name"`
+	Picture string `json:"picture"`
+}
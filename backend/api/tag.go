@@ -0,0 +1,60 @@
+package api
+
+// Holds all tag related api request and response structs
+
+type TagResp struct {
+	ID    uint   `json:"id"`
+	Name  string `json:"name"`
+	Color string `json:"color"`
+}
+
+// Tag Create
+
+type TagCreateRequest struct {
+	Name  string `json:"name" binding:"required"`
+	Color string `json:"color"` // hex color, defaults to grey
+}
+
+type TagCreateResp struct {
+	Tag TagResp `json:"tag"`
+}
+
+// Tag Update
+
+type TagUpdateRequest struct {
+	TagID uint   `json:"tag_id" binding:"required"`
+	Name  string `json:"name,omitempty"`
+	Color string `json:"color,omitempty"`
+}
+
+type TagUpdateResp struct {
+	Tag TagResp `json:"tag"`
+}
+
+// Tag Delete
+
+type TagDeleteRequest struct {
+	TagID uint `json:"tag_id" binding:"required"`
+}
+
+type TagDeleteResp struct{}
+
+// Tag List
+
+type TagListResp struct {
+	Tags []TagCountResp `json:"tags"`
+}
+
+type TagCountResp struct {
+	TagResp
+	PageCount int64 `json:"page_count"`
+}
+
+// Page Tag / Page Untag
+
+type PageTagRequest struct {
+	PageUUIDs []string `json:"page_uuids" binding:"required,min=1,max=100"`
+	TagIDs    []uint   `json:"tag_ids" binding:"required,min=1,max=20"`
+}
+
+type PageTagResp struct{}
@@ -1,5 +1,7 @@
 package api
 
+import "time"
+
 // Holds all user related api request and response structs
 
 // User Login
@@ -24,9 +26,36 @@ type UserGetResp struct {
 	Name     string `json:"name"`
 	Picture  string `json:"picture"`
 	Status   string `json:"status"`
+	// Set while the account is scheduled for deletion
+	DeletionScheduledFor *time.Time `json:"deletion_scheduled_for,omitempty"`
 	// Add other user data as needed
 }
 
 // User Logout
 
 type UserLogoutResp struct{}
+
+// User Export
+// The export is a zip archive holding profile.json and one pages/<page_uuid>.json per page.
+
+type UserExportProfile struct {
+	ID        uint      `json:"id"`
+	Email     string    `json:"email"`
+	Name      string    `json:"name"`
+	Picture   string    `json:"picture"`
+	Status    string    `json:"status"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type UserExportPage struct {
+	Page     PageRespOwner            `json:"page"`
+	Elements []ElementsResponseObject `json:"elements"`
+}
+
+// User Delete
+
+type UserDeleteResp struct {
+	ScheduledFor time.Time `json:"scheduled_for"`
+}
+
+type UserDeleteCancelResp struct{}
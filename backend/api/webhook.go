@@ -0,0 +1,94 @@
+package api
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Holds all webhook related api request and response structs
+
+type WebhookResp struct {
+	ID        uint      `json:"id"`
+	URL       string    `json:"url"`
+	Events    []string  `json:"events"`
+	Active    bool      `json:"active"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type WebhookDeliveryResp struct {
+	ID             uint            `json:"id"`
+	EventID        string          `json:"event_id"`
+	Event          string          `json:"event"`
+	Payload        json.RawMessage `json:"payload"`
+	Status         string          `json:"status"` // pending, succeeded or failed
+	Attempts       int             `json:"attempts"`
+	NextAttemptAt  *time.Time      `json:"next_attempt_at"`
+	ResponseStatus int             `json:"response_status,omitempty"`
+	ResponseBody   string          `json:"response_body,omitempty"`
+	Error          string          `json:"error,omitempty"`
+	CreatedAt      time.Time       `json:"created_at"`
+	DeliveredAt    *time.Time      `json:"delivered_at"`
+}
+
+// Webhook Create
+
+type WebhookCreateRequest struct {
+	URL    string   `json:"url" binding:"required"`
+	Events []string `json:"events" binding:"required"`
+}
+
+type WebhookCreateResp struct {
+	Webhook WebhookResp `json:"webhook"`
+	Secret  string      `json:"secret"` // only returned on creation
+}
+
+// Webhook Update
+
+type WebhookUpdateRequest struct {
+	WebhookID uint     `json:"webhook_id" binding:"required"`
+	URL       *string  `json:"url,omitempty"`
+	Events    []string `json:"events,omitempty"`
+	Active    *bool    `json:"active,omitempty"`
+}
+
+type WebhookUpdateResp struct {
+	Webhook WebhookResp `json:"webhook"`
+}
+
+// Webhook Delete
+
+type WebhookDeleteRequest struct {
+	WebhookID uint `json:"webhook_id" binding:"required"`
+}
+
+type WebhookDeleteResp struct{}
+
+// Webhook List
+
+type WebhookListResp struct {
+	Webhooks []WebhookResp `json:"webhooks"`
+	Events   []string      `json:"events"` // every event webhooks may subscribe to
+}
+
+// Webhook Deliveries
+
+type WebhookDeliveriesRequest struct {
+	Limit  int `form:"limit"`
+	Offset int `form:"offset"`
+}
+
+type WebhookDeliveriesResp struct {
+	Deliveries []WebhookDeliveryResp `json:"deliveries"`
+	Total      int64                 `json:"total"`
+}
+
+// Webhook Redeliver
+
+type WebhookRedeliverRequest struct {
+	DeliveryID uint `json:"delivery_id" binding:"required"`
+}
+
+type WebhookRedeliverResp struct {
+	Delivery WebhookDeliveryResp `json:"delivery"`
+}
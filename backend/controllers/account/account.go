@@ -0,0 +1,377 @@
+package account
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/jackc/pgtype"
+	"github.com/opalescencelabs/backend/api"
+	"github.com/opalescencelabs/backend/api/caching"
+	"github.com/opalescencelabs/backend/controllers/audit"
+	"github.com/opalescencelabs/backend/controllers/auth"
+	"github.com/opalescencelabs/backend/controllers/views"
+	"github.com/opalescencelabs/backend/models"
+	"gorm.io/gorm"
+)
+
+// GracePeriod is how long after a deletion request the account is actually deleted.
+// The user may cancel the deletion until then.
+const GracePeriod = 14 * 24 * time.Hour
+
+var (
+	// ErrDeletionPending is returned when a deletion is requested for an account already scheduled for deletion.
+	ErrDeletionPending = errors.New("account deletion already pending")
+	// ErrNoPendingDeletion is returned when cancelling the deletion of an account not scheduled for deletion.
+	ErrNoPendingDeletion = errors.New("no pending account deletion")
+)
+
+// PendingDeletion returns the user's pending deletion, if any.
+func PendingDeletion(db *gorm.DB, userID uint) (models.AccountDeletion, bool) {
+	var deletion models.AccountDeletion
+	if err := db.Where("user_id = ? AND status = ?", userID, "pending").First(&deletion).Error; err != nil {
+		return deletion, false
+	}
+	return deletion, true
+}
+
+// RequestDeletion schedules the user's account for deletion after the GracePeriod.
+// Returns ErrDeletionPending if the account is already scheduled for deletion.
+func RequestDeletion(db *gorm.DB, userID uint) (models.AccountDeletion, error) {
+	if deletion, ok := PendingDeletion(db, userID); ok {
+		return deletion, ErrDeletionPending
+	}
+
+	deletion := models.AccountDeletion{
+		UserID:       userID,
+		Status:       "pending",
+		ScheduledFor: time.Now().Add(GracePeriod),
+	}
+	if err := db.Omit("id", "completed_at").Create(&deletion).Error; err != nil {
+		return deletion, err
+	}
+	return deletion, nil
+}
+
+// CancelDeletion cancels the user's pending account deletion.
+// Returns ErrNoPendingDeletion if the account is not scheduled for deletion.
+func CancelDeletion(db *gorm.DB, userID uint) error {
+	result := db.Model(&models.AccountDeletion{}).
+		Where("user_id = ? AND status = ?", userID, "pending").
+		Update("status", "cancelled")
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNoPendingDeletion
+	}
+	return nil
+}
+
+// Export writes a zip archive of the user's profile, pages and elements to w.
+func Export(db *gorm.DB, user models.User, w io.Writer) error {
+	archive := zip.NewWriter(w)
+
+	profile := api.UserExportProfile{
+		ID:        user.ID,
+		Email:     user.Email,
+		Name:      user.Name,
+		Picture:   user.Picture,
+		Status:    user.Status,
+		CreatedAt: user.CreatedAt,
+	}
+	if err := writeJSON(archive, "profile.json", profile); err != nil {
+		return err
+	}
+
+	var pages []models.Page
+	if err := db.Where("user_id = ?", user.ID).Order("id").Find(&pages).Error; err != nil {
+		return err
+	}
+	for _, page := range pages {
+		var elements []models.Element
+		if err := db.Where("page_id = ?", page.ID).Order("id").Find(&elements).Error; err != nil {
+			return err
+		}
+
+		dateViewCount, err := views.DailyCounts(db, page.ID)
+		if err != nil {
+			return err
+		}
+
+		exportPage, err := toExportPage(page, elements, dateViewCount)
+		if err != nil {
+			return err
+		}
+		if err := writeJSON(archive, "pages/"+page.PageUUID+".json", exportPage); err != nil {
+			return err
+		}
+	}
+
+	return archive.Close()
+}
+
+// writeJSON adds a file holding the indented JSON encoding of v to the archive.
+func writeJSON(archive *zip.Writer, name string, v interface{}) error {
+	file, err := archive.Create(name)
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(file)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
+
+// toExportPage converts a page, its elements and its daily view counts to their exported form.
+func toExportPage(page models.Page, elements []models.Element, dateViewCount map[string]int) (api.UserExportPage, error) {
+	var elementPositions []string
+	var etc map[string]interface{}
+	if err := unmarshalJSONB(page.ElementPositions, &elementPositions); err != nil {
+		return api.UserExportPage{}, err
+	}
+	if err := unmarshalJSONB(page.Etc, &etc); err != nil {
+		return api.UserExportPage{}, err
+	}
+
+	var slug string
+	if page.Slug != nil {
+		slug = *page.Slug
+	}
+	exportPage := api.UserExportPage{
+		Page: api.PageRespOwner{
+			ID:                page.ID,
+			CreatedAt:         page.CreatedAt,
+			UpdatedAt:         page.UpdatedAt,
+			PageUUID:          page.PageUUID,
+			PageName:          page.PageName,
+			IsRoot:            page.IsRoot,
+			ElementPositions:  elementPositions,
+			ParentPageUUID:    page.ParentPageUUID,
+			PublicPage:        page.PublicPage,
+			PageUUIDURL:       page.PageUUIDURL,
+			Slug:              slug,
+			IsFavourite:       page.IsFavourite,
+			LastUpdatedAt:     page.LastUpdatedAt,
+			ViewCount:         page.ViewCount,
+			ExcludedViewCount: page.ExcludedViewCount,
+			DateViewCount:     dateViewCount,
+			Etc:               etc,
+		},
+		Elements: make([]api.ElementsResponseObject, 0, len(elements)),
+	}
+
+	for _, element := range elements {
+		var content map[string]interface{}
+		var elementEtc map[string]interface{}
+		if err := unmarshalJSONB(element.Content, &content); err != nil {
+			return api.UserExportPage{}, err
+		}
+		if err := unmarshalJSONB(element.Etc, &elementEtc); err != nil {
+			return api.UserExportPage{}, err
+		}
+		exportPage.Elements = append(exportPage.Elements, api.ElementsResponseObject{
+			ID:          element.ID,
+			ElementUUID: element.ElementUUID,
+			Type:        element.Type,
+			Content:     content,
+			Etc:         elementEtc,
+			Size:        element.Size,
+		})
+	}
+
+	return exportPage, nil
+}
+
+// unmarshalJSONB unmarshals a JSONB value into v if it is present.
+func unmarshalJSONB(value pgtype.JSONB, v interface{}) error {
+	if value.Status != pgtype.Present || len(value.Bytes) == 0 {
+		return nil
+	}
+	return json.Unmarshal(value.Bytes, v)
+}
+
+// DeleteAccount permanently deletes a user's content and anonymises their account.
+// The user's pages, elements, views, shares, tags and links are removed along with the cached pages,
+// and the user row is kept anonymised so residual references (e.g. the audit log) don't point at personal data.
+// Their entries in the audit log are anonymised too, the account deletion itself is recorded afterwards.
+// The user's provider tokens are revoked once the deletion is committed, so a failed deletion leaves the account usable.
+func DeleteAccount(ctx context.Context, db *gorm.DB, user models.User) error {
+	// Anonymising the user clears the credentials
+	credentials := user.Credentials
+
+	var pageUUIDs []string
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.Page{}).Unscoped().Where("user_id = ?", user.ID).Pluck("page_uuid", &pageUUIDs).Error; err != nil {
+			return err
+		}
+
+		// Shares of the user's pages and pages shared with the user
+		if err := tx.Unscoped().
+			Where("user_id = ? OR page_id IN (SELECT id FROM pages WHERE user_id = ?)", user.ID, user.ID).
+			Delete(&models.PageShare{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("page_id IN (SELECT id FROM pages WHERE user_id = ?)", user.ID).Delete(&models.PageView{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("source_page_id IN (SELECT id FROM pages WHERE user_id = ?) OR target_page_uuid IN (SELECT page_uuid FROM pages WHERE user_id = ?)",
+			user.ID, user.ID).Delete(&models.PageLink{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ? OR actor_id = ? OR page_id IN (SELECT id FROM pages WHERE user_id = ?)", user.ID, user.ID, user.ID).
+			Delete(&models.Notification{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", user.ID).Delete(&models.NotificationMute{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", user.ID).Delete(&models.EmailPreference{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ? OR page_id IN (SELECT id FROM pages WHERE user_id = ?)", user.ID, user.ID).Delete(&models.PageFollow{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ? OR page_id IN (SELECT id FROM pages WHERE user_id = ?)", user.ID, user.ID).Delete(&models.PublishSchedule{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("page_id IN (SELECT id FROM pages WHERE user_id = ?)", user.ID).Delete(&models.PageSnapshot{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", user.ID).Delete(&models.CustomDomain{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("webhook_id IN (SELECT id FROM webhooks WHERE user_id = ?)", user.ID).Delete(&models.WebhookDelivery{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", user.ID).Delete(&models.Webhook{}).Error; err != nil {
+			return err
+		}
+		// Comments on the user's pages and the user's comments elsewhere, with the replies to their threads
+		if err := tx.Unscoped().
+			Where("user_id = ? OR page_id IN (SELECT id FROM pages WHERE user_id = ?) OR parent_id IN (SELECT id FROM comments WHERE user_id = ?)",
+				user.ID, user.ID, user.ID).
+			Delete(&models.Comment{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("page_id IN (SELECT id FROM pages WHERE user_id = ?)", user.ID).Delete(&models.PageTag{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Where("user_id = ?", user.ID).Delete(&models.Tag{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Where("user_id = ?", user.ID).Delete(&models.Element{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Where("user_id = ?", user.ID).Delete(&models.Page{}).Error; err != nil {
+			return err
+		}
+
+		// Anonymise the user, unique columns get placeholders derived from the ID
+		if err := tx.Model(&user).Updates(map[string]interface{}{
+			"google_id":           fmt.Sprintf("deleted-%d", user.ID),
+			"email":               fmt.Sprintf("deleted-%d@deleted.invalid", user.ID),
+			"name":                "Deleted user",
+			"picture":             "",
+			"credentials":         []byte("{}"),
+			"billing_customer_id": nil,
+		}).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&user).Error; err != nil {
+			return err
+		}
+		if err := audit.Anonymise(tx, user.ID, pageUUIDs); err != nil {
+			return err
+		}
+
+		if err := tx.Model(&models.AccountDeletion{}).
+			Where("user_id = ? AND status = ?", user.ID, "pending").
+			Updates(map[string]interface{}{"status": "completed", "completed_at": time.Now()}).Error; err != nil {
+			return err
+		}
+
+		return audit.Record(tx, audit.Entry{
+			Action:     audit.ActionAccountDeleted,
+			TargetType: audit.TargetUser,
+			TargetID:   fmt.Sprint(user.ID),
+			Details:    map[string]interface{}{"pages_deleted": len(pageUUIDs)},
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	revokeTokens(user.ID, credentials)
+	caching.InvalidatePages(ctx, pageUUIDs...)
+
+	return nil
+}
+
+// revokeTokens revokes the Google tokens in the credentials of a user.
+// Failures are logged but don't fail the deletion, the tokens may have already expired.
+func revokeTokens(userID uint, credentialsJSON []byte) {
+	var credentials map[string]interface{}
+	if err := json.Unmarshal(credentialsJSON, &credentials); err != nil {
+		fmt.Printf("Failed to unmarshal credentials of user %d: %s\n", userID, err)
+		return
+	}
+
+	// Revoking the refresh token revokes the whole grant, the access token is revoked in case it fails
+	for _, key := range []string{"refresh_token", "access_token"} {
+		token, ok := credentials[key].(string)
+		if !ok || token == "" {
+			continue
+		}
+		if err := auth.RevokeAccessToken(token); err != nil {
+			fmt.Printf("Failed to revoke %s of user %d: %s\n", key, userID, err)
+			continue
+		}
+		return
+	}
+}
+
+// ProcessDueDeletions deletes every account whose grace period has elapsed.
+func ProcessDueDeletions(ctx context.Context, db *gorm.DB) error {
+	var deletions []models.AccountDeletion
+	if err := db.Where("status = ? AND scheduled_for <= ?", "pending", time.Now()).Find(&deletions).Error; err != nil {
+		return err
+	}
+
+	for _, deletion := range deletions {
+		var user models.User
+		if err := db.First(&user, "id = ?", deletion.UserID).Error; err != nil {
+			fmt.Printf("User %d scheduled for deletion not found: %s\n", deletion.UserID, err)
+			continue
+		}
+		if err := DeleteAccount(ctx, db, user); err != nil {
+			fmt.Printf("Failed to delete account of user %d: %s\n", deletion.UserID, err)
+			continue
+		}
+		fmt.Printf("Deleted account of user %d\n", deletion.UserID)
+	}
+
+	return nil
+}
+
+// RunDeletionWorker processes due account deletions every interval until ctx is cancelled.
+// Deletions are stored in the database, so pending deletions survive restarts.
+func RunDeletionWorker(ctx context.Context, db *gorm.DB, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := ProcessDueDeletions(ctx, db); err != nil {
+			fmt.Println("Failed to process account deletions: ", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,283 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/opalescencelabs/backend/api"
+	"github.com/opalescencelabs/backend/api/caching"
+	"github.com/opalescencelabs/backend/controllers/admin"
+	"github.com/opalescencelabs/backend/controllers/audit"
+	"github.com/opalescencelabs/backend/controllers/billing"
+	"github.com/opalescencelabs/backend/controllers/plans"
+	"github.com/opalescencelabs/backend/controllers/publishing"
+	"github.com/opalescencelabs/backend/database"
+	"github.com/opalescencelabs/backend/models"
+	"gorm.io/gorm"
+)
+
+// toAdminUserResp converts a user to the response admins see.
+func toAdminUserResp(user models.User) api.AdminUserResp {
+	return api.AdminUserResp{
+		ID:        user.ID,
+		Email:     user.Email,
+		Name:      user.Name,
+		Picture:   user.Picture,
+		Status:    user.Status,
+		Role:      user.Role,
+		Disabled:  user.Disabled,
+		CreatedAt: user.CreatedAt,
+	}
+}
+
+// AdminUserSearch is the handler for GET /admin/user-search.
+// Searches users by email or name (q), optionally filtered by status, paginated with limit and offset.
+// Returns 200 on success, 401 on unauthorized, 403 on forbidden, 500 on error.
+func AdminUserSearch(c *gin.Context) {
+	query := database.DB.Model(&models.User{})
+	if q := c.Query("q"); q != "" {
+		escaped := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(q)
+		query = query.Where(`email ILIKE ? ESCAPE '\' OR name ILIKE ? ESCAPE '\'`, "%"+escaped+"%", "%"+escaped+"%")
+	}
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || limit < 1 || limit > 200 {
+		limit = 50
+	}
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		offset = 0
+	}
+
+	var total int64
+	var users []models.User
+	if err := query.Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to search users"})
+		return
+	}
+	if err := query.Order("id").Limit(limit).Offset(offset).Find(&users).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to search users"})
+		return
+	}
+
+	entry := audit.FromRequest(c, audit.ActionAdminUserSearch, "", "", map[string]interface{}{"q": c.Query("q"), "status": c.Query("status")})
+	if err := audit.Record(database.DB, entry); err != nil {
+		fmt.Println("Failed to record admin action: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to search users"})
+		return
+	}
+
+	usersResp := make([]api.AdminUserResp, len(users))
+	for i, user := range users {
+		usersResp[i] = toAdminUserResp(user)
+	}
+
+	c.JSON(http.StatusOK, api.AdminUserSearchResp{Users: usersResp, Total: total})
+}
+
+// AdminUserPages is the handler for GET /admin/user-pages/:user_id.
+// Returns a user and the pages they own.
+// Returns 200 on success, 400 on bad request, 401 on unauthorized, 403 on forbidden, 404 on not found, 500 on error.
+func AdminUserPages(c *gin.Context) {
+	var user models.User
+	if err := database.DB.First(&user, "id = ?", c.Param("user_id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	var pages []models.Page
+	if err := database.DB.Where("user_id = ?", user.ID).Order("last_updated_at DESC").Find(&pages).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch pages"})
+		return
+	}
+
+	if err := audit.Record(database.DB, audit.FromRequest(c, audit.ActionAdminUserPages, audit.TargetUser, fmt.Sprint(user.ID), nil)); err != nil {
+		fmt.Println("Failed to record admin action: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch pages"})
+		return
+	}
+
+	pageResps := make([]api.PageResp, len(pages))
+	for i, page := range pages {
+		pageResp, err := toPageResp(page)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process page data", "details": err.Error()})
+			return
+		}
+		pageResps[i] = pageResp
+	}
+
+	c.JSON(http.StatusOK, api.AdminUserPagesResp{User: toAdminUserResp(user), Pages: pageResps})
+}
+
+// AdminUserStatus is the handler for POST /admin/user-status.
+// Changes a user's plan. Public pages over the limits of a lower plan are made private.
+// Returns 200 on success, 400 on bad request, 401 on unauthorized, 403 on forbidden, 404 on not found, 500 on error.
+func AdminUserStatus(c *gin.Context) {
+	var request api.AdminUserStatusRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "details": err.Error()})
+		return
+	}
+	if !slices.Contains(plans.Tiers, request.Status) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid status"})
+		return
+	}
+
+	var user models.User
+	if err := database.DB.First(&user, "id = ?", request.UserID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	var unpublished []string
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		previousStatus := user.Status
+		if err := tx.Model(&user).Update("status", request.Status).Error; err != nil {
+			return err
+		}
+		user.Status = request.Status
+
+		var err error
+		if unpublished, err = billing.Downgrade(tx, user); err != nil {
+			return err
+		}
+
+		return audit.Record(tx, audit.FromRequest(c, audit.ActionAdminUserStatus, audit.TargetUser, fmt.Sprint(user.ID),
+			map[string]interface{}{"previous_status": previousStatus, "new_status": request.Status, "unpublished_pages": unpublished}))
+	})
+	if err != nil {
+		fmt.Println("Failed to change user status: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to change user status"})
+		return
+	}
+
+	invalidatePagesAndParents(c, unpublished)
+
+	c.JSON(http.StatusOK, api.AdminUserStatusResp{})
+}
+
+// AdminUserDisable is the handler for POST /admin/user-disable.
+// Disables or re-enables a user's account. Disabled users can't log in or use authenticated routes.
+// Returns 200 on success, 400 on bad request, 401 on unauthorized, 403 on forbidden, 404 on not found, 500 on error.
+func AdminUserDisable(c *gin.Context) {
+	var request api.AdminUserDisableRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "details": err.Error()})
+		return
+	}
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.User{}).Where("id = ?", request.UserID).Update("disabled", request.Disabled)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+
+		return audit.Record(tx, audit.FromRequest(c, audit.ActionAdminUserDisable, audit.TargetUser, fmt.Sprint(request.UserID),
+			map[string]interface{}{"disabled": request.Disabled}))
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	if err != nil {
+		fmt.Println("Failed to disable user: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to disable user"})
+		return
+	}
+
+	c.JSON(http.StatusOK, api.AdminUserDisableResp{})
+}
+
+// AdminPageUnpublish is the handler for POST /admin/page-unpublish.
+// Makes any user's public page private, e.g. for abusive content.
+// Returns 200 on success, 400 on bad request, 401 on unauthorized, 403 on forbidden, 404 on not found, 500 on error.
+func AdminPageUnpublish(c *gin.Context) {
+	var request api.AdminPageUnpublishRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "details": err.Error()})
+		return
+	}
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var page models.Page
+		if err := tx.Where("page_uuid = ?", request.PageUUID).First(&page).Error; err != nil {
+			return err
+		}
+		// Unpublished as the owner would, the owner's webhooks are told the page is no longer public
+		entry := audit.FromRequest(c, audit.ActionPageUnpublished, audit.TargetPage, page.PageUUID, map[string]interface{}{"reason": request.Reason})
+		if _, err := publishing.Unpublish(tx, []models.Page{page}, entry, "page unpublished by an admin"); err != nil {
+			return err
+		}
+
+		return audit.Record(tx, audit.FromRequest(c, audit.ActionAdminPageUnpublish, audit.TargetPage, request.PageUUID,
+			map[string]interface{}{"reason": request.Reason}))
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Page not found"})
+		return
+	}
+	if err != nil {
+		fmt.Println("Failed to unpublish page: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unpublish page"})
+		return
+	}
+
+	invalidatePagesAndParents(c, []string{request.PageUUID})
+
+	c.JSON(http.StatusOK, api.AdminPageUnpublishResp{})
+}
+
+// AdminPageTransfer is the handler for POST /admin/page-transfer.
+// Transfers a page and its sub-pages to another user.
+// Returns 200 on success, 400 on bad request, 401 on unauthorized, 403 on forbidden, 404 on not found, 500 on error.
+func AdminPageTransfer(c *gin.Context) {
+	var request api.AdminPageTransferRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "details": err.Error()})
+		return
+	}
+
+	var newOwner models.User
+	if err := database.DB.First(&newOwner, "id = ?", request.UserID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	var page models.Page
+	if err := database.DB.Where("page_uuid = ?", request.PageUUID).First(&page).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Page not found"})
+		return
+	}
+
+	var pageUUIDs []string
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if pageUUIDs, err = admin.TransferPage(tx, request.PageUUID, newOwner.ID); err != nil {
+			return err
+		}
+
+		return audit.Record(tx, audit.FromRequest(c, audit.ActionAdminPageTransfer, audit.TargetPage, request.PageUUID,
+			map[string]interface{}{"previous_owner_id": page.UserID, "new_owner_id": newOwner.ID, "page_uuids": pageUUIDs}))
+	})
+	if err != nil {
+		fmt.Println("Failed to transfer page: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to transfer page"})
+		return
+	}
+
+	// The cached pages hold the previous owner's view, and the previous parent lists the page as a sub-page
+	caching.InvalidatePages(c, append(pageUUIDs, page.ParentPageUUID)...)
+
+	c.JSON(http.StatusOK, api.AdminPageTransferResp{PageUUIDs: pageUUIDs})
+}
@@ -0,0 +1,128 @@
+package admin
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/opalescencelabs/backend/controllers/audit"
+	"github.com/opalescencelabs/backend/controllers/auth"
+	"github.com/opalescencelabs/backend/controllers/domains"
+	"github.com/opalescencelabs/backend/controllers/publishing"
+	"github.com/opalescencelabs/backend/database"
+	"github.com/opalescencelabs/backend/models"
+	"gorm.io/gorm"
+)
+
+// ImpersonateHeader is the header an admin sets to the ID of the user they want to impersonate.
+const ImpersonateHeader = "X-Impersonate-User"
+
+// impersonationDenied holds the routes that may not be impersonated even though they are read-only,
+// e.g. the export of the user's full data.
+var impersonationDenied = []string{"/user-export"}
+
+// ImpersonationMiddleware lets admins view the app as another user, for support.
+// Must be registered after AuthenticateMiddleware or OptionalAuthenticateMiddleware.
+// Impersonation is read-only, so only GET and HEAD requests may be impersonated, except the impersonationDenied routes.
+// Every impersonated request is recorded in the audit log.
+func ImpersonationMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		targetID := c.GetHeader(ImpersonateHeader)
+		if targetID == "" {
+			c.Next()
+			return
+		}
+
+		admin, ok := auth.CurrentUser(c)
+		if !ok || admin.Role != "admin" {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Forbidden"})
+			return
+		}
+		if c.Request.Method != http.MethodGet && c.Request.Method != http.MethodHead {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Impersonation is read-only"})
+			return
+		}
+		if slices.Contains(impersonationDenied, c.FullPath()) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Route can't be impersonated"})
+			return
+		}
+
+		id, err := strconv.ParseUint(targetID, 10, 64)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid " + ImpersonateHeader + " header"})
+			return
+		}
+		var target models.User
+		if err := database.DB.First(&target, "id = ?", id).Error; err != nil {
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+
+		entry := audit.FromRequest(c, audit.ActionAdminImpersonate, audit.TargetUser, targetID,
+			map[string]interface{}{"method": c.Request.Method, "path": c.Request.URL.Path})
+		if err := audit.Record(database.DB, entry); err != nil {
+			fmt.Println("Failed to record impersonation: ", err)
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to impersonate user"})
+			return
+		}
+
+		auth.Impersonate(c, admin, target)
+		c.Next()
+	}
+}
+
+// TransferPage makes newOwnerID the owner of a page, its sub-pages and their elements.
+// The page is detached from its parent, which stays with the previous owner,
+// and shares with the new owner become redundant and are removed, as are the previous owner's tags and schedules.
+// Returns the UUIDs of the transferred pages.
+func TransferPage(tx *gorm.DB, pageUUID string, newOwnerID uint) ([]string, error) {
+	var pageUUIDs []string
+	if err := tx.Raw(`
+		WITH RECURSIVE subtree AS (
+			SELECT page_uuid FROM pages WHERE page_uuid = ? AND deleted_at IS NULL
+			UNION
+			SELECT p.page_uuid FROM pages p
+			JOIN subtree s ON p.parent_page_uuid = s.page_uuid
+			WHERE p.deleted_at IS NULL
+		)
+		SELECT page_uuid FROM subtree`, pageUUID).Scan(&pageUUIDs).Error; err != nil {
+		return nil, err
+	}
+	if len(pageUUIDs) == 0 {
+		return nil, gorm.ErrRecordNotFound
+	}
+
+	if err := tx.Model(&models.Page{}).Where("page_uuid IN ?", pageUUIDs).Update("user_id", newOwnerID).Error; err != nil {
+		return nil, err
+	}
+	if err := tx.Model(&models.Page{}).Where("page_uuid = ?", pageUUID).
+		Updates(map[string]interface{}{"is_root": true, "parent_page_uuid": nil}).Error; err != nil {
+		return nil, err
+	}
+	if err := tx.Model(&models.Element{}).
+		Where("page_id IN (SELECT id FROM pages WHERE page_uuid IN ?)", pageUUIDs).
+		Update("user_id", newOwnerID).Error; err != nil {
+		return nil, err
+	}
+	if err := tx.Unscoped().
+		Where("user_id = ? AND page_id IN (SELECT id FROM pages WHERE page_uuid IN ?)", newOwnerID, pageUUIDs).
+		Delete(&models.PageShare{}).Error; err != nil {
+		return nil, err
+	}
+	// Tags belong to the previous owner
+	if err := tx.Where("page_id IN (SELECT id FROM pages WHERE page_uuid IN ?)", pageUUIDs).Delete(&models.PageTag{}).Error; err != nil {
+		return nil, err
+	}
+	// So are the changes of visibility they scheduled
+	if err := publishing.CancelPages(tx, pageUUIDs, "page transferred"); err != nil {
+		return nil, err
+	}
+	// And the custom domains they attached, whose ownership the new owner hasn't proved
+	if err := domains.DeletePages(tx, pageUUIDs); err != nil {
+		return nil, err
+	}
+
+	return pageUUIDs, nil
+}
@@ -0,0 +1,320 @@
+package controllers
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/opalescencelabs/backend/api"
+	"github.com/opalescencelabs/backend/controllers/auth"
+	"github.com/opalescencelabs/backend/controllers/views"
+	"github.com/opalescencelabs/backend/database"
+	"github.com/opalescencelabs/backend/models"
+)
+
+// defaultAnalyticsRange is the range of analytics queries without a start.
+const defaultAnalyticsRange = 30 * 24 * time.Hour
+
+// parseAnalyticsTime parses an analytics range bound, either RFC 3339 or a date (midnight UTC).
+// Returns fallback if value is empty.
+func parseAnalyticsTime(value string, fallback time.Time) (time.Time, error) {
+	if value == "" {
+		return fallback, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t.UTC(), nil
+	}
+	return time.Parse("2006-01-02", value)
+}
+
+// parseAnalyticsRange parses the range of an analytics request, defaulting to the last 30 days.
+func parseAnalyticsRange(fromValue string, toValue string) (time.Time, time.Time, error) {
+	to, err := parseAnalyticsTime(toValue, time.Now().UTC())
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("invalid to: %w", err)
+	}
+	from, err := parseAnalyticsTime(fromValue, to.Add(-defaultAnalyticsRange))
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("invalid from: %w", err)
+	}
+	return from, to, nil
+}
+
+// toAnalyticsBreakdownResp converts a breakdown of views to its response.
+func toAnalyticsBreakdownResp(breakdowns []views.Breakdown) []api.AnalyticsBreakdownResp {
+	resp := make([]api.AnalyticsBreakdownResp, len(breakdowns))
+	for i, breakdown := range breakdowns {
+		resp[i] = api.AnalyticsBreakdownResp{Value: breakdown.Value, Views: breakdown.Views, UniqueVisitors: breakdown.UniqueVisitors}
+	}
+	return resp
+}
+
+// PageAnalytics is the handler for GET /page-analytics/:page_uuid.
+// Returns the views and unique visitors of a page owned by the current user over a range,
+// as a series of the requested granularity with the top referrers, devices and countries.
+// Views excluded from the view count (bots, the owner, collaborators, repeat visitors) are reported separately.
+// Returns 200 on success, 400 on bad request, 401 on unauthorized, 403 on forbidden, 404 on not found, 500 on error.
+func PageAnalytics(c *gin.Context) {
+	var request api.PageAnalyticsRequest
+	if err := c.ShouldBindQuery(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "details": err.Error()})
+		return
+	}
+	from, to, err := parseAnalyticsRange(request.From, request.To)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "details": err.Error()})
+		return
+	}
+	granularity := request.Granularity
+	if granularity == "" {
+		granularity = views.GranularityDay
+	}
+
+	page, _, err := auth.AuthorizePage(c, c.Param("page_uuid"), auth.AccessOwner)
+	if err != nil {
+		respondAccessError(c, err)
+		return
+	}
+
+	analytics, err := views.Query(database.DB, []uint{page.ID}, from, to, granularity)
+	if errors.Is(err, views.ErrInvalidRange) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid range", "details": err.Error()})
+		return
+	}
+	if err != nil {
+		fmt.Println("Failed to query page analytics: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to query page analytics"})
+		return
+	}
+
+	series := make([]api.AnalyticsPointResp, len(analytics.Series))
+	for i, point := range analytics.Series {
+		series[i] = api.AnalyticsPointResp{
+			Start:          point.Start,
+			Views:          point.Views,
+			UniqueVisitors: point.UniqueVisitors,
+			ExcludedViews:  point.ExcludedViews,
+		}
+	}
+
+	c.JSON(http.StatusOK, api.PageAnalyticsResp{
+		PageUUID:       page.PageUUID,
+		From:           analytics.From,
+		To:             analytics.To,
+		Granularity:    analytics.Granularity,
+		Views:          analytics.Views,
+		UniqueVisitors: analytics.UniqueVisitors,
+		ExcludedViews:  analytics.ExcludedViews,
+		Series:         series,
+		TopReferrers:   toAnalyticsBreakdownResp(analytics.TopReferrers),
+		Devices:        toAnalyticsBreakdownResp(analytics.Devices),
+		Countries:      toAnalyticsBreakdownResp(analytics.Countries),
+		Excluded:       toAnalyticsBreakdownResp(analytics.Excluded),
+	})
+}
+
+// PageAnalyticsExport is the handler for GET /page-analytics-export.
+// Streams the daily views of a page owned by the current user, or of all their public pages if no page is given,
+// as CSV or JSON with one row per page and day with views.
+// Returns 200 on success, 400 on bad request, 401 on unauthorized, 403 on forbidden, 404 on not found, 500 on error.
+func PageAnalyticsExport(c *gin.Context) {
+	var request api.PageAnalyticsExportRequest
+	if err := c.ShouldBindQuery(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "details": err.Error()})
+		return
+	}
+	from, to, err := parseAnalyticsRange(request.From, request.To)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "details": err.Error()})
+		return
+	}
+	if _, err := views.Buckets(from, to, views.GranularityDay); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid range", "details": err.Error()})
+		return
+	}
+	if request.Format == "" {
+		request.Format = "csv"
+	}
+	if request.Format != "csv" && request.Format != "json" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid format, must be csv or json"})
+		return
+	}
+
+	var pageIDs []uint
+	if request.PageUUID != "" {
+		page, _, err := auth.AuthorizePage(c, request.PageUUID, auth.AccessOwner)
+		if err != nil {
+			respondAccessError(c, err)
+			return
+		}
+		pageIDs = []uint{page.ID}
+	} else if err := database.DB.Model(&models.Page{}).
+		Where("user_id = ? AND public_page = ?", auth.MustCurrentUserID(c), true).
+		Pluck("id", &pageIDs).Error; err != nil {
+		fmt.Println("Failed to list public pages: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export analytics"})
+		return
+	}
+
+	filename := fmt.Sprintf("analytics-%s-%s.%s", from.Format("2006-01-02"), to.Format("2006-01-02"), request.Format)
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	c.Status(http.StatusOK)
+
+	if request.Format == "csv" {
+		err = writeAnalyticsCSV(c, pageIDs, from, to)
+	} else {
+		err = writeAnalyticsJSON(c, pageIDs, from, to)
+	}
+	if err != nil {
+		// Headers are already sent, the client receives a truncated export
+		fmt.Println("Failed to export analytics: ", err)
+	}
+}
+
+// writeAnalyticsCSV streams the daily views of the pages as CSV, referrers as "host=views" separated by ";".
+func writeAnalyticsCSV(c *gin.Context, pageIDs []uint, from time.Time, to time.Time) error {
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	writer := csv.NewWriter(c.Writer)
+	if err := writer.Write([]string{"date", "page_uuid", "page_name", "views", "unique_visitors", "excluded_views", "referrers"}); err != nil {
+		return err
+	}
+
+	err := views.ExportDaily(database.DB, pageIDs, from, to, func(row views.DailyRow) error {
+		referrers := make([]string, len(row.Referrers))
+		for i, referrer := range row.Referrers {
+			referrers[i] = referrer.Value + "=" + strconv.FormatInt(referrer.Views, 10)
+		}
+		return writer.Write([]string{
+			row.Day.Format("2006-01-02"),
+			row.PageUUID,
+			row.PageName,
+			strconv.FormatInt(row.Views, 10),
+			strconv.FormatInt(row.UniqueVisitors, 10),
+			strconv.FormatInt(row.ExcludedViews, 10),
+			strings.Join(referrers, ";"),
+		})
+	})
+	writer.Flush()
+	if err != nil {
+		return err
+	}
+	return writer.Error()
+}
+
+// writeAnalyticsJSON streams the daily views of the pages as a JSON array.
+func writeAnalyticsJSON(c *gin.Context, pageIDs []uint, from time.Time, to time.Time) error {
+	c.Header("Content-Type", "application/json; charset=utf-8")
+	if _, err := c.Writer.WriteString("["); err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(c.Writer)
+	first := true
+	err := views.ExportDaily(database.DB, pageIDs, from, to, func(row views.DailyRow) error {
+		if !first {
+			if _, err := c.Writer.WriteString(","); err != nil {
+				return err
+			}
+		}
+		first = false
+
+		referrers := make([]api.AnalyticsReferrerResp, len(row.Referrers))
+		for i, referrer := range row.Referrers {
+			referrers[i] = api.AnalyticsReferrerResp{Referrer: referrer.Value, Views: referrer.Views}
+		}
+		return encoder.Encode(api.AnalyticsExportRow{
+			Date:           row.Day.Format("2006-01-02"),
+			PageUUID:       row.PageUUID,
+			PageName:       row.PageName,
+			Views:          row.Views,
+			UniqueVisitors: row.UniqueVisitors,
+			ExcludedViews:  row.ExcludedViews,
+			Referrers:      referrers,
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = c.Writer.WriteString("]")
+	return err
+}
+
+// weekChange returns the week over week change of views, nil if there were no views last week.
+func weekChange(thisWeek int64, lastWeek int64) *float64 {
+	change, ok := views.WeekOverWeek(thisWeek, lastWeek)
+	if !ok {
+		return nil
+	}
+	return &change
+}
+
+// toAnalyticsPageStatsResp converts the stats of pages to their response.
+func toAnalyticsPageStatsResp(pages []views.PageStats) []api.AnalyticsPageStatsResp {
+	resp := make([]api.AnalyticsPageStatsResp, len(pages))
+	for i, stats := range pages {
+		resp[i] = api.AnalyticsPageStatsResp{
+			PageUUID:    stats.PageUUID,
+			PageName:    stats.PageName,
+			ViewCount:   stats.ViewCount,
+			PeriodViews: stats.PeriodViews,
+			Sparkline:   stats.Sparkline,
+			ThisWeek:    stats.ThisWeek,
+			LastWeek:    stats.LastWeek,
+			WeekChange:  weekChange(stats.ThisWeek, stats.LastWeek),
+		}
+	}
+	return resp
+}
+
+// AnalyticsDashboard is the handler for GET /analytics-dashboard.
+// Returns the views of the current user's public pages, or of those under a root page:
+// totals, week over week change, trending and least viewed pages over the period, and a sparkline per page.
+// Returns 200 on success, 400 on bad request, 401 on unauthorized, 403 on forbidden, 404 on not found, 500 on error.
+func AnalyticsDashboard(c *gin.Context) {
+	var request api.AnalyticsDashboardRequest
+	if err := c.ShouldBindQuery(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "details": err.Error()})
+		return
+	}
+	if request.Period == 0 {
+		request.Period = views.DashboardPeriods[0]
+	}
+	if !slices.Contains(views.DashboardPeriods, request.Period) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid period, must be 7 or 30"})
+		return
+	}
+
+	if request.RootPageUUID != "" {
+		if _, _, err := auth.AuthorizePage(c, request.RootPageUUID, auth.AccessOwner); err != nil {
+			respondAccessError(c, err)
+			return
+		}
+	}
+
+	dashboard, err := views.GetDashboard(database.DB, auth.MustCurrentUserID(c), request.RootPageUUID, request.Period)
+	if err != nil {
+		fmt.Println("Failed to get analytics dashboard: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get analytics dashboard"})
+		return
+	}
+
+	c.JSON(http.StatusOK, api.AnalyticsDashboardResp{
+		PeriodDays:  dashboard.PeriodDays,
+		TotalViews:  dashboard.TotalViews,
+		PeriodViews: dashboard.PeriodViews,
+		ThisWeek:    dashboard.ThisWeek,
+		LastWeek:    dashboard.LastWeek,
+		WeekChange:  weekChange(dashboard.ThisWeek, dashboard.LastWeek),
+		Trending:    toAnalyticsPageStatsResp(dashboard.Trending),
+		LeastViewed: toAnalyticsPageStatsResp(dashboard.LeastViewed),
+		Pages:       toAnalyticsPageStatsResp(dashboard.Pages),
+	})
+}
@@ -0,0 +1,225 @@
+package controllers
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/opalescencelabs/backend/api"
+	"github.com/opalescencelabs/backend/controllers/audit"
+	"github.com/opalescencelabs/backend/controllers/auth"
+	"github.com/opalescencelabs/backend/database"
+)
+
+// defaultAuditLimit is the number of events listed at once without a limit.
+const defaultAuditLimit = 20
+
+// parseAuditFilter parses the range and actions of an audit request, an empty bound leaves the range open.
+func parseAuditFilter(fromValue string, toValue string, actions []string) (audit.Filter, error) {
+	from, err := parseAnalyticsTime(fromValue, time.Time{})
+	if err != nil {
+		return audit.Filter{}, fmt.Errorf("invalid from: %w", err)
+	}
+	to, err := parseAnalyticsTime(toValue, time.Time{})
+	if err != nil {
+		return audit.Filter{}, fmt.Errorf("invalid to: %w", err)
+	}
+	return audit.Filter{From: from, To: to, Actions: actions}, nil
+}
+
+// parseAuditPage checks the limit and offset of an audit request, and returns the limit to use.
+func parseAuditPage(limit int, offset int) (int, error) {
+	if limit <= 0 {
+		limit = defaultAuditLimit
+	}
+	if limit > audit.MaxLimit || offset < 0 {
+		return 0, fmt.Errorf("limit must be at most %d and offset positive", audit.MaxLimit)
+	}
+	return limit, nil
+}
+
+// toAuditEventResp converts an audit event to its response.
+// In the audit log (withClient), the IP and user agent are only included for the viewer's own actions,
+// and other actors are reduced to their name.
+func toAuditEventResp(event audit.Event, viewerID uint, withClient bool) api.AuditEventResp {
+	resp := api.AuditEventResp{
+		ID:         event.ID,
+		CreatedAt:  event.CreatedAt,
+		Action:     event.Action,
+		TargetType: event.TargetType,
+		TargetID:   event.TargetID,
+		Details:    json.RawMessage(event.Details.Bytes),
+	}
+	if len(resp.Details) == 0 {
+		resp.Details = json.RawMessage("{}")
+	}
+	own := event.ActorID != nil && *event.ActorID == viewerID
+	if event.ActorID != nil && event.ActorFound {
+		if withClient && !own {
+			resp.Actor = &api.AuditActorResp{Name: event.ActorName}
+		} else {
+			resp.Actor = &api.AuditActorResp{ID: *event.ActorID, Name: event.ActorName, Picture: event.ActorPicture}
+		}
+	}
+	if withClient && own {
+		resp.IP, resp.UserAgent = event.IP, event.UserAgent
+	}
+	return resp
+}
+
+// PageActivity is the handler for GET /page-activity/:page_uuid.
+// Returns the activity feed of a page owned by the current user, newest first: its creation, updates with the
+// fields that changed, publication and shares. Filtered by range and action, paginated with limit and offset.
+// Returns 200 on success, 400 on bad request, 401 on unauthorized, 403 on forbidden, 404 on not found, 500 on error.
+func PageActivity(c *gin.Context) {
+	var request api.PageActivityRequest
+	if err := c.ShouldBindQuery(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "details": err.Error()})
+		return
+	}
+	filter, err := parseAuditFilter(request.From, request.To, request.Action)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "details": err.Error()})
+		return
+	}
+	limit, err := parseAuditPage(request.Limit, request.Offset)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "details": err.Error()})
+		return
+	}
+
+	page, _, err := auth.AuthorizePage(c, c.Param("page_uuid"), auth.AccessOwner)
+	if err != nil {
+		respondAccessError(c, err)
+		return
+	}
+	filter.PageUUID = page.PageUUID
+
+	events, total, err := audit.Query(database.DB, filter, limit, request.Offset)
+	if err != nil {
+		fmt.Println("Failed to query page activity: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch page activity"})
+		return
+	}
+
+	resp := api.PageActivityResp{Events: make([]api.AuditEventResp, len(events)), Total: total}
+	for i, event := range events {
+		resp.Events[i] = toAuditEventResp(event, page.UserID, false)
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// AuditLog is the handler for GET /audit-log.
+// Returns the audit log of the current user, newest first: the actions they performed, including logins,
+// and those targeting them or their pages. The IP and user agent are only included for their own actions,
+// and other actors, e.g. collaborators or admins, are reduced to their name.
+// Filtered by range and action, paginated with limit and offset.
+// Returns 200 on success, 400 on bad request, 401 on unauthorized, 500 on error.
+func AuditLog(c *gin.Context) {
+	var request api.AuditLogRequest
+	if err := c.ShouldBindQuery(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "details": err.Error()})
+		return
+	}
+	filter, err := parseAuditFilter(request.From, request.To, request.Action)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "details": err.Error()})
+		return
+	}
+	limit, err := parseAuditPage(request.Limit, request.Offset)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "details": err.Error()})
+		return
+	}
+	userID := auth.MustCurrentUserID(c)
+	filter.UserID = userID
+
+	events, total, err := audit.Query(database.DB, filter, limit, request.Offset)
+	if err != nil {
+		fmt.Println("Failed to query audit log: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch audit log"})
+		return
+	}
+
+	resp := api.AuditLogResp{Events: make([]api.AuditEventResp, len(events)), Total: total}
+	for i, event := range events {
+		resp.Events[i] = toAuditEventResp(event, userID, true)
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// AuditLogExport is the handler for GET /audit-log-export.
+// Streams the audit log of the current user as CSV, oldest first, filtered by range and action.
+// As in the audit log, the IP and user agent are only included for their own actions.
+// Returns 200 on success, 400 on bad request, 401 on unauthorized, 500 on error.
+func AuditLogExport(c *gin.Context) {
+	var request api.AuditLogExportRequest
+	if err := c.ShouldBindQuery(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "details": err.Error()})
+		return
+	}
+	filter, err := parseAuditFilter(request.From, request.To, request.Action)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "details": err.Error()})
+		return
+	}
+	userID := auth.MustCurrentUserID(c)
+	filter.UserID = userID
+
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="audit-log-%s.csv"`, time.Now().Format("2006-01-02")))
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Status(http.StatusOK)
+
+	if err := writeAuditCSV(c, filter, userID); err != nil {
+		// Headers are already sent, the client receives a truncated export
+		fmt.Println("Failed to export audit log: ", err)
+	}
+}
+
+// auditCSVHeader is the header of audit log exports.
+var auditCSVHeader = []string{"id", "created_at", "actor_id", "actor_name", "action", "target_type", "target_id", "details", "ip", "user_agent"}
+
+// auditCSVRecord returns the CSV record of an event of the audit log, actor_id is empty for other actors.
+func auditCSVRecord(event api.AuditEventResp) []string {
+	actorID, actorName := "", ""
+	if event.Actor != nil {
+		actorName = event.Actor.Name
+		if event.Actor.ID != 0 {
+			actorID = strconv.FormatUint(uint64(event.Actor.ID), 10)
+		}
+	}
+	return []string{
+		strconv.FormatUint(uint64(event.ID), 10),
+		event.CreatedAt.UTC().Format(time.RFC3339),
+		actorID,
+		actorName,
+		event.Action,
+		event.TargetType,
+		event.TargetID,
+		string(event.Details),
+		event.IP,
+		event.UserAgent,
+	}
+}
+
+// writeAuditCSV streams the events selected by the filter as CSV, details as JSON.
+// Events are written as in the audit log of the viewer, see toAuditEventResp.
+func writeAuditCSV(c *gin.Context, filter audit.Filter, viewerID uint) error {
+	writer := csv.NewWriter(c.Writer)
+	if err := writer.Write(auditCSVHeader); err != nil {
+		return err
+	}
+
+	err := audit.Export(database.DB, filter, func(event audit.Event) error {
+		return writer.Write(auditCSVRecord(toAuditEventResp(event, viewerID, true)))
+	})
+	writer.Flush()
+	if err != nil {
+		return err
+	}
+	return writer.Error()
+}
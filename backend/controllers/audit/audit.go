@@ -0,0 +1,133 @@
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgtype"
+	"github.com/opalescencelabs/backend/controllers/auth"
+	"github.com/opalescencelabs/backend/models"
+	"gorm.io/gorm"
+)
+
+// Actions recorded in the audit log.
+const (
+	ActionAccountExport            = "account.export"
+	ActionAccountDeletionRequested = "account.deletion_requested"
+	ActionAccountDeletionCancelled = "account.deletion_cancelled"
+	ActionAccountDeleted           = "account.deleted"
+
+	ActionAdminUserSearch    = "admin.user_search"
+	ActionAdminUserPages     = "admin.user_pages"
+	ActionAdminUserStatus    = "admin.user_status"
+	ActionAdminUserDisable   = "admin.user_disable"
+	ActionAdminPageUnpublish = "admin.page_unpublish"
+	ActionAdminPageTransfer  = "admin.page_transfer"
+	ActionAdminImpersonate   = "admin.impersonate"
+
+	ActionPageCreated     = "page.created"
+	ActionPageUpdated     = "page.updated"
+	ActionPageDeleted     = "page.deleted"
+	ActionPagePublished   = "page.published"
+	ActionPageUnpublished = "page.unpublished"
+	ActionPageShared      = "page.shared"
+	ActionPageUnshared    = "page.unshared"
+	// Changes of visibility scheduled by the owner, executed as page.published or page.unpublished by the system.
+	ActionPageScheduled         = "page.scheduled"
+	ActionPageScheduleCancelled = "page.schedule_cancelled"
+	// The draft of a page made the version served to visitors, or restored to it.
+	ActionPageDraftPublished = "page.draft_published"
+	ActionPageDraftDiscarded = "page.draft_discarded"
+	// Custom domains serving the page tree of a root page.
+	ActionPageDomainAdded    = "page.domain_added"
+	ActionPageDomainVerified = "page.domain_verified"
+	ActionPageDomainRemoved  = "page.domain_removed"
+
+	ActionUserLogin  = "user.login"
+	ActionUserLogout = "user.logout"
+)
+
+// Types of the targets of audited actions.
+const (
+	TargetUser = "user"
+	TargetPage = "page"
+)
+
+// Entry describes an audited action.
+type Entry struct {
+	// ActorID is the user who performed the action, nil for actions performed by the system.
+	ActorID    *uint
+	Action     string
+	TargetType string
+	TargetID   string
+	// Details is marshalled to JSON, nil for none.
+	Details   interface{}
+	IP        string
+	UserAgent string
+}
+
+// FromRequest returns an Entry for an action performed by the current user in the request.
+// Actions performed while impersonating a user are attributed to the admin.
+func FromRequest(c *gin.Context, action string, targetType string, targetID string, details interface{}) Entry {
+	entry := Entry{
+		Action:     action,
+		TargetType: targetType,
+		TargetID:   targetID,
+		Details:    details,
+		IP:         c.ClientIP(),
+		UserAgent:  c.Request.UserAgent(),
+	}
+	if admin, ok := auth.Impersonator(c); ok {
+		entry.ActorID = &admin.ID
+	} else if userID, ok := auth.CurrentUserID(c); ok {
+		entry.ActorID = &userID
+	}
+	return entry
+}
+
+// Record appends the entry to the audit log.
+// Pass a transaction as db to record the entry atomically with the action.
+func Record(db *gorm.DB, entry Entry) error {
+	details := pgtype.JSONB{Bytes: []byte("{}"), Status: pgtype.Present}
+	if entry.Details != nil {
+		bytes, err := json.Marshal(entry.Details)
+		if err != nil {
+			return fmt.Errorf("failed to marshal audit details: %w", err)
+		}
+		details.Bytes = bytes
+	}
+
+	event := models.AuditEvent{
+		CreatedAt:  time.Now(),
+		ActorID:    entry.ActorID,
+		Action:     entry.Action,
+		TargetType: entry.TargetType,
+		TargetID:   entry.TargetID,
+		Details:    details,
+		IP:         entry.IP,
+		UserAgent:  entry.UserAgent,
+	}
+	return db.Omit("id").Create(&event).Error
+}
+
+// Anonymise removes the personal data of a deleted user from the audit log: their actions are attributed to no one
+// and lose their IP and user agent, and the details of the events targeting them or their pages are cleared.
+// The entries themselves are kept. Must be called with a transaction, the append-only trigger only accepts these
+// updates while opalescence.audit_anonymise is set, and it is only set until the transaction ends.
+func Anonymise(tx *gorm.DB, userID uint, pageUUIDs []string) error {
+	if err := tx.Exec("SET LOCAL opalescence.audit_anonymise = 'on'").Error; err != nil {
+		return err
+	}
+	if err := tx.Model(&models.AuditEvent{}).Where("actor_id = ?", userID).
+		Updates(map[string]interface{}{"actor_id": nil, "ip": "", "user_agent": ""}).Error; err != nil {
+		return err
+	}
+	if err := tx.Model(&models.AuditEvent{}).
+		Where("(target_type = ? AND target_id = ?) OR (target_type = ? AND target_id IN ?)", TargetUser, fmt.Sprint(userID), TargetPage, pageUUIDs).
+		Update("details", gorm.Expr("'{}'::jsonb")).Error; err != nil {
+		return err
+	}
+	return tx.Exec("SET LOCAL opalescence.audit_anonymise = 'off'").Error
+}
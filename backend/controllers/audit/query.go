@@ -0,0 +1,123 @@
+package audit
+
+import (
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/opalescencelabs/backend/models"
+	"gorm.io/gorm"
+)
+
+// MaxLimit bounds the number of events returned at once.
+const MaxLimit = 100
+
+// PageSummary returns the fields of a page recorded before and after changes.
+// Its visibility is recorded by the page.published and page.unpublished actions.
+func PageSummary(page models.Page) map[string]interface{} {
+	slug := ""
+	if page.Slug != nil {
+		slug = *page.Slug
+	}
+	return map[string]interface{}{
+		"page_name":        page.PageName,
+		"parent_page_uuid": page.ParentPageUUID,
+		"is_root":          page.IsRoot,
+		"slug":             slug,
+	}
+}
+
+// Diff returns the details of a change, {"before": {...}, "after": {...}} with only the fields that changed.
+// Returns nil if nothing changed.
+func Diff(before map[string]interface{}, after map[string]interface{}) map[string]interface{} {
+	changedBefore := map[string]interface{}{}
+	changedAfter := map[string]interface{}{}
+	for key, value := range after {
+		if !reflect.DeepEqual(before[key], value) {
+			changedBefore[key], changedAfter[key] = before[key], value
+		}
+	}
+	if len(changedAfter) == 0 {
+		return nil
+	}
+	return map[string]interface{}{"before": changedBefore, "after": changedAfter}
+}
+
+// Filter selects events of the audit log. Zero values don't filter.
+type Filter struct {
+	// PageUUID selects the events of a page.
+	PageUUID string
+	// UserID selects the events performed by a user, and those targeting the user or their pages.
+	UserID  uint
+	Actions []string
+	From    time.Time
+	// To is exclusive.
+	To time.Time
+}
+
+// Event is an entry of the audit log with its actor, whose fields are empty for system actions and deleted users.
+type Event struct {
+	models.AuditEvent
+	// ActorFound is false for system actions and deleted users.
+	ActorFound   bool
+	ActorName    string
+	ActorPicture string
+}
+
+// query returns the events selected by the filter.
+func query(db *gorm.DB, filter Filter) *gorm.DB {
+	query := db.Model(&models.AuditEvent{}).
+		Select("audit_events.*, COALESCE(users.name, '') AS actor_name, users.id IS NOT NULL AS actor_found, " +
+			"COALESCE(users.picture, '') AS actor_picture").
+		Joins("LEFT JOIN users ON users.id = audit_events.actor_id AND users.deleted_at IS NULL")
+	if filter.PageUUID != "" {
+		query = query.Where("audit_events.target_type = ? AND audit_events.target_id = ?", TargetPage, filter.PageUUID)
+	}
+	if filter.UserID != 0 {
+		query = query.Where("audit_events.actor_id = @user OR (audit_events.target_type = @user_target AND audit_events.target_id = @user_id) OR "+
+			"(audit_events.target_type = @page_target AND audit_events.target_id IN (SELECT page_uuid FROM pages WHERE user_id = @user))",
+			map[string]interface{}{"user": filter.UserID, "user_id": fmt.Sprint(filter.UserID), "user_target": TargetUser, "page_target": TargetPage})
+	}
+	if len(filter.Actions) > 0 {
+		query = query.Where("audit_events.action IN ?", filter.Actions)
+	}
+	if !filter.From.IsZero() {
+		query = query.Where("audit_events.created_at >= ?", filter.From)
+	}
+	if !filter.To.IsZero() {
+		query = query.Where("audit_events.created_at < ?", filter.To)
+	}
+	return query
+}
+
+// Query returns the events selected by the filter, newest first, and their total.
+func Query(db *gorm.DB, filter Filter, limit int, offset int) ([]Event, int64, error) {
+	selected := query(db, filter)
+	var total int64
+	if err := selected.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var events []Event
+	err := selected.Order("audit_events.id DESC").Limit(limit).Offset(offset).Scan(&events).Error
+	return events, total, err
+}
+
+// Export calls fn with each event selected by the filter, oldest first, without loading them all in memory.
+func Export(db *gorm.DB, filter Filter, fn func(Event) error) error {
+	rows, err := query(db, filter).Order("audit_events.id").Rows()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var event Event
+		if err := db.ScanRows(rows, &event); err != nil {
+			return err
+		}
+		if err := fn(event); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
@@ -0,0 +1,55 @@
+package audit
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/opalescencelabs/backend/models"
+)
+
+func TestPageSummary(t *testing.T) {
+	slug := "notes"
+	tests := []struct {
+		name string
+		page models.Page
+		want map[string]interface{}
+	}{
+		{"without slug", models.Page{PageName: "Notes", ParentPageUUID: "root", IsRoot: false},
+			map[string]interface{}{"page_name": "Notes", "parent_page_uuid": "root", "is_root": false, "slug": ""}},
+		{"with slug", models.Page{PageName: "Notes", IsRoot: true, Slug: &slug},
+			map[string]interface{}{"page_name": "Notes", "parent_page_uuid": "", "is_root": true, "slug": "notes"}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := PageSummary(tc.page); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("PageSummary() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestDiff(t *testing.T) {
+	tests := []struct {
+		name   string
+		before map[string]interface{}
+		after  map[string]interface{}
+		want   map[string]interface{}
+	}{
+		{"unchanged", map[string]interface{}{"page_name": "A", "is_root": true}, map[string]interface{}{"page_name": "A", "is_root": true}, nil},
+		{"changed fields only",
+			map[string]interface{}{"page_name": "A", "is_root": true},
+			map[string]interface{}{"page_name": "B", "is_root": true},
+			map[string]interface{}{"before": map[string]interface{}{"page_name": "A"}, "after": map[string]interface{}{"page_name": "B"}}},
+		{"new field",
+			map[string]interface{}{},
+			map[string]interface{}{"slug": "notes"},
+			map[string]interface{}{"before": map[string]interface{}{"slug": nil}, "after": map[string]interface{}{"slug": "notes"}}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := Diff(tc.before, tc.after); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("Diff() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,87 @@
+package controllers
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgtype"
+	"github.com/opalescencelabs/backend/api"
+	"github.com/opalescencelabs/backend/controllers/audit"
+	"github.com/opalescencelabs/backend/models"
+)
+
+func TestToAuditEventResp(t *testing.T) {
+	owner, collaborator := uint(1), uint(2)
+	event := func(actorID *uint, found bool) audit.Event {
+		return audit.Event{
+			AuditEvent: models.AuditEvent{
+				ID: 7, CreatedAt: time.Unix(0, 0), ActorID: actorID, Action: audit.ActionPageUpdated, TargetType: audit.TargetPage,
+				TargetID: "page", Details: pgtype.JSONB{Bytes: []byte(`{"a":1}`), Status: pgtype.Present},
+				IP: "203.0.113.7", UserAgent: "Browser",
+			},
+			ActorFound: found, ActorName: "Name", ActorPicture: "picture.png",
+		}
+	}
+	tests := []struct {
+		name          string
+		event         audit.Event
+		withClient    bool
+		wantActor     *api.AuditActorResp
+		wantIP        string
+		wantUserAgent string
+	}{
+		{"own action in the audit log", event(&owner, true), true, &api.AuditActorResp{ID: owner, Name: "Name", Picture: "picture.png"}, "203.0.113.7", "Browser"},
+		{"other actor in the audit log", event(&collaborator, true), true, &api.AuditActorResp{Name: "Name"}, "", ""},
+		{"system action in the audit log", event(nil, false), true, nil, "", ""},
+		{"deleted actor in the audit log", event(&collaborator, false), true, nil, "", ""},
+		{"other actor in the page activity", event(&collaborator, true), false, &api.AuditActorResp{ID: collaborator, Name: "Name", Picture: "picture.png"}, "", ""},
+		{"own action in the page activity", event(&owner, true), false, &api.AuditActorResp{ID: owner, Name: "Name", Picture: "picture.png"}, "", ""},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got := toAuditEventResp(tc.event, owner, tc.withClient)
+			if !reflect.DeepEqual(got.Actor, tc.wantActor) {
+				t.Errorf("toAuditEventResp() actor = %+v, want %+v", got.Actor, tc.wantActor)
+			}
+			if got.IP != tc.wantIP || got.UserAgent != tc.wantUserAgent {
+				t.Errorf("toAuditEventResp() client = %q %q, want %q %q", got.IP, got.UserAgent, tc.wantIP, tc.wantUserAgent)
+			}
+			if string(got.Details) != `{"a":1}` {
+				t.Errorf("toAuditEventResp() details = %s, want the recorded details", got.Details)
+			}
+		})
+	}
+}
+
+func TestAuditCSVRecord(t *testing.T) {
+	createdAt := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	tests := []struct {
+		name  string
+		event api.AuditEventResp
+		want  []string
+	}{
+		{"own action",
+			api.AuditEventResp{ID: 1, CreatedAt: createdAt, Actor: &api.AuditActorResp{ID: 3, Name: "Me"}, Action: "login", TargetType: "user", TargetID: "3",
+				Details: []byte("{}"), IP: "203.0.113.7", UserAgent: "Browser"},
+			[]string{"1", "2024-01-02T03:04:05Z", "3", "Me", "login", "user", "3", "{}", "203.0.113.7", "Browser"}},
+		{"other actor",
+			api.AuditEventResp{ID: 2, CreatedAt: createdAt, Actor: &api.AuditActorResp{Name: "Other"}, Action: "page.updated", TargetType: "page", TargetID: "p",
+				Details: []byte("{}")},
+			[]string{"2", "2024-01-02T03:04:05Z", "", "Other", "page.updated", "page", "p", "{}", "", ""}},
+		{"system action",
+			api.AuditEventResp{ID: 3, CreatedAt: createdAt, Action: "page.published", TargetType: "page", TargetID: "p", Details: []byte("{}")},
+			[]string{"3", "2024-01-02T03:04:05Z", "", "", "page.published", "page", "p", "{}", "", ""}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got := auditCSVRecord(tc.event)
+			if len(got) != len(auditCSVHeader) {
+				t.Fatalf("auditCSVRecord() has %d fields, want %d", len(got), len(auditCSVHeader))
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("auditCSVRecord() = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
@@ -191,13 +191,29 @@ func MakeTokenString(accessToken string, refreshToken string, expiry int) (strin
 // If the access token happens to be invalid, it will try to use the refresh token to get a new access token.
 // Returns the user's ID if the token is valid. Otherwise, returns an error.
 func AuthenticateUser(c *gin.Context) (uint, error) {
+	user, err := ResolveUser(c)
+	if err != nil {
+		return 0, err
+	}
+	return user.ID, nil
+}
+
+// ResolveUser retrieves the JWT token from the request, validates it and loads the user it belongs to.
+// If the access token happens to be invalid, it will try to use the refresh token to get a new access token.
+// Returns the user if the token is valid. Otherwise, returns an error.
+func ResolveUser(c *gin.Context) (models.User, error) {
+	var user models.User
+
 	// Retrieve the JWT token from the request
 	token, err := c.Cookie("Authorization")
 	if err != nil {
-		return 0, err
+		return user, err
 	}
 	if token == "Only_for_testing1200332" {
-		return 0, nil
+		if err := database.DB.First(&user, "id = ?", 0).Error; err != nil {
+			return user, errors.New("test user doesn't exist in DB")
+		}
+		return user, nil
 	}
 
 	// Parse and validate the JWT token
@@ -207,13 +223,13 @@ func AuthenticateUser(c *gin.Context) (uint, error) {
 	})
 
 	if err != nil {
-		return 0, err
+		return user, err
 	}
 
 	// Retrieve access_token from JWT claims
 	accessToken, ok := claims["access_token"].(string)
 	if !ok {
-		return 0, errors.New("unable to parse access_token from JWT claims")
+		return user, errors.New("unable to parse access_token from JWT claims")
 	}
 
 	// Validate accessToken
@@ -226,11 +242,11 @@ func AuthenticateUser(c *gin.Context) (uint, error) {
 		var err error
 		if accessToken, refreshToken, expiry, err = RefreshTokens(claims["refresh_token"].(string)); err != nil {
 			fmt.Println("new tokens: " + accessToken + refreshToken + fmt.Sprint(expiry))
-			return 0, errors.New("unable to validate access_token: " + err.Error())
+			return user, errors.New("unable to validate access_token: " + err.Error())
 		}
 		tokenString, err := MakeTokenString(accessToken, refreshToken, expiry)
 		if err != nil {
-			return 0, err
+			return user, err
 		}
 		// Attach new tokens to browser
 		c.SetSameSite(http.SameSiteLaxMode)
@@ -248,46 +264,135 @@ func AuthenticateUser(c *gin.Context) (uint, error) {
 	// Get user information using access_token
 	userInfo, err := GetUserInfo(accessToken)
 	if err != nil {
-		return 0, errors.New("unable to get userInfo from accessToken: " + err.Error())
+		return user, errors.New("unable to get userInfo from accessToken: " + err.Error())
 	}
 
-	var user models.User
 	if err := database.DB.First(&user, "google_id = ?", userInfo["sub"].(string)); err.Error != nil {
-		return 0, errors.New("user doesn't exist in DB: " + userInfo["sub"].(string))
+		return user, errors.New("user doesn't exist in DB: " + userInfo["sub"].(string))
 	}
 
 	if newTokensMade {
 		// Update credentials in DB
 		credentials, err := MakeCredentialsJson(accessToken, refreshToken, expiry)
 		if err != nil {
-			return 0, err
+			return user, err
 		}
 		if err := database.DB.Model(&user).Update("credentials", credentials).Error; err != nil {
-			return 0, errors.New("failed to update credentials in DB: " + err.Error())
+			return user, errors.New("failed to update credentials in DB: " + err.Error())
 		}
 
 		fmt.Println("credentials updated for user: " + fmt.Sprint(user.ID))
 	}
 
-	return user.ID, nil
+	return user, nil
 }
 
+// Keys under which the middleware stores the resolved user in the gin context.
+const (
+	userIDKey       = "user_id"
+	userKey         = "user"
+	impersonatorKey = "impersonator"
+)
+
 // AuthenticateMiddleware is middleware that checks if the user is authenticated.
+// The resolved user is attached to the context, see CurrentUser and CurrentUserID.
+// Aborts with 401 if the user is not authenticated, 403 if their account is disabled.
 func AuthenticateMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// Authenticate the user
-		userID, err := AuthenticateUser(c)
+		user, err := ResolveUser(c)
 		if err != nil {
 			// User is not authenticated
 			fmt.Println("unauthenticated: " + err.Error())
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
-			c.Abort()
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			return
+		}
+		if user.Disabled {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Account disabled"})
 			return
 		}
 
 		// Continue processing the request
-		// Attach user_id to context
-		c.Set("user_id", userID)
+		// Attach user to context
+		SetCurrentUser(c, user)
 		c.Next()
 	}
 }
+
+// OptionalAuthenticateMiddleware is middleware that resolves the user if the request is authenticated,
+// but lets anonymous requests through (e.g. visitors of public pages).
+func OptionalAuthenticateMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if user, err := ResolveUser(c); err == nil && !user.Disabled {
+			SetCurrentUser(c, user)
+		}
+		c.Next()
+	}
+}
+
+// SetCurrentUser attaches the user and their ID to the context.
+func SetCurrentUser(c *gin.Context, user models.User) {
+	c.Set(userKey, user)
+	c.Set(userIDKey, user.ID)
+}
+
+// CurrentUser returns the user resolved by the authentication middleware.
+// The second return value is false if the request is anonymous.
+func CurrentUser(c *gin.Context) (models.User, bool) {
+	user, ok := c.Get(userKey)
+	if !ok {
+		return models.User{}, false
+	}
+	return user.(models.User), true
+}
+
+// CurrentUserID returns the ID of the user resolved by the authentication middleware.
+// The second return value is false if the request is anonymous.
+func CurrentUserID(c *gin.Context) (uint, bool) {
+	userID, ok := c.Get(userIDKey)
+	if !ok {
+		return 0, false
+	}
+	return userID.(uint), true
+}
+
+// MustCurrentUser returns the user resolved by AuthenticateMiddleware.
+// Panics if called from a handler that is not behind AuthenticateMiddleware.
+func MustCurrentUser(c *gin.Context) models.User {
+	return c.MustGet(userKey).(models.User)
+}
+
+// MustCurrentUserID returns the ID of the user resolved by AuthenticateMiddleware.
+// Panics if called from a handler that is not behind AuthenticateMiddleware.
+func MustCurrentUserID(c *gin.Context) uint {
+	return c.MustGet(userIDKey).(uint)
+}
+
+// AdminMiddleware is middleware that only lets admins through.
+// Must be registered after AuthenticateMiddleware, aborts with 403 if the user is not an admin.
+func AdminMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if user, ok := CurrentUser(c); !ok || user.Role != "admin" {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Forbidden"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// Impersonate makes the target the current user of the request on behalf of the admin.
+// The admin can be retrieved with Impersonator.
+func Impersonate(c *gin.Context, admin models.User, target models.User) {
+	c.Set(impersonatorKey, admin)
+	SetCurrentUser(c, target)
+}
+
+// Impersonator returns the admin impersonating the current user.
+// The second return value is false if the request is not impersonated.
+func Impersonator(c *gin.Context) (models.User, bool) {
+	admin, ok := c.Get(impersonatorKey)
+	if !ok {
+		return models.User{}, false
+	}
+	return admin.(models.User), true
+}
@@ -0,0 +1,78 @@
+package auth
+
+import (
+	"errors"
+
+	"github.com/gin-gonic/gin"
+	"github.com/opalescencelabs/backend/database"
+	"github.com/opalescencelabs/backend/models"
+)
+
+// Access is the level of access a user has to a page.
+// Levels are ordered, so a higher level grants everything a lower level does.
+type Access int
+
+const (
+	// AccessNone means the page may not be seen at all.
+	AccessNone Access = iota
+	// AccessPublic means the page is public and may be read by anyone.
+	AccessPublic
+	// AccessShared means the page has been shared with the user and may be read by them.
+	AccessShared
+	// AccessOwner means the user owns the page and may read and modify it.
+	AccessOwner
+)
+
+var (
+	// ErrPageNotFound is returned when the requested page does not exist.
+	ErrPageNotFound = errors.New("page not found")
+	// ErrForbidden is returned when the user's access level is lower than required.
+	ErrForbidden = errors.New("forbidden")
+)
+
+// PageAccess returns the level of access the user has to the page.
+// authenticated is false for anonymous requests, in which case userID is ignored.
+func PageAccess(userID uint, authenticated bool, page models.Page) Access {
+	if authenticated {
+		if page.UserID == userID {
+			return AccessOwner
+		}
+		if IsSharedWith(page.ID, userID) {
+			return AccessShared
+		}
+	}
+	if page.PublicPage {
+		return AccessPublic
+	}
+	return AccessNone
+}
+
+// IsSharedWith returns true if the page has been shared with the user.
+func IsSharedWith(pageID uint, userID uint) bool {
+	var count int64
+	database.DB.Model(&models.PageShare{}).Where("page_id = ? AND user_id = ?", pageID, userID).Count(&count)
+	return count > 0
+}
+
+// AuthorizePage loads the page with the given UUID and checks the current user's access to it.
+// Returns the page and the access level if the access level is at least required.
+// Returns ErrPageNotFound if the page does not exist or the user may not see it at all, authenticated or not,
+// ErrForbidden if access is insufficient.
+func AuthorizePage(c *gin.Context, pageUUID string, required Access) (models.Page, Access, error) {
+	var page models.Page
+	if err := database.DB.Where("page_uuid = ?", pageUUID).First(&page).Error; err != nil {
+		return models.Page{}, AccessNone, ErrPageNotFound
+	}
+
+	userID, authenticated := CurrentUserID(c)
+	access := PageAccess(userID, authenticated, page)
+	if access == AccessNone {
+		// Don't leak the existence of private pages, e.g. to anonymous requests probing UUIDs or slugs
+		return models.Page{}, access, ErrPageNotFound
+	}
+	if access < required {
+		return models.Page{}, access, ErrForbidden
+	}
+
+	return page, access, nil
+}
@@ -0,0 +1,56 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/opalescencelabs/backend/api"
+	"github.com/opalescencelabs/backend/controllers/billing"
+	"github.com/opalescencelabs/backend/database"
+)
+
+// BillingWebhook is the handler for POST /billing-webhook.
+// Receives signed subscription events from the payment provider and updates the user's plan.
+// Events are processed idempotently, redelivered events are acknowledged without being applied again,
+// and so are events older than the last applied event of their subscription.
+// Returns 200 on success, 400 on bad request or invalid signature, 500 on error.
+func BillingWebhook(c *gin.Context) {
+	payload, err := c.GetRawData()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	if err := billing.VerifySignature(payload, c.GetHeader(billing.SignatureHeader), billing.GetWebhookSecret(), time.Now()); err != nil {
+		fmt.Println("Rejected billing webhook: ", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid signature"})
+		return
+	}
+
+	event, err := billing.ParseEvent(payload)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid event", "details": err.Error()})
+		return
+	}
+
+	result, err := billing.ProcessEvent(database.DB, event, payload)
+	if err != nil {
+		// The provider redelivers events that weren't acknowledged
+		fmt.Printf("Failed to process billing event %s: %s\n", event.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process event"})
+		return
+	}
+	if result.Stale {
+		fmt.Printf("Billing event %s is older than the last applied event of its subscription\n", event.ID)
+	}
+	if result.UnknownCustomer {
+		fmt.Printf("Billing event %s does not belong to a known user\n", event.ID)
+	}
+
+	// Pages made private by a downgrade must not be served from the cache
+	invalidatePagesAndParents(c, result.UnpublishedPages)
+
+	c.JSON(http.StatusOK, api.BillingWebhookResp{Received: true, Duplicate: result.Duplicate, Stale: result.Stale})
+}
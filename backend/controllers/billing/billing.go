@@ -0,0 +1,327 @@
+package billing
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgtype"
+	"github.com/opalescencelabs/backend/controllers/audit"
+	"github.com/opalescencelabs/backend/controllers/plans"
+	"github.com/opalescencelabs/backend/controllers/publishing"
+	"github.com/opalescencelabs/backend/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// SignatureHeader is the header the payment provider signs webhook payloads in.
+const SignatureHeader = "Stripe-Signature"
+
+// SignatureTolerance is how old a signed webhook may be before it is rejected, to prevent replays.
+const SignatureTolerance = 5 * time.Minute
+
+// Subscription event types handled by the webhook.
+const (
+	EventSubscriptionCreated   = "customer.subscription.created"
+	EventSubscriptionUpdated   = "customer.subscription.updated"
+	EventSubscriptionCancelled = "customer.subscription.deleted"
+)
+
+var (
+	// ErrInvalidSignature is returned when a webhook's signature is missing, malformed, stale or doesn't match.
+	ErrInvalidSignature = errors.New("invalid webhook signature")
+	// ErrUnknownCustomer is returned when an event can't be matched to a user.
+	ErrUnknownCustomer = errors.New("unknown billing customer")
+)
+
+// GetWebhookSecret returns the secret webhooks are signed with from the environment variables.
+func GetWebhookSecret() string {
+	return os.Getenv("BILLING_WEBHOOK_SECRET")
+}
+
+// Event is a webhook event sent by the payment provider.
+type Event struct {
+	ID      string `json:"id"`
+	Type    string `json:"type"`
+	Created int64  `json:"created"`
+	Data    struct {
+		Object Subscription `json:"object"`
+	} `json:"data"`
+}
+
+// Subscription is the subscription object carried by subscription events.
+type Subscription struct {
+	ID       string            `json:"id"`
+	Customer string            `json:"customer"`
+	Status   string            `json:"status"`
+	Metadata map[string]string `json:"metadata"`
+}
+
+// Sign returns the signature header value for a payload signed at the given time.
+// The signature is an HMAC-SHA256 of "<timestamp>.<payload>", as sent by the payment provider.
+func Sign(payload []byte, secret string, timestamp time.Time) string {
+	t := strconv.FormatInt(timestamp.Unix(), 10)
+	return "t=" + t + ",v1=" + computeSignature(payload, secret, t)
+}
+
+// computeSignature returns the hex encoded HMAC-SHA256 of the signed payload.
+func computeSignature(payload []byte, secret string, timestamp string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifySignature checks the signature header of a webhook payload.
+// Returns ErrInvalidSignature if the signature is invalid or older than SignatureTolerance, nil otherwise.
+func VerifySignature(payload []byte, header string, secret string, now time.Time) error {
+	if secret == "" {
+		return errors.New("webhook secret is not configured")
+	}
+
+	var timestamp string
+	var signatures []string
+	for _, part := range strings.Split(header, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "t":
+			timestamp = value
+		case "v1":
+			signatures = append(signatures, value)
+		}
+	}
+	if timestamp == "" || len(signatures) == 0 {
+		return ErrInvalidSignature
+	}
+
+	signedAt, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	if age := now.Sub(time.Unix(signedAt, 0)); age > SignatureTolerance || age < -SignatureTolerance {
+		return ErrInvalidSignature
+	}
+
+	expected := computeSignature(payload, secret, timestamp)
+	for _, signature := range signatures {
+		if hmac.Equal([]byte(signature), []byte(expected)) {
+			return nil
+		}
+	}
+	return ErrInvalidSignature
+}
+
+// statusFor returns the User.Status a subscription event results in.
+// Active subscriptions grant the plan named in their metadata, lapsed subscriptions fall back to freemium.
+// The second return value is false if the event doesn't change the user's status (e.g. a payment is past due).
+func statusFor(event Event) (string, bool) {
+	subscription := event.Data.Object
+	if event.Type == EventSubscriptionCancelled {
+		return "freemium", true
+	}
+
+	switch subscription.Status {
+	case "active", "trialing":
+		plan := subscription.Metadata["plan"]
+		if !slices.Contains(plans.Tiers, plan) {
+			return "", false
+		}
+		return plan, true
+	case "canceled", "unpaid", "incomplete_expired":
+		return "freemium", true
+	}
+	return "", false
+}
+
+// Result describes the outcome of processing an event.
+type Result struct {
+	// Duplicate is true if the event was already processed and has been ignored.
+	Duplicate bool
+	// Stale is true if a newer event of the subscription was already applied, the event is logged but not applied.
+	Stale bool
+	// UnknownCustomer is true if the event couldn't be matched to a user, it is logged but not applied.
+	UnknownCustomer bool
+	// UnpublishedPages holds the UUIDs of pages made private because the user was downgraded.
+	UnpublishedPages []string
+}
+
+// ProcessEvent applies a subscription event to the user it belongs to and records it in the billing event log.
+// Events are processed at most once, identified by their ID. Events may be delivered out of order, those created
+// before the last applied event of their subscription are not applied, see claimSubscription.
+func ProcessEvent(db *gorm.DB, event Event, payload []byte) (Result, error) {
+	var result Result
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		record := models.BillingEvent{
+			EventID:        event.ID,
+			Type:           event.Type,
+			CustomerID:     event.Data.Object.Customer,
+			SubscriptionID: event.Data.Object.ID,
+			Payload:        pgtype.JSONB{Bytes: payload, Status: pgtype.Present},
+		}
+
+		// Claim the event, concurrent or repeated deliveries of the same event are ignored
+		insert := tx.Clauses(clause.OnConflict{DoNothing: true}).Omit("id").Create(&record)
+		if insert.Error != nil {
+			return insert.Error
+		}
+		if insert.RowsAffected == 0 {
+			result.Duplicate = true
+			return nil
+		}
+
+		switch event.Type {
+		case EventSubscriptionCreated, EventSubscriptionUpdated, EventSubscriptionCancelled:
+		default:
+			// Other events are only logged
+			return nil
+		}
+
+		applied, err := claimSubscription(tx, event)
+		if err != nil {
+			return err
+		}
+		if !applied {
+			result.Stale = true
+			return nil
+		}
+
+		user, err := findUser(tx, event.Data.Object)
+		if errors.Is(err, ErrUnknownCustomer) {
+			// Keep the event in the log for investigation, redelivering it won't help
+			result.UnknownCustomer = true
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		record.UserID = &user.ID
+		record.PreviousStatus = user.Status
+		record.NewStatus = user.Status
+
+		if newStatus, ok := statusFor(event); ok && newStatus != user.Status {
+			record.NewStatus = newStatus
+			if err := tx.Model(&user).Update("status", newStatus).Error; err != nil {
+				return err
+			}
+			user.Status = newStatus
+
+			// Bring the user's content back within the limits of the new plan
+			unpublished, err := Downgrade(tx, user)
+			if err != nil {
+				return err
+			}
+			result.UnpublishedPages = unpublished
+		}
+
+		return tx.Model(&record).Updates(map[string]interface{}{
+			"user_id":         record.UserID,
+			"previous_status": record.PreviousStatus,
+			"new_status":      record.NewStatus,
+		}).Error
+	})
+
+	return result, err
+}
+
+// claimSubscription records the event as the last applied event of its subscription.
+// Returns false if an event of the subscription created after it was already applied, e.g. a delayed update
+// delivered after the cancellation that followed it.
+func claimSubscription(tx *gorm.DB, event Event) (bool, error) {
+	if event.Data.Object.ID == "" {
+		return true, nil
+	}
+	subscription := models.BillingSubscription{SubscriptionID: event.Data.Object.ID, LastEventAt: time.Unix(event.Created, 0)}
+	result := tx.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "subscription_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"last_event_at", "updated_at"}),
+		Where: clause.Where{Exprs: []clause.Expression{
+			clause.Expr{SQL: "billing_subscriptions.last_event_at <= excluded.last_event_at"},
+		}},
+	}).Omit("id").Create(&subscription)
+	return result.RowsAffected > 0, result.Error
+}
+
+// findUser returns the user a subscription belongs to.
+// Subscriptions are matched by customer ID, or by the user_id metadata set when the user subscribed,
+// in which case the customer ID is linked to the user for later events.
+func findUser(tx *gorm.DB, subscription Subscription) (models.User, error) {
+	var user models.User
+	if subscription.Customer != "" {
+		if err := tx.Where("billing_customer_id = ?", subscription.Customer).First(&user).Error; err == nil {
+			return user, nil
+		}
+	}
+
+	userID, err := strconv.ParseUint(subscription.Metadata["user_id"], 10, 64)
+	if err != nil {
+		return user, ErrUnknownCustomer
+	}
+	if err := tx.First(&user, "id = ?", userID).Error; err != nil {
+		return user, ErrUnknownCustomer
+	}
+
+	if subscription.Customer != "" {
+		if err := tx.Model(&user).Update("billing_customer_id", subscription.Customer).Error; err != nil {
+			return user, fmt.Errorf("failed to link billing customer: %w", err)
+		}
+	}
+	return user, nil
+}
+
+// Downgrade brings a user's content within the limits of their current plan.
+// Public pages over the limit are made private with publishing.Unpublish, keeping the most recently updated ones public.
+// Returns the UUIDs of the pages that were made private.
+func Downgrade(tx *gorm.DB, user models.User) ([]string, error) {
+	maxPublic := plans.LimitsFor(user.Status).PublicPages
+	if maxPublic == plans.Unlimited {
+		return nil, nil
+	}
+
+	var excess []models.Page
+	if err := tx.Where("user_id = ? AND public_page = ?", user.ID, true).
+		Order("last_updated_at DESC").
+		Offset(int(maxPublic)).
+		Find(&excess).Error; err != nil {
+		return nil, err
+	}
+	if len(excess) == 0 {
+		return nil, nil
+	}
+
+	// Unpublished as the owner would, attributed to the system
+	entry := audit.Entry{Details: map[string]interface{}{"reason": "plan downgraded", "status": user.Status}}
+	unpublished, err := publishing.Unpublish(tx, excess, entry, "plan downgraded")
+	if err != nil {
+		return nil, err
+	}
+	pageUUIDs := make([]string, len(unpublished))
+	for i, page := range unpublished {
+		pageUUIDs[i] = page.PageUUID
+	}
+	return pageUUIDs, nil
+}
+
+// ParseEvent decodes a webhook payload.
+func ParseEvent(payload []byte) (Event, error) {
+	var event Event
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return event, err
+	}
+	if event.ID == "" || event.Type == "" {
+		return event, errors.New("event is missing its id or type")
+	}
+	return event, nil
+}
@@ -0,0 +1,78 @@
+package billing
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestVerifySignature(t *testing.T) {
+	payload := []byte(`{"id":"evt_test","type":"customer.subscription.updated"}`)
+	now := time.Unix(1700000000, 0)
+
+	tests := []struct {
+		name    string
+		header  string
+		secret  string
+		wantErr error
+	}{
+		{"valid", Sign(payload, "secret", now), "secret", nil},
+		{"within tolerance", Sign(payload, "secret", now.Add(-SignatureTolerance+time.Second)), "secret", nil},
+		{"one of several signatures", Sign(payload, "secret", now) + ",v1=deadbeef", "secret", nil},
+		{"wrong secret", Sign(payload, "other", now), "secret", ErrInvalidSignature},
+		{"stale", Sign(payload, "secret", now.Add(-SignatureTolerance-time.Second)), "secret", ErrInvalidSignature},
+		{"from the future", Sign(payload, "secret", now.Add(SignatureTolerance+time.Second)), "secret", ErrInvalidSignature},
+		{"missing timestamp", "v1=deadbeef", "secret", ErrInvalidSignature},
+		{"missing signature", "t=1700000000", "secret", ErrInvalidSignature},
+		{"malformed timestamp", "t=yesterday,v1=deadbeef", "secret", ErrInvalidSignature},
+		{"empty header", "", "secret", ErrInvalidSignature},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			err := VerifySignature(payload, tc.header, tc.secret, now)
+			if !errors.Is(err, tc.wantErr) {
+				t.Errorf("VerifySignature() = %v, want %v", err, tc.wantErr)
+			}
+		})
+	}
+
+	if err := VerifySignature(payload, Sign(payload, "", now), "", now); err == nil {
+		t.Error("VerifySignature() accepted a payload without a configured secret")
+	}
+}
+
+func TestVerifySignatureTamperedPayload(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	header := Sign([]byte(`{"id":"evt_test"}`), "secret", now)
+	if err := VerifySignature([]byte(`{"id":"evt_other"}`), header, "secret", now); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("VerifySignature() = %v, want %v", err, ErrInvalidSignature)
+	}
+}
+
+func TestStatusFor(t *testing.T) {
+	tests := []struct {
+		name       string
+		eventType  string
+		status     string
+		plan       string
+		wantStatus string
+		wantOK     bool
+	}{
+		{"active premium", EventSubscriptionUpdated, "active", "premium", "premium", true},
+		{"trialing enterprise", EventSubscriptionCreated, "trialing", "enterprise", "enterprise", true},
+		{"unknown plan", EventSubscriptionUpdated, "active", "platinum", "", false},
+		{"lapsed", EventSubscriptionUpdated, "unpaid", "premium", "freemium", true},
+		{"past due keeps the plan", EventSubscriptionUpdated, "past_due", "premium", "", false},
+		{"cancelled", EventSubscriptionCancelled, "active", "premium", "freemium", true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			event := Event{Type: tc.eventType}
+			event.Data.Object = Subscription{Status: tc.status, Metadata: map[string]string{"plan": tc.plan}}
+			status, ok := statusFor(event)
+			if status != tc.wantStatus || ok != tc.wantOK {
+				t.Errorf("statusFor() = %q, %v, want %q, %v", status, ok, tc.wantStatus, tc.wantOK)
+			}
+		})
+	}
+}
@@ -0,0 +1,55 @@
+package billing
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// Simulator sends signed subscription events to a webhook endpoint the way the payment provider does.
+// It is used to test the webhook locally without a payment provider account.
+type Simulator struct {
+	// URL of the webhook endpoint, e.g. "http://localhost:8000/billing-webhook"
+	URL    string
+	Secret string
+	Client *http.Client
+
+	counter atomic.Int64
+}
+
+// NewSimulator returns a Simulator posting events to url signed with secret.
+func NewSimulator(url string, secret string) *Simulator {
+	return &Simulator{URL: url, Secret: secret, Client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+// NewEvent returns an event of the given type carrying the subscription, with a unique ID.
+func (s *Simulator) NewEvent(eventType string, subscription Subscription) Event {
+	event := Event{
+		ID:      fmt.Sprintf("evt_sim_%d_%d", time.Now().UnixNano(), s.counter.Add(1)),
+		Type:    eventType,
+		Created: time.Now().Unix(),
+	}
+	event.Data.Object = subscription
+	return event
+}
+
+// Send signs the event and posts it to the webhook endpoint.
+// Sending the same event twice simulates a redelivery.
+func (s *Simulator) Send(event Event) (*http.Response, error) {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest("POST", s.URL, bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(SignatureHeader, Sign(payload, s.Secret, time.Now()))
+
+	return s.Client.Do(req)
+}
@@ -0,0 +1,245 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/opalescencelabs/backend/api"
+	"github.com/opalescencelabs/backend/controllers/auth"
+	"github.com/opalescencelabs/backend/controllers/comments"
+	"github.com/opalescencelabs/backend/controllers/notifications"
+	"github.com/opalescencelabs/backend/database"
+	"github.com/opalescencelabs/backend/models"
+)
+
+// respondCommentError writes the response for an error returned by the comments package.
+func respondCommentError(c *gin.Context, err error, action string) {
+	switch {
+	case errors.Is(err, comments.ErrInvalidBody):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, comments.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Comment, element or thread not found"})
+	case errors.Is(err, comments.ErrForbidden):
+		c.JSON(http.StatusForbidden, gin.H{"error": "Forbidden"})
+	default:
+		fmt.Printf("Failed to %s: %s\n", action, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to " + action})
+	}
+}
+
+// authorizeComment loads a comment and its page, and checks the current user may comment on the page,
+// i.e. owns it or it is shared with them. Responds and returns false otherwise.
+func authorizeComment(c *gin.Context, commentID uint) (models.Comment, models.Page, auth.Access, bool) {
+	comment, err := comments.Get(database.DB, commentID)
+	if err != nil {
+		respondCommentError(c, err, "fetch comment")
+		return models.Comment{}, models.Page{}, auth.AccessNone, false
+	}
+	var page models.Page
+	if err := database.DB.First(&page, "id = ?", comment.PageID).Error; err != nil {
+		respondCommentError(c, comments.ErrNotFound, "fetch comment")
+		return models.Comment{}, models.Page{}, auth.AccessNone, false
+	}
+	page, access, err := auth.AuthorizePage(c, page.PageUUID, auth.AccessShared)
+	if err != nil {
+		// Commenters are always authenticated, don't reveal comments on pages the user may only read
+		respondCommentError(c, comments.ErrNotFound, "fetch comment")
+		return models.Comment{}, models.Page{}, auth.AccessNone, false
+	}
+	return comment, page, access, true
+}
+
+// toCommentResp converts a comment and its author to its response.
+func toCommentResp(entry comments.Entry) api.CommentResp {
+	return api.CommentResp{
+		ID:          entry.ID,
+		ElementUUID: entry.ElementUUID,
+		ParentID:    entry.ParentID,
+		Author:      api.CommentAuthorResp{ID: entry.Author.ID, Name: entry.Author.Name, Picture: entry.Author.Picture},
+		Body:        entry.Body,
+		CreatedAt:   entry.CreatedAt,
+		EditedAt:    entry.EditedAt,
+		ResolvedAt:  entry.ResolvedAt,
+		ResolvedBy:  entry.ResolvedByID,
+	}
+}
+
+// toCommentThreadsResp converts comment threads to their response.
+func toCommentThreadsResp(threads []comments.Thread) []api.CommentThreadResp {
+	resp := make([]api.CommentThreadResp, len(threads))
+	for i, thread := range threads {
+		replies := make([]api.CommentResp, len(thread.Replies))
+		for j, reply := range thread.Replies {
+			replies[j] = toCommentResp(reply)
+		}
+		resp[i] = api.CommentThreadResp{CommentResp: toCommentResp(thread.Entry), Replies: replies}
+	}
+	return resp
+}
+
+// currentAuthor returns the current user as the author of a comment.
+func currentAuthor(c *gin.Context) comments.Author {
+	user := auth.MustCurrentUser(c)
+	return comments.Author{ID: user.ID, Name: user.Name, Picture: user.Picture}
+}
+
+// loadPageComments returns the unresolved comment threads of a page and their counts.
+func loadPageComments(page models.Page) (*api.PageCommentsResp, error) {
+	threads, err := comments.List(database.DB, page.ID, false)
+	if err != nil {
+		return nil, err
+	}
+	summary, err := comments.Summarize(database.DB, page.ID)
+	if err != nil {
+		return nil, err
+	}
+	return &api.PageCommentsResp{
+		Threads:             toCommentThreadsResp(threads),
+		Unresolved:          summary.Unresolved,
+		UnresolvedByElement: summary.ByElement,
+	}, nil
+}
+
+// CommentCreate is the handler for POST /comment-create.
+// Comments on a page or one of its elements, or replies to a thread. The page must be owned by or shared with the user.
+// Returns 200 on success, 400 on bad request, 401 on unauthorized, 404 on not found, 500 on error.
+func CommentCreate(c *gin.Context) {
+	var request api.CommentCreateRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "details": err.Error()})
+		return
+	}
+	body, err := comments.NormalizeBody(request.Body)
+	if err != nil {
+		respondCommentError(c, err, "create comment")
+		return
+	}
+
+	page, _, err := auth.AuthorizePage(c, request.PageUUID, auth.AccessShared)
+	if err != nil {
+		// Pages the user may only read are not found, like pages they may not see
+		c.JSON(http.StatusNotFound, gin.H{"error": "Page not found"})
+		return
+	}
+
+	comment, err := comments.Create(database.DB, page, auth.MustCurrentUserID(c), request.ElementUUID, request.ParentID, body)
+	if err != nil {
+		respondCommentError(c, err, "create comment")
+		return
+	}
+	if err := notifications.CommentCreated(database.DB, page, comment); err != nil {
+		// Not critical, the comment is created
+		fmt.Printf("Failed to notify comment %d: %s\n", comment.ID, err)
+	}
+
+	c.JSON(http.StatusOK, api.CommentCreateResp{Comment: toCommentResp(comments.Entry{Comment: comment, Author: currentAuthor(c)})})
+}
+
+// CommentUpdate is the handler for POST /comment-update.
+// Edits a comment written by the user.
+// Returns 200 on success, 400 on bad request, 401 on unauthorized, 403 on forbidden, 404 on not found, 500 on error.
+func CommentUpdate(c *gin.Context) {
+	var request api.CommentUpdateRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "details": err.Error()})
+		return
+	}
+	body, err := comments.NormalizeBody(request.Body)
+	if err != nil {
+		respondCommentError(c, err, "update comment")
+		return
+	}
+
+	comment, page, _, ok := authorizeComment(c, request.CommentID)
+	if !ok {
+		return
+	}
+	previousBody := comment.Body
+	if comment, err = comments.Update(database.DB, comment, auth.MustCurrentUserID(c), body); err != nil {
+		respondCommentError(c, err, "update comment")
+		return
+	}
+	if err := notifications.CommentEdited(database.DB, page, comment, previousBody); err != nil {
+		// Not critical, the comment is updated
+		fmt.Printf("Failed to notify comment %d: %s\n", comment.ID, err)
+	}
+
+	c.JSON(http.StatusOK, api.CommentUpdateResp{Comment: toCommentResp(comments.Entry{Comment: comment, Author: currentAuthor(c)})})
+}
+
+// CommentResolve is the handler for POST /comment-resolve.
+// Resolves or reopens the thread of a comment, anyone who may comment on the page may.
+// Returns 200 on success, 400 on bad request, 401 on unauthorized, 404 on not found, 500 on error.
+func CommentResolve(c *gin.Context) {
+	var request api.CommentResolveRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "details": err.Error()})
+		return
+	}
+
+	comment, _, _, ok := authorizeComment(c, request.CommentID)
+	if !ok {
+		return
+	}
+	thread, err := comments.Resolve(database.DB, comment, auth.MustCurrentUserID(c), request.Resolved)
+	if err != nil {
+		respondCommentError(c, err, "resolve comment")
+		return
+	}
+
+	var author models.User
+	database.DB.First(&author, "id = ?", thread.UserID)
+	c.JSON(http.StatusOK, api.CommentResolveResp{Comment: toCommentResp(comments.Entry{
+		Comment: thread,
+		Author:  comments.Author{ID: author.ID, Name: author.Name, Picture: author.Picture},
+	})})
+}
+
+// CommentDelete is the handler for POST /comment-delete.
+// Deletes a comment, with its replies if it starts a thread. Only its author and the page owner may.
+// Returns 200 on success, 400 on bad request, 401 on unauthorized, 403 on forbidden, 404 on not found, 500 on error.
+func CommentDelete(c *gin.Context) {
+	var request api.CommentDeleteRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "details": err.Error()})
+		return
+	}
+
+	comment, _, access, ok := authorizeComment(c, request.CommentID)
+	if !ok {
+		return
+	}
+	if err := comments.Delete(database.DB, comment, auth.MustCurrentUserID(c), access == auth.AccessOwner); err != nil {
+		respondCommentError(c, err, "delete comment")
+		return
+	}
+
+	c.JSON(http.StatusOK, api.CommentDeleteResp{})
+}
+
+// CommentList is the handler for GET /comment-list/:page_uuid.
+// Returns the comment threads of a page owned by or shared with the user, resolved threads only if include_resolved is true.
+// Returns 200 on success, 400 on bad request, 401 on unauthorized, 404 on not found, 500 on error.
+func CommentList(c *gin.Context) {
+	var request api.CommentListRequest
+	if err := c.ShouldBindQuery(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "details": err.Error()})
+		return
+	}
+
+	page, _, err := auth.AuthorizePage(c, c.Param("page_uuid"), auth.AccessShared)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Page not found"})
+		return
+	}
+
+	threads, err := comments.List(database.DB, page.ID, request.IncludeResolved)
+	if err != nil {
+		respondCommentError(c, err, "list comments")
+		return
+	}
+
+	c.JSON(http.StatusOK, api.CommentListResp{Threads: toCommentThreadsResp(threads)})
+}
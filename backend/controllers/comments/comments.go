@@ -0,0 +1,210 @@
+package comments
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/opalescencelabs/backend/models"
+	"gorm.io/gorm"
+)
+
+// MaxBodyLength bounds the length of a comment, in characters.
+const MaxBodyLength = 10000
+
+var (
+	// ErrInvalidBody is returned for comments that are empty or too long.
+	ErrInvalidBody = errors.New("comment must be 1 to 10000 characters")
+	// ErrNotFound is returned when a comment, or the element or thread commented on, doesn't exist.
+	ErrNotFound = errors.New("comment not found")
+	// ErrForbidden is returned when the user may not modify the comment.
+	ErrForbidden = errors.New("comment forbidden")
+)
+
+// Author is the user who wrote a comment.
+type Author struct {
+	ID      uint
+	Name    string
+	Picture string
+}
+
+// Entry is a comment with its author.
+type Entry struct {
+	models.Comment
+	Author Author
+}
+
+// Thread is a top-level comment and its replies, oldest first.
+type Thread struct {
+	Entry
+	Replies []Entry
+}
+
+// Summary counts the unresolved threads of a page.
+type Summary struct {
+	Unresolved int64
+	// ByElement counts the unresolved threads on each element, threads on the page itself are only in Unresolved
+	ByElement map[string]int64
+}
+
+// NormalizeBody trims the body and checks its length.
+func NormalizeBody(body string) (string, error) {
+	body = strings.TrimSpace(body)
+	if body == "" || len([]rune(body)) > MaxBodyLength {
+		return "", ErrInvalidBody
+	}
+	return body, nil
+}
+
+// Get returns a comment that hasn't been deleted.
+func Get(db *gorm.DB, commentID uint) (models.Comment, error) {
+	var comment models.Comment
+	if err := db.First(&comment, "id = ?", commentID).Error; err != nil {
+		return models.Comment{}, ErrNotFound
+	}
+	return comment, nil
+}
+
+// Create adds a comment to a page, on one of its elements if elementUUID isn't empty,
+// or a reply to the thread of parentID if it isn't nil. Replies are on the element of their thread.
+// Returns ErrNotFound if the element or thread isn't on the page.
+func Create(db *gorm.DB, page models.Page, userID uint, elementUUID string, parentID *uint, body string) (models.Comment, error) {
+	comment := models.Comment{PageID: page.ID, UserID: userID, ElementUUID: elementUUID, Body: body}
+	if parentID != nil {
+		parent, err := Get(db, *parentID)
+		if err != nil || parent.PageID != page.ID {
+			return models.Comment{}, ErrNotFound
+		}
+		// Replies to replies belong to the same thread
+		if parent.ParentID != nil {
+			parentID = parent.ParentID
+		}
+		comment.ParentID = parentID
+		comment.ElementUUID = parent.ElementUUID
+	} else if elementUUID != "" {
+		var count int64
+		if err := db.Model(&models.Element{}).Where("element_uuid = ? AND page_id = ?", elementUUID, page.ID).Count(&count).Error; err != nil {
+			return models.Comment{}, err
+		}
+		if count == 0 {
+			return models.Comment{}, ErrNotFound
+		}
+	}
+
+	if err := db.Omit("id").Create(&comment).Error; err != nil {
+		return models.Comment{}, err
+	}
+	return comment, nil
+}
+
+// Update edits the body of a comment, only its author may.
+func Update(db *gorm.DB, comment models.Comment, userID uint, body string) (models.Comment, error) {
+	if comment.UserID != userID {
+		return models.Comment{}, ErrForbidden
+	}
+	now := time.Now()
+	comment.Body, comment.EditedAt = body, &now
+	if err := db.Model(&comment).Updates(map[string]interface{}{"body": body, "edited_at": now}).Error; err != nil {
+		return models.Comment{}, err
+	}
+	return comment, nil
+}
+
+// Resolve resolves or reopens the thread of a comment.
+// Returns the top-level comment of the thread.
+func Resolve(db *gorm.DB, comment models.Comment, userID uint, resolved bool) (models.Comment, error) {
+	if comment.ParentID != nil {
+		var err error
+		if comment, err = Get(db, *comment.ParentID); err != nil {
+			return models.Comment{}, err
+		}
+	}
+
+	updates := map[string]interface{}{"resolved_at": nil, "resolved_by_id": nil}
+	comment.ResolvedAt, comment.ResolvedByID = nil, nil
+	if resolved {
+		now := time.Now()
+		updates["resolved_at"], updates["resolved_by_id"] = now, userID
+		comment.ResolvedAt, comment.ResolvedByID = &now, &userID
+	}
+	if err := db.Model(&comment).Updates(updates).Error; err != nil {
+		return models.Comment{}, err
+	}
+	return comment, nil
+}
+
+// Delete deletes a comment, and its replies if it is a top-level comment.
+// Only its author and the owner of the page may.
+func Delete(db *gorm.DB, comment models.Comment, userID uint, isPageOwner bool) error {
+	if comment.UserID != userID && !isPageOwner {
+		return ErrForbidden
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		// Notifications of the deleted comments would lead nowhere
+		if err := tx.Where("comment_id IN (SELECT id FROM comments WHERE id = ? OR parent_id = ?)", comment.ID, comment.ID).
+			Delete(&models.Notification{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("id = ? OR parent_id = ?", comment.ID, comment.ID).Delete(&models.Comment{}).Error
+	})
+}
+
+// List returns the threads of a page, oldest first. Resolved threads are left out unless includeResolved is true.
+// Threads on elements since deleted are listed too, with the UUID of the deleted element.
+func List(db *gorm.DB, pageID uint, includeResolved bool) ([]Thread, error) {
+	query := db.Model(&models.Comment{}).
+		Select("comments.*, users.id AS author_id, users.name AS author_name, users.picture AS author_picture").
+		Joins("LEFT JOIN users ON users.id = comments.user_id").
+		Where("comments.page_id = ?", pageID).
+		Order("comments.created_at, comments.id")
+	if !includeResolved {
+		query = query.Where("comments.parent_id IS NOT NULL OR comments.resolved_at IS NULL")
+	}
+	var rows []struct {
+		models.Comment
+		AuthorID      uint
+		AuthorName    string
+		AuthorPicture string
+	}
+	if err := query.Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	threads := []Thread{}
+	positions := make(map[uint]int)
+	for _, row := range rows {
+		entry := Entry{Comment: row.Comment, Author: Author{ID: row.AuthorID, Name: row.AuthorName, Picture: row.AuthorPicture}}
+		if row.ParentID == nil {
+			positions[row.ID] = len(threads)
+			threads = append(threads, Thread{Entry: entry, Replies: []Entry{}})
+		} else if i, ok := positions[*row.ParentID]; ok {
+			// Replies to resolved threads are left out with their thread
+			threads[i].Replies = append(threads[i].Replies, entry)
+		}
+	}
+	return threads, nil
+}
+
+// Summarize counts the unresolved threads of a page.
+func Summarize(db *gorm.DB, pageID uint) (Summary, error) {
+	var rows []struct {
+		ElementUUID string
+		Threads     int64
+	}
+	if err := db.Model(&models.Comment{}).
+		Select("element_uuid, COUNT(*) AS threads").
+		Where("page_id = ? AND parent_id IS NULL AND resolved_at IS NULL", pageID).
+		Group("element_uuid").
+		Scan(&rows).Error; err != nil {
+		return Summary{}, err
+	}
+
+	summary := Summary{ByElement: make(map[string]int64)}
+	for _, row := range rows {
+		summary.Unresolved += row.Threads
+		if row.ElementUUID != "" {
+			summary.ByElement[row.ElementUUID] = row.Threads
+		}
+	}
+	return summary, nil
+}
@@ -0,0 +1,31 @@
+package comments
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestNormalizeBody(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		want    string
+		wantErr error
+	}{
+		{"plain", "Looks good", "Looks good", nil},
+		{"trimmed", "  \n Looks good \t", "Looks good", nil},
+		{"empty", "", "", ErrInvalidBody},
+		{"whitespace only", " \n\t ", "", ErrInvalidBody},
+		{"at most the limit in characters", strings.Repeat("é", MaxBodyLength), strings.Repeat("é", MaxBodyLength), nil},
+		{"over the limit", strings.Repeat("a", MaxBodyLength+1), "", ErrInvalidBody},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := NormalizeBody(tc.body)
+			if got != tc.want || !errors.Is(err, tc.wantErr) {
+				t.Errorf("NormalizeBody() = %q, %v, want %q, %v", got, err, tc.want, tc.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,284 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/gin-contrib/cors"
+	"github.com/gin-gonic/gin"
+	"github.com/opalescencelabs/backend/api"
+	"github.com/opalescencelabs/backend/controllers/audit"
+	"github.com/opalescencelabs/backend/controllers/auth"
+	"github.com/opalescencelabs/backend/controllers/domains"
+	"github.com/opalescencelabs/backend/database"
+	"github.com/opalescencelabs/backend/models"
+	"gorm.io/gorm"
+)
+
+// respondDomainError writes the response for an error returned by the domains package.
+func respondDomainError(c *gin.Context, err error, action string) {
+	switch {
+	case errors.Is(err, domains.ErrInvalidHostname), errors.Is(err, domains.ErrReservedHostname), errors.Is(err, domains.ErrNotRootPage):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, domains.ErrTooManyDomains):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, domains.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Domain not found"})
+	case errors.Is(err, domains.ErrHostnameTaken), errors.Is(err, domains.ErrNotVerified):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, domains.ErrLookupFailed):
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+	default:
+		fmt.Printf("Failed to %s: %s\n", action, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to " + action})
+	}
+}
+
+// toCustomDomainResp converts a domain of the page with the given UUID to its response, with its verification record.
+func toCustomDomainResp(domain models.CustomDomain, pageUUID string) api.CustomDomainResp {
+	return api.CustomDomainResp{
+		ID:          domain.ID,
+		PageUUID:    pageUUID,
+		Hostname:    domain.Hostname,
+		RecordName:  domains.RecordName(domain),
+		RecordValue: domains.RecordValue(domain),
+		Verified:    domain.VerifiedAt != nil,
+		VerifiedAt:  domain.VerifiedAt,
+		CreatedAt:   domain.CreatedAt,
+	}
+}
+
+// domainPageUUID returns the UUID of the root page of a domain.
+func domainPageUUID(db *gorm.DB, domain models.CustomDomain) (string, error) {
+	var page models.Page
+	if err := db.Select("page_uuid").First(&page, "id = ?", domain.PageID).Error; err != nil {
+		return "", err
+	}
+	return page.PageUUID, nil
+}
+
+// refreshDomains reloads the verified hostnames after a change, so this instance routes them right away.
+func refreshDomains() {
+	if err := domains.Refresh(database.DB); err != nil {
+		// Not critical, the hostnames are refreshed periodically
+		fmt.Println("Failed to refresh custom domains: ", err)
+	}
+}
+
+// DomainCreate is the handler for POST /domain-create.
+// Attaches a hostname to a public root page owned by the current user. The domain is served once verified,
+// the response holds the TXT record to create to prove its ownership, see DomainVerify.
+// Returns 200 on success, 400 on bad request, 401 on unauthorized, 403 on forbidden or too many domains,
+// 404 on not found, 409 if the hostname is verified or already claimed by the user, 500 on error.
+func DomainCreate(c *gin.Context) {
+	var request api.DomainCreateRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "details": err.Error()})
+		return
+	}
+
+	page, _, err := auth.AuthorizePage(c, request.PageUUID, auth.AccessOwner)
+	if err != nil {
+		respondAccessError(c, err)
+		return
+	}
+
+	var domain models.CustomDomain
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if domain, err = domains.Create(tx, page, auth.MustCurrentUserID(c), request.Hostname); err != nil {
+			return err
+		}
+		return audit.Record(tx, audit.FromRequest(c, audit.ActionPageDomainAdded, audit.TargetPage, page.PageUUID,
+			map[string]interface{}{"domain_id": domain.ID, "hostname": domain.Hostname}))
+	})
+	if err != nil {
+		respondDomainError(c, err, "create domain")
+		return
+	}
+
+	c.JSON(http.StatusOK, api.DomainCreateResp{Domain: toCustomDomainResp(domain, page.PageUUID)})
+}
+
+// DomainVerify is the handler for POST /domain-verify.
+// Looks up the TXT record of a domain of the current user and marks the domain verified if it holds its token,
+// after which the page tree of its root page is served at the hostname. Other users' claims of the hostname are deleted.
+// Returns 200 on success, 400 on bad request, 401 on unauthorized, 404 on not found,
+// 409 if the record is missing or another claim was verified first, 502 if the record can't be looked up, 500 on error.
+func DomainVerify(c *gin.Context) {
+	var request api.DomainVerifyRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "details": err.Error()})
+		return
+	}
+
+	domain, err := domains.Get(database.DB, auth.MustCurrentUserID(c), request.DomainID)
+	if err != nil {
+		respondDomainError(c, err, "verify domain")
+		return
+	}
+	pageUUID, err := domainPageUUID(database.DB, domain)
+	if err != nil {
+		respondDomainError(c, err, "verify domain")
+		return
+	}
+
+	wasVerified := domain.VerifiedAt != nil
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if domain, err = domains.Verify(c, tx, domains.Default, domain); err != nil || wasVerified {
+			return err
+		}
+		return audit.Record(tx, audit.FromRequest(c, audit.ActionPageDomainVerified, audit.TargetPage, pageUUID,
+			map[string]interface{}{"domain_id": domain.ID, "hostname": domain.Hostname}))
+	})
+	if err != nil {
+		respondDomainError(c, err, "verify domain")
+		return
+	}
+	refreshDomains()
+
+	c.JSON(http.StatusOK, api.DomainVerifyResp{Domain: toCustomDomainResp(domain, pageUUID)})
+}
+
+// DomainDelete is the handler for POST /domain-delete.
+// Detaches a domain of the current user from its page, which is no longer served at the hostname.
+// Returns 200 on success, 400 on bad request, 401 on unauthorized, 404 on not found, 500 on error.
+func DomainDelete(c *gin.Context) {
+	var request api.DomainDeleteRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "details": err.Error()})
+		return
+	}
+
+	domain, err := domains.Get(database.DB, auth.MustCurrentUserID(c), request.DomainID)
+	if err != nil {
+		respondDomainError(c, err, "delete domain")
+		return
+	}
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		pageUUID, err := domainPageUUID(tx, domain)
+		if err != nil {
+			return err
+		}
+		if err := domains.Delete(tx, domain); err != nil {
+			return err
+		}
+		return audit.Record(tx, audit.FromRequest(c, audit.ActionPageDomainRemoved, audit.TargetPage, pageUUID,
+			map[string]interface{}{"domain_id": domain.ID, "hostname": domain.Hostname}))
+	})
+	if err != nil {
+		respondDomainError(c, err, "delete domain")
+		return
+	}
+	refreshDomains()
+
+	c.JSON(http.StatusOK, api.DomainDeleteResp{})
+}
+
+// DomainList is the handler for GET /domain-list.
+// Returns the domains of the current user with their verification records, by hostname.
+// Returns 200 on success, 401 on unauthorized, 500 on error.
+func DomainList(c *gin.Context) {
+	list, err := domains.List(database.DB, auth.MustCurrentUserID(c))
+	if err != nil {
+		respondDomainError(c, err, "list domains")
+		return
+	}
+
+	pageIDs := make([]uint, len(list))
+	for i, domain := range list {
+		pageIDs[i] = domain.PageID
+	}
+	var pages []models.Page
+	if err := database.DB.Select("id", "page_uuid").Where("id IN ?", pageIDs).Find(&pages).Error; err != nil {
+		respondDomainError(c, err, "list domains")
+		return
+	}
+	pageUUIDs := make(map[uint]string, len(pages))
+	for _, page := range pages {
+		pageUUIDs[page.ID] = page.PageUUID
+	}
+
+	resp := api.DomainListResp{Domains: make([]api.CustomDomainResp, len(list))}
+	for i, domain := range list {
+		resp.Domains[i] = toCustomDomainResp(domain, pageUUIDs[domain.PageID])
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// CustomDomainRouter routes the requests for verified custom domains, by their Host header, to the page tree of
+// their root page: "/" serves the root page and slug paths its public sub-pages, see domains.Resolve.
+// Pages are served as PageGet serves them to visitors. Requests for other hosts continue to the routes.
+// Returns 200 on success, 404 on not found, 405 on methods other than GET and HEAD, 500 on error.
+func CustomDomainRouter() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		hostname := domains.HostOf(c.Request.Host)
+		if !domains.IsVerified(hostname) {
+			c.Next()
+			return
+		}
+		c.Abort()
+
+		if c.Request.Method != http.MethodGet && c.Request.Method != http.MethodHead {
+			c.JSON(http.StatusMethodNotAllowed, gin.H{"error": "Method not allowed"})
+			return
+		}
+		domain, err := domains.Lookup(database.DB, hostname)
+		if errors.Is(err, domains.ErrNotFound) {
+			// Deleted since the hostnames were refreshed
+			c.JSON(http.StatusNotFound, gin.H{"error": "Domain not found"})
+			return
+		}
+		if err != nil {
+			fmt.Printf("Failed to look up domain %s: %s\n", hostname, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch page"})
+			return
+		}
+		page, err := domains.Resolve(database.DB, domain, c.Request.URL.Path)
+		if errors.Is(err, domains.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Page not found"})
+			return
+		}
+		if err != nil {
+			fmt.Printf("Failed to resolve %s%s: %s\n", hostname, c.Request.URL.Path, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch page"})
+			return
+		}
+
+		servePage(c, page, auth.AccessPublic)
+	}
+}
+
+// isPublicPageRoute returns true for the public routes serving pages, which pages on custom domains may call.
+func isPublicPageRoute(path string) bool {
+	return strings.HasPrefix(path, "/page-get/") || path == "/page-search-public"
+}
+
+// CORS returns the CORS middleware. The given origins, the frontend and the app, may call every route with the
+// user's session. Pages served on verified custom domains may only call the public page routes, without credentials,
+// so they can't act on behalf of visitors logged into the app. Requests from other origins are rejected with 403.
+func CORS(origins ...string) gin.HandlerFunc {
+	config := cors.DefaultConfig()
+	config.AllowOriginFunc = func(origin string) bool { return slices.Contains(origins, origin) }
+	config.AllowCredentials = true
+	config.AllowHeaders = append(config.AllowHeaders, "Authorization")
+	credentialed := cors.New(config)
+
+	publicConfig := cors.DefaultConfig()
+	publicConfig.AllowOriginFunc = domains.IsVerifiedOrigin
+	publicConfig.AllowMethods = []string{http.MethodGet, http.MethodHead}
+	public := cors.New(publicConfig)
+
+	return func(c *gin.Context) {
+		origin := c.GetHeader("Origin")
+		if origin != "" && !slices.Contains(origins, origin) && isPublicPageRoute(c.Request.URL.Path) {
+			public(c)
+			return
+		}
+		credentialed(c)
+	}
+}
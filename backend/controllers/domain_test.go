@@ -0,0 +1,78 @@
+package controllers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestIsPublicPageRoute(t *testing.T) {
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"/page-get/1234", true},
+		{"/page-search-public", true},
+		{"/page-search", false},
+		{"/page-get", false},
+		{"/page-update", false},
+		{"/user-get", false},
+	}
+	for _, tc := range tests {
+		if got := isPublicPageRoute(tc.path); got != tc.want {
+			t.Errorf("isPublicPageRoute(%q) = %v, want %v", tc.path, got, tc.want)
+		}
+	}
+}
+
+func TestCORS(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	const frontend = "https://opalescence.example"
+	r := gin.New()
+	r.Use(CORS(frontend, "https://api.opalescence.example"))
+	r.GET("/page-get/:page_uuid", func(c *gin.Context) { c.Status(http.StatusOK) })
+	r.GET("/user-get", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	tests := []struct {
+		name            string
+		method          string
+		path            string
+		origin          string
+		wantStatus      int
+		wantOrigin      string
+		wantCredentials string
+	}{
+		{"frontend", http.MethodGet, "/user-get", frontend, http.StatusOK, frontend, "true"},
+		{"frontend on a public route", http.MethodGet, "/page-get/1234", frontend, http.StatusOK, frontend, "true"},
+		{"frontend preflight", http.MethodOptions, "/user-get", frontend, http.StatusNoContent, frontend, "true"},
+		{"without origin", http.MethodGet, "/user-get", "", http.StatusOK, "", ""},
+		// Custom domains that aren't verified are rejected like any other origin
+		{"other origin", http.MethodGet, "/user-get", "https://docs.example.com", http.StatusForbidden, "", ""},
+		{"other origin on a public route", http.MethodGet, "/page-get/1234", "https://docs.example.com", http.StatusForbidden, "", ""},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, tc.path, nil)
+			if tc.origin != "" {
+				req.Header.Set("Origin", tc.origin)
+			}
+			if tc.method == http.MethodOptions {
+				req.Header.Set("Access-Control-Request-Method", http.MethodGet)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if w.Code != tc.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tc.wantStatus)
+			}
+			if got := w.Header().Get("Access-Control-Allow-Origin"); got != tc.wantOrigin {
+				t.Errorf("Access-Control-Allow-Origin = %q, want %q", got, tc.wantOrigin)
+			}
+			if got := w.Header().Get("Access-Control-Allow-Credentials"); got != tc.wantCredentials {
+				t.Errorf("Access-Control-Allow-Credentials = %q, want %q", got, tc.wantCredentials)
+			}
+		})
+	}
+}
@@ -0,0 +1,245 @@
+package domains
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/opalescencelabs/backend/controllers/auth"
+	"github.com/opalescencelabs/backend/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// MaxDomains bounds the number of custom domains of a user.
+const MaxDomains = 10
+
+// maxDepth bounds the number of slugs in the path of a page served on a custom domain.
+const maxDepth = 32
+
+// Prefixes of the name and value of the TXT record proving the ownership of a domain.
+const (
+	recordPrefix = "_opalescence-verification."
+	valuePrefix  = "opalescence-verification="
+)
+
+var (
+	// ErrInvalidHostname is returned for hostnames that aren't domain names, e.g. IP addresses or hostnames with a port.
+	ErrInvalidHostname = errors.New("hostname must be a domain name, e.g. docs.example.com")
+	// ErrReservedHostname is returned for the hostnames of the app itself.
+	ErrReservedHostname = errors.New("hostname is reserved")
+	// ErrHostnameTaken is returned for hostnames of verified domains, and hostnames the user already claimed.
+	ErrHostnameTaken = errors.New("hostname already in use")
+	// ErrNotRootPage is returned when attaching a domain to a sub-page or a private page.
+	ErrNotRootPage = errors.New("custom domains can only be attached to public root pages")
+	// ErrTooManyDomains is returned when the user already has MaxDomains domains.
+	ErrTooManyDomains = errors.New("at most 10 custom domains per user")
+	// ErrNotFound is returned for domains that don't exist or belong to another user, and for paths matching no page.
+	ErrNotFound = errors.New("domain not found")
+	// ErrNotVerified is returned when the TXT record of a domain is missing or holds another token.
+	ErrNotVerified = errors.New("verification record not found")
+	// ErrLookupFailed is returned when the TXT record of a domain can't be looked up, e.g. on DNS timeouts.
+	ErrLookupFailed = errors.New("failed to look up verification record")
+)
+
+// hostnamePattern matches lowercase domain names of at least two labels, the last one alphabetic.
+var hostnamePattern = regexp.MustCompile(`^([a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?\.)+[a-z]{2,63}$`)
+
+// NormalizeHostname returns a hostname lowercased and without its trailing dot, or an error if it isn't a domain name.
+func NormalizeHostname(hostname string) (string, error) {
+	hostname = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(hostname)), ".")
+	if len(hostname) > 253 || !hostnamePattern.MatchString(hostname) {
+		return "", ErrInvalidHostname
+	}
+	for _, appURL := range []string{auth.GetDomain(), auth.GetFrontendURL()} {
+		if parsed, err := url.Parse(appURL); err == nil && parsed.Hostname() == hostname {
+			return "", ErrReservedHostname
+		}
+	}
+	return hostname, nil
+}
+
+// HostOf returns the hostname of a Host header, without its port.
+func HostOf(host string) string {
+	if hostname, _, err := net.SplitHostPort(host); err == nil {
+		host = hostname
+	}
+	return strings.TrimSuffix(strings.ToLower(host), ".")
+}
+
+// RecordName returns the name of the TXT record proving the ownership of a domain.
+func RecordName(domain models.CustomDomain) string {
+	return recordPrefix + domain.Hostname
+}
+
+// RecordValue returns the value of the TXT record proving the ownership of a domain.
+func RecordValue(domain models.CustomDomain) string {
+	return valuePrefix + domain.VerificationToken
+}
+
+// Create attaches a hostname to a public root page of the user, unverified until its TXT record is found.
+// A hostname may be claimed by several users until one of them verifies it.
+func Create(db *gorm.DB, page models.Page, userID uint, hostname string) (models.CustomDomain, error) {
+	hostname, err := NormalizeHostname(hostname)
+	if err != nil {
+		return models.CustomDomain{}, err
+	}
+	if !page.IsRoot || page.ParentPageUUID != "" || !page.PublicPage {
+		return models.CustomDomain{}, ErrNotRootPage
+	}
+	// Unverified claims of other users don't block the hostname, the first verified claim takes it over, see Verify
+	var count int64
+	if err := db.Model(&models.CustomDomain{}).Where("hostname = ? AND (verified_at IS NOT NULL OR user_id = ?)", hostname, userID).
+		Count(&count).Error; err != nil {
+		return models.CustomDomain{}, err
+	}
+	if count > 0 {
+		return models.CustomDomain{}, ErrHostnameTaken
+	}
+	if err := db.Model(&models.CustomDomain{}).Where("user_id = ?", userID).Count(&count).Error; err != nil {
+		return models.CustomDomain{}, err
+	}
+	if count >= MaxDomains {
+		return models.CustomDomain{}, ErrTooManyDomains
+	}
+
+	token := make([]byte, 16)
+	if _, err := rand.Read(token); err != nil {
+		return models.CustomDomain{}, err
+	}
+	domain := models.CustomDomain{UserID: userID, PageID: page.ID, Hostname: hostname, VerificationToken: hex.EncodeToString(token)}
+	if err := db.Omit("id").Create(&domain).Error; err != nil {
+		return models.CustomDomain{}, err
+	}
+	return domain, nil
+}
+
+// Get returns a domain of the user.
+func Get(db *gorm.DB, userID uint, domainID uint) (models.CustomDomain, error) {
+	var domain models.CustomDomain
+	if err := db.Where("id = ? AND user_id = ?", domainID, userID).First(&domain).Error; err != nil {
+		return models.CustomDomain{}, ErrNotFound
+	}
+	return domain, nil
+}
+
+// List returns the domains of the user, by hostname.
+func List(db *gorm.DB, userID uint) ([]models.CustomDomain, error) {
+	var domains []models.CustomDomain
+	err := db.Where("user_id = ?", userID).Order("hostname").Find(&domains).Error
+	return domains, err
+}
+
+// Verify looks up the TXT record of a domain and marks it verified if it holds its token. The unverified claims of
+// the hostname by other users are deleted, and ErrHostnameTaken is returned if another claim was verified first.
+// Must be called with a transaction. Verified domains are served once the hostnames are refreshed, see Refresh.
+func Verify(ctx context.Context, tx *gorm.DB, resolver Resolver, domain models.CustomDomain) (models.CustomDomain, error) {
+	records, err := resolver.LookupTXT(ctx, RecordName(domain))
+	if err != nil {
+		return models.CustomDomain{}, fmt.Errorf("%w %s: %s", ErrLookupFailed, RecordName(domain), err)
+	}
+	found := false
+	for _, record := range records {
+		found = found || strings.TrimSpace(record) == RecordValue(domain)
+	}
+	if !found {
+		return models.CustomDomain{}, ErrNotVerified
+	}
+	if domain.VerifiedAt != nil {
+		return domain, nil
+	}
+
+	// Lock the claims of the hostname, so that concurrent verifications of competing claims take turns
+	var claims []models.CustomDomain
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("hostname = ?", domain.Hostname).Find(&claims).Error; err != nil {
+		return models.CustomDomain{}, err
+	}
+	claimed := false
+	for _, claim := range claims {
+		if claim.ID == domain.ID {
+			claimed = true
+		} else if claim.VerifiedAt != nil {
+			return models.CustomDomain{}, ErrHostnameTaken
+		}
+	}
+	if !claimed {
+		// Deleted by the verification of a competing claim
+		return models.CustomDomain{}, ErrNotFound
+	}
+
+	now := time.Now()
+	if err := tx.Model(&domain).Update("verified_at", now).Error; err != nil {
+		return models.CustomDomain{}, err
+	}
+	if err := tx.Where("hostname = ? AND id <> ? AND verified_at IS NULL", domain.Hostname, domain.ID).
+		Delete(&models.CustomDomain{}).Error; err != nil {
+		return models.CustomDomain{}, err
+	}
+	domain.VerifiedAt = &now
+	return domain, nil
+}
+
+// Delete detaches a domain from its page.
+func Delete(db *gorm.DB, domain models.CustomDomain) error {
+	return db.Delete(&models.CustomDomain{}, domain.ID).Error
+}
+
+// DeletePages detaches the domains of the pages, e.g. when they are transferred to another user.
+func DeletePages(tx *gorm.DB, pageUUIDs []string) error {
+	return tx.Where("page_id IN (SELECT id FROM pages WHERE page_uuid IN ?)", pageUUIDs).Delete(&models.CustomDomain{}).Error
+}
+
+// Lookup returns the verified domain with the hostname.
+func Lookup(db *gorm.DB, hostname string) (models.CustomDomain, error) {
+	var domain models.CustomDomain
+	result := db.Where("hostname = ? AND verified_at IS NOT NULL", hostname).Limit(1).Find(&domain)
+	if result.Error != nil {
+		return models.CustomDomain{}, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return models.CustomDomain{}, ErrNotFound
+	}
+	return domain, nil
+}
+
+// Resolve returns the page served at a path of a domain: the root page for "/", and the public sub-pages below it
+// by slug, e.g. "/guides/install" is the sub-page "install" of the sub-page "guides" of the root page.
+// Pages are only served while they are public and owned by the owner of the domain.
+func Resolve(db *gorm.DB, domain models.CustomDomain, path string) (models.Page, error) {
+	var page models.Page
+	result := db.Where("id = ? AND user_id = ? AND public_page", domain.PageID, domain.UserID).Limit(1).Find(&page)
+	if result.Error != nil {
+		return models.Page{}, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return models.Page{}, ErrNotFound
+	}
+
+	var slugs []string
+	if path = strings.Trim(path, "/"); path != "" {
+		slugs = strings.Split(path, "/")
+	}
+	if len(slugs) > maxDepth {
+		return models.Page{}, ErrNotFound
+	}
+	for _, slug := range slugs {
+		var subPage models.Page
+		result := db.Where("parent_page_uuid = ? AND slug = ? AND user_id = ? AND public_page", page.PageUUID, slug, domain.UserID).
+			Limit(1).Find(&subPage)
+		if result.Error != nil {
+			return models.Page{}, result.Error
+		}
+		if result.RowsAffected == 0 {
+			return models.Page{}, ErrNotFound
+		}
+		page = subPage
+	}
+	return page, nil
+}
@@ -0,0 +1,79 @@
+package domains
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestNormalizeHostname(t *testing.T) {
+	t.Setenv("APP_ENV", "")
+	t.Setenv("DOMAIN", "https://api.opalescence.example")
+	t.Setenv("FRONTEND_URL", "https://opalescence.example")
+
+	tests := []struct {
+		name     string
+		hostname string
+		want     string
+		wantErr  error
+	}{
+		{"lowercased", "Docs.Example.COM", "docs.example.com", nil},
+		{"trimmed with trailing dot", "  docs.example.com. ", "docs.example.com", nil},
+		{"hyphens", "my-docs.example-site.com", "my-docs.example-site.com", nil},
+		{"single label", "localhost", "", ErrInvalidHostname},
+		{"port", "docs.example.com:8080", "", ErrInvalidHostname},
+		{"ip address", "127.0.0.1", "", ErrInvalidHostname},
+		{"leading hyphen", "-docs.example.com", "", ErrInvalidHostname},
+		{"scheme", "https://docs.example.com", "", ErrInvalidHostname},
+		{"empty", "", "", ErrInvalidHostname},
+		{"app", "api.opalescence.example", "", ErrReservedHostname},
+		{"frontend", "Opalescence.example", "", ErrReservedHostname},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := NormalizeHostname(tc.hostname)
+			if got != tc.want || !errors.Is(err, tc.wantErr) {
+				t.Errorf("NormalizeHostname(%q) = %q, %v, want %q, %v", tc.hostname, got, err, tc.want, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestHostOf(t *testing.T) {
+	tests := []struct {
+		host string
+		want string
+	}{
+		{"docs.example.com", "docs.example.com"},
+		{"Docs.Example.com:443", "docs.example.com"},
+		{"docs.example.com.", "docs.example.com"},
+		{"[::1]:8000", "::1"},
+	}
+	for _, tc := range tests {
+		if got := HostOf(tc.host); got != tc.want {
+			t.Errorf("HostOf(%q) = %q, want %q", tc.host, got, tc.want)
+		}
+	}
+}
+
+func TestIsVerifiedOrigin(t *testing.T) {
+	previous := verified.Load()
+	defer verified.Store(previous)
+	verified.Store(&map[string]bool{"docs.example.com": true})
+
+	tests := []struct {
+		origin string
+		want   bool
+	}{
+		{"https://docs.example.com", true},
+		{"http://docs.example.com", false},
+		{"https://other.example.com", false},
+		{"https://docs.example.com:8443", false},
+		{"docs.example.com", false},
+		{"", false},
+	}
+	for _, tc := range tests {
+		if got := IsVerifiedOrigin(tc.origin); got != tc.want {
+			t.Errorf("IsVerifiedOrigin(%q) = %v, want %v", tc.origin, got, tc.want)
+		}
+	}
+}
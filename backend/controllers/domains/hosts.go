@@ -0,0 +1,62 @@
+package domains
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/opalescencelabs/backend/models"
+	"gorm.io/gorm"
+)
+
+// verified holds the hostnames of the verified domains, so that requests for other hosts and CORS checks
+// don't query the database. Refreshed by Refresh.
+var verified atomic.Pointer[map[string]bool]
+
+// Refresh loads the hostnames of the verified domains.
+func Refresh(db *gorm.DB) error {
+	var hostnames []string
+	if err := db.Model(&models.CustomDomain{}).Where("verified_at IS NOT NULL").Pluck("hostname", &hostnames).Error; err != nil {
+		return err
+	}
+	hosts := make(map[string]bool, len(hostnames))
+	for _, hostname := range hostnames {
+		hosts[hostname] = true
+	}
+	verified.Store(&hosts)
+	return nil
+}
+
+// IsVerified returns true if the hostname is a verified domain, as of the last refresh.
+func IsVerified(hostname string) bool {
+	hosts := verified.Load()
+	return hosts != nil && (*hosts)[hostname]
+}
+
+// IsVerifiedOrigin returns true if the origin is a verified domain over HTTPS, whose pages may call the public
+// page routes, see controllers.CORS.
+func IsVerifiedOrigin(origin string) bool {
+	hostname, ok := strings.CutPrefix(origin, "https://")
+	return ok && IsVerified(hostname)
+}
+
+// RunRefresher refreshes the verified hostnames every interval until ctx is cancelled,
+// picking up the domains verified or deleted through other instances of the app.
+func RunRefresher(ctx context.Context, db *gorm.DB, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := Refresh(db.WithContext(ctx)); err != nil && ctx.Err() == nil {
+			fmt.Println("Failed to refresh custom domains: ", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package domains
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+)
+
+// Resolver looks up the TXT records proving the ownership of custom domains.
+type Resolver interface {
+	LookupTXT(ctx context.Context, name string) ([]string, error)
+}
+
+// Default is the resolver used by the app.
+var Default Resolver = NewDNS()
+
+// DNS is a Resolver querying the system's DNS resolver.
+type DNS struct {
+	resolver *net.Resolver
+	timeout  time.Duration
+}
+
+// NewDNS returns a Resolver querying the system's DNS resolver.
+func NewDNS() *DNS {
+	return &DNS{resolver: net.DefaultResolver, timeout: 5 * time.Second}
+}
+
+// LookupTXT returns the TXT records of name, none if it has no records.
+func (d *DNS) LookupTXT(ctx context.Context, name string) ([]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, d.timeout)
+	defer cancel()
+	records, err := d.resolver.LookupTXT(ctx, name)
+	if dnsErr, ok := err.(*net.DNSError); ok && dnsErr.IsNotFound {
+		return nil, nil
+	}
+	return records, err
+}
+
+// Fake is a Resolver answering with records set in memory, used to test verification without DNS.
+type Fake struct {
+	mu      sync.Mutex
+	records map[string][]string
+}
+
+// NewFake returns a Resolver without records.
+func NewFake() *Fake {
+	return &Fake{records: make(map[string][]string)}
+}
+
+// Set replaces the TXT records of name.
+func (f *Fake) Set(name string, records ...string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.records[name] = records
+}
+
+// LookupTXT returns the TXT records set for name.
+func (f *Fake) LookupTXT(ctx context.Context, name string) ([]string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.records[name], nil
+}
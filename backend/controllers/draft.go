@@ -0,0 +1,149 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/opalescencelabs/backend/api"
+	"github.com/opalescencelabs/backend/api/caching"
+	"github.com/opalescencelabs/backend/controllers/audit"
+	"github.com/opalescencelabs/backend/controllers/auth"
+	"github.com/opalescencelabs/backend/controllers/drafts"
+	"github.com/opalescencelabs/backend/controllers/links"
+	"github.com/opalescencelabs/backend/controllers/search"
+	"github.com/opalescencelabs/backend/database"
+	"github.com/opalescencelabs/backend/models"
+	"gorm.io/gorm"
+)
+
+// PagePublish is the handler for POST /page-publish.
+// Publishes the draft of a page owned by the current user: visitors of the page get its elements as they are now,
+// until the next publication. Private pages may be published before they are made public.
+// Returns 200 on success, 400 on bad request, 401 on unauthorized, 403 on forbidden, 404 on not found, 500 on error.
+func PagePublish(c *gin.Context) {
+	var request api.PagePublishRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "details": err.Error()})
+		return
+	}
+
+	page, _, err := auth.AuthorizePage(c, request.PageUUID, auth.AccessOwner)
+	if err != nil {
+		respondAccessError(c, err)
+		return
+	}
+
+	var snapshot models.PageSnapshot
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if snapshot, err = drafts.Publish(tx, page, auth.MustCurrentUserID(c)); err != nil {
+			return err
+		}
+		return audit.Record(tx, audit.FromRequest(c, audit.ActionPageDraftPublished, audit.TargetPage, page.PageUUID, nil))
+	})
+	if err != nil {
+		fmt.Println("Failed to publish page: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to publish page"})
+		return
+	}
+
+	// Visitors get the published version
+	caching.InvalidatePages(c, page.PageUUID)
+
+	c.JSON(http.StatusOK, api.PagePublishResp{PublishedAt: snapshot.PublishedAt})
+}
+
+// PageDiscardDraft is the handler for POST /page-discard-draft.
+// Restores the elements of a page owned by the current user to its published version, discarding the changes since.
+// Returns 200 on success, 400 on bad request, 401 on unauthorized, 403 on forbidden, 404 on not found,
+// 409 if the page was never published, 500 on error.
+func PageDiscardDraft(c *gin.Context) {
+	var request api.PageDiscardDraftRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "details": err.Error()})
+		return
+	}
+
+	page, _, err := auth.AuthorizePage(c, request.PageUUID, auth.AccessOwner)
+	if err != nil {
+		respondAccessError(c, err)
+		return
+	}
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := drafts.Discard(tx, page); err != nil {
+			return err
+		}
+		if err := tx.Model(&page).Update("last_updated_at", time.Now()).Error; err != nil {
+			return err
+		}
+		// Keep the search and link indexes up to date with the restored elements
+		if err := search.IndexPage(tx, page.PageUUID); err != nil {
+			return err
+		}
+		if err := links.IndexPage(tx, page.ID); err != nil {
+			return err
+		}
+		return audit.Record(tx, audit.FromRequest(c, audit.ActionPageDraftDiscarded, audit.TargetPage, page.PageUUID, nil))
+	})
+	if errors.Is(err, drafts.ErrNotPublished) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Page was never published"})
+		return
+	}
+	if err != nil {
+		fmt.Println("Failed to discard draft: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to discard draft"})
+		return
+	}
+
+	caching.InvalidatePages(c, page.PageUUID)
+
+	c.JSON(http.StatusOK, api.PageDiscardDraftResp{})
+}
+
+// PageDraftDiff is the handler for GET /page-draft-diff/:page_uuid.
+// Returns the elements of a page owned by the current user added, removed, changed and reordered since it was published.
+// Returns 200 on success, 401 on unauthorized, 403 on forbidden, 404 on not found, 500 on error.
+func PageDraftDiff(c *gin.Context) {
+	page, _, err := auth.AuthorizePage(c, c.Param("page_uuid"), auth.AccessOwner)
+	if err != nil {
+		respondAccessError(c, err)
+		return
+	}
+
+	draft, err := drafts.Elements(database.DB, page)
+	if err != nil {
+		fmt.Println("Failed to load draft: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load draft"})
+		return
+	}
+	snapshot, ok, err := drafts.Published(database.DB, page.ID)
+	published := []api.ElementsResponseObject{}
+	if err == nil && ok {
+		published, err = drafts.SnapshotElements(snapshot)
+	}
+	if err != nil {
+		fmt.Println("Failed to load published version: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load published version"})
+		return
+	}
+
+	diff := drafts.Compare(draft, published)
+	resp := api.PageDraftDiffResp{
+		HasChanges: !diff.Empty(),
+		Added:      diff.Added,
+		Removed:    diff.Removed,
+		Changed:    make([]api.ElementChangeResp, len(diff.Changed)),
+		Reordered:  diff.Reordered,
+	}
+	if ok {
+		resp.PublishedAt = &snapshot.PublishedAt
+	}
+	for i, change := range diff.Changed {
+		resp.Changed[i] = api.ElementChangeResp{ElementUUID: change.ElementUUID, Published: change.Published, Draft: change.Draft}
+	}
+	c.JSON(http.StatusOK, resp)
+}
@@ -0,0 +1,259 @@
+package drafts
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/jackc/pgtype"
+	"github.com/opalescencelabs/backend/api"
+	"github.com/opalescencelabs/backend/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrNotPublished is returned when discarding the draft of a page that was never published.
+var ErrNotPublished = errors.New("page has no published version")
+
+// decode returns the value of a JSONB column as a map, nil if it isn't present.
+func decode(value pgtype.JSONB) (map[string]interface{}, error) {
+	var decoded map[string]interface{}
+	if value.Status != pgtype.Present {
+		return nil, nil
+	}
+	err := json.Unmarshal(value.Bytes, &decoded)
+	return decoded, err
+}
+
+// encode returns a map as a JSONB column, null if the map is nil.
+func encode(value map[string]interface{}) (pgtype.JSONB, error) {
+	if value == nil {
+		return pgtype.JSONB{Status: pgtype.Null}, nil
+	}
+	bytes, err := json.Marshal(value)
+	return pgtype.JSONB{Bytes: bytes, Status: pgtype.Present}, err
+}
+
+// Elements returns the draft of a page: its elements as they are edited, in the order of its element positions.
+func Elements(db *gorm.DB, page models.Page) ([]api.ElementsResponseObject, error) {
+	var elementPositions []string
+	if page.ElementPositions.Status == pgtype.Present {
+		if err := json.Unmarshal(page.ElementPositions.Bytes, &elementPositions); err != nil {
+			return nil, fmt.Errorf("failed to process page data: %w", err)
+		}
+	}
+
+	var elements []models.Element
+	if err := db.Where("page_id = ?", page.ID).Find(&elements).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch elements for the page: %w", err)
+	}
+
+	// Sort the elements by their position in the elementPositions slice
+	positionMap := make(map[string]int)
+	for i, uuid := range elementPositions {
+		positionMap[uuid] = i
+	}
+	sort.Slice(elements, func(i, j int) bool {
+		return positionMap[elements[i].ElementUUID] < positionMap[elements[j].ElementUUID]
+	})
+
+	resp := make([]api.ElementsResponseObject, 0, len(elements))
+	for _, element := range elements {
+		content, err := decode(element.Content)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal element content: %w", err)
+		}
+		etc, err := decode(element.Etc)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal element etc: %w", err)
+		}
+		resp = append(resp, api.ElementsResponseObject{
+			ID:          element.ID,
+			ElementUUID: element.ElementUUID,
+			Type:        element.Type,
+			Content:     content,
+			Etc:         etc,
+			Size:        element.Size,
+		})
+	}
+	return resp, nil
+}
+
+// Published returns the published version of a page, false if it was never published.
+func Published(db *gorm.DB, pageID uint) (models.PageSnapshot, bool, error) {
+	var snapshot models.PageSnapshot
+	result := db.Where("page_id = ?", pageID).Limit(1).Find(&snapshot)
+	return snapshot, result.RowsAffected > 0, result.Error
+}
+
+// PublishedElements returns the elements of the published version of a page, none if it was never published.
+func PublishedElements(db *gorm.DB, page models.Page) ([]api.ElementsResponseObject, error) {
+	snapshot, ok, err := Published(db, page.ID)
+	if err != nil || !ok {
+		return []api.ElementsResponseObject{}, err
+	}
+	return SnapshotElements(snapshot)
+}
+
+// SnapshotElements returns the elements of a published version.
+func SnapshotElements(snapshot models.PageSnapshot) ([]api.ElementsResponseObject, error) {
+	elements := []api.ElementsResponseObject{}
+	if err := json.Unmarshal(snapshot.Elements.Bytes, &elements); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal published elements: %w", err)
+	}
+	return elements, nil
+}
+
+// Publish makes the draft of a page its published version, replacing the previous one.
+func Publish(tx *gorm.DB, page models.Page, userID uint) (models.PageSnapshot, error) {
+	elements, err := Elements(tx, page)
+	if err != nil {
+		return models.PageSnapshot{}, err
+	}
+	bytes, err := json.Marshal(elements)
+	if err != nil {
+		return models.PageSnapshot{}, err
+	}
+
+	snapshot := models.PageSnapshot{
+		PageID:      page.ID,
+		UserID:      userID,
+		Elements:    pgtype.JSONB{Bytes: bytes, Status: pgtype.Present},
+		PublishedAt: time.Now(),
+	}
+	err = tx.Omit("id").Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "page_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"user_id", "elements", "published_at", "updated_at"}),
+	}).Create(&snapshot).Error
+	return snapshot, err
+}
+
+// EnsurePublished publishes the draft of a page that was never published, e.g. when it is made public,
+// so that its visitors don't find it empty.
+func EnsurePublished(tx *gorm.DB, page models.Page, userID uint) error {
+	_, ok, err := Published(tx, page.ID)
+	if err != nil || ok {
+		return err
+	}
+	_, err = Publish(tx, page, userID)
+	return err
+}
+
+// Discard restores the draft of a page to its published version: elements added since are deleted,
+// and deleted and changed elements are restored, in the published order.
+// Returns ErrNotPublished if the page was never published.
+func Discard(tx *gorm.DB, page models.Page) error {
+	snapshot, ok, err := Published(tx, page.ID)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrNotPublished
+	}
+	published, err := SnapshotElements(snapshot)
+	if err != nil {
+		return err
+	}
+
+	positions := make([]string, len(published))
+	for i, publishedElement := range published {
+		positions[i] = publishedElement.ElementUUID
+
+		// Deleted elements are soft deleted, they are restored with their ID
+		var element models.Element
+		if err := tx.Unscoped().Where("element_uuid = ? AND page_id = ?", publishedElement.ElementUUID, page.ID).Limit(1).Find(&element).Error; err != nil {
+			return err
+		}
+		element.ElementUUID = publishedElement.ElementUUID
+		element.PageID = page.ID
+		element.UserID = page.UserID
+		element.Type = publishedElement.Type
+		element.Size = publishedElement.Size
+		element.DeletedAt = gorm.DeletedAt{}
+		if element.Content, err = encode(publishedElement.Content); err != nil {
+			return err
+		}
+		if element.Etc, err = encode(publishedElement.Etc); err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Save(&element).Error; err != nil {
+			return err
+		}
+	}
+
+	added := tx.Where("page_id = ?", page.ID)
+	if len(positions) > 0 {
+		added = added.Where("element_uuid NOT IN ?", positions)
+	}
+	if err := added.Delete(&models.Element{}).Error; err != nil {
+		return err
+	}
+
+	encodedPositions, err := json.Marshal(positions)
+	if err != nil {
+		return err
+	}
+	return tx.Model(&models.Page{}).Where("id = ?", page.ID).Update("element_positions", encodedPositions).Error
+}
+
+// Change is an element whose type, content or size differs between the draft and the published version.
+type Change struct {
+	ElementUUID string
+	Published   api.ElementsResponseObject
+	Draft       api.ElementsResponseObject
+}
+
+// Diff holds the differences between the draft of a page and its published version.
+type Diff struct {
+	// Added holds the elements of the draft that aren't published.
+	Added []api.ElementsResponseObject
+	// Removed holds the published elements deleted from the draft.
+	Removed []api.ElementsResponseObject
+	Changed []Change
+	// Reordered is true if the elements both versions have are in a different order.
+	Reordered bool
+}
+
+// Empty returns true if the draft is the same as the published version.
+func (d Diff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0 && !d.Reordered
+}
+
+// Compare returns the differences between the draft of a page and its published version.
+func Compare(draft []api.ElementsResponseObject, published []api.ElementsResponseObject) Diff {
+	diff := Diff{Added: []api.ElementsResponseObject{}, Removed: []api.ElementsResponseObject{}, Changed: []Change{}}
+
+	publishedByUUID := make(map[string]api.ElementsResponseObject, len(published))
+	for _, element := range published {
+		publishedByUUID[element.ElementUUID] = element
+	}
+	draftByUUID := make(map[string]api.ElementsResponseObject, len(draft))
+	var draftOrder []string
+	for _, element := range draft {
+		draftByUUID[element.ElementUUID] = element
+		publishedElement, ok := publishedByUUID[element.ElementUUID]
+		if !ok {
+			diff.Added = append(diff.Added, element)
+			continue
+		}
+		draftOrder = append(draftOrder, element.ElementUUID)
+		if publishedElement.Type != element.Type || publishedElement.Size != element.Size ||
+			!reflect.DeepEqual(publishedElement.Content, element.Content) || !reflect.DeepEqual(publishedElement.Etc, element.Etc) {
+			diff.Changed = append(diff.Changed, Change{ElementUUID: element.ElementUUID, Published: publishedElement, Draft: element})
+		}
+	}
+
+	var publishedOrder []string
+	for _, element := range published {
+		if _, ok := draftByUUID[element.ElementUUID]; !ok {
+			diff.Removed = append(diff.Removed, element)
+			continue
+		}
+		publishedOrder = append(publishedOrder, element.ElementUUID)
+	}
+	diff.Reordered = !reflect.DeepEqual(draftOrder, publishedOrder)
+	return diff
+}
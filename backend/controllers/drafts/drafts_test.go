@@ -0,0 +1,77 @@
+package drafts
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/opalescencelabs/backend/api"
+)
+
+// element returns an element with a text content.
+func element(uuid string, text string) api.ElementsResponseObject {
+	return api.ElementsResponseObject{ElementUUID: uuid, Type: "Text", Content: map[string]interface{}{"text": text}, Size: "medium"}
+}
+
+// uuids returns the UUIDs of elements.
+func uuids(elements []api.ElementsResponseObject) []string {
+	result := []string{}
+	for _, element := range elements {
+		result = append(result, element.ElementUUID)
+	}
+	return result
+}
+
+func TestCompare(t *testing.T) {
+	resized := element("b", "B")
+	resized.Size = "large"
+	tests := []struct {
+		name          string
+		draft         []api.ElementsResponseObject
+		published     []api.ElementsResponseObject
+		wantAdded     []string
+		wantRemoved   []string
+		wantChanged   []string
+		wantReordered bool
+	}{
+		{"same", []api.ElementsResponseObject{element("a", "A"), element("b", "B")}, []api.ElementsResponseObject{element("a", "A"), element("b", "B")},
+			[]string{}, []string{}, []string{}, false},
+		{"never published", []api.ElementsResponseObject{element("a", "A")}, nil,
+			[]string{"a"}, []string{}, []string{}, false},
+		{"added and removed", []api.ElementsResponseObject{element("a", "A"), element("c", "C")}, []api.ElementsResponseObject{element("a", "A"), element("b", "B")},
+			[]string{"c"}, []string{"b"}, []string{}, false},
+		{"content changed", []api.ElementsResponseObject{element("a", "A2"), element("b", "B")}, []api.ElementsResponseObject{element("a", "A"), element("b", "B")},
+			[]string{}, []string{}, []string{"a"}, false},
+		{"size changed", []api.ElementsResponseObject{element("a", "A"), resized}, []api.ElementsResponseObject{element("a", "A"), element("b", "B")},
+			[]string{}, []string{}, []string{"b"}, false},
+		{"reordered", []api.ElementsResponseObject{element("b", "B"), element("a", "A")}, []api.ElementsResponseObject{element("a", "A"), element("b", "B")},
+			[]string{}, []string{}, []string{}, true},
+		// Inserting or removing elements doesn't reorder the others
+		{"inserted", []api.ElementsResponseObject{element("a", "A"), element("c", "C"), element("b", "B")}, []api.ElementsResponseObject{element("a", "A"), element("b", "B")},
+			[]string{"c"}, []string{}, []string{}, false},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			diff := Compare(tc.draft, tc.published)
+			changed := []string{}
+			for _, change := range diff.Changed {
+				changed = append(changed, change.ElementUUID)
+			}
+			if got := uuids(diff.Added); !reflect.DeepEqual(got, tc.wantAdded) {
+				t.Errorf("Compare() added = %v, want %v", got, tc.wantAdded)
+			}
+			if got := uuids(diff.Removed); !reflect.DeepEqual(got, tc.wantRemoved) {
+				t.Errorf("Compare() removed = %v, want %v", got, tc.wantRemoved)
+			}
+			if !reflect.DeepEqual(changed, tc.wantChanged) {
+				t.Errorf("Compare() changed = %v, want %v", changed, tc.wantChanged)
+			}
+			if diff.Reordered != tc.wantReordered {
+				t.Errorf("Compare() reordered = %v, want %v", diff.Reordered, tc.wantReordered)
+			}
+			wantEmpty := len(tc.wantAdded) == 0 && len(tc.wantRemoved) == 0 && len(tc.wantChanged) == 0 && !tc.wantReordered
+			if diff.Empty() != wantEmpty {
+				t.Errorf("Compare().Empty() = %v, want %v", diff.Empty(), wantEmpty)
+			}
+		})
+	}
+}
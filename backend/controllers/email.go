@@ -0,0 +1,141 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/opalescencelabs/backend/api"
+	"github.com/opalescencelabs/backend/controllers/auth"
+	"github.com/opalescencelabs/backend/controllers/mail"
+	"github.com/opalescencelabs/backend/controllers/notifications"
+	"github.com/opalescencelabs/backend/database"
+	"github.com/opalescencelabs/backend/models"
+)
+
+// toEmailPreferencesResp converts email preferences to their response.
+func toEmailPreferencesResp(preference models.EmailPreference) api.EmailPreferencesResp {
+	return api.EmailPreferencesResp{
+		Notifications: preference.Notifications,
+		Digest:        preference.Digest,
+		DigestSentAt:  preference.DigestSentAt,
+	}
+}
+
+// EmailPreferences is the handler for GET /email-preferences.
+// Returns whether the user gets notification emails and the daily digest of followed pages.
+// Returns 200 on success, 401 on unauthorized, 500 on error.
+func EmailPreferences(c *gin.Context) {
+	preference, err := notifications.Preferences(database.DB, auth.MustCurrentUserID(c))
+	if err != nil {
+		fmt.Println("Failed to fetch email preferences: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch email preferences"})
+		return
+	}
+
+	c.JSON(http.StatusOK, toEmailPreferencesResp(preference))
+}
+
+// EmailPreferencesUpdate is the handler for POST /email-preferences-update.
+// Turns notification emails and the daily digest on or off, missing fields are left as they are.
+// Returns 200 on success, 400 on bad request, 401 on unauthorized, 500 on error.
+func EmailPreferencesUpdate(c *gin.Context) {
+	var request api.EmailPreferencesUpdateRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "details": err.Error()})
+		return
+	}
+
+	preference, err := notifications.UpdatePreferences(database.DB, auth.MustCurrentUserID(c), request.Notifications, request.Digest)
+	if err != nil {
+		fmt.Println("Failed to update email preferences: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update email preferences"})
+		return
+	}
+
+	c.JSON(http.StatusOK, api.EmailPreferencesUpdateResp{EmailPreferencesResp: toEmailPreferencesResp(preference)})
+}
+
+// EmailUnsubscribe is the handler for GET and POST /email-unsubscribe?token=.
+// Follows the unsubscribe link of an email, signed with the app SECRET, without logging in.
+// GET answers the link opened in a browser with a confirmation page, POST the one-click unsubscribe of email clients.
+// Returns 200 on success, 400 on bad request, 500 on error.
+func EmailUnsubscribe(c *gin.Context) {
+	var request api.EmailUnsubscribeRequest
+	if err := c.ShouldBindQuery(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "details": err.Error()})
+		return
+	}
+
+	userID, scope, err := mail.VerifyUnsubscribeToken(request.Token, auth.GetSecretKey())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid unsubscribe link"})
+		return
+	}
+	if err := notifications.Unsubscribe(database.DB, userID, scope); err != nil {
+		fmt.Println("Failed to unsubscribe: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unsubscribe"})
+		return
+	}
+
+	if c.Request.Method == http.MethodGet {
+		emails := "notification emails"
+		if scope == mail.ScopeDigest {
+			emails = "the daily digest"
+		}
+		c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(
+			"<!DOCTYPE html><html><head><meta charset=\"utf-8\"><title>Unsubscribed</title></head>"+
+				"<body style=\"font-family:sans-serif;padding:24px;\"><p>You have been unsubscribed from "+emails+
+				". Turn them back on in your settings.</p></body></html>"))
+		return
+	}
+	c.JSON(http.StatusOK, api.EmailUnsubscribeResp{Scope: scope})
+}
+
+// PageFollow is the handler for POST /page-follow.
+// Adds a page the user may see to their daily digest, which must be turned on to be sent.
+// Returns 200 on success, 400 on bad request, 401 on unauthorized, 404 on not found, 500 on error.
+func PageFollow(c *gin.Context) {
+	var request api.PageFollowRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "details": err.Error()})
+		return
+	}
+
+	page, _, err := auth.AuthorizePage(c, request.PageUUID, auth.AccessPublic)
+	if err != nil {
+		respondAccessError(c, err)
+		return
+	}
+	if err := notifications.Follow(database.DB, auth.MustCurrentUserID(c), page.ID); err != nil {
+		fmt.Println("Failed to follow page: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to follow page"})
+		return
+	}
+
+	c.JSON(http.StatusOK, api.PageFollowResp{})
+}
+
+// PageUnfollow is the handler for POST /page-unfollow.
+// Removes a page from the user's daily digest, also once the user may no longer see it.
+// Returns 200 on success, 400 on bad request, 401 on unauthorized, 404 on not found, 500 on error.
+func PageUnfollow(c *gin.Context) {
+	var request api.PageUnfollowRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "details": err.Error()})
+		return
+	}
+
+	var page models.Page
+	if err := database.DB.Where("page_uuid = ?", request.PageUUID).First(&page).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Page not found"})
+		return
+	}
+	if err := notifications.Unfollow(database.DB, auth.MustCurrentUserID(c), page.ID); err != nil {
+		fmt.Println("Failed to unfollow page: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unfollow page"})
+		return
+	}
+
+	c.JSON(http.StatusOK, api.PageUnfollowResp{})
+}
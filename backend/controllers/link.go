@@ -0,0 +1,76 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+
+	"github.com/gin-gonic/gin"
+	"github.com/opalescencelabs/backend/api"
+	"github.com/opalescencelabs/backend/controllers/auth"
+	"github.com/opalescencelabs/backend/controllers/links"
+	"github.com/opalescencelabs/backend/controllers/search"
+	"github.com/opalescencelabs/backend/database"
+	"gorm.io/gorm"
+)
+
+// toBacklinksResp converts backlinks to their response.
+func toBacklinksResp(backlinks []links.Backlink) []api.BacklinkResp {
+	resp := make([]api.BacklinkResp, len(backlinks))
+	for i, backlink := range backlinks {
+		resp[i] = api.BacklinkResp{
+			PageUUID:       backlink.PageUUID,
+			PageName:       backlink.PageName,
+			ElementUUID:    backlink.ElementUUID,
+			Kind:           backlink.Kind,
+			TargetPageUUID: backlink.TargetPageUUID,
+		}
+	}
+	return resp
+}
+
+// redirectLinks rewrites the links to the pages in the user's other pages to link to another page,
+// and reindexes the rewritten pages for search. Returns the UUIDs of the rewritten pages.
+func redirectLinks(tx *gorm.DB, userID uint, pageUUIDs []string, toPageUUID string) ([]string, error) {
+	var redirected []string
+	for _, pageUUID := range pageUUIDs {
+		rewritten, err := links.Redirect(tx, userID, pageUUID, toPageUUID, pageUUIDs)
+		if err != nil {
+			return nil, err
+		}
+		for _, rewrittenUUID := range rewritten {
+			if slices.Contains(redirected, rewrittenUUID) {
+				continue
+			}
+			if err := search.IndexPage(tx, rewrittenUUID); err != nil {
+				return nil, err
+			}
+			redirected = append(redirected, rewrittenUUID)
+		}
+	}
+	return redirected, nil
+}
+
+// PageBacklinks is the handler for GET /page-backlinks/:page_uuid.
+// Returns the pages the user may see that link to a page the user may see.
+// Returns 200 on success, 401 on unauthorized, 404 on not found, 500 on error.
+func PageBacklinks(c *gin.Context) {
+	page, access, err := auth.AuthorizePage(c, c.Param("page_uuid"), auth.AccessPublic)
+	if err != nil {
+		respondAccessError(c, err)
+		return
+	}
+
+	backlinks, total, err := links.Backlinks(database.DB, []string{page.PageUUID}, auth.MustCurrentUserID(c))
+	if err != nil {
+		fmt.Println("Failed to fetch backlinks: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch backlinks"})
+		return
+	}
+	// Only the owner is told about links from pages they may not see
+	if access != auth.AccessOwner {
+		total = int64(len(backlinks))
+	}
+
+	c.JSON(http.StatusOK, api.PageBacklinksResp{Backlinks: toBacklinksResp(backlinks), Total: total})
+}
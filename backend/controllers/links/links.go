@@ -0,0 +1,225 @@
+package links
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/opalescencelabs/backend/models"
+	"gorm.io/gorm"
+)
+
+// Kinds of references between pages.
+const (
+	// KindNested is a Nested Page element, which holds the UUID of the sub-page in etc.text.
+	KindNested = "nested"
+	// KindLink is a page UUID, e.g. in a link to /live/<uuid>, in the text of an element.
+	KindLink = "link"
+)
+
+// NestedPageType is the element type embedding a sub-page.
+const NestedPageType = "Nested Page"
+
+var uuidPattern = regexp.MustCompile(`[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}`)
+
+// Ref is a reference from an element to a page.
+type Ref struct {
+	ElementUUID string
+	PageUUID    string
+	Kind        string
+}
+
+// Extract returns the pages an element references, given its type and the text of its content and etc.
+// References may be to pages that don't exist, IndexPage only keeps those that do.
+func Extract(elementUUID string, elementType string, contentText string, etcText string) []Ref {
+	var refs []Ref
+	seen := make(map[string]bool)
+	if elementType == NestedPageType {
+		if pageUUID := strings.ToLower(strings.TrimSpace(etcText)); uuidPattern.MatchString(pageUUID) {
+			refs = append(refs, Ref{ElementUUID: elementUUID, PageUUID: pageUUID, Kind: KindNested})
+			seen[pageUUID] = true
+		}
+	}
+	for _, pageUUID := range uuidPattern.FindAllString(contentText, -1) {
+		pageUUID = strings.ToLower(pageUUID)
+		if !seen[pageUUID] {
+			refs = append(refs, Ref{ElementUUID: elementUUID, PageUUID: pageUUID, Kind: KindLink})
+			seen[pageUUID] = true
+		}
+	}
+	return refs
+}
+
+// IndexPage replaces the links from a page with the references of its elements to other existing pages.
+// Call it with the transaction changing the elements, so the index is always up to date.
+func IndexPage(tx *gorm.DB, pageID uint) error {
+	if err := tx.Where("source_page_id = ?", pageID).Delete(&models.PageLink{}).Error; err != nil {
+		return err
+	}
+
+	var elements []struct {
+		ElementUUID string
+		Type        string
+		ContentText string
+		EtcText     string
+	}
+	if err := tx.Model(&models.Element{}).
+		Select("element_uuid, type, COALESCE(content->>'text', '') AS content_text, COALESCE(etc->>'text', '') AS etc_text").
+		Where("page_id = ?", pageID).
+		Scan(&elements).Error; err != nil {
+		return err
+	}
+
+	var refs []Ref
+	var targets []string
+	for _, element := range elements {
+		for _, ref := range Extract(element.ElementUUID, element.Type, element.ContentText, element.EtcText) {
+			refs = append(refs, ref)
+			targets = append(targets, ref.PageUUID)
+		}
+	}
+	if len(refs) == 0 {
+		return nil
+	}
+
+	// Only index references to other pages that exist
+	var existing []string
+	if err := tx.Model(&models.Page{}).Where("page_uuid IN ? AND id <> ?", targets, pageID).Pluck("page_uuid", &existing).Error; err != nil {
+		return err
+	}
+	exists := make(map[string]bool, len(existing))
+	for _, pageUUID := range existing {
+		exists[pageUUID] = true
+	}
+
+	var pageLinks []models.PageLink
+	for _, ref := range refs {
+		if exists[ref.PageUUID] {
+			pageLinks = append(pageLinks, models.PageLink{SourcePageID: pageID, ElementUUID: ref.ElementUUID, TargetPageUUID: ref.PageUUID, Kind: ref.Kind})
+		}
+	}
+	if len(pageLinks) == 0 {
+		return nil
+	}
+	return tx.Omit("id").Create(&pageLinks).Error
+}
+
+// Backlink is a reference to a page from an element of another page.
+type Backlink struct {
+	PageUUID    string
+	PageName    string
+	ElementUUID string
+	Kind        string
+	// TargetPageUUID is the page referenced, one of the targets passed to Backlinks.
+	TargetPageUUID string
+}
+
+// Backlinks returns the references to the target pages from other pages the viewer may see:
+// their own pages, pages shared with them and the published versions of public pages. Pages among the targets are not sources.
+// Also returns the number of references from every page, including those the viewer may not see.
+func Backlinks(db *gorm.DB, targetPageUUIDs []string, viewerID uint) ([]Backlink, int64, error) {
+	return backlinks(inbound(db, targetPageUUIDs), viewerID)
+}
+
+// DeleteBacklinks returns the backlinks blocking the deletion of a page and its sub-pages, like Backlinks.
+// The Nested Page elements of the page's parent embedding it are left out, as they are how sub-pages are created
+// rather than links to them, and the editor removes the element when it deletes the sub-page.
+func DeleteBacklinks(db *gorm.DB, page models.Page, subtree []string, viewerID uint) ([]Backlink, int64, error) {
+	query := inbound(db, subtree)
+	if page.ParentPageUUID != "" {
+		query = query.Where("NOT (page_links.kind = ? AND pages.page_uuid = ? AND page_links.target_page_uuid = ?)",
+			KindNested, page.ParentPageUUID, page.PageUUID)
+	}
+	return backlinks(query, viewerID)
+}
+
+// inbound returns the query of the links to the target pages from other pages.
+func inbound(db *gorm.DB, targetPageUUIDs []string) *gorm.DB {
+	return db.Model(&models.PageLink{}).
+		Joins("JOIN pages ON pages.id = page_links.source_page_id AND pages.deleted_at IS NULL").
+		Where("page_links.target_page_uuid IN ? AND pages.page_uuid NOT IN ?", targetPageUUIDs, targetPageUUIDs)
+}
+
+// publishedLink is true if the element of a link is in the published version of its page and still references
+// the target, so that visitors of public pages don't see links the owner hasn't published.
+const publishedLink = `EXISTS (
+	SELECT 1 FROM page_snapshots, jsonb_array_elements(page_snapshots.elements) AS element
+	WHERE page_snapshots.page_id = pages.id AND jsonb_typeof(page_snapshots.elements) = 'array'
+		AND element->>'element_uuid' = page_links.element_uuid AND strpos(element::text, page_links.target_page_uuid) > 0
+)`
+
+// backlinks returns the links of the inbound query from pages the viewer may see, and the number of all of them.
+// Links from public pages of other users are only returned once published.
+func backlinks(inbound *gorm.DB, viewerID uint) ([]Backlink, int64, error) {
+	var total int64
+	if err := inbound.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var backlinks []Backlink
+	err := inbound.
+		Select("pages.page_uuid, COALESCE(pages.page_name, '') AS page_name, page_links.element_uuid, page_links.kind, page_links.target_page_uuid").
+		Where("pages.user_id = ? OR pages.id IN (SELECT page_id FROM page_shares WHERE user_id = ? AND deleted_at IS NULL) OR "+
+			"(pages.public_page AND "+publishedLink+")", viewerID, viewerID).
+		Order("pages.page_name, pages.page_uuid, page_links.element_uuid").
+		Scan(&backlinks).Error
+	return backlinks, total, err
+}
+
+// Redirect rewrites the references to a page in the elements of the user's other pages to reference another page,
+// and reindexes the links of the rewritten pages. Pages among skipPageUUIDs are left as they are.
+// Returns the UUIDs of the rewritten pages.
+func Redirect(tx *gorm.DB, userID uint, fromPageUUID string, toPageUUID string, skipPageUUIDs []string) ([]string, error) {
+	query := tx.Where("user_id = ? AND id IN (SELECT source_page_id FROM page_links WHERE target_page_uuid = ?)", userID, fromPageUUID)
+	if len(skipPageUUIDs) > 0 {
+		query = query.Where("page_uuid NOT IN ?", skipPageUUIDs)
+	}
+	var sources []models.Page
+	if err := query.Find(&sources).Error; err != nil {
+		return nil, err
+	}
+
+	pageUUIDs := make([]string, 0, len(sources))
+	for _, source := range sources {
+		// UUIDs have no characters JSON escapes, so they are replaced in the encoded JSON as they are
+		if err := tx.Exec(`UPDATE elements SET
+				content = replace(content::text, @from, @to)::jsonb,
+				etc = replace(etc::text, @from, @to)::jsonb
+			WHERE page_id = @page AND element_uuid IN (SELECT element_uuid FROM page_links WHERE source_page_id = @page AND target_page_uuid = @from)`,
+			map[string]interface{}{"from": fromPageUUID, "to": toPageUUID, "page": source.ID}).Error; err != nil {
+			return nil, err
+		}
+		if err := IndexPage(tx, source.ID); err != nil {
+			return nil, err
+		}
+		pageUUIDs = append(pageUUIDs, source.PageUUID)
+	}
+	return pageUUIDs, nil
+}
+
+// DeletePage removes the links from and to a page that is deleted.
+func DeletePage(tx *gorm.DB, pageUUID string) error {
+	return tx.Where("source_page_id IN (SELECT id FROM pages WHERE page_uuid = ?) OR target_page_uuid = ?", pageUUID, pageUUID).
+		Delete(&models.PageLink{}).Error
+}
+
+// IndexMissing indexes the links of every page while there are none, e.g. after links were introduced.
+// Only pages with elements that may reference another page are indexed.
+func IndexMissing(db *gorm.DB) error {
+	var count int64
+	if err := db.Model(&models.PageLink{}).Limit(1).Count(&count).Error; err != nil || count > 0 {
+		return err
+	}
+
+	var pageIDs []uint
+	if err := db.Model(&models.Element{}).Distinct("page_id").
+		Where("type = ? OR content->>'text' ~ ?", NestedPageType, uuidPattern.String()).
+		Pluck("page_id", &pageIDs).Error; err != nil {
+		return err
+	}
+	for _, pageID := range pageIDs {
+		if err := db.Transaction(func(tx *gorm.DB) error { return IndexPage(tx, pageID) }); err != nil {
+			return err
+		}
+	}
+	return nil
+}
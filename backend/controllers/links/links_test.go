@@ -0,0 +1,35 @@
+package links
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestExtract(t *testing.T) {
+	const page1, page2 = "6f1c1d2e-8a4b-4c1d-9e2f-0a1b2c3d4e01", "6f1c1d2e-8a4b-4c1d-9e2f-0a1b2c3d4e02"
+
+	tests := []struct {
+		name        string
+		elementType string
+		contentText string
+		etcText     string
+		want        []Ref
+	}{
+		{"no references", "Paragraph", "plain text", "", nil},
+		{"nested page", NestedPageType, "Untitled", page1, []Ref{{"e", page1, KindNested}}},
+		{"nested page with whitespace and uppercase", NestedPageType, "Untitled", "  6F1C1D2E-8A4B-4C1D-9E2F-0A1B2C3D4E01 ", []Ref{{"e", page1, KindNested}}},
+		{"nested page without a page", NestedPageType, "Untitled", "normal; autofocus;", nil},
+		{"etc of other types is ignored", "Callout", "", page1, nil},
+		{"link in text", "Paragraph", "See /live/" + page1 + " for details", "", []Ref{{"e", page1, KindLink}}},
+		{"several links, each once", "Paragraph", page1 + " " + page2 + " " + page1, "", []Ref{{"e", page1, KindLink}, {"e", page2, KindLink}}},
+		{"link to the nested page isn't repeated", NestedPageType, "Go to " + page1 + " or " + page2, page1, []Ref{{"e", page1, KindNested}, {"e", page2, KindLink}}},
+		{"partial uuid", "Paragraph", "6f1c1d2e-8a4b-4c1d-9e2f", "", nil},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := Extract("e", tc.elementType, tc.contentText, tc.etcText); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("Extract() = %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,185 @@
+package mail
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"strings"
+	"time"
+)
+
+// Message is an email with a plain text and an HTML body.
+type Message struct {
+	To      string
+	Subject string
+	Text    string
+	HTML    string
+	// Headers are added to the message, e.g. List-Unsubscribe
+	Headers map[string]string
+}
+
+// Mailer sends emails.
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// Default is the mailer used by the app, set by initializers.InitializeMailer.
+var Default Mailer = NewNoop()
+
+// Noop is a Mailer that logs emails instead of sending them, used while no SMTP server is configured.
+type Noop struct{}
+
+// NewNoop returns a Mailer that doesn't send emails.
+func NewNoop() *Noop {
+	return &Noop{}
+}
+
+// Send logs the recipient and subject of the email.
+func (n *Noop) Send(ctx context.Context, msg Message) error {
+	log.Printf("Email to %s not sent, no mailer configured: %s", msg.To, msg.Subject)
+	return nil
+}
+
+// SMTP is a Mailer sending emails through an SMTP server, e.g. a local sink like Mailpit in development.
+type SMTP struct {
+	addr     string
+	username string
+	password string
+	from     string
+	timeout  time.Duration
+}
+
+// NewSMTP returns a Mailer sending emails from the from address through the SMTP server at addr (host:port).
+// The connection is upgraded with STARTTLS when the server supports it, and authenticated if username isn't empty.
+func NewSMTP(addr string, username string, password string, from string) *SMTP {
+	return &SMTP{addr: addr, username: username, password: password, from: from, timeout: 30 * time.Second}
+}
+
+// Send sends the email, giving up when ctx is done or after the timeout.
+func (s *SMTP) Send(ctx context.Context, msg Message) error {
+	body, err := s.encode(msg)
+	if err != nil {
+		return err
+	}
+
+	deadline := time.Now().Add(s.timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	dialer := net.Dialer{Deadline: deadline}
+	conn, err := dialer.DialContext(ctx, "tcp", s.addr)
+	if err != nil {
+		return err
+	}
+	if err := conn.SetDeadline(deadline); err != nil {
+		conn.Close()
+		return err
+	}
+
+	host, _, _ := net.SplitHostPort(s.addr)
+	client, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return err
+		}
+	}
+	if s.username != "" {
+		if err := client.Auth(smtp.PlainAuth("", s.username, s.password, host)); err != nil {
+			return err
+		}
+	}
+	if err := client.Mail(address(s.from)); err != nil {
+		return err
+	}
+	if err := client.Rcpt(msg.To); err != nil {
+		return err
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(body); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+// encode returns the message as a multipart/alternative MIME message.
+func (s *SMTP) encode(msg Message) ([]byte, error) {
+	var buf bytes.Buffer
+	parts := multipart.NewWriter(&buf)
+
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	domain := "localhost"
+	if at := strings.LastIndex(address(s.from), "@"); at >= 0 {
+		domain = address(s.from)[at+1:]
+	}
+
+	var header bytes.Buffer
+	fmt.Fprintf(&header, "From: %s\r\n", s.from)
+	fmt.Fprintf(&header, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&header, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&header, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&header, "Message-ID: <%s@%s>\r\n", hex.EncodeToString(id), domain)
+	for name, value := range msg.Headers {
+		fmt.Fprintf(&header, "%s: %s\r\n", textproto.CanonicalMIMEHeaderKey(name), value)
+	}
+	fmt.Fprintf(&header, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&header, "Content-Type: multipart/alternative; boundary=%s\r\n\r\n", parts.Boundary())
+
+	// Clients show the last part they support, so HTML comes after the plain text
+	for _, part := range []struct{ contentType, body string }{
+		{"text/plain; charset=utf-8", msg.Text},
+		{"text/html; charset=utf-8", msg.HTML},
+	} {
+		w, err := parts.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		qp := quotedprintable.NewWriter(w)
+		if _, err := qp.Write([]byte(part.body)); err != nil {
+			return nil, err
+		}
+		if err := qp.Close(); err != nil {
+			return nil, err
+		}
+	}
+	if err := parts.Close(); err != nil {
+		return nil, err
+	}
+
+	return append(header.Bytes(), buf.Bytes()...), nil
+}
+
+// address returns the address of a from header value like "Name <address>".
+func address(from string) string {
+	if start, end := strings.LastIndex(from, "<"), strings.LastIndex(from, ">"); start >= 0 && end > start {
+		return from[start+1 : end]
+	}
+	return from
+}
@@ -0,0 +1,141 @@
+package mail
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	netmail "net/mail"
+	"strings"
+	"testing"
+)
+
+func TestUnsubscribeToken(t *testing.T) {
+	token := UnsubscribeToken(42, ScopeDigest, "secret")
+	userID, scope, err := VerifyUnsubscribeToken(token, "secret")
+	if err != nil || userID != 42 || scope != ScopeDigest {
+		t.Fatalf("VerifyUnsubscribeToken() = %d, %q, %v, want 42, digest", userID, scope, err)
+	}
+
+	signature := token[strings.LastIndex(token, ".")+1:]
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{"other secret", UnsubscribeToken(42, ScopeDigest, "other")},
+		{"other user", "43." + ScopeDigest + "." + signature},
+		{"other scope", "42." + ScopeNotifications + "." + signature},
+		{"unknown scope", UnsubscribeToken(42, "everything", "secret")},
+		{"user 0", UnsubscribeToken(0, ScopeDigest, "secret")},
+		{"missing signature", "42." + ScopeDigest},
+		{"empty", ""},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, _, err := VerifyUnsubscribeToken(tc.token, "secret"); !errors.Is(err, ErrInvalidToken) {
+				t.Errorf("VerifyUnsubscribeToken(%q) = %v, want ErrInvalidToken", tc.token, err)
+			}
+		})
+	}
+}
+
+func TestAddress(t *testing.T) {
+	tests := map[string]string{
+		"noreply@example.com":                     "noreply@example.com",
+		"Opalescence <noreply@example.com>":       "noreply@example.com",
+		`"Team <ops>" <noreply@mail.example.com>`: "noreply@mail.example.com",
+	}
+	for from, want := range tests {
+		if got := address(from); got != want {
+			t.Errorf("address(%q) = %q, want %q", from, got, want)
+		}
+	}
+}
+
+func TestSMTPEncode(t *testing.T) {
+	s := NewSMTP("localhost:1025", "", "", "Opalescence <noreply@example.com>")
+	raw, err := s.encode(Message{
+		To:      "alice@example.com",
+		Subject: "Bob shared “Roadmap” with you",
+		Text:    "Hi Alice,\nOpen it: https://example.com/live/page\n",
+		HTML:    "<p>Hi Alice,</p>",
+		Headers: UnsubscribeHeaders("https://example.com/email-unsubscribe?token=t"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg, err := netmail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatalf("encode() isn't a valid message: %v", err)
+	}
+	subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil || subject != "Bob shared “Roadmap” with you" {
+		t.Errorf("Subject = %q, %v", subject, err)
+	}
+	if got := msg.Header.Get("To"); got != "alice@example.com" {
+		t.Errorf("To = %q", got)
+	}
+	if got := msg.Header.Get("Message-Id"); !strings.HasSuffix(got, "@example.com>") {
+		t.Errorf("Message-ID = %q, want the domain of the sender", got)
+	}
+	if got := msg.Header.Get("List-Unsubscribe-Post"); got != "List-Unsubscribe=One-Click" {
+		t.Errorf("List-Unsubscribe-Post = %q", got)
+	}
+
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/alternative" {
+		t.Fatalf("Content-Type = %q, %v", mediaType, err)
+	}
+	reader := multipart.NewReader(msg.Body, params["boundary"])
+	var types, bodies []string
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := io.ReadAll(quotedprintable.NewReader(part))
+		if err != nil {
+			t.Fatal(err)
+		}
+		types = append(types, part.Header.Get("Content-Type"))
+		bodies = append(bodies, string(body))
+	}
+	if len(types) != 2 || !strings.HasPrefix(types[0], "text/plain") || !strings.HasPrefix(types[1], "text/html") {
+		t.Errorf("parts = %v, want plain text then HTML", types)
+	}
+	// Line breaks of text parts are CRLF on the wire
+	if len(bodies) == 2 && (bodies[0] != "Hi Alice,\r\nOpen it: https://example.com/live/page\r\n" || bodies[1] != "<p>Hi Alice,</p>") {
+		t.Errorf("bodies = %q", bodies)
+	}
+}
+
+func TestRender(t *testing.T) {
+	TemplateDirectory = "../templates/mail"
+	defer func() { TemplateDirectory = "./controllers/templates/mail" }()
+
+	msg, err := Render("share", "alice@example.com", map[string]string{
+		"RecipientName":  "Alice",
+		"ActorName":      "<Bob>",
+		"PageName":       "Road\nmap",
+		"PageURL":        "https://example.com/live/page",
+		"UnsubscribeURL": "https://example.com/email-unsubscribe?token=t",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.To != "alice@example.com" || msg.Subject != `<Bob> shared "Road map" with you` {
+		t.Errorf("Render() = to %q, subject %q", msg.To, msg.Subject)
+	}
+	if !strings.Contains(msg.Text, "https://example.com/email-unsubscribe?token=t") {
+		t.Errorf("Render() text %q has no unsubscribe link", msg.Text)
+	}
+	if !strings.Contains(msg.HTML, "&lt;Bob&gt;") || strings.Contains(msg.HTML, "<Bob>") {
+		t.Errorf("Render() HTML doesn't escape the actor name: %q", msg.HTML)
+	}
+}
@@ -0,0 +1,46 @@
+package mail
+
+import (
+	"bytes"
+	htmltemplate "html/template"
+	"path/filepath"
+	"strings"
+	texttemplate "text/template"
+)
+
+// TemplateDirectory holds the email templates, relative to the working directory like the page templates.
+// Each email has a <name>.txt template defining "subject" and "text", and a <name>.html template defining "content",
+// rendered in layout.html.
+var TemplateDirectory = "./controllers/templates/mail"
+
+// Render renders the email template with the given name, for the recipient to.
+func Render(name string, to string, data interface{}) (Message, error) {
+	text, err := texttemplate.ParseFiles(filepath.Join(TemplateDirectory, name+".txt"))
+	if err != nil {
+		return Message{}, err
+	}
+	var subject, plain bytes.Buffer
+	if err := text.ExecuteTemplate(&subject, "subject", data); err != nil {
+		return Message{}, err
+	}
+	if err := text.ExecuteTemplate(&plain, "text", data); err != nil {
+		return Message{}, err
+	}
+
+	html, err := htmltemplate.ParseFiles(filepath.Join(TemplateDirectory, "layout.html"), filepath.Join(TemplateDirectory, name+".html"))
+	if err != nil {
+		return Message{}, err
+	}
+	var rich bytes.Buffer
+	if err := html.ExecuteTemplate(&rich, "layout", data); err != nil {
+		return Message{}, err
+	}
+
+	return Message{
+		To: to,
+		// Subjects are a single line
+		Subject: strings.Join(strings.Fields(subject.String()), " "),
+		Text:    strings.TrimSpace(plain.String()) + "\n",
+		HTML:    rich.String(),
+	}, nil
+}
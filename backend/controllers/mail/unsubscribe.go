@@ -0,0 +1,73 @@
+package mail
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/opalescencelabs/backend/controllers/auth"
+)
+
+// Scopes of unsubscribe links, the emails they unsubscribe from.
+const (
+	ScopeNotifications = "notifications"
+	ScopeDigest        = "digest"
+)
+
+// ErrInvalidToken is returned for unsubscribe tokens that are malformed or not signed with the secret.
+var ErrInvalidToken = errors.New("invalid unsubscribe token")
+
+// UnsubscribeToken returns a token unsubscribing the user from the emails of the scope, signed with the secret.
+// Tokens don't expire, so links in old emails keep working.
+func UnsubscribeToken(userID uint, scope string, secret string) string {
+	payload := strconv.FormatUint(uint64(userID), 10) + "." + scope
+	return payload + "." + signUnsubscribe(payload, secret)
+}
+
+// VerifyUnsubscribeToken returns the user and scope of a token signed with the secret.
+func VerifyUnsubscribeToken(token string, secret string) (uint, string, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 || (parts[1] != ScopeNotifications && parts[1] != ScopeDigest) {
+		return 0, "", ErrInvalidToken
+	}
+	payload := parts[0] + "." + parts[1]
+	if !hmac.Equal([]byte(parts[2]), []byte(signUnsubscribe(payload, secret))) {
+		return 0, "", ErrInvalidToken
+	}
+	userID, err := strconv.ParseUint(parts[0], 10, 64)
+	if err != nil || userID == 0 {
+		return 0, "", ErrInvalidToken
+	}
+	return uint(userID), parts[1], nil
+}
+
+// signUnsubscribe returns the hex encoded HMAC-SHA256 of an unsubscribe payload.
+// The purpose is signed too, so signatures are never valid for other uses of the secret.
+func signUnsubscribe(payload string, secret string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("unsubscribe."))
+	mac.Write([]byte(payload))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// UnsubscribeURL returns the link unsubscribing the user from the emails of the scope, signed with the app SECRET.
+func UnsubscribeURL(userID uint, scope string) string {
+	return auth.GetDomain() + "/email-unsubscribe?token=" + url.QueryEscape(UnsubscribeToken(userID, scope, auth.GetSecretKey()))
+}
+
+// UnsubscribeHeaders returns the headers letting email clients unsubscribe in one click, see RFC 8058.
+func UnsubscribeHeaders(unsubscribeURL string) map[string]string {
+	return map[string]string{
+		"List-Unsubscribe":      "<" + unsubscribeURL + ">",
+		"List-Unsubscribe-Post": "List-Unsubscribe=One-Click",
+	}
+}
+
+// PageURL returns the link to a page in the frontend.
+func PageURL(pageUUID string) string {
+	return auth.GetFrontendURL() + "/live/" + pageUUID
+}
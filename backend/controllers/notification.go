@@ -0,0 +1,151 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/opalescencelabs/backend/api"
+	"github.com/opalescencelabs/backend/controllers/auth"
+	"github.com/opalescencelabs/backend/controllers/notifications"
+	"github.com/opalescencelabs/backend/database"
+)
+
+// defaultNotificationLimit is the number of notifications listed when the request has no limit.
+const defaultNotificationLimit = 20
+
+// NotificationList is the handler for GET /notification-list.
+// Returns the user's notifications, newest first, only the unread ones if unread is true, and the number of unread notifications.
+// Returns 200 on success, 400 on bad request, 401 on unauthorized, 500 on error.
+func NotificationList(c *gin.Context) {
+	var request api.NotificationListRequest
+	if err := c.ShouldBindQuery(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "details": err.Error()})
+		return
+	}
+	if request.Limit <= 0 {
+		request.Limit = defaultNotificationLimit
+	}
+	if request.Limit > notifications.MaxLimit || request.Offset < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Limit must be at most %d and offset positive", notifications.MaxLimit)})
+		return
+	}
+
+	userID := auth.MustCurrentUserID(c)
+	entries, err := notifications.List(database.DB, userID, request.Unread, request.Limit, request.Offset)
+	if err != nil {
+		fmt.Println("Failed to list notifications: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list notifications"})
+		return
+	}
+	unread, err := notifications.Unread(database.DB, userID)
+	if err != nil {
+		fmt.Println("Failed to count unread notifications: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list notifications"})
+		return
+	}
+
+	resp := api.NotificationListResp{Notifications: make([]api.NotificationResp, len(entries)), Unread: unread}
+	for i, entry := range entries {
+		resp.Notifications[i] = api.NotificationResp{
+			ID:          entry.ID,
+			Category:    entry.Category,
+			CreatedAt:   entry.CreatedAt,
+			ReadAt:      entry.ReadAt,
+			Actor:       api.NotificationActorResp{ID: entry.ActorID, Name: entry.ActorName, Picture: entry.ActorPicture},
+			PageUUID:    entry.PageUUID,
+			PageName:    entry.PageName,
+			ElementUUID: entry.ElementUUID,
+			CommentID:   entry.CommentID,
+		}
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// NotificationRead is the handler for POST /notification-read.
+// Marks some of the user's notifications as read, the others are ignored.
+// Returns 200 on success, 400 on bad request, 401 on unauthorized, 500 on error.
+func NotificationRead(c *gin.Context) {
+	var request api.NotificationReadRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "details": err.Error()})
+		return
+	}
+
+	userID := auth.MustCurrentUserID(c)
+	updated, err := notifications.MarkRead(database.DB, userID, request.NotificationIDs)
+	if err != nil {
+		fmt.Println("Failed to mark notifications read: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to mark notifications read"})
+		return
+	}
+	unread, err := notifications.Unread(database.DB, userID)
+	if err != nil {
+		fmt.Println("Failed to count unread notifications: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to mark notifications read"})
+		return
+	}
+
+	c.JSON(http.StatusOK, api.NotificationReadResp{Updated: updated, Unread: unread})
+}
+
+// NotificationReadAll is the handler for POST /notification-read-all.
+// Marks every notification of the user as read.
+// Returns 200 on success, 401 on unauthorized, 500 on error.
+func NotificationReadAll(c *gin.Context) {
+	updated, err := notifications.MarkRead(database.DB, auth.MustCurrentUserID(c), nil)
+	if err != nil {
+		fmt.Println("Failed to mark notifications read: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to mark notifications read"})
+		return
+	}
+
+	c.JSON(http.StatusOK, api.NotificationReadAllResp{Updated: updated})
+}
+
+// NotificationPreferences is the handler for GET /notification-preferences.
+// Returns the categories of notifications and those the user muted.
+// Returns 200 on success, 401 on unauthorized, 500 on error.
+func NotificationPreferences(c *gin.Context) {
+	muted, err := notifications.Muted(database.DB, auth.MustCurrentUserID(c))
+	if err != nil {
+		fmt.Println("Failed to fetch notification preferences: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch notification preferences"})
+		return
+	}
+
+	c.JSON(http.StatusOK, api.NotificationPreferencesResp{Categories: notifications.Categories, Muted: muted})
+}
+
+// NotificationPreferencesUpdate is the handler for POST /notification-preferences-update.
+// Replaces the categories of notifications the user muted. Muted notifications are not recorded at all.
+// Returns 200 on success, 400 on bad request, 401 on unauthorized, 500 on error.
+func NotificationPreferencesUpdate(c *gin.Context) {
+	var request api.NotificationPreferencesUpdateRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "details": err.Error()})
+		return
+	}
+
+	userID := auth.MustCurrentUserID(c)
+	if err := notifications.SetMuted(database.DB, userID, request.Muted); err != nil {
+		if errors.Is(err, notifications.ErrInvalidCategory) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		fmt.Println("Failed to update notification preferences: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update notification preferences"})
+		return
+	}
+	muted, err := notifications.Muted(database.DB, userID)
+	if err != nil {
+		fmt.Println("Failed to fetch notification preferences: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch notification preferences"})
+		return
+	}
+
+	c.JSON(http.StatusOK, api.NotificationPreferencesUpdateResp{
+		NotificationPreferencesResp: api.NotificationPreferencesResp{Categories: notifications.Categories, Muted: muted},
+	})
+}
@@ -0,0 +1,271 @@
+package notifications
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/opalescencelabs/backend/controllers/mail"
+	"github.com/opalescencelabs/backend/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// EmailDelay is how long a notification stays unread before it is emailed, so users active in the app aren't emailed too.
+const EmailDelay = 5 * time.Minute
+
+// MaxEmailAge is how old a notification may be and still be emailed, so a backlog isn't sent e.g. after an outage.
+const MaxEmailAge = 24 * time.Hour
+
+// DigestInterval is how often the digest of followed pages is sent.
+const DigestInterval = 24 * time.Hour
+
+// emailBatchSize bounds the number of emails sent of each kind per run of the worker.
+const emailBatchSize = 100
+
+// untitled names pages without a name in emails.
+const untitled = "Untitled"
+
+// Preferences returns the user's email preferences, the defaults if they never changed them.
+func Preferences(db *gorm.DB, userID uint) (models.EmailPreference, error) {
+	var preference models.EmailPreference
+	result := db.Where("user_id = ?", userID).Limit(1).Find(&preference)
+	if result.Error != nil {
+		return models.EmailPreference{}, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return models.EmailPreference{UserID: userID, Notifications: true}, nil
+	}
+	return preference, nil
+}
+
+// UpdatePreferences turns notification emails and the digest on or off, nil values are left as they are.
+func UpdatePreferences(db *gorm.DB, userID uint, notificationEmails *bool, digest *bool) (models.EmailPreference, error) {
+	preference, err := Preferences(db, userID)
+	if err != nil {
+		return models.EmailPreference{}, err
+	}
+	if notificationEmails != nil {
+		preference.Notifications = *notificationEmails
+	}
+	if digest != nil {
+		preference.Digest = *digest
+	}
+
+	err = db.Omit("id").Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"notifications", "digest", "updated_at"}),
+	}).Create(&preference).Error
+	return preference, err
+}
+
+// Unsubscribe turns off the emails of an unsubscribe link's scope.
+func Unsubscribe(db *gorm.DB, userID uint, scope string) error {
+	off := false
+	var err error
+	switch scope {
+	case mail.ScopeNotifications:
+		_, err = UpdatePreferences(db, userID, &off, nil)
+	case mail.ScopeDigest:
+		_, err = UpdatePreferences(db, userID, nil, &off)
+	default:
+		err = mail.ErrInvalidToken
+	}
+	return err
+}
+
+// Follow adds a page to the user's digest.
+func Follow(db *gorm.DB, userID uint, pageID uint) error {
+	follow := models.PageFollow{UserID: userID, PageID: pageID}
+	return db.Omit("id").Clauses(clause.OnConflict{DoNothing: true}).Create(&follow).Error
+}
+
+// Unfollow removes a page from the user's digest.
+func Unfollow(db *gorm.DB, userID uint, pageID uint) error {
+	return db.Where("user_id = ? AND page_id = ?", userID, pageID).Delete(&models.PageFollow{}).Error
+}
+
+// notificationEmail holds the data of the notification email templates, named after the categories.
+type notificationEmail struct {
+	RecipientName  string
+	ActorName      string
+	PageName       string
+	PageURL        string
+	CommentBody    string
+	UnsubscribeURL string
+}
+
+// SendEmails emails the notifications that are still unread after EmailDelay to users who didn't turn notification emails off.
+// Notifications that failed to send are retried on the next run until they are MaxEmailAge old.
+// Returns the number of emails sent.
+func SendEmails(ctx context.Context, db *gorm.DB, mailer mail.Mailer, now time.Time) (int, error) {
+	var pending []struct {
+		models.Notification
+		Email         string
+		RecipientName string
+		ActorName     string
+		PageUUID      string
+		PageName      string
+		CommentBody   string
+	}
+	if err := db.Model(&models.Notification{}).
+		Select("notifications.*, users.email, users.name AS recipient_name, COALESCE(actors.name, '') AS actor_name, "+
+			"pages.page_uuid, COALESCE(pages.page_name, '') AS page_name, COALESCE(comments.body, '') AS comment_body").
+		Joins("JOIN users ON users.id = notifications.user_id AND users.deleted_at IS NULL AND NOT users.disabled").
+		Joins("LEFT JOIN users actors ON actors.id = notifications.actor_id").
+		Joins("JOIN pages ON pages.id = notifications.page_id AND pages.deleted_at IS NULL").
+		Joins("LEFT JOIN comments ON comments.id = notifications.comment_id AND comments.deleted_at IS NULL").
+		Joins("LEFT JOIN email_preferences ON email_preferences.user_id = notifications.user_id").
+		Where("notifications.emailed_at IS NULL AND notifications.read_at IS NULL").
+		Where("notifications.created_at BETWEEN ? AND ?", now.Add(-MaxEmailAge), now.Add(-EmailDelay)).
+		Where("notifications.comment_id IS NULL OR comments.id IS NOT NULL").
+		Where("email_preferences.id IS NULL OR email_preferences.notifications").
+		Order("notifications.id").
+		Limit(emailBatchSize).
+		Scan(&pending).Error; err != nil {
+		return 0, err
+	}
+
+	sent := 0
+	for _, notification := range pending {
+		if ctx.Err() != nil {
+			return sent, ctx.Err()
+		}
+		data := notificationEmail{
+			RecipientName:  notification.RecipientName,
+			ActorName:      notification.ActorName,
+			PageName:       notification.PageName,
+			PageURL:        mail.PageURL(notification.PageUUID),
+			CommentBody:    notification.CommentBody,
+			UnsubscribeURL: mail.UnsubscribeURL(notification.UserID, mail.ScopeNotifications),
+		}
+		if data.PageName == "" {
+			data.PageName = untitled
+		}
+		msg, err := mail.Render(notification.Category, notification.Email, data)
+		if err != nil {
+			return sent, err
+		}
+		msg.Headers = mail.UnsubscribeHeaders(data.UnsubscribeURL)
+		if err := mailer.Send(ctx, msg); err != nil {
+			// Retried on the next run
+			fmt.Printf("Failed to email notification %d: %s\n", notification.ID, err)
+			continue
+		}
+		if err := db.Model(&models.Notification{}).Where("id = ?", notification.ID).Update("emailed_at", now).Error; err != nil {
+			return sent, err
+		}
+		sent++
+	}
+	return sent, nil
+}
+
+// digestPage is a followed page in a digest.
+type digestPage struct {
+	Name      string
+	URL       string
+	UpdatedAt time.Time
+}
+
+// digestEmail holds the data of the digest email template.
+type digestEmail struct {
+	RecipientName  string
+	Pages          []digestPage
+	UnsubscribeURL string
+}
+
+// SendDigests emails users who turned the digest on the pages they follow that changed since their last digest,
+// at most every DigestInterval. Only pages the user may still see and doesn't own are included,
+// no email is sent if none changed. Returns the number of emails sent.
+func SendDigests(ctx context.Context, db *gorm.DB, mailer mail.Mailer, now time.Time) (int, error) {
+	var due []struct {
+		UserID       uint
+		Email        string
+		Name         string
+		DigestSentAt *time.Time
+	}
+	if err := db.Model(&models.EmailPreference{}).
+		Select("email_preferences.user_id, users.email, users.name, email_preferences.digest_sent_at").
+		Joins("JOIN users ON users.id = email_preferences.user_id AND users.deleted_at IS NULL AND NOT users.disabled").
+		Where("email_preferences.digest AND (email_preferences.digest_sent_at IS NULL OR email_preferences.digest_sent_at <= ?)", now.Add(-DigestInterval)).
+		Order("email_preferences.user_id").
+		Limit(emailBatchSize).
+		Scan(&due).Error; err != nil {
+		return 0, err
+	}
+
+	sent := 0
+	for _, user := range due {
+		if ctx.Err() != nil {
+			return sent, ctx.Err()
+		}
+		since := now.Add(-DigestInterval)
+		if user.DigestSentAt != nil {
+			since = *user.DigestSentAt
+		}
+
+		var pages []struct {
+			PageUUID  string
+			PageName  string
+			UpdatedAt time.Time
+		}
+		if err := db.Model(&models.Page{}).
+			Select("pages.page_uuid, COALESCE(pages.page_name, '') AS page_name, COALESCE(pages.last_updated_at, pages.created_at) AS updated_at").
+			Joins("JOIN page_follows ON page_follows.page_id = pages.id AND page_follows.user_id = ?", user.UserID).
+			Where("pages.user_id <> ? AND (pages.public_page OR pages.id IN (SELECT page_id FROM page_shares WHERE user_id = ? AND deleted_at IS NULL))", user.UserID, user.UserID).
+			Where("COALESCE(pages.last_updated_at, pages.created_at) > ? AND COALESCE(pages.last_updated_at, pages.created_at) > page_follows.created_at", since).
+			Order("updated_at DESC").
+			Scan(&pages).Error; err != nil {
+			return sent, err
+		}
+
+		if len(pages) > 0 {
+			data := digestEmail{RecipientName: user.Name, UnsubscribeURL: mail.UnsubscribeURL(user.UserID, mail.ScopeDigest)}
+			for _, page := range pages {
+				name := page.PageName
+				if name == "" {
+					name = untitled
+				}
+				data.Pages = append(data.Pages, digestPage{Name: name, URL: mail.PageURL(page.PageUUID), UpdatedAt: page.UpdatedAt})
+			}
+			msg, err := mail.Render("digest", user.Email, data)
+			if err != nil {
+				return sent, err
+			}
+			msg.Headers = mail.UnsubscribeHeaders(data.UnsubscribeURL)
+			if err := mailer.Send(ctx, msg); err != nil {
+				// Retried on the next run, with the changes since
+				fmt.Printf("Failed to email digest to user %d: %s\n", user.UserID, err)
+				continue
+			}
+			sent++
+		}
+
+		if err := db.Model(&models.EmailPreference{}).Where("user_id = ?", user.UserID).Update("digest_sent_at", now).Error; err != nil {
+			return sent, err
+		}
+	}
+	return sent, nil
+}
+
+// RunEmailWorker emails notifications and digests every interval until ctx is cancelled.
+// What was emailed is stored in the database, so nothing is sent twice across restarts.
+func RunEmailWorker(ctx context.Context, db *gorm.DB, mailer mail.Mailer, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := SendEmails(ctx, db, mailer, time.Now()); err != nil {
+			fmt.Println("Failed to email notifications: ", err)
+		}
+		if _, err := SendDigests(ctx, db, mailer, time.Now()); err != nil {
+			fmt.Println("Failed to email digests: ", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
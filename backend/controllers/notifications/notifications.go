@@ -0,0 +1,349 @@
+package notifications
+
+import (
+	"errors"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/opalescencelabs/backend/models"
+	"gorm.io/gorm"
+)
+
+// Categories of notifications, each may be muted.
+const (
+	// CategoryMention is a mention of the user in an element or a comment.
+	CategoryMention = "mention"
+	// CategoryTask is a mention of the user in a Checkbox element, assigning them the task.
+	CategoryTask = "task"
+	// CategoryReply is a reply to a comment thread the user took part in.
+	CategoryReply = "reply"
+	// CategoryShare is a page shared with the user.
+	CategoryShare = "share"
+)
+
+// Categories lists every category of notifications.
+var Categories = []string{CategoryMention, CategoryTask, CategoryReply, CategoryShare}
+
+// CheckboxType is the element type of tasks.
+const CheckboxType = "Checkbox"
+
+// MaxLimit bounds the number of notifications listed at once.
+const MaxLimit = 100
+
+// ErrInvalidCategory is returned for unknown categories of notifications.
+var ErrInvalidCategory = errors.New("category must be mention, task, reply or share")
+
+// mentionPattern matches mentions of users by email, e.g. @alice@example.com, not preceded by a character of an email.
+var mentionPattern = regexp.MustCompile(`(?:^|[^\w.%+@-])@([\w.%+-]+@[\w-]+(?:\.[\w-]+)*\.[A-Za-z]{2,})`)
+
+// Mentions returns the lowercased emails mentioned in a text, without duplicates.
+func Mentions(text string) []string {
+	var emails []string
+	seen := make(map[string]bool)
+	for _, match := range mentionPattern.FindAllStringSubmatch(text, -1) {
+		email := strings.ToLower(match[1])
+		if !seen[email] {
+			emails = append(emails, email)
+			seen[email] = true
+		}
+	}
+	return emails
+}
+
+// Mentioned holds the emails mentioned in an element.
+type Mentioned struct {
+	Type   string
+	Emails []string
+}
+
+// ElementMentions returns the emails mentioned in the text of each element of a page, by element UUID.
+// Elements mentioning no one are left out.
+func ElementMentions(db *gorm.DB, pageID uint) (map[string]Mentioned, error) {
+	var elements []struct {
+		ElementUUID string
+		Type        string
+		Text        string
+	}
+	if err := db.Model(&models.Element{}).
+		Select("element_uuid, type, COALESCE(content->>'text', '') AS text").
+		Where("page_id = ? AND content->>'text' LIKE '%@%'", pageID).
+		Scan(&elements).Error; err != nil {
+		return nil, err
+	}
+
+	mentions := make(map[string]Mentioned)
+	for _, element := range elements {
+		if emails := Mentions(element.Text); len(emails) > 0 {
+			mentions[element.ElementUUID] = Mentioned{Type: element.Type, Emails: emails}
+		}
+	}
+	return mentions, nil
+}
+
+// members restricts a query on users to those who may comment on the page: its owner and the users it is shared with.
+func members(query *gorm.DB, page models.Page) *gorm.DB {
+	return query.Where("users.id = ? OR users.id IN (SELECT user_id FROM page_shares WHERE page_id = ? AND deleted_at IS NULL)", page.UserID, page.ID)
+}
+
+// mentionedUsers returns the IDs of the page members with the emails, by email.
+// Users without access to the page are never notified, so mentions don't reveal the page.
+func mentionedUsers(db *gorm.DB, page models.Page, emails []string) (map[string]uint, error) {
+	users := make(map[string]uint)
+	if len(emails) == 0 {
+		return users, nil
+	}
+	var rows []struct {
+		ID    uint
+		Email string
+	}
+	if err := members(db.Model(&models.User{}), page).
+		Select("users.id, LOWER(users.email) AS email").
+		Where("LOWER(users.email) IN ?", emails).
+		Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		users[row.Email] = row.ID
+	}
+	return users, nil
+}
+
+// NotifyElementMentions notifies the users newly mentioned in the elements of a page, given the mentions
+// returned by ElementMentions before the elements were updated. Mentions in Checkbox elements are tasks.
+func NotifyElementMentions(db *gorm.DB, page models.Page, actorID uint, before map[string]Mentioned) error {
+	after, err := ElementMentions(db, page.ID)
+	if err != nil {
+		return err
+	}
+
+	added := make(map[string][]string)
+	var emails []string
+	for elementUUID, mentioned := range after {
+		for _, email := range mentioned.Emails {
+			if !slices.Contains(before[elementUUID].Emails, email) {
+				added[elementUUID] = append(added[elementUUID], email)
+				emails = append(emails, email)
+			}
+		}
+	}
+	users, err := mentionedUsers(db, page, emails)
+	if err != nil {
+		return err
+	}
+
+	var notifications []models.Notification
+	for elementUUID, emails := range added {
+		category := CategoryMention
+		if after[elementUUID].Type == CheckboxType {
+			category = CategoryTask
+		}
+		for _, email := range emails {
+			if userID, ok := users[email]; ok {
+				notifications = append(notifications, models.Notification{
+					UserID: userID, ActorID: actorID, Category: category, PageID: page.ID, ElementUUID: elementUUID,
+				})
+			}
+		}
+	}
+	return Notify(db, notifications...)
+}
+
+// commentMentions returns the notifications of the users mentioned in a comment but not in its previous body.
+func commentMentions(db *gorm.DB, page models.Page, comment models.Comment, previousBody string) ([]models.Notification, error) {
+	var emails []string
+	previous := Mentions(previousBody)
+	for _, email := range Mentions(comment.Body) {
+		if !slices.Contains(previous, email) {
+			emails = append(emails, email)
+		}
+	}
+	users, err := mentionedUsers(db, page, emails)
+	if err != nil {
+		return nil, err
+	}
+
+	var notifications []models.Notification
+	for _, email := range emails {
+		if userID, ok := users[email]; ok {
+			notifications = append(notifications, commentNotification(comment, userID, CategoryMention))
+		}
+	}
+	return notifications, nil
+}
+
+// commentNotification returns a notification about a comment for a user.
+func commentNotification(comment models.Comment, userID uint, category string) models.Notification {
+	commentID := comment.ID
+	return models.Notification{
+		UserID: userID, ActorID: comment.UserID, Category: category,
+		PageID: comment.PageID, ElementUUID: comment.ElementUUID, CommentID: &commentID,
+	}
+}
+
+// CommentCreated notifies the users mentioned in a new comment, and for replies the other participants of the thread.
+// Participants who no longer have access to the page are not notified.
+func CommentCreated(db *gorm.DB, page models.Page, comment models.Comment) error {
+	notifications, err := commentMentions(db, page, comment, "")
+	if err != nil {
+		return err
+	}
+
+	if comment.ParentID != nil {
+		var participants []uint
+		if err := members(db.Model(&models.User{}), page).
+			Where("users.id IN (SELECT user_id FROM comments WHERE (id = ? OR parent_id = ?) AND deleted_at IS NULL)", *comment.ParentID, *comment.ParentID).
+			Pluck("users.id", &participants).Error; err != nil {
+			return err
+		}
+		// Mentioned participants are only notified of the mention
+		for _, userID := range participants {
+			notifications = append(notifications, commentNotification(comment, userID, CategoryReply))
+		}
+	}
+	return Notify(db, notifications...)
+}
+
+// CommentEdited notifies the users newly mentioned in an edited comment.
+func CommentEdited(db *gorm.DB, page models.Page, comment models.Comment, previousBody string) error {
+	notifications, err := commentMentions(db, page, comment, previousBody)
+	if err != nil {
+		return err
+	}
+	return Notify(db, notifications...)
+}
+
+// PageShared notifies a user of a page shared with them.
+func PageShared(db *gorm.DB, page models.Page, actorID uint, userID uint) error {
+	return Notify(db, models.Notification{UserID: userID, ActorID: actorID, Category: CategoryShare, PageID: page.ID})
+}
+
+// Notify adds notifications to the inboxes of their users. Notifications of users about their own actions,
+// of muted categories, and repeated for the same user and element or comment are left out.
+func Notify(db *gorm.DB, notifications ...models.Notification) error {
+	type target struct {
+		userID      uint
+		elementUUID string
+		commentID   uint
+	}
+	seen := make(map[target]bool)
+	var userIDs []uint
+	var pending []models.Notification
+	for _, notification := range notifications {
+		t := target{userID: notification.UserID, elementUUID: notification.ElementUUID}
+		if notification.CommentID != nil {
+			t.commentID = *notification.CommentID
+		}
+		if notification.UserID == notification.ActorID || seen[t] {
+			continue
+		}
+		seen[t] = true
+		userIDs = append(userIDs, notification.UserID)
+		pending = append(pending, notification)
+	}
+	if len(pending) == 0 {
+		return nil
+	}
+
+	var mutes []models.NotificationMute
+	if err := db.Where("user_id IN ?", userIDs).Find(&mutes).Error; err != nil {
+		return err
+	}
+	muted := make(map[uint]map[string]bool)
+	for _, mute := range mutes {
+		if muted[mute.UserID] == nil {
+			muted[mute.UserID] = make(map[string]bool)
+		}
+		muted[mute.UserID][mute.Category] = true
+	}
+
+	var created []models.Notification
+	for _, notification := range pending {
+		if !muted[notification.UserID][notification.Category] {
+			created = append(created, notification)
+		}
+	}
+	if len(created) == 0 {
+		return nil
+	}
+	return db.Omit("id").Create(&created).Error
+}
+
+// Entry is a notification with its actor and page.
+type Entry struct {
+	models.Notification
+	ActorName    string
+	ActorPicture string
+	PageUUID     string
+	PageName     string
+}
+
+// List returns the user's notifications, newest first, only the unread ones if unreadOnly is true.
+func List(db *gorm.DB, userID uint, unreadOnly bool, limit int, offset int) ([]Entry, error) {
+	query := db.Model(&models.Notification{}).
+		Select("notifications.*, COALESCE(users.name, '') AS actor_name, COALESCE(users.picture, '') AS actor_picture, "+
+			"COALESCE(pages.page_uuid, '') AS page_uuid, COALESCE(pages.page_name, '') AS page_name").
+		Joins("LEFT JOIN users ON users.id = notifications.actor_id").
+		Joins("LEFT JOIN pages ON pages.id = notifications.page_id").
+		Where("notifications.user_id = ?", userID).
+		Order("notifications.created_at DESC, notifications.id DESC").
+		Limit(limit).
+		Offset(offset)
+	if unreadOnly {
+		query = query.Where("notifications.read_at IS NULL")
+	}
+	var entries []Entry
+	err := query.Scan(&entries).Error
+	return entries, err
+}
+
+// Unread counts the user's unread notifications.
+func Unread(db *gorm.DB, userID uint) (int64, error) {
+	var count int64
+	err := db.Model(&models.Notification{}).Where("user_id = ? AND read_at IS NULL", userID).Count(&count).Error
+	return count, err
+}
+
+// MarkRead marks the user's notifications with the IDs as read, or every unread notification if notificationIDs is nil.
+// Returns the number of notifications marked.
+func MarkRead(db *gorm.DB, userID uint, notificationIDs []uint) (int64, error) {
+	query := db.Model(&models.Notification{}).Where("user_id = ? AND read_at IS NULL", userID)
+	if notificationIDs != nil {
+		query = query.Where("id IN ?", notificationIDs)
+	}
+	result := query.Update("read_at", time.Now())
+	return result.RowsAffected, result.Error
+}
+
+// Muted returns the categories the user muted.
+func Muted(db *gorm.DB, userID uint) ([]string, error) {
+	categories := []string{}
+	err := db.Model(&models.NotificationMute{}).Where("user_id = ?", userID).Order("category").Pluck("category", &categories).Error
+	return categories, err
+}
+
+// SetMuted replaces the categories the user muted.
+func SetMuted(db *gorm.DB, userID uint, categories []string) error {
+	var mutes []models.NotificationMute
+	seen := make(map[string]bool)
+	for _, category := range categories {
+		if !slices.Contains(Categories, category) {
+			return ErrInvalidCategory
+		}
+		if !seen[category] {
+			mutes = append(mutes, models.NotificationMute{UserID: userID, Category: category})
+			seen[category] = true
+		}
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&models.NotificationMute{}).Error; err != nil {
+			return err
+		}
+		if len(mutes) == 0 {
+			return nil
+		}
+		return tx.Omit("id").Create(&mutes).Error
+	})
+}
@@ -0,0 +1,29 @@
+package notifications
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMentions(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []string
+	}{
+		{"none", "no mentions here", nil},
+		{"at the start", "@alice@example.com please review", []string{"alice@example.com"}},
+		{"in a sentence", "Thanks, @Bob.Smith@Example.co.uk!", []string{"bob.smith@example.co.uk"}},
+		{"several without duplicates", "@a@example.com and @b@example.com, cc @A@example.com", []string{"a@example.com", "b@example.com"}},
+		{"plain email isn't a mention", "write to alice@example.com", nil},
+		{"inside an email isn't a mention", "x@alice@example.com", nil},
+		{"without a domain", "@alice", nil},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := Mentions(tc.text); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("Mentions(%q) = %v, want %v", tc.text, got, tc.want)
+			}
+		})
+	}
+}
@@ -4,32 +4,78 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"reflect"
+	"regexp"
 	"slices"
-	"sort"
 	"time"
 
 	"errors"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 	"github.com/jackc/pgtype"
 	"github.com/opalescencelabs/backend/api"
 	"github.com/opalescencelabs/backend/api/caching"
+	"github.com/opalescencelabs/backend/controllers/audit"
 	"github.com/opalescencelabs/backend/controllers/auth"
+	"github.com/opalescencelabs/backend/controllers/drafts"
+	"github.com/opalescencelabs/backend/controllers/links"
+	"github.com/opalescencelabs/backend/controllers/notifications"
+	"github.com/opalescencelabs/backend/controllers/pagelist"
+	"github.com/opalescencelabs/backend/controllers/plans"
+	"github.com/opalescencelabs/backend/controllers/search"
+	"github.com/opalescencelabs/backend/controllers/tags"
 	"github.com/opalescencelabs/backend/controllers/templates"
+	"github.com/opalescencelabs/backend/controllers/views"
+	"github.com/opalescencelabs/backend/controllers/webhooks"
 	"github.com/opalescencelabs/backend/database"
 	"github.com/opalescencelabs/backend/models"
 	"gorm.io/gorm"
 )
 
+// respondAccessError writes the response for an error returned by auth.AuthorizePage.
+// Private pages the user may not see are not found. Anonymous requests for pages they may see but not modify
+// are unauthorized, authenticated ones forbidden.
+func respondAccessError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, auth.ErrForbidden):
+		if _, ok := auth.CurrentUserID(c); !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			return
+		}
+		c.JSON(http.StatusForbidden, gin.H{"error": "Forbidden"})
+	default:
+		c.JSON(http.StatusNotFound, gin.H{"error": "Page not found"})
+	}
+}
+
+// slugPattern matches slugs of 3 to 64 lowercase letters, digits and single dashes.
+var slugPattern = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+// validSlug returns true if slug is a valid page slug.
+// Slugs can't be UUIDs, so a page can be looked up by UUID or slug unambiguously.
+func validSlug(slug string) bool {
+	if len(slug) < 3 || len(slug) > 64 || !slugPattern.MatchString(slug) {
+		return false
+	}
+	_, err := uuid.Parse(slug)
+	return err != nil
+}
+
+// pageSlug returns the slug of the page, empty if it has none.
+func pageSlug(page models.Page) string {
+	if page.Slug == nil {
+		return ""
+	}
+	return *page.Slug
+}
+
 // PageCreate is the handler for POST /page/create
 // Creates a new page in the database given the request and authentication.
-// Returns 200 on success, 400 on bad request, 401 on unauthorized, 500 on error.
+// Returns 200 on success, 400 on bad request, 401 on unauthorized, 402/403 on exceeded plan limits, 500 on error.
 func PageCreate(c *gin.Context) {
-	userID, err := auth.AuthenticateUser(c)
-	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
-		return
-	}
+	user := auth.MustCurrentUser(c)
+	userID := user.ID
 
 	var request api.PageCreateRequest
 	if err := c.ShouldBindJSON(&request); err != nil {
@@ -51,6 +97,15 @@ func PageCreate(c *gin.Context) {
 		return
 	}
 
+	// Enforce the limits of the user's plan
+	parentPageUUID := ""
+	if request.ParentPageUUID != nil {
+		parentPageUUID = *request.ParentPageUUID
+	}
+	if respondLimitError(c, plans.CheckPageCreate(database.DB, user, parentPageUUID, request.PublicPage)) {
+		return
+	}
+
 	if len(request.ElementPositions.Bytes) == 0 {
 		request.ElementPositions = pgtype.JSONB{Status: pgtype.Null}
 	} else if string(request.ElementPositions.Bytes) == "[]" {
@@ -87,316 +142,121 @@ func PageCreate(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{})
 		return
 	}
+	if err := search.IndexPage(database.DB, request.PageUUID); err != nil {
+		// Not critical, the page is indexed on its next update
+		fmt.Println("Failed to index page: ", err)
+	}
+	if err := database.DB.Where("page_uuid = ?", request.PageUUID).First(&newPage).Error; err == nil {
+		details := audit.PageSummary(newPage)
+		details["public_page"] = newPage.PublicPage
+		if err := audit.Record(database.DB, audit.FromRequest(c, audit.ActionPageCreated, audit.TargetPage, newPage.PageUUID, details)); err != nil {
+			// Not critical, the page is created
+			fmt.Println("Failed to record page creation: ", err)
+		}
+		if err := webhooks.Enqueue(database.DB, userID, webhooks.EventPageCreated, webhooks.PageData(newPage)); err != nil {
+			// Not critical, the page is created
+			fmt.Println("Failed to enqueue webhooks: ", err)
+		}
+	}
+
+	// The parent's views list its sub-pages
+	caching.InvalidatePages(c, parentPageUUID)
 
 	c.JSON(http.StatusOK, api.PageCreateResp{})
 }
 
+// Time to live of the cached views of a page.
+// Changes to a page invalidate its views, the TTL bounds how long a missed invalidation is served.
+const (
+	pageCacheOwnerTTL  = 10 * time.Minute
+	pageCachePublicTTL = 5 * time.Minute
+)
+
+// pageContent is the cached part of a view of a page: its elements and sub-pages.
+// The page itself is loaded to authorize every request, so its fields and view counts are never served stale.
+type pageContent struct {
+	Elements []api.ElementsResponseObject `json:"elements"`
+	SubPages map[string]string            `json:"sub_pages"`
+}
+
 // PageGet is the handler for POST /page-get/:page_uuid.
 // Returns the page with the given UUID from the database.
-// Uses the cache if available, otherwise fetches from the database and stores in the cache.
-// If the page is public, increments the page view count.
-// Returns 200 on success, 400 on bad request, 401 on unauthorized, 500 on error.
+// The owner and other viewers get separately cached views, visitors and shared users only see public sub-pages.
+// If the page is public, records a view of the page, see views.Record.
+// Returns 200 on success, 400 on bad request, 401 on unauthorized, 403 on forbidden, 404 on not found, 500 on error.
 func PageGet(c *gin.Context) {
 	pageUUID := c.Param("page_uuid")
-	fmt.Println("Page UUID: ", pageUUID)
 	if pageUUID == "" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Page UUID cannot be empty"})
 		return
 	}
 
-	userID, user_err := auth.AuthenticateUser(c)
-
-	// Check if the response is already cached
-	cachedResponse, err := caching.Check(c, fmt.Sprintf("/page-get/%s", pageUUID))
+	page, access, err := auth.AuthorizePage(c, pageUUID, auth.AccessPublic)
 	if err != nil {
-		fmt.Printf("Response for /page-get/%s not found in cache\n", pageUUID)
-	} else {
-		// Return the cached response as JSON
-		fmt.Printf("Response for /page-get/%s found in cache\n", pageUUID)
-
-		// If the page is public, increment the view count and update the cache
-		// Unmarshmal the cached response
-		var response api.PageGetRespOwner
-		var pub_response api.PageGetResp
-		var flag = 0
-		err := json.Unmarshal([]byte(cachedResponse.(string)), &response)
-		if err == nil {
-			if response.Page.PublicPage {
-				// If page is public, increment the view count and update the cache, database
-				fmt.Printf("Response /page-get/%s -> page:%s is public, incrementing view count\n", pageUUID, pageUUID)
-				response.Page.ViewCount++
-				response.Page.DateViewCount[time.Now().Format("2006-01-02")]++
-
-				responseMarshaled, err := json.Marshal(response)
-				if err != nil {
-					return
-				}
-				if err := caching.Store(c, fmt.Sprintf("/page-get/%s", pageUUID), responseMarshaled); err != nil {
-					// (failed to update cache)
-					fmt.Printf("Failed to store /page-get/%s in cache: %s\n", pageUUID, err)
-					// Not a critical error, so we can continue with the rest of the handler
-				}
-				// Update the database
-				var page models.Page
-				if err := database.DB.Where("page_uuid = ?", pageUUID).First(&page).Error; err != nil {
-				}
-				page.ViewCount++
-				type ViewCountData map[string]int
-				var viewCounts ViewCountData
-
-				currentDate := time.Now().Format("2006-01-02")
-				// Increment view count
-				if page.DateViewCount.Status != pgtype.Present {
-					viewCounts = ViewCountData{currentDate: 1}
-				} else {
-					err := json.Unmarshal(page.DateViewCount.Bytes, &viewCounts)
-					if err != nil {
-						c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process view count data", "details": err.Error()})
-						return
-					}
-
-					viewCounts[currentDate]++
-				}
-
-				updatedBytes, err := json.Marshal(viewCounts)
-				if err != nil {
-					c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process view count data", "details": err.Error()})
-					return
-				}
-
-				page.DateViewCount = pgtype.JSONB{Bytes: updatedBytes, Status: pgtype.Present}
-
-				if err := database.DB.Save(&page).Error; err != nil {
-					fmt.Printf("Failed to update view count for /page-get/%s: %s\n", pageUUID, err)
-					c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update view count"})
-					return
-				}
+		respondAccessError(c, err)
+		return
+	}
 
-				if page.UserID != userID {
-					flag = 1
-					pub_response = api.PageGetResp{
-						Page: api.PageResp{
-							ID:             response.Page.ID,
-							CreatedAt:      response.Page.CreatedAt,
-							UpdatedAt:      response.Page.UpdatedAt,
-							PageUUID:       response.Page.PageUUID,
-							PageName:       response.Page.PageName,
-							IsRoot:         response.Page.IsRoot,
-							ParentPageUUID: response.Page.ParentPageUUID,
-							PublicPage:     response.Page.PublicPage,
-							PageUUIDURL:    response.Page.PageUUIDURL,
-							IsFavourite:    response.Page.IsFavourite,
-							ViewCount:      response.Page.ViewCount,
-							LastUpdatedAt:  response.Page.LastUpdatedAt,
-							Etc:            response.Page.Etc,
-						},
-						Elements: response.Elements,
-						SubPages: response.SubPages,
-					}
+	servePage(c, page, access)
+}
 
-				}
+// servePage writes the view of a page for the given access, recording a view of the page if it is public.
+// Used by PageGet and to serve pages on custom domains, see CustomDomainRouter.
+func servePage(c *gin.Context, page models.Page, access auth.Access) {
+	pageUUID := page.PageUUID
 
-			} else {
-				if user_err != nil {
-					c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
-					return
-				}
-			}
-			// Return the cached response, updated or not
-			if flag == 1 {
-				c.JSON(http.StatusOK, pub_response)
-				return
-			} else {
-				c.JSON(http.StatusOK, response)
-				return
-			}
-		} else { // (unmarshalling failed)
-			// If unmarshalling fails, invalidate the cache and return to the rest of the handler
-			fmt.Printf("Failed to unmarshal cached response for /page-get/%s: %s\n", pageUUID, err)
-			if err := caching.Invalidate(c, fmt.Sprintf("/page-get/%s", pageUUID)); err != nil {
-				fmt.Printf("Failed to invalidate /page-get/%s in cache: %s\n", pageUUID, err)
-			}
-			// Not a critical error, so we can continue
+	// Views are counted asynchronously, the returned view counts include them once flushed
+	if page.PublicPage {
+		if err := views.Record(c, caching.DefaultCounter, views.NewVisit(c, page, access)); err != nil {
+			// Not critical, the page is still served
+			fmt.Printf("Failed to record view of page %s: %s\n", pageUUID, err)
 		}
-
 	}
 
-	var page models.Page
-	result := database.DB.Where("page_uuid = ?", pageUUID).First(&page)
-	if result.Error != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Page not found"})
-		return
+	isOwner := access == auth.AccessOwner
+	view, ttl := caching.PageViewPublic, pageCachePublicTTL
+	if isOwner {
+		view, ttl = caching.PageViewOwner, pageCacheOwnerTTL
 	}
 
-	if user_err != nil && !page.PublicPage {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+	// Concurrent misses share a single load, e.g. when a freshly published page gets many visitors at once
+	key := caching.PageKey(pageUUID, view)
+	cached, err := caching.GetOrLoad(c, caching.Default, key, ttl, func() (interface{}, error) {
+		return loadPageContent(page, isOwner)
+	})
+	if err != nil {
+		fmt.Printf("Failed to load page %s: %s\n", pageUUID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch page content"})
 		return
 	}
-
-	if userID != page.UserID && !page.PublicPage {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+	var content pageContent
+	if err := json.Unmarshal(cached, &content); err != nil {
+		fmt.Printf("Failed to unmarshal cached %s: %s\n", key, err)
+		caching.InvalidatePages(c, pageUUID)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch page content"})
 		return
 	}
 
-	if page.PublicPage {
-		type ViewCountData map[string]int
-		var viewCounts ViewCountData
-
-		currentDate := time.Now().Format("2006-01-02")
-		// Increment view count
-		if page.DateViewCount.Status != pgtype.Present {
-			viewCounts = make(map[string]int)
-			viewCounts = ViewCountData{currentDate: 1}
-		} else {
-			err := json.Unmarshal(page.DateViewCount.Bytes, &viewCounts)
-			if err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process view count data", "details": err.Error()})
-				return
-			}
-			if viewCounts == nil {
-				viewCounts = make(map[string]int) // Initialize the map if it was nil
-			}
-
-			viewCounts[currentDate]++
-		}
-
-		updatedBytes, err := json.Marshal(viewCounts)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process view count data", "details": err.Error()})
-			return
-		}
-
-		page.DateViewCount = pgtype.JSONB{Bytes: updatedBytes, Status: pgtype.Present}
-		page.ViewCount++
-		updateResult := database.DB.Save(&page)
-		if updateResult.Error != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update view count"})
-			return
-		}
-	}
-
-	// Unmarshal DateViewCount if present and user ID matches
-	var dateViewCountData map[string]int
-	if page.DateViewCount.Status == pgtype.Present && userID == page.UserID {
-		err := json.Unmarshal(page.DateViewCount.Bytes, &dateViewCountData)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process date view count data", "details": err.Error()})
-			return
-		}
-	}
-
-	var elementPositions []string
-
-	// Unmarshal ElementPositions if present
-	if page.ElementPositions.Status == pgtype.Present {
-		err := json.Unmarshal(page.ElementPositions.Bytes, &elementPositions)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process page data", "details": err.Error()})
-			return
-		}
-	}
 	var PageEtc map[string]interface{}
 	if page.Etc.Status == pgtype.Present {
-		err := json.Unmarshal(page.Etc.Bytes, &PageEtc)
-		if err != nil {
+		if err := json.Unmarshal(page.Etc.Bytes, &PageEtc); err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process page data", "details": err.Error()})
 			return
 		}
 	}
 
-	var elements []models.Element
-	// Replace 'ForeignKeyColumn' with the actual foreign key column name in your Element model that references Page
-	result = database.DB.Where("page_id = ?", page.ID).Find(&elements)
-	if result.Error != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch elements for the page"})
-		return
-	}
-
-	responseElements := make([]api.ElementsResponseObject, 0, len(elements))
-	// Add the elements to the response in the order of the element positions
-	positionMap := make(map[string]int)
-	for i, uuid := range elementPositions {
-		positionMap[uuid] = i
-	}
-	// Sort the elements by their position in the elementPositions slice
-	sort.Slice(elements, func(i, j int) bool {
-		positionI := positionMap[elements[i].ElementUUID]
-		positionJ := positionMap[elements[j].ElementUUID]
-		return positionI < positionJ
-	})
-
-	for _, element := range elements {
-		var content map[string]interface{}
-		var etc map[string]interface{}
-
-		// Unmarshal Content if present
-		if element.Content.Status == pgtype.Present {
-			if err := json.Unmarshal(element.Content.Bytes, &content); err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unmarshal element content", "details": err.Error()})
-				return
-			}
-		}
-
-		// Unmarshal Etc if present
-		if element.Etc.Status == pgtype.Present {
-			if err := json.Unmarshal(element.Etc.Bytes, &etc); err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unmarshal element etc", "details": err.Error()})
-				return
-			}
+	// Comments change more often than the page, they are loaded on every request
+	var pageComments *api.PageCommentsResp
+	if access >= auth.AccessShared {
+		if pageComments, err = loadPageComments(page); err != nil {
+			fmt.Printf("Failed to load comments of page %s: %s\n", pageUUID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch page comments"})
+			return
 		}
-
-		// Append the processed element to the response slice
-		responseElements = append(responseElements, api.ElementsResponseObject{
-			ID:          element.ID,
-			ElementUUID: element.ElementUUID,
-			Type:        element.Type,
-			Content:     content,
-			Etc:         etc,
-			Size:        element.Size,
-		})
 	}
-	fmt.Println("Page UUID: ", pageUUID)
 
-	// Query all Sub-Pages
-	var subPages []models.Page
-	subPagesResult := database.DB.Where("parent_page_uuid = ?", pageUUID).Find(&subPages)
-	if subPagesResult.Error != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch sub-pages"})
-		return
-	}
-
-	// Create a map of sub-pages for easy access
-	subPagesMap := make(map[string]string)
-	for _, subPage := range subPages {
-		fmt.Println("SubPage: ", subPage.PageUUID)
-		subPagesMap[subPage.PageUUID] = subPage.PageName
-	}
-
-	var response any
-	// Construct the response based on the user's ownership of the page
-	if userID == page.UserID {
-		response = api.PageGetRespOwner{
-			Page: api.PageRespOwner{
-				ID:             page.ID,
-				CreatedAt:      page.CreatedAt,
-				UpdatedAt:      page.UpdatedAt,
-				PageUUID:       page.PageUUID,
-				PageName:       page.PageName,
-				IsRoot:         page.IsRoot,
-				ParentPageUUID: page.ParentPageUUID,
-				PublicPage:     page.PublicPage,
-				PageUUIDURL:    page.PageUUIDURL,
-				IsFavourite:    page.IsFavourite,
-				ViewCount:      page.ViewCount,
-				DateViewCount:  dateViewCountData,
-				LastUpdatedAt:  page.LastUpdatedAt,
-				Etc:            PageEtc,
-			},
-			Elements: responseElements,
-			SubPages: subPagesMap,
-		}
-	} else {
-		response = api.PageGetResp{
+	if !isOwner {
+		c.JSON(http.StatusOK, api.PageGetResp{
 			Page: api.PageResp{
 				ID:             page.ID,
 				CreatedAt:      page.CreatedAt,
@@ -407,40 +267,205 @@ func PageGet(c *gin.Context) {
 				ParentPageUUID: page.ParentPageUUID,
 				PublicPage:     page.PublicPage,
 				PageUUIDURL:    page.PageUUIDURL,
+				Slug:           pageSlug(page),
 				IsFavourite:    page.IsFavourite,
 				ViewCount:      page.ViewCount,
 				LastUpdatedAt:  page.LastUpdatedAt,
 				Etc:            PageEtc,
 			},
-			Elements: responseElements,
-			SubPages: subPagesMap,
+			Elements: content.Elements,
+			SubPages: content.SubPages,
+			Comments: pageComments,
+		})
+		return
+	}
+
+	dateViewCountData, err := views.DailyCounts(database.DB, page.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process date view count data", "details": err.Error()})
+		return
+	}
+	var publishedAt *time.Time
+	if snapshot, ok, err := drafts.Published(database.DB, page.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch published version"})
+		return
+	} else if ok {
+		publishedAt = &snapshot.PublishedAt
+	}
+
+	c.JSON(http.StatusOK, api.PageGetRespOwner{
+		Page: api.PageRespOwner{
+			ID:                page.ID,
+			CreatedAt:         page.CreatedAt,
+			UpdatedAt:         page.UpdatedAt,
+			PageUUID:          page.PageUUID,
+			PageName:          page.PageName,
+			IsRoot:            page.IsRoot,
+			ParentPageUUID:    page.ParentPageUUID,
+			PublicPage:        page.PublicPage,
+			PageUUIDURL:       page.PageUUIDURL,
+			Slug:              pageSlug(page),
+			IsFavourite:       page.IsFavourite,
+			ViewCount:         page.ViewCount,
+			ExcludedViewCount: page.ExcludedViewCount,
+			DateViewCount:     dateViewCountData,
+			LastUpdatedAt:     page.LastUpdatedAt,
+			Etc:               PageEtc,
+			PublishedAt:       publishedAt,
+		},
+		Elements: content.Elements,
+		SubPages: content.SubPages,
+		Comments: pageComments,
+	})
+}
+
+// loadPageContent loads the elements of a page, in the order of its element positions, and its sub-pages.
+// Visitors of a public page get its published version, the owner and the users a private page is shared with its draft.
+// Private sub-pages are only included in the owner's view.
+func loadPageContent(page models.Page, isOwner bool) (pageContent, error) {
+	content := pageContent{SubPages: make(map[string]string)}
+	var err error
+	if !isOwner && page.PublicPage {
+		content.Elements, err = drafts.PublishedElements(database.DB, page)
+	} else {
+		content.Elements, err = drafts.Elements(database.DB, page)
+	}
+	if err != nil {
+		return pageContent{}, err
+	}
+
+	subPagesQuery := database.DB.Where("parent_page_uuid = ?", page.PageUUID)
+	if !isOwner {
+		subPagesQuery = subPagesQuery.Where("public_page = ?", true)
+	}
+	var subPages []models.Page
+	if err := subPagesQuery.Find(&subPages).Error; err != nil {
+		return pageContent{}, fmt.Errorf("failed to fetch sub-pages: %w", err)
+	}
+	for _, subPage := range subPages {
+		content.SubPages[subPage.PageUUID] = subPage.PageName
+	}
+
+	return content, nil
+}
+
+// invalidatePagesAndParents invalidates the cached views of the pages and of their parents,
+// whose public views list them as sub-pages only while they are public.
+func invalidatePagesAndParents(c *gin.Context, pageUUIDs []string) {
+	if len(pageUUIDs) == 0 {
+		return
+	}
+
+	var parentPageUUIDs []string
+	if err := database.DB.Model(&models.Page{}).
+		Where("page_uuid IN ? AND parent_page_uuid <> ''", pageUUIDs).
+		Distinct().Pluck("parent_page_uuid", &parentPageUUIDs).Error; err != nil {
+		fmt.Println("Failed to find parent pages to invalidate: ", err)
+	}
+
+	caching.InvalidatePages(c, append(pageUUIDs, parentPageUUIDs...)...)
+}
+
+// toPageResp converts a page to its listing response, excluding the User and element positions.
+// Returns an error if the page's JSONB data can't be unmarshalled.
+func toPageResp(page models.Page) (api.PageResp, error) {
+	// Initialize the slice to store the unmarshalled element positions
+	var elementPositions []string
+
+	// Check if the JSONB data is present and not null
+	if page.ElementPositions.Status == pgtype.Present && len(page.ElementPositions.Bytes) > 0 {
+		// Directly unmarshal the JSONB Bytes into the []string slice
+		if err := json.Unmarshal(page.ElementPositions.Bytes, &elementPositions); err != nil {
+			return api.PageResp{}, fmt.Errorf("elementPositions: %w", err)
 		}
 	}
 
-	// Only store the owner's response in the cache
-	if userID == page.UserID {
-		if err := caching.Store(c, fmt.Sprintf("/page-get/%s", pageUUID), response); err != nil {
-			fmt.Printf("Failed to store /page-get/%s in cache: %s\n", pageUUID, err)
-			// Not a critical error, so we can continue
+	var etc map[string]interface{}
+	if page.Etc.Status == pgtype.Present && len(page.Etc.Bytes) > 0 {
+		if err := json.Unmarshal(page.Etc.Bytes, &etc); err != nil {
+			return api.PageResp{}, fmt.Errorf("etc: %w", err)
 		}
 	}
 
-	c.JSON(http.StatusOK, response)
+	// Manually map each field from Page to PageResp, excluding User
+	return api.PageResp{
+		ID:        page.ID,
+		CreatedAt: page.CreatedAt,
+		UpdatedAt: page.UpdatedAt,
+		PageUUID:  page.PageUUID,
+		PageName:  page.PageName,
+		IsRoot:    page.IsRoot,
+		// ElementPositions: elementPositions,
+		ParentPageUUID: page.ParentPageUUID,
+		PublicPage:     page.PublicPage,
+		PageUUIDURL:    page.PageUUIDURL,
+		Slug:           pageSlug(page),
+		IsFavourite:    page.IsFavourite,
+		ViewCount:      page.ViewCount,
+		Etc:            etc,
+		LastUpdatedAt:  page.LastUpdatedAt,
+	}, nil
 }
 
-// PageList is the handler for POST /page-list.
-// Returns a list of the user's pages from the database.
-// Returns 200 on success, 401 on unauthorized, 404 on no pages found, 500 on error.
+// PageList is the handler for GET /page-list.
+// Returns the user's pages from the database, with their tags.
+// Pages can be filtered, e.g. by tag or name, and sorted. Every page is listed unless a limit is given,
+// in which case the total is counted and the next page of results is listed with next_cursor.
+// Returns 200 on success, 400 on bad request, 401 on unauthorized, 500 on error.
 func PageList(c *gin.Context) {
-	var pages []models.Page
-	userID, err := auth.AuthenticateUser(c)
+	var request api.PageListRequest
+	if err := c.ShouldBindQuery(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "details": err.Error()})
+		return
+	}
+	allTags, err := parseTagMatch(request.TagMatch)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if request.Limit < 0 || request.Limit > pagelist.MaxLimit {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Limit must be at most %d", pagelist.MaxLimit)})
+		return
+	}
+	var updatedSince time.Time
+	if request.UpdatedSince != "" {
+		if updatedSince, err = parseAnalyticsTime(request.UpdatedSince, time.Time{}); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "updated_since must be an RFC 3339 time or a date"})
+			return
+		}
+	}
+
+	userID := auth.MustCurrentUserID(c)
+	opts := pagelist.Options{
+		RootOnly:       request.Root,
+		ParentPageUUID: request.ParentPageUUID,
+		PublicOnly:     request.Public,
+		FavouritesOnly: request.Favourite,
+		UpdatedSince:   updatedSince,
+		NameContains:   request.Name,
+		TagIDs:         request.TagIDs,
+		AllTags:        allTags,
+		Sort:           request.Sort,
+		Order:          request.Order,
+		Limit:          request.Limit,
+		Cursor:         request.Cursor,
+	}
+	list, err := pagelist.List(database.DB, userID, opts)
+	if errors.Is(err, pagelist.ErrInvalidSort) || errors.Is(err, pagelist.ErrInvalidCursor) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		fmt.Println("Failed to list pages: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list pages"})
 		return
 	}
+	pages := list.Pages
 
-	result := database.DB.Where("user_id = ? AND deleted_at IS NULL", userID).Order("is_favourite DESC, last_updated_at DESC").Find(&pages)
-	if result.Error != nil || len(pages) == 0 {
+	// Impersonation is read-only, so no welcome page is created for impersonated users
+	// No page may match the filters, or be left after the cursor, while the user has pages
+	_, impersonated := auth.Impersonator(c)
+	if len(pages) == 0 && !impersonated && !opts.Filtered() && opts.Cursor == "" {
 		// Generate welcome page if no pages are found
 		fmt.Println("No pages found for user ", userID)
 		fmt.Println("Creating welcome page")
@@ -457,59 +482,41 @@ func PageList(c *gin.Context) {
 		}
 	}
 
-	// Convert pages to PageResp, including unmarshalling ElementPositions
+	pageIDs := make([]uint, len(pages))
+	for i, page := range pages {
+		pageIDs[i] = page.ID
+	}
+	pageTags, err := tags.PageTags(database.DB, pageIDs)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch page tags", "details": err.Error()})
+		return
+	}
+
+	// Convert pages to PageResp
 	pageResps := make([]api.PageResp, len(pages))
 	for i, page := range pages {
-		// Initialize the slice to store the unmarshalled element positions
-		var elementPositions []string
-
-		// Check if the JSONB data is present and not null
-		if page.ElementPositions.Status == pgtype.Present && len(page.ElementPositions.Bytes) > 0 {
-			// Directly unmarshal the JSONB Bytes into the []string slice
-			err := json.Unmarshal(page.ElementPositions.Bytes, &elementPositions)
-			if err != nil {
-				// Handle JSON unmarshal error if necessary
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process page data (elementPositions)", "details": err.Error()})
-				return
-			}
+		pageResp, err := toPageResp(page)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process page data", "details": err.Error()})
+			return
 		}
-
-		var etc map[string]interface{}
-		if page.Etc.Status == pgtype.Present && len(page.Etc.Bytes) > 0 {
-			// Directly unmarshal the JSONB Bytes into the []string slice
-			err := json.Unmarshal(page.Etc.Bytes, &etc)
-			if err != nil {
-				// Handle JSON unmarshal error if necessary
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process page data (etc)", "details": err.Error()})
-				return
-			}
+		for _, tag := range pageTags[page.ID] {
+			pageResp.Tags = append(pageResp.Tags, toTagResp(tag))
 		}
-		// Manually map each field from Page to PageResp, excluding User
-		pageResps[i] = api.PageResp{
-			ID:        page.ID,
-			CreatedAt: page.CreatedAt,
-			UpdatedAt: page.UpdatedAt,
-			PageUUID:  page.PageUUID,
-			PageName:  page.PageName,
-			IsRoot:    page.IsRoot,
-			// ElementPositions: elementPositions,
-			ParentPageUUID: page.ParentPageUUID,
-			PublicPage:     page.PublicPage,
-			PageUUIDURL:    page.PageUUIDURL,
-			IsFavourite:    page.IsFavourite,
-			ViewCount:      page.ViewCount,
-			Etc:            etc,
-			LastUpdatedAt:  page.LastUpdatedAt,
-		}
-	}
-
-	c.JSON(http.StatusOK, api.PageListResp{Pages: pageResps})
+		pageResps[i] = pageResp
+	}
+
+	resp := api.PageListResp{Pages: pageResps, NextCursor: list.NextCursor}
+	if opts.Limit > 0 {
+		resp.Total = &list.Total
+	}
+	c.JSON(http.StatusOK, resp)
 }
 
 // PageUpdate is the handler for POST /page-update.
 // Updates a page in the database given the request and authentication.
 // Invalidates the Page cache for the updated page.
-// Returns 200 on success, 400 on bad request, 401 on unauthorized, 500 on error.
+// Returns 200 on success, 400 on bad request, 401 on unauthorized, 402/403 on exceeded plan limits, 409 if the slug is in use, 500 on error.
 func PageUpdate(c *gin.Context) {
 	var request api.PageUpdateRequest
 	if err := c.BindJSON(&request); err != nil {
@@ -518,20 +525,53 @@ func PageUpdate(c *gin.Context) {
 		return
 	}
 
-	userID, err := auth.AuthenticateUser(c)
-	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
-		return
-	}
+	user := auth.MustCurrentUser(c)
+	userID := user.ID
 
-	var page models.Page
 	PageUUID := request.Page.PageUUID
-	if err := database.DB.Where("page_uuid = ? AND user_id = ?", PageUUID, userID).First(&page).Error; err != nil {
+	page, _, err := auth.AuthorizePage(c, PageUUID, auth.AccessOwner)
+	if err != nil {
 		// Page does not exist / user doesn't own
 		fmt.Printf("Page not found for user %d (UUID %s)", userID, PageUUID)
-		c.JSON(http.StatusNotFound, gin.H{})
+		respondAccessError(c, err)
 		return
 	}
+
+	// Enforce the limits of the user's plan
+	if request.Page.PublicPage != nil && *request.Page.PublicPage && !page.PublicPage {
+		if respondLimitError(c, plans.CheckPublish(database.DB, user)) {
+			return
+		}
+	}
+	if request.Page.ParentPageUUID != "" && request.Page.ParentPageUUID != page.ParentPageUUID {
+		if respondLimitError(c, plans.CheckMove(database.DB, user, page.PageUUID, request.Page.ParentPageUUID)) {
+			return
+		}
+	}
+	if request.Elements != nil {
+		var contentBytes int64
+		for _, element := range request.Elements {
+			contentBytes += int64(len(element.Content.Bytes) + len(element.Etc.Bytes))
+		}
+		if respondLimitError(c, plans.CheckElements(database.DB, user, page.ID, len(request.Elements), contentBytes)) {
+			return
+		}
+	}
+	if slug := request.Page.Slug; slug != nil && *slug != "" {
+		if !validSlug(*slug) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Slug must be 3 to 64 lowercase letters, digits and dashes"})
+			return
+		}
+		var count int64
+		if err := database.DB.Model(&models.Page{}).Where("slug = ? AND id <> ?", *slug, page.ID).Count(&count).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "check slug"})
+			return
+		}
+		if count > 0 {
+			c.JSON(http.StatusConflict, gin.H{"error": "Slug already in use"})
+			return
+		}
+	}
 	parent_page_uuid := page.ParentPageUUID
 
 	page.LastUpdatedAt = time.Now()
@@ -541,6 +581,16 @@ func PageUpdate(c *gin.Context) {
 		return
 	}
 
+	// Users newly mentioned in the elements are notified once they are updated
+	var mentionsBefore map[string]notifications.Mentioned
+	if request.Elements != nil {
+		var err error
+		if mentionsBefore, err = notifications.ElementMentions(database.DB, page.ID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch mentions"})
+			return
+		}
+	}
+
 	// Wrap changes in a transaction in event of error
 	tx := database.DB.Begin()
 	// Rollback in case of an unexpected error...
@@ -571,9 +621,17 @@ func PageUpdate(c *gin.Context) {
 		// Reset view counts if toggling public_page status
 		if *pageUpdate.PublicPage != page.PublicPage {
 			pageUpdateQuery = pageUpdateQuery.Update("view_count", 0)
-			pageUpdateQuery = pageUpdateQuery.Update("date_view_count", pgtype.JSONB{Bytes: []byte("{}"), Status: pgtype.Null})
+			pageUpdateQuery = pageUpdateQuery.Update("excluded_view_count", 0)
+			// Views buffered before the reset are dropped when flushed, see views.Flush
+			pageUpdateQuery = pageUpdateQuery.Update("views_reset_at", time.Now())
+			if err := tx.Where("page_id = ?", page.ID).Delete(&models.PageView{}).Error; err != nil {
+				fmt.Println("Failed to reset page views", err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "reset view counts"})
+				tx.Rollback()
+				return
+			}
 		} else {
-			pageUpdateQuery = pageUpdateQuery.Omit("view_count")
+			pageUpdateQuery = pageUpdateQuery.Omit("view_count", "excluded_view_count")
 			pageUpdateQuery = pageUpdateQuery.Omit("date_view_count")
 		}
 
@@ -581,6 +639,20 @@ func PageUpdate(c *gin.Context) {
 	if pageUpdate.IsFavourite == nil {
 		pageUpdateQuery = pageUpdateQuery.Omit("is_favourite")
 	}
+	// The slug is updated separately, an empty slug removes it
+	pageUpdateQuery = pageUpdateQuery.Omit("slug")
+	if pageUpdate.Slug != nil {
+		var slug *string
+		if *pageUpdate.Slug != "" {
+			slug = pageUpdate.Slug
+		}
+		if err := tx.Model(&page).Update("slug", slug).Error; err != nil {
+			fmt.Println("Failed to update slug", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "update slug"})
+			tx.Rollback()
+			return
+		}
+	}
 	// Rest of these fields are never updated
 	pageUpdateQuery.Omit("etc", "page_uuid", "element_positions", "user_id")
 
@@ -597,6 +669,7 @@ func PageUpdate(c *gin.Context) {
 
 	elementQuery := "element_uuid = ? AND page_id = ? AND user_id = ?"
 	var newElementPositions []string
+	var elementChanges webhooks.ElementChanges
 
 	// update, create new elements
 	for _, update := range request.Elements {
@@ -606,6 +679,9 @@ func PageUpdate(c *gin.Context) {
 			element.ElementUUID = update.ElementUUID
 			element.PageID = PageID
 			element.UserID = userID
+			elementChanges.Created = append(elementChanges.Created, update.ElementUUID)
+		} else if elementChanged(element, update) {
+			elementChanges.Updated = append(elementChanges.Updated, update.ElementUUID)
 		}
 		element.Type = update.Type
 		element.Content = update.Content
@@ -654,6 +730,7 @@ func PageUpdate(c *gin.Context) {
 					tx.Rollback()
 					return
 				}
+				elementChanges.Deleted = append(elementChanges.Deleted, existingElementUUID)
 			}
 		}
 
@@ -673,6 +750,52 @@ func PageUpdate(c *gin.Context) {
 		}
 	}
 
+	// Keep the search index up to date with the page's name and elements
+	if err := search.IndexPage(tx, PageUUID); err != nil {
+		fmt.Println("Failed to index page", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "index page"})
+		tx.Rollback()
+		return
+	}
+
+	// Keep the link index up to date with the references of the elements to other pages
+	if err := links.IndexPage(tx, PageID); err != nil {
+		fmt.Println("Failed to index page links", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "index page links"})
+		tx.Rollback()
+		return
+	}
+
+	// Record the changes in the audit log, and deliver them to the user's webhooks once committed
+	var updatedPage models.Page
+	if err := tx.First(&updatedPage, "id = ?", page.ID).Error; err != nil {
+		fmt.Println("Failed to fetch updated page", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "fetch updated page"})
+		tx.Rollback()
+		return
+	}
+	// Pages made public for the first time are published as they are, later changes are drafts until published
+	if updatedPage.PublicPage && !page.PublicPage {
+		if err := drafts.EnsurePublished(tx, updatedPage, userID); err != nil {
+			fmt.Println("Failed to publish page", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "publish page"})
+			tx.Rollback()
+			return
+		}
+	}
+	if err := recordPageUpdate(c, tx, page, updatedPage, elementChanges); err != nil {
+		fmt.Println("Failed to record page update", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "record update"})
+		tx.Rollback()
+		return
+	}
+	if err := enqueuePageUpdateEvents(tx, updatedPage, page.PublicPage, elementChanges); err != nil {
+		fmt.Println("Failed to enqueue webhooks", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "enqueue webhooks"})
+		tx.Rollback()
+		return
+	}
+
 	// Commit the transaction
 	if err := tx.Commit().Error; err != nil {
 		fmt.Println("Unexpected error", err)
@@ -680,15 +803,115 @@ func PageUpdate(c *gin.Context) {
 		return
 	}
 
-	// Invalidate cache for this page post update
-	caching.Invalidate(c, fmt.Sprintf("/page-get/%s", PageUUID))
+	// Invalidate the views of this page, and of its old and new parent which list it as a sub-page
+	caching.InvalidatePages(c, PageUUID, parent_page_uuid, request.Page.ParentPageUUID)
 
-	if parent_page_uuid != "" {
-		caching.Invalidate(c, fmt.Sprintf("/page-get/%s", parent_page_uuid))
+	if request.Elements != nil {
+		if err := notifications.NotifyElementMentions(database.DB, page, userID, mentionsBefore); err != nil {
+			// Not critical, the page is updated
+			fmt.Println("Failed to notify mentions", err)
+		}
+	}
+
+	// Warn about pages linking to a moved page, e.g. its previous parent
+	var resp api.PageUpdateResp
+	if request.Page.ParentPageUUID != "" && request.Page.ParentPageUUID != parent_page_uuid {
+		backlinks, _, err := links.Backlinks(database.DB, []string{PageUUID}, userID)
+		if err != nil {
+			fmt.Println("Failed to fetch backlinks", err)
+		}
+		resp.Backlinks = toBacklinksResp(backlinks)
 	}
 
 	// Success
-	c.JSON(http.StatusOK, api.PageUpdateResp{})
+	c.JSON(http.StatusOK, resp)
+}
+
+// elementChanged returns true if an update changes the type, content or size of an element.
+// Content is compared as JSON, as Postgres normalises the formatting of JSONB.
+func elementChanged(element models.Element, update api.ElementsUpdateObject) bool {
+	if element.Type != update.Type || element.Size != update.Size {
+		return true
+	}
+	for _, pair := range [][2]pgtype.JSONB{{element.Content, update.Content}, {element.Etc, update.Etc}} {
+		var before, after interface{}
+		json.Unmarshal(pair[0].Bytes, &before)
+		json.Unmarshal(pair[1].Bytes, &after)
+		if !reflect.DeepEqual(before, after) {
+			return true
+		}
+	}
+	return false
+}
+
+// recordPageUpdate records an update of a page in the audit log: page.updated with the fields that changed and
+// the number of elements created, updated and deleted, and page.published or page.unpublished if its visibility changed.
+// Updates that changed nothing, e.g. autosaves, are not recorded.
+func recordPageUpdate(c *gin.Context, tx *gorm.DB, before models.Page, after models.Page, elementChanges webhooks.ElementChanges) error {
+	details := audit.Diff(audit.PageSummary(before), audit.PageSummary(after))
+	if !elementChanges.Empty() {
+		if details == nil {
+			details = map[string]interface{}{}
+		}
+		details["elements"] = map[string]int{
+			"created": len(elementChanges.Created),
+			"updated": len(elementChanges.Updated),
+			"deleted": len(elementChanges.Deleted),
+		}
+	}
+	if details != nil {
+		if err := audit.Record(tx, audit.FromRequest(c, audit.ActionPageUpdated, audit.TargetPage, after.PageUUID, details)); err != nil {
+			return err
+		}
+	}
+	if after.PublicPage == before.PublicPage {
+		return nil
+	}
+	action := audit.ActionPageUnpublished
+	if after.PublicPage {
+		action = audit.ActionPagePublished
+	}
+	return audit.Record(tx, audit.FromRequest(c, action, audit.TargetPage, after.PageUUID, nil))
+}
+
+// enqueuePageUpdateEvents queues the webhook events of an update of a page: page.updated,
+// page.published or page.unpublished if its visibility changed from wasPublic, and element.changed if elements changed.
+func enqueuePageUpdateEvents(tx *gorm.DB, page models.Page, wasPublic bool, elementChanges webhooks.ElementChanges) error {
+	data := webhooks.PageData(page)
+	if err := webhooks.Enqueue(tx, page.UserID, webhooks.EventPageUpdated, data); err != nil {
+		return err
+	}
+	if page.PublicPage != wasPublic {
+		event := webhooks.EventPageUnpublished
+		if page.PublicPage {
+			event = webhooks.EventPagePublished
+		}
+		if err := webhooks.Enqueue(tx, page.UserID, event, data); err != nil {
+			return err
+		}
+	}
+	if elementChanges.Empty() {
+		return nil
+	}
+	return webhooks.Enqueue(tx, page.UserID, webhooks.EventElementChanged, map[string]interface{}{
+		"page":     data,
+		"elements": elementChanges,
+	})
+}
+
+// pageSubtree returns the UUIDs of a page and its sub-pages, at any depth.
+func pageSubtree(db *gorm.DB, pageUUID string) ([]string, error) {
+	var pageUUIDs []string
+	err := db.Raw(`
+		WITH RECURSIVE subtree AS (
+			SELECT page_uuid, user_id FROM pages WHERE page_uuid = ? AND deleted_at IS NULL
+			UNION
+			SELECT p.page_uuid, p.user_id FROM pages p
+			JOIN subtree s ON p.parent_page_uuid = s.page_uuid AND p.user_id = s.user_id
+			WHERE p.deleted_at IS NULL
+		)
+		SELECT page_uuid FROM subtree`, pageUUID).Scan(&pageUUIDs).Error
+	return pageUUIDs, err
 }
 
 // Helper function to recursively delete a page and its children.
@@ -714,23 +937,73 @@ func deletePageAndChildren(c *gin.Context, tx *gorm.DB, pageUUID string, userID
 		return err
 	}
 
+	// Delete the recorded views of the current page
+	if err := tx.Where("page_id = (SELECT id FROM pages WHERE page_uuid = ? AND user_id = ?)", pageUUID, userID).Delete(&models.PageView{}).Error; err != nil {
+		return err
+	}
+
+	// Remove the links from and to the current page
+	if err := links.DeletePage(tx, pageUUID); err != nil {
+		return err
+	}
+
+	// Delete the follows of the current page
+	if err := tx.Where("page_id = (SELECT id FROM pages WHERE page_uuid = ? AND user_id = ?)", pageUUID, userID).Delete(&models.PageFollow{}).Error; err != nil {
+		return err
+	}
+
+	// Delete the notifications about the current page
+	if err := tx.Where("page_id = (SELECT id FROM pages WHERE page_uuid = ? AND user_id = ?)", pageUUID, userID).Delete(&models.Notification{}).Error; err != nil {
+		return err
+	}
+
+	// Delete the comments on the current page
+	if err := tx.Unscoped().Where("page_id = (SELECT id FROM pages WHERE page_uuid = ? AND user_id = ?)", pageUUID, userID).Delete(&models.Comment{}).Error; err != nil {
+		return err
+	}
+
+	// Untag the current page
+	if err := tx.Where("page_id = (SELECT id FROM pages WHERE page_uuid = ? AND user_id = ?)", pageUUID, userID).Delete(&models.PageTag{}).Error; err != nil {
+		return err
+	}
+
+	// Delete the published version of the current page
+	if err := tx.Where("page_id = (SELECT id FROM pages WHERE page_uuid = ? AND user_id = ?)", pageUUID, userID).Delete(&models.PageSnapshot{}).Error; err != nil {
+		return err
+	}
+
+	// Detach the custom domains of the current page
+	if err := tx.Where("page_id = (SELECT id FROM pages WHERE page_uuid = ? AND user_id = ?)", pageUUID, userID).Delete(&models.CustomDomain{}).Error; err != nil {
+		return err
+	}
+
+	// Delete the visibility changes scheduled for the current page
+	if err := tx.Where("page_id = (SELECT id FROM pages WHERE page_uuid = ? AND user_id = ?)", pageUUID, userID).Delete(&models.PublishSchedule{}).Error; err != nil {
+		return err
+	}
+
+	// Revoke any shares of the current page
+	if err := tx.Unscoped().Where("page_id = (SELECT id FROM pages WHERE page_uuid = ? AND user_id = ?)", pageUUID, userID).Delete(&models.PageShare{}).Error; err != nil {
+		return err
+	}
+
 	// Finally, delete the page itself
 	if err := tx.Unscoped().Where("page_uuid = ? AND user_id = ?", pageUUID, userID).Delete(&models.Page{}).Error; err != nil {
 		return err
 	}
 
 	// Invalidate the cache for the deleted page
-	if err := caching.Invalidate(c, fmt.Sprintf("/page-get/%s", pageUUID)); err != nil {
-		return err
-	}
+	caching.InvalidatePages(c, pageUUID)
 
 	return nil // Successfully deleted the page and its children
 }
 
 // PageDelete is the handler for POST /page-delete.
 // Deletes a page and its associated elements and sub-pages from the database.
+// Pages linked to from other pages are only deleted with force, or with the links redirected to another page.
+// The Nested Page element of the parent embedding the page doesn't count as a link.
 // Invalidates the Page cache for the deleted page.
-// Returns 200 on success, 400 on bad request, 401 on unauthorized, 404 on not found, 500 on error.
+// Returns 200 on success, 400 on bad request, 401 on unauthorized, 404 on not found, 409 if the page has inbound links, 500 on error.
 func PageDelete(c *gin.Context) {
 	var req api.PageDeleteReq
 	if err := c.BindJSON(&req); err != nil {
@@ -738,20 +1011,82 @@ func PageDelete(c *gin.Context) {
 		return
 	}
 
-	userID, err := auth.AuthenticateUser(c)
+	userID := auth.MustCurrentUserID(c)
+
+	page, _, err := auth.AuthorizePage(c, req.PageUUID, auth.AccessOwner)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		respondAccessError(c, err)
 		return
 	}
 
-	if err = database.DB.Where("page_uuid = ? AND user_id = ?", req.PageUUID, userID).First(&models.Page{}).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Page not found or does not belong to the current user"})
+	// Warn about links to the deleted pages from other pages, unless they are deleted anyway or redirected
+	subtree, err := pageSubtree(database.DB, page.PageUUID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch sub-pages"})
 		return
 	}
+	backlinks, inbound, err := links.DeleteBacklinks(database.DB, page, subtree, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch backlinks"})
+		return
+	}
+	if inbound > 0 && !req.Force && req.RedirectLinksTo == "" {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":         "Page has inbound links, delete with force or redirect_links_to",
+			"inbound_links": inbound,
+			"backlinks":     toBacklinksResp(backlinks),
+		})
+		return
+	}
+	if req.RedirectLinksTo != "" {
+		if slices.Contains(subtree, req.RedirectLinksTo) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot redirect links to a deleted page"})
+			return
+		}
+		if _, _, err := auth.AuthorizePage(c, req.RedirectLinksTo, auth.AccessPublic); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Page to redirect links to not found"})
+			return
+		}
+	}
 
 	// Start a transaction
 	tx := database.DB.Begin()
 
+	// Rewrite the links in the user's other pages, links in pages of other users are left dangling
+	var redirected []string
+	if req.RedirectLinksTo != "" {
+		if redirected, err = redirectLinks(tx, userID, subtree, req.RedirectLinksTo); err != nil {
+			tx.Rollback()
+			fmt.Println("Failed to redirect links: ", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to redirect links"})
+			return
+		}
+	}
+
+	// Record the deletion of the page and its sub-pages, and deliver it to the user's webhooks once committed
+	var deleted []models.Page
+	if err := tx.Where("page_uuid IN ? AND user_id = ?", subtree, userID).Find(&deleted).Error; err != nil {
+		tx.Rollback()
+		fmt.Println("Failed to fetch deleted pages: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch sub-pages"})
+		return
+	}
+	for _, deletedPage := range deleted {
+		if err := webhooks.Enqueue(tx, userID, webhooks.EventPageDeleted, webhooks.PageData(deletedPage)); err != nil {
+			tx.Rollback()
+			fmt.Println("Failed to enqueue webhooks: ", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to enqueue webhooks"})
+			return
+		}
+		entry := audit.FromRequest(c, audit.ActionPageDeleted, audit.TargetPage, deletedPage.PageUUID, audit.PageSummary(deletedPage))
+		if err := audit.Record(tx, entry); err != nil {
+			tx.Rollback()
+			fmt.Println("Failed to record page deletion: ", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record page deletion"})
+			return
+		}
+	}
+
 	// Pass the transaction to the recursive deletion process
 	if err := deletePageAndChildren(c, tx, req.PageUUID, userID); err != nil {
 		tx.Rollback() // Rollback the transaction if an error occurs
@@ -769,5 +1104,8 @@ func PageDelete(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, api.PageDeleteResp{})
+	// The parent's views list the deleted page as a sub-page, the redirected pages' elements changed
+	caching.InvalidatePages(c, append(redirected, page.ParentPageUUID)...)
+
+	c.JSON(http.StatusOK, api.PageDeleteResp{RedirectedPageUUIDs: redirected})
 }
@@ -0,0 +1,293 @@
+package pagelist
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/opalescencelabs/backend/controllers/tags"
+	"github.com/opalescencelabs/backend/models"
+	"gorm.io/gorm"
+)
+
+// Sort orders of a page list.
+const (
+	// SortDefault lists favourites first, then the most recently updated.
+	SortDefault = "default"
+	SortName    = "name"
+	SortCreated = "created"
+	SortUpdated = "updated"
+	SortViews   = "views"
+)
+
+// MaxLimit bounds the number of pages of a page of results.
+const MaxLimit = 200
+
+var (
+	// ErrInvalidSort is returned for unknown sort orders or directions.
+	ErrInvalidSort = errors.New("sort must be default, name, created, updated or views, and order asc or desc")
+	// ErrInvalidCursor is returned for cursors that weren't returned by a list with the same sort order.
+	ErrInvalidCursor = errors.New("invalid cursor")
+)
+
+// Kinds of the values of sort keys, so they are decoded from cursors with their type.
+const (
+	kindBool   = "bool"
+	kindTime   = "time"
+	kindString = "string"
+	kindInt    = "int"
+)
+
+// key is a column pages are sorted by.
+type key struct {
+	column string
+	kind   string
+	value  func(page models.Page) interface{}
+}
+
+// updatedAt sorts pages never updated since they were created by their creation time.
+func updatedAt(page models.Page) interface{} {
+	if page.LastUpdatedAt.IsZero() {
+		return page.CreatedAt
+	}
+	return page.LastUpdatedAt
+}
+
+// sorts holds the keys of each sort order and whether it is descending by default.
+// The page ID is always the last key, so the order is total and cursors are stable.
+var sorts = map[string]struct {
+	keys []key
+	desc bool
+}{
+	SortDefault: {desc: true, keys: []key{
+		{"is_favourite", kindBool, func(page models.Page) interface{} { return page.IsFavourite }},
+		{"COALESCE(last_updated_at, created_at)", kindTime, updatedAt},
+	}},
+	SortName: {desc: false, keys: []key{
+		{"LOWER(page_name)", kindString, func(page models.Page) interface{} { return strings.ToLower(page.PageName) }},
+	}},
+	SortCreated: {desc: true, keys: []key{
+		{"created_at", kindTime, func(page models.Page) interface{} { return page.CreatedAt }},
+	}},
+	SortUpdated: {desc: true, keys: []key{
+		{"COALESCE(last_updated_at, created_at)", kindTime, updatedAt},
+	}},
+	SortViews: {desc: true, keys: []key{
+		{"view_count", kindInt, func(page models.Page) interface{} { return int64(page.ViewCount) }},
+	}},
+}
+
+// Options filters, sorts and paginates a page list. Zero values don't filter.
+type Options struct {
+	RootOnly       bool
+	ParentPageUUID string
+	PublicOnly     bool
+	FavouritesOnly bool
+	UpdatedSince   time.Time
+	// NameContains matches page names case-insensitively
+	NameContains string
+	// TagIDs lists pages with any of the tags, or all of them if AllTags is true
+	TagIDs  []uint
+	AllTags bool
+
+	// Sort is one of the Sort constants, SortDefault if empty
+	Sort string
+	// Order is "asc" or "desc", the default direction of the sort order if empty
+	Order string
+	// Limit is the number of pages to list, 0 to list every page
+	Limit int
+	// Cursor continues a list where the previous page of results ended
+	Cursor string
+}
+
+// Filtered returns true if the options filter the pages.
+func (o Options) Filtered() bool {
+	return o.RootOnly || o.ParentPageUUID != "" || o.PublicOnly || o.FavouritesOnly || !o.UpdatedSince.IsZero() ||
+		o.NameContains != "" || len(o.TagIDs) > 0
+}
+
+// Result is a page of a page list.
+type Result struct {
+	Pages []models.Page
+	// Total is the number of pages matching the filters, only counted when paginating
+	Total int64
+	// NextCursor continues the list, empty on the last page of results
+	NextCursor string
+}
+
+// cursor is the position after the last page of a page of results.
+type cursor struct {
+	Sort   string        `json:"s"`
+	Order  string        `json:"o"`
+	Values []interface{} `json:"v"`
+	ID     uint          `json:"id"`
+}
+
+// List returns the user's pages matching the options, in the selected order.
+func List(db *gorm.DB, userID uint, opts Options) (Result, error) {
+	if opts.Sort == "" {
+		opts.Sort = SortDefault
+	}
+	sort, ok := sorts[opts.Sort]
+	if !ok {
+		return Result{}, ErrInvalidSort
+	}
+	desc := sort.desc
+	switch opts.Order {
+	case "":
+		if desc {
+			opts.Order = "desc"
+		} else {
+			opts.Order = "asc"
+		}
+	case "asc":
+		desc = false
+	case "desc":
+		desc = true
+	default:
+		return Result{}, ErrInvalidSort
+	}
+
+	// The filtered query is shared by the count and the list
+	query := filter(db.Model(&models.Page{}), userID, opts).Session(&gorm.Session{})
+
+	var result Result
+	if opts.Limit > 0 {
+		if err := query.Count(&result.Total).Error; err != nil {
+			return Result{}, err
+		}
+	}
+
+	columns := make([]string, 0, len(sort.keys)+1)
+	for _, k := range sort.keys {
+		columns = append(columns, k.column)
+	}
+	columns = append(columns, "id")
+	direction := " ASC"
+	if desc {
+		direction = " DESC"
+	}
+	order := strings.Join(columns, direction+", ") + direction
+
+	if opts.Cursor != "" {
+		values, err := decodeCursor(opts.Cursor, opts.Sort, opts.Order, sort.keys)
+		if err != nil {
+			return Result{}, err
+		}
+		// Every key has the same direction, so the position compares as a row
+		comparison := " > "
+		if desc {
+			comparison = " < "
+		}
+		placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(values)), ", ")
+		query = query.Where("("+strings.Join(columns, ", ")+")"+comparison+"("+placeholders+")", values...)
+	}
+
+	query = query.Order(order)
+	if opts.Limit > 0 {
+		// One more page tells whether there is a next page of results
+		query = query.Limit(opts.Limit + 1)
+	}
+	if err := query.Find(&result.Pages).Error; err != nil {
+		return Result{}, err
+	}
+
+	if opts.Limit > 0 && len(result.Pages) > opts.Limit {
+		result.Pages = result.Pages[:opts.Limit]
+		next, err := encodeCursor(opts.Sort, opts.Order, sort.keys, result.Pages[len(result.Pages)-1])
+		if err != nil {
+			return Result{}, err
+		}
+		result.NextCursor = next
+	}
+	return result, nil
+}
+
+// filter restricts the query to the user's pages matching the options.
+func filter(query *gorm.DB, userID uint, opts Options) *gorm.DB {
+	query = query.Where("user_id = ? AND deleted_at IS NULL", userID)
+	if opts.RootOnly {
+		query = query.Where("is_root")
+	}
+	if opts.ParentPageUUID != "" {
+		query = query.Where("parent_page_uuid = ?", opts.ParentPageUUID)
+	}
+	if opts.PublicOnly {
+		query = query.Where("public_page")
+	}
+	if opts.FavouritesOnly {
+		query = query.Where("is_favourite")
+	}
+	if !opts.UpdatedSince.IsZero() {
+		query = query.Where("COALESCE(last_updated_at, created_at) >= ?", opts.UpdatedSince)
+	}
+	if opts.NameContains != "" {
+		escaped := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(opts.NameContains)
+		query = query.Where(`page_name ILIKE ? ESCAPE '\'`, "%"+escaped+"%")
+	}
+	if len(opts.TagIDs) > 0 {
+		query = query.Where("id IN (?)", tags.PagesWith(query, opts.TagIDs, opts.AllTags))
+	}
+	return query
+}
+
+// encodeCursor returns the cursor continuing a list of the sort order after the last page.
+func encodeCursor(sort string, order string, keys []key, last models.Page) (string, error) {
+	c := cursor{Sort: sort, Order: order, ID: last.ID}
+	for _, k := range keys {
+		c.Values = append(c.Values, k.value(last))
+	}
+	encoded, err := json.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(encoded), nil
+}
+
+// decodeCursor returns the values of the sort keys and the page ID encoded in a cursor of the sort order.
+func decodeCursor(encoded string, sort string, order string, keys []key) ([]interface{}, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var c struct {
+		Sort   string            `json:"s"`
+		Order  string            `json:"o"`
+		Values []json.RawMessage `json:"v"`
+		ID     uint              `json:"id"`
+	}
+	if err := json.Unmarshal(raw, &c); err != nil || c.Sort != sort || c.Order != order || len(c.Values) != len(keys) {
+		return nil, ErrInvalidCursor
+	}
+
+	values := make([]interface{}, 0, len(keys)+1)
+	for i, k := range keys {
+		var value interface{}
+		var err error
+		switch k.kind {
+		case kindBool:
+			var v bool
+			err = json.Unmarshal(c.Values[i], &v)
+			value = v
+		case kindTime:
+			var v time.Time
+			err = json.Unmarshal(c.Values[i], &v)
+			value = v
+		case kindString:
+			var v string
+			err = json.Unmarshal(c.Values[i], &v)
+			value = v
+		case kindInt:
+			var v int64
+			err = json.Unmarshal(c.Values[i], &v)
+			value = v
+		}
+		if err != nil {
+			return nil, ErrInvalidCursor
+		}
+		values = append(values, value)
+	}
+	return append(values, c.ID), nil
+}
@@ -0,0 +1,94 @@
+package pagelist
+
+import (
+	"encoding/base64"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/opalescencelabs/backend/models"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	created := time.Date(2024, 3, 1, 10, 0, 0, 123456789, time.UTC)
+	updated := created.Add(time.Hour)
+	page := models.Page{ID: 42, PageName: "Getting Started", IsFavourite: true, ViewCount: 7}
+	page.CreatedAt = created
+	neverUpdated := page
+	page.LastUpdatedAt = updated
+
+	tests := []struct {
+		name  string
+		sort  string
+		order string
+		page  models.Page
+		want  []interface{}
+	}{
+		{"default", SortDefault, "desc", page, []interface{}{true, updated, uint(42)}},
+		{"default never updated", SortDefault, "desc", neverUpdated, []interface{}{true, created, uint(42)}},
+		{"name", SortName, "asc", page, []interface{}{"getting started", uint(42)}},
+		{"created", SortCreated, "asc", page, []interface{}{created, uint(42)}},
+		{"updated", SortUpdated, "desc", page, []interface{}{updated, uint(42)}},
+		{"views", SortViews, "desc", page, []interface{}{int64(7), uint(42)}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			keys := sorts[tc.sort].keys
+			encoded, err := encodeCursor(tc.sort, tc.order, keys, tc.page)
+			if err != nil {
+				t.Fatalf("encodeCursor() = %v", err)
+			}
+			values, err := decodeCursor(encoded, tc.sort, tc.order, keys)
+			if err != nil {
+				t.Fatalf("decodeCursor() = %v", err)
+			}
+			if !reflect.DeepEqual(values, tc.want) {
+				t.Errorf("decodeCursor() = %#v, want %#v", values, tc.want)
+			}
+		})
+	}
+}
+
+func TestDecodeCursorInvalid(t *testing.T) {
+	page := models.Page{ID: 1, PageName: "Page"}
+	nameCursor, err := encodeCursor(SortName, "asc", sorts[SortName].keys, page)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encode := func(raw string) string { return base64.RawURLEncoding.EncodeToString([]byte(raw)) }
+
+	tests := []struct {
+		name    string
+		encoded string
+		sort    string
+		order   string
+	}{
+		{"not base64", "not a cursor!", SortName, "asc"},
+		{"not json", encode("cursor"), SortName, "asc"},
+		{"other sort", nameCursor, SortCreated, "asc"},
+		{"other order", nameCursor, SortName, "desc"},
+		{"missing values", encode(`{"s":"name","o":"asc","v":[],"id":1}`), SortName, "asc"},
+		{"value of another kind", encode(`{"s":"views","o":"desc","v":["many"],"id":1}`), SortViews, "desc"},
+		{"malformed time", encode(`{"s":"created","o":"desc","v":["yesterday"],"id":1}`), SortCreated, "desc"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := decodeCursor(tc.encoded, tc.sort, tc.order, sorts[tc.sort].keys); !errors.Is(err, ErrInvalidCursor) {
+				t.Errorf("decodeCursor() = %v, want ErrInvalidCursor", err)
+			}
+		})
+	}
+}
+
+func TestOptionsFiltered(t *testing.T) {
+	if (Options{Sort: SortName, Order: "asc", Limit: 10, Cursor: "x"}).Filtered() {
+		t.Error("Filtered() = true for sorting and pagination only")
+	}
+	for _, opts := range []Options{{RootOnly: true}, {ParentPageUUID: "p"}, {PublicOnly: true}, {FavouritesOnly: true},
+		{UpdatedSince: time.Now()}, {NameContains: "a"}, {TagIDs: []uint{1}}} {
+		if !opts.Filtered() {
+			t.Errorf("Filtered() = false for %+v", opts)
+		}
+	}
+}
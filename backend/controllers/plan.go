@@ -0,0 +1,68 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/opalescencelabs/backend/api"
+	"github.com/opalescencelabs/backend/controllers/auth"
+	"github.com/opalescencelabs/backend/controllers/plans"
+	"github.com/opalescencelabs/backend/database"
+)
+
+// respondLimitError writes the response for an error returned by a plans.Check function.
+// Exceeded limits are 402 if upgrading the plan would lift them, 403 otherwise.
+// Returns true if a response was written.
+func respondLimitError(c *gin.Context, err error) bool {
+	if err == nil {
+		return false
+	}
+
+	var limitErr *plans.LimitError
+	if !errors.As(err, &limitErr) {
+		fmt.Println("Failed to check plan limits: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check plan limits"})
+		return true
+	}
+
+	status := http.StatusForbidden
+	if limitErr.Upgradable {
+		status = http.StatusPaymentRequired
+	}
+	c.JSON(status, api.PlanLimitErrorResp{
+		Error:   "Plan limit exceeded: " + limitErr.Limit,
+		Limit:   limitErr.Limit,
+		Max:     limitErr.Max,
+		Current: limitErr.Current,
+		Status:  limitErr.Status,
+	})
+	return true
+}
+
+// PlanUsage is the handler for GET /plan-usage.
+// Returns the user's consumption against each limit of their plan.
+// Returns 200 on success, 401 on unauthorized, 500 on error.
+func PlanUsage(c *gin.Context) {
+	user := auth.MustCurrentUser(c)
+
+	usage, err := plans.GetUsage(database.DB, user.ID)
+	if err != nil {
+		fmt.Println("Failed to get plan usage: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get plan usage"})
+		return
+	}
+
+	limits := plans.LimitsFor(user.Status)
+	limitsResp := make([]api.PlanLimitResp, len(plans.LimitNames))
+	for i, name := range plans.LimitNames {
+		limitsResp[i] = api.PlanLimitResp{
+			Limit: name,
+			Used:  usage.Get(name),
+			Max:   limits.Get(name),
+		}
+	}
+
+	c.JSON(http.StatusOK, api.PlanUsageResp{Status: user.Status, Limits: limitsResp})
+}
@@ -0,0 +1,56 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/opalescencelabs/backend/api"
+	"github.com/opalescencelabs/backend/controllers/plans"
+)
+
+func TestRespondLimitError(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus int
+	}{
+		{"upgrade lifts the limit", &plans.LimitError{Limit: plans.LimitPublicPages, Max: 3, Current: 4, Status: "freemium", Upgradable: true}, http.StatusPaymentRequired},
+		{"no plan lifts the limit", &plans.LimitError{Limit: plans.LimitCollaborators, Max: 100, Current: 101, Status: "enterprise"}, http.StatusForbidden},
+		{"failed check", errors.New("connection refused"), http.StatusInternalServerError},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			if !respondLimitError(c, tc.err) {
+				t.Fatal("respondLimitError() = false, want true")
+			}
+			if w.Code != tc.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tc.wantStatus)
+			}
+
+			var limitErr *plans.LimitError
+			if !errors.As(tc.err, &limitErr) {
+				return
+			}
+			var resp api.PlanLimitErrorResp
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+			if resp.Limit != limitErr.Limit || resp.Max != limitErr.Max || resp.Current != limitErr.Current || resp.Status != limitErr.Status {
+				t.Errorf("response = %+v, want the fields of %+v", resp, limitErr)
+			}
+		})
+	}
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	if respondLimitError(c, nil) {
+		t.Error("respondLimitError(nil) = true, want false")
+	}
+}
@@ -0,0 +1,323 @@
+package plans
+
+import (
+	"fmt"
+
+	"github.com/opalescencelabs/backend/models"
+	"gorm.io/gorm"
+)
+
+// Unlimited marks a quota that is not enforced.
+const Unlimited int64 = -1
+
+// Names of the quotas, used in error responses and the usage endpoint.
+const (
+	LimitPages           = "pages"
+	LimitElementsPerPage = "elements_per_page"
+	LimitPublicPages     = "public_pages"
+	LimitNestingDepth    = "nesting_depth"
+	LimitCollaborators   = "collaborators"
+	LimitStorage         = "storage_bytes"
+)
+
+// Limits holds the quotas of a subscription tier.
+type Limits struct {
+	Pages           int64
+	ElementsPerPage int64
+	PublicPages     int64
+	NestingDepth    int64
+	Collaborators   int64
+	StorageBytes    int64
+}
+
+// Get returns the quota with the given name.
+func (l Limits) Get(name string) int64 {
+	switch name {
+	case LimitPages:
+		return l.Pages
+	case LimitElementsPerPage:
+		return l.ElementsPerPage
+	case LimitPublicPages:
+		return l.PublicPages
+	case LimitNestingDepth:
+		return l.NestingDepth
+	case LimitCollaborators:
+		return l.Collaborators
+	case LimitStorage:
+		return l.StorageBytes
+	}
+	return Unlimited
+}
+
+// Tiers in ascending order, matching the values allowed for models.User.Status.
+var Tiers = []string{"freemium", "premium", "enterprise"}
+
+// tierLimits holds the quotas of every tier.
+var tierLimits = map[string]Limits{
+	"freemium": {
+		Pages:           50,
+		ElementsPerPage: 100,
+		PublicPages:     3,
+		NestingDepth:    3,
+		Collaborators:   3,
+		StorageBytes:    10 << 20, // 10 MiB
+	},
+	"premium": {
+		Pages:           1000,
+		ElementsPerPage: 500,
+		PublicPages:     50,
+		NestingDepth:    10,
+		Collaborators:   25,
+		StorageBytes:    1 << 30, // 1 GiB
+	},
+	"enterprise": {
+		Pages:           Unlimited,
+		ElementsPerPage: Unlimited,
+		PublicPages:     Unlimited,
+		NestingDepth:    Unlimited,
+		Collaborators:   Unlimited,
+		StorageBytes:    Unlimited,
+	},
+}
+
+// LimitsFor returns the quotas of the given tier.
+// Unknown tiers get the freemium quotas.
+func LimitsFor(status string) Limits {
+	if limits, ok := tierLimits[status]; ok {
+		return limits
+	}
+	return tierLimits["freemium"]
+}
+
+// LimitError is returned when an action would exceed one of the user's quotas.
+type LimitError struct {
+	Limit   string
+	Max     int64
+	Current int64
+	Status  string
+	// Upgradable is true if a higher tier would allow the action.
+	Upgradable bool
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("%s plan limit exceeded for %s: %d of %d", e.Status, e.Limit, e.Current, e.Max)
+}
+
+// check returns a LimitError if a value of requested would exceed the named quota of the user's tier.
+func check(user models.User, name string, requested int64) error {
+	max := LimitsFor(user.Status).Get(name)
+	if max == Unlimited || requested <= max {
+		return nil
+	}
+
+	upgradable := false
+	for _, tier := range Tiers {
+		if higher := LimitsFor(tier).Get(name); higher == Unlimited || requested <= higher {
+			upgradable = tier != user.Status
+			break
+		}
+	}
+
+	return &LimitError{Limit: name, Max: max, Current: requested, Status: user.Status, Upgradable: upgradable}
+}
+
+// CheckPageCreate returns a LimitError if the user may not create another page
+// with the given visibility under the given parent page (empty for a root page).
+func CheckPageCreate(db *gorm.DB, user models.User, parentPageUUID string, public bool) error {
+	usage, err := GetUsage(db, user.ID)
+	if err != nil {
+		return err
+	}
+
+	if err := check(user, LimitPages, usage.Pages+1); err != nil {
+		return err
+	}
+	if public {
+		if err := check(user, LimitPublicPages, usage.PublicPages+1); err != nil {
+			return err
+		}
+	}
+	if parentPageUUID != "" {
+		depth, err := PageDepth(db, parentPageUUID)
+		if err != nil {
+			return err
+		}
+		if err := check(user, LimitNestingDepth, depth+1); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// CheckPublish returns a LimitError if the user may not make another page public.
+func CheckPublish(db *gorm.DB, user models.User) error {
+	return CheckPublishPages(db, user, 1)
+}
+
+// CheckPublishPages returns a LimitError if the user may not make count more pages public.
+func CheckPublishPages(db *gorm.DB, user models.User, count int64) error {
+	usage, err := GetUsage(db, user.ID)
+	if err != nil {
+		return err
+	}
+	return check(user, LimitPublicPages, usage.PublicPages+count)
+}
+
+// CheckElements returns a LimitError if a page may not hold the given number of elements,
+// or if replacing the page's elements with ones of contentBytes in total would exceed the user's storage.
+func CheckElements(db *gorm.DB, user models.User, pageID uint, elementCount int, contentBytes int64) error {
+	if err := check(user, LimitElementsPerPage, int64(elementCount)); err != nil {
+		return err
+	}
+
+	var otherBytes int64
+	if err := db.Model(&models.Element{}).
+		Where("user_id = ? AND page_id <> ?", user.ID, pageID).
+		Select("COALESCE(SUM(octet_length(content::text) + octet_length(etc::text)), 0)").
+		Scan(&otherBytes).Error; err != nil {
+		return err
+	}
+	return check(user, LimitStorage, otherBytes+contentBytes)
+}
+
+// CheckMove returns a LimitError if moving the page under the given parent would nest its sub-pages too deeply.
+func CheckMove(db *gorm.DB, user models.User, pageUUID string, parentPageUUID string) error {
+	depth, err := PageDepth(db, parentPageUUID)
+	if err != nil {
+		return err
+	}
+	height, err := SubtreeHeight(db, pageUUID)
+	if err != nil {
+		return err
+	}
+	return check(user, LimitNestingDepth, depth+height)
+}
+
+// CheckCollaborator returns a LimitError if the owner may not share a page with another collaborator.
+// Users the owner already shares a page with don't count as new collaborators.
+func CheckCollaborator(db *gorm.DB, owner models.User, collaboratorID uint) error {
+	var existing int64
+	if err := db.Model(&models.PageShare{}).
+		Joins("JOIN pages ON pages.id = page_shares.page_id").
+		Where("pages.user_id = ? AND page_shares.user_id = ?", owner.ID, collaboratorID).
+		Count(&existing).Error; err != nil {
+		return err
+	}
+	if existing > 0 {
+		return nil
+	}
+
+	usage, err := GetUsage(db, owner.ID)
+	if err != nil {
+		return err
+	}
+	return check(owner, LimitCollaborators, usage.Collaborators+1)
+}
+
+// PageDepth returns the nesting depth of a page, root pages having a depth of 1.
+func PageDepth(db *gorm.DB, pageUUID string) (int64, error) {
+	var depth int64
+	err := db.Raw(`
+		WITH RECURSIVE ancestors AS (
+			SELECT page_uuid, parent_page_uuid, 1 AS depth FROM pages WHERE page_uuid = ? AND deleted_at IS NULL
+			UNION ALL
+			SELECT p.page_uuid, p.parent_page_uuid, a.depth + 1 FROM pages p
+			JOIN ancestors a ON p.page_uuid = a.parent_page_uuid
+			WHERE p.deleted_at IS NULL AND a.depth < 1000
+		)
+		SELECT COALESCE(MAX(depth), 0) FROM ancestors`, pageUUID).Scan(&depth).Error
+	return depth, err
+}
+
+// SubtreeHeight returns the number of levels of a page and its sub-pages, a page without sub-pages having a height of 1.
+func SubtreeHeight(db *gorm.DB, pageUUID string) (int64, error) {
+	var height int64
+	err := db.Raw(`
+		WITH RECURSIVE descendants AS (
+			SELECT page_uuid, 1 AS height FROM pages WHERE page_uuid = ? AND deleted_at IS NULL
+			UNION ALL
+			SELECT p.page_uuid, d.height + 1 FROM pages p
+			JOIN descendants d ON p.parent_page_uuid = d.page_uuid
+			WHERE p.deleted_at IS NULL AND d.height < 1000
+		)
+		SELECT COALESCE(MAX(height), 0) FROM descendants`, pageUUID).Scan(&height).Error
+	return height, err
+}
+
+// Usage holds a user's consumption of each quota.
+type Usage struct {
+	Pages           int64
+	PublicPages     int64
+	MaxElements     int64
+	MaxNestingDepth int64
+	Collaborators   int64
+	StorageBytes    int64
+}
+
+// Get returns the consumption of the quota with the given name.
+func (u Usage) Get(name string) int64 {
+	switch name {
+	case LimitPages:
+		return u.Pages
+	case LimitElementsPerPage:
+		return u.MaxElements
+	case LimitPublicPages:
+		return u.PublicPages
+	case LimitNestingDepth:
+		return u.MaxNestingDepth
+	case LimitCollaborators:
+		return u.Collaborators
+	case LimitStorage:
+		return u.StorageBytes
+	}
+	return 0
+}
+
+// Names of all quotas, in the order they are reported.
+var LimitNames = []string{LimitPages, LimitElementsPerPage, LimitPublicPages, LimitNestingDepth, LimitCollaborators, LimitStorage}
+
+// GetUsage returns the user's consumption of each quota.
+// Per-page quotas (elements, nesting depth) report the user's largest page.
+func GetUsage(db *gorm.DB, userID uint) (Usage, error) {
+	var usage Usage
+
+	if err := db.Model(&models.Page{}).Where("user_id = ?", userID).Count(&usage.Pages).Error; err != nil {
+		return usage, err
+	}
+	if err := db.Model(&models.Page{}).Where("user_id = ? AND public_page = ?", userID, true).Count(&usage.PublicPages).Error; err != nil {
+		return usage, err
+	}
+	if err := db.Model(&models.Element{}).
+		Where("user_id = ?", userID).
+		Select("COALESCE(SUM(octet_length(content::text) + octet_length(etc::text)), 0)").
+		Scan(&usage.StorageBytes).Error; err != nil {
+		return usage, err
+	}
+	if err := db.Raw(`
+		SELECT COALESCE(MAX(n), 0) FROM (
+			SELECT COUNT(*) AS n FROM elements WHERE user_id = ? AND deleted_at IS NULL GROUP BY page_id
+		) counts`, userID).Scan(&usage.MaxElements).Error; err != nil {
+		return usage, err
+	}
+	if err := db.Model(&models.PageShare{}).
+		Joins("JOIN pages ON pages.id = page_shares.page_id").
+		Where("pages.user_id = ?", userID).
+		Distinct("page_shares.user_id").
+		Count(&usage.Collaborators).Error; err != nil {
+		return usage, err
+	}
+	if err := db.Raw(`
+		WITH RECURSIVE tree AS (
+			SELECT page_uuid, 1 AS depth FROM pages WHERE user_id = ? AND is_root AND deleted_at IS NULL
+			UNION ALL
+			SELECT p.page_uuid, t.depth + 1 FROM pages p
+			JOIN tree t ON p.parent_page_uuid = t.page_uuid
+			WHERE p.deleted_at IS NULL AND t.depth < 1000
+		)
+		SELECT COALESCE(MAX(depth), 0) FROM tree`, userID).Scan(&usage.MaxNestingDepth).Error; err != nil {
+		return usage, err
+	}
+
+	return usage, nil
+}
@@ -0,0 +1,54 @@
+package plans
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/opalescencelabs/backend/models"
+)
+
+func TestCheck(t *testing.T) {
+	// Enterprise collaborators are capped for the test, so some limits can't be lifted by upgrading
+	enterprise := tierLimits["enterprise"]
+	capped := enterprise
+	capped.Collaborators = 100
+	tierLimits["enterprise"] = capped
+	t.Cleanup(func() { tierLimits["enterprise"] = enterprise })
+
+	tests := []struct {
+		name           string
+		status         string
+		limit          string
+		requested      int64
+		wantErr        bool
+		wantUpgradable bool
+	}{
+		{"within the limit", "freemium", LimitPublicPages, 3, false, false},
+		{"over the limit of a lower tier", "freemium", LimitPublicPages, 4, true, true},
+		{"over the limit of every finite tier", "premium", LimitPublicPages, 51, true, true},
+		{"unlimited", "enterprise", LimitPublicPages, 1 << 40, false, false},
+		{"over a limit no tier lifts", "freemium", LimitCollaborators, 101, true, false},
+		{"over the limit of the highest tier", "enterprise", LimitCollaborators, 101, true, false},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			err := check(models.User{Status: tc.status}, tc.limit, tc.requested)
+			if !tc.wantErr {
+				if err != nil {
+					t.Errorf("check() = %v, want nil", err)
+				}
+				return
+			}
+			var limitErr *LimitError
+			if !errors.As(err, &limitErr) {
+				t.Fatalf("check() = %v, want a LimitError", err)
+			}
+			if limitErr.Upgradable != tc.wantUpgradable {
+				t.Errorf("check().Upgradable = %v, want %v", limitErr.Upgradable, tc.wantUpgradable)
+			}
+			if want := LimitsFor(tc.status).Get(tc.limit); limitErr.Max != want || limitErr.Current != tc.requested {
+				t.Errorf("check() = %+v, want max %d and current %d", limitErr, want, tc.requested)
+			}
+		})
+	}
+}
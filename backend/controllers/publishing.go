@@ -0,0 +1,147 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/opalescencelabs/backend/api"
+	"github.com/opalescencelabs/backend/controllers/audit"
+	"github.com/opalescencelabs/backend/controllers/auth"
+	"github.com/opalescencelabs/backend/controllers/plans"
+	"github.com/opalescencelabs/backend/controllers/publishing"
+	"github.com/opalescencelabs/backend/database"
+	"github.com/opalescencelabs/backend/models"
+	"gorm.io/gorm"
+)
+
+// respondScheduleError writes the response for an error returned by the publishing package.
+func respondScheduleError(c *gin.Context, err error, action string) {
+	switch {
+	case errors.Is(err, publishing.ErrInvalidTime), errors.Is(err, publishing.ErrTooManyPending):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, publishing.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Schedule not found"})
+	case errors.Is(err, publishing.ErrNotPending):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		fmt.Printf("Failed to %s: %s\n", action, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to " + action})
+	}
+}
+
+// toPublishScheduleResp converts a schedule to its response.
+func toPublishScheduleResp(schedule models.PublishSchedule) api.PublishScheduleResp {
+	return api.PublishScheduleResp{
+		ID:              schedule.ID,
+		Public:          schedule.Public,
+		IncludeSubPages: schedule.IncludeSubPages,
+		RunAt:           schedule.RunAt,
+		Status:          schedule.Status,
+		Attempts:        schedule.Attempts,
+		NextAttemptAt:   schedule.NextAttemptAt,
+		ExecutedAt:      schedule.ExecutedAt,
+		PagesChanged:    schedule.PagesChanged,
+		Error:           schedule.Error,
+		CreatedAt:       schedule.CreatedAt,
+	}
+}
+
+// PageSchedule is the handler for POST /page-schedule.
+// Schedules a page owned by the current user, and optionally its sub-pages, to become public or private at run_at.
+// The change is executed by the scheduler as PageUpdate would, resetting view counts. Plan limits are checked again
+// when it runs, the schedule fails if publishing the pages would exceed them.
+// Returns 200 on success, 400 on bad request, 401 on unauthorized, 402/403 on exceeded plan limits, 404 on not found, 500 on error.
+func PageSchedule(c *gin.Context) {
+	var request api.PageScheduleRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "details": err.Error()})
+		return
+	}
+
+	page, _, err := auth.AuthorizePage(c, request.PageUUID, auth.AccessOwner)
+	if err != nil {
+		respondAccessError(c, err)
+		return
+	}
+	if request.Public && !page.PublicPage {
+		if respondLimitError(c, plans.CheckPublish(database.DB, auth.MustCurrentUser(c))) {
+			return
+		}
+	}
+
+	var schedule models.PublishSchedule
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if schedule, err = publishing.Schedule(tx, page, auth.MustCurrentUserID(c), request.Public, request.IncludeSubPages, request.RunAt); err != nil {
+			return err
+		}
+		return audit.Record(tx, audit.FromRequest(c, audit.ActionPageScheduled, audit.TargetPage, page.PageUUID, map[string]interface{}{
+			"schedule_id": schedule.ID, "public": schedule.Public, "include_sub_pages": schedule.IncludeSubPages, "run_at": schedule.RunAt,
+		}))
+	})
+	if err != nil {
+		respondScheduleError(c, err, "schedule page")
+		return
+	}
+
+	c.JSON(http.StatusOK, api.PageScheduleResp{Schedule: toPublishScheduleResp(schedule)})
+}
+
+// PageScheduleCancel is the handler for POST /page-schedule-cancel.
+// Cancels a pending schedule of a page owned by the current user.
+// Returns 200 on success, 400 on bad request, 401 on unauthorized, 404 on not found, 409 if not pending, 500 on error.
+func PageScheduleCancel(c *gin.Context) {
+	var request api.PageScheduleCancelRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "details": err.Error()})
+		return
+	}
+
+	schedule, err := publishing.Get(database.DB, auth.MustCurrentUserID(c), request.ScheduleID)
+	if err != nil {
+		respondScheduleError(c, err, "cancel schedule")
+		return
+	}
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		var page models.Page
+		if err := tx.First(&page, "id = ?", schedule.PageID).Error; err != nil {
+			return err
+		}
+		if schedule, err = publishing.Cancel(tx, schedule); err != nil {
+			return err
+		}
+		return audit.Record(tx, audit.FromRequest(c, audit.ActionPageScheduleCancelled, audit.TargetPage, page.PageUUID,
+			map[string]interface{}{"schedule_id": schedule.ID}))
+	})
+	if err != nil {
+		respondScheduleError(c, err, "cancel schedule")
+		return
+	}
+
+	c.JSON(http.StatusOK, api.PageScheduleCancelResp{Schedule: toPublishScheduleResp(schedule)})
+}
+
+// PageScheduleList is the handler for GET /page-schedule-list/:page_uuid.
+// Returns the pending and past schedules of a page owned by the current user, latest first.
+// Returns 200 on success, 401 on unauthorized, 403 on forbidden, 404 on not found, 500 on error.
+func PageScheduleList(c *gin.Context) {
+	page, _, err := auth.AuthorizePage(c, c.Param("page_uuid"), auth.AccessOwner)
+	if err != nil {
+		respondAccessError(c, err)
+		return
+	}
+
+	schedules, err := publishing.List(database.DB, page.ID)
+	if err != nil {
+		respondScheduleError(c, err, "list schedules")
+		return
+	}
+
+	resp := api.PageScheduleListResp{Schedules: make([]api.PublishScheduleResp, len(schedules))}
+	for i, schedule := range schedules {
+		resp.Schedules[i] = toPublishScheduleResp(schedule)
+	}
+	c.JSON(http.StatusOK, resp)
+}
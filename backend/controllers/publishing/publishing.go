@@ -0,0 +1,356 @@
+package publishing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/opalescencelabs/backend/api/caching"
+	"github.com/opalescencelabs/backend/controllers/audit"
+	"github.com/opalescencelabs/backend/controllers/drafts"
+	"github.com/opalescencelabs/backend/controllers/plans"
+	"github.com/opalescencelabs/backend/controllers/webhooks"
+	"github.com/opalescencelabs/backend/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Statuses of schedules.
+const (
+	// StatusPending schedules are executed at RunAt, or retried at NextAttemptAt after an error.
+	StatusPending = "pending"
+	StatusDone    = "done"
+	// StatusFailed schedules could not be executed, e.g. because of the owner's plan limits or after MaxAttempts
+	// errors, see Error.
+	StatusFailed    = "failed"
+	StatusCancelled = "cancelled"
+)
+
+// MaxPending bounds the number of pending schedules of a page.
+const MaxPending = 10
+
+// MaxAhead bounds how far in the future a change may be scheduled.
+const MaxAhead = 365 * 24 * time.Hour
+
+// MaxAttempts bounds the number of executions of a schedule failing with an error, retried with exponential backoff.
+const MaxAttempts = 5
+
+// Bounds of the delay before retrying a schedule, doubled after every attempt.
+const (
+	BaseBackoff = time.Minute
+	MaxBackoff  = time.Hour
+)
+
+// runBatchSize bounds the number of schedules executed per run of the scheduler.
+const runBatchSize = 50
+
+var (
+	// ErrInvalidTime is returned for times in the past or more than MaxAhead in the future.
+	ErrInvalidTime = errors.New("run_at must be in the future, at most a year ahead")
+	// ErrTooManyPending is returned when the page already has MaxPending pending schedules.
+	ErrTooManyPending = errors.New("at most 10 pending schedules per page")
+	// ErrNotFound is returned for schedules that don't exist or belong to another user.
+	ErrNotFound = errors.New("schedule not found")
+	// ErrNotPending is returned when cancelling a schedule that was already executed or cancelled.
+	ErrNotPending = errors.New("schedule is not pending")
+)
+
+// Schedule schedules a page, and its sub-pages if includeSubPages is true, to become public or private at runAt.
+func Schedule(db *gorm.DB, page models.Page, userID uint, public bool, includeSubPages bool, runAt time.Time) (models.PublishSchedule, error) {
+	now := time.Now()
+	if !runAt.After(now) || runAt.After(now.Add(MaxAhead)) {
+		return models.PublishSchedule{}, ErrInvalidTime
+	}
+	var count int64
+	if err := db.Model(&models.PublishSchedule{}).Where("page_id = ? AND status = ?", page.ID, StatusPending).Count(&count).Error; err != nil {
+		return models.PublishSchedule{}, err
+	}
+	if count >= MaxPending {
+		return models.PublishSchedule{}, ErrTooManyPending
+	}
+
+	schedule := models.PublishSchedule{
+		UserID: userID, PageID: page.ID, Public: public, IncludeSubPages: includeSubPages, RunAt: runAt, Status: StatusPending,
+	}
+	if err := db.Omit("id").Create(&schedule).Error; err != nil {
+		return models.PublishSchedule{}, err
+	}
+	return schedule, nil
+}
+
+// Get returns a schedule of a page owned by the user.
+func Get(db *gorm.DB, userID uint, scheduleID uint) (models.PublishSchedule, error) {
+	var schedule models.PublishSchedule
+	if err := db.Where("id = ? AND page_id IN (SELECT id FROM pages WHERE user_id = ?)", scheduleID, userID).First(&schedule).Error; err != nil {
+		return models.PublishSchedule{}, ErrNotFound
+	}
+	return schedule, nil
+}
+
+// Cancel cancels a pending schedule.
+func Cancel(db *gorm.DB, schedule models.PublishSchedule) (models.PublishSchedule, error) {
+	result := db.Model(&schedule).Where("status = ?", StatusPending).Update("status", StatusCancelled)
+	if result.Error != nil {
+		return models.PublishSchedule{}, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return models.PublishSchedule{}, ErrNotPending
+	}
+	schedule.Status = StatusCancelled
+	return schedule, nil
+}
+
+// CancelPages cancels the pending schedules of the pages, e.g. when they are transferred to another user.
+func CancelPages(tx *gorm.DB, pageUUIDs []string, reason string) error {
+	return tx.Model(&models.PublishSchedule{}).
+		Where("status = ? AND page_id IN (SELECT id FROM pages WHERE page_uuid IN ?)", StatusPending, pageUUIDs).
+		Updates(map[string]interface{}{"status": StatusCancelled, "error": reason}).Error
+}
+
+// List returns the schedules of a page, latest first.
+func List(db *gorm.DB, pageID uint) ([]models.PublishSchedule, error) {
+	var schedules []models.PublishSchedule
+	err := db.Where("page_id = ?", pageID).Order("run_at DESC, id DESC").Limit(50).Find(&schedules).Error
+	return schedules, err
+}
+
+// subtree returns the UUIDs of a page and its sub-pages of the same owner, at any depth.
+func subtree(tx *gorm.DB, page models.Page) ([]string, error) {
+	var pageUUIDs []string
+	err := tx.Raw(`
+		WITH RECURSIVE subtree AS (
+			SELECT page_uuid FROM pages WHERE id = ? AND deleted_at IS NULL
+			UNION
+			SELECT p.page_uuid FROM pages p
+			JOIN subtree s ON p.parent_page_uuid = s.page_uuid
+			WHERE p.user_id = ? AND p.deleted_at IS NULL
+		)
+		SELECT page_uuid FROM subtree`, page.ID, page.UserID).Scan(&pageUUIDs).Error
+	return pageUUIDs, err
+}
+
+// SetVisibility makes pages public or private as PageUpdate does: their view counts are reset, pages made public for
+// the first time are published, and the change of each page is recorded in the audit log from entry, page.published
+// or page.unpublished unless entry has an action, and delivered to the owner's webhooks.
+// Pages that already have the visibility are left as they are. The caller invalidates the cached views of the changed
+// pages and of their parents. Returns the changed pages.
+func SetVisibility(tx *gorm.DB, pages []models.Page, public bool, entry audit.Entry) ([]models.Page, error) {
+	var changed []models.Page
+	for _, page := range pages {
+		if page.PublicPage != public {
+			changed = append(changed, page)
+		}
+	}
+	if len(changed) == 0 {
+		return nil, nil
+	}
+
+	pageIDs := make([]uint, len(changed))
+	for i, page := range changed {
+		pageIDs[i] = page.ID
+	}
+	if err := tx.Model(&models.Page{}).Where("id IN ?", pageIDs).
+		Updates(map[string]interface{}{"public_page": public, "view_count": 0, "excluded_view_count": 0, "views_reset_at": time.Now()}).Error; err != nil {
+		return nil, err
+	}
+	if err := tx.Where("page_id IN ?", pageIDs).Delete(&models.PageView{}).Error; err != nil {
+		return nil, err
+	}
+
+	action, event := audit.ActionPageUnpublished, webhooks.EventPageUnpublished
+	if public {
+		action, event = audit.ActionPagePublished, webhooks.EventPagePublished
+	}
+	if entry.Action != "" {
+		action = entry.Action
+	}
+	for i := range changed {
+		page := &changed[i]
+		page.PublicPage = public
+		page.ViewCount, page.ExcludedViewCount = 0, 0
+		if public {
+			publishedBy := page.UserID
+			if entry.ActorID != nil {
+				publishedBy = *entry.ActorID
+			}
+			if err := drafts.EnsurePublished(tx, *page, publishedBy); err != nil {
+				return nil, err
+			}
+		}
+		pageEntry := entry
+		pageEntry.Action, pageEntry.TargetType, pageEntry.TargetID = action, audit.TargetPage, page.PageUUID
+		if err := audit.Record(tx, pageEntry); err != nil {
+			return nil, err
+		}
+		if err := webhooks.Enqueue(tx, page.UserID, event, webhooks.PageData(*page)); err != nil {
+			return nil, err
+		}
+	}
+	return changed, nil
+}
+
+// Unpublish makes pages private with SetVisibility, e.g. when an admin unpublishes them or their owner is downgraded,
+// and cancels their pending schedules making them public again, giving reason.
+func Unpublish(tx *gorm.DB, pages []models.Page, entry audit.Entry, reason string) ([]models.Page, error) {
+	pageIDs := make([]uint, len(pages))
+	for i, page := range pages {
+		pageIDs[i] = page.ID
+	}
+	if err := tx.Model(&models.PublishSchedule{}).Where("status = ? AND public AND page_id IN ?", StatusPending, pageIDs).
+		Updates(map[string]interface{}{"status": StatusCancelled, "error": reason}).Error; err != nil {
+		return nil, err
+	}
+	return SetVisibility(tx, pages, false, entry)
+}
+
+// execute changes the visibility of the pages of a schedule with SetVisibility, as performed by the system.
+// Returns the changed pages, or a message if the schedule can't be executed.
+func execute(tx *gorm.DB, schedule models.PublishSchedule) ([]models.Page, string, error) {
+	var page models.Page
+	if err := tx.First(&page, "id = ?", schedule.PageID).Error; err != nil {
+		return nil, "page not found", nil
+	}
+	pageUUIDs := []string{page.PageUUID}
+	if schedule.IncludeSubPages {
+		var err error
+		if pageUUIDs, err = subtree(tx, page); err != nil {
+			return nil, "", err
+		}
+	}
+	var pages []models.Page
+	if err := tx.Where("page_uuid IN ? AND user_id = ? AND public_page <> ?", pageUUIDs, page.UserID, schedule.Public).Find(&pages).Error; err != nil {
+		return nil, "", err
+	}
+	if len(pages) == 0 {
+		return nil, "", nil
+	}
+
+	if schedule.Public {
+		var owner models.User
+		if err := tx.First(&owner, "id = ?", page.UserID).Error; err != nil {
+			return nil, "", err
+		}
+		err := plans.CheckPublishPages(tx, owner, int64(len(pages)))
+		var limitErr *plans.LimitError
+		if errors.As(err, &limitErr) {
+			return nil, limitErr.Error(), nil
+		}
+		if err != nil {
+			return nil, "", err
+		}
+	}
+
+	changed, err := SetVisibility(tx, pages, schedule.Public, audit.Entry{
+		Details: map[string]interface{}{"schedule_id": schedule.ID, "scheduled_by": schedule.UserID},
+	})
+	return changed, "", err
+}
+
+// Backoff returns the delay before the attempt following the given number of attempts.
+func Backoff(attempts int) time.Duration {
+	delay := BaseBackoff
+	for i := 1; i < attempts && delay < MaxBackoff; i++ {
+		delay *= 2
+	}
+	return min(delay, MaxBackoff)
+}
+
+// retry returns the updates of a schedule whose execution failed with err: it is attempted again after Backoff,
+// and fails once it was attempted MaxAttempts times.
+func retry(schedule models.PublishSchedule, err error, now time.Time) map[string]interface{} {
+	attempts := schedule.Attempts + 1
+	updates := map[string]interface{}{"attempts": attempts, "error": err.Error()}
+	if attempts >= MaxAttempts {
+		updates["status"], updates["executed_at"], updates["next_attempt_at"] = StatusFailed, now, nil
+	} else {
+		updates["next_attempt_at"] = now.Add(Backoff(attempts))
+	}
+	return updates
+}
+
+// runNext executes the next due pending schedule, locked so other instances of the app skip it, in a transaction
+// marking it done or failed. Schedules failing with an error are rolled back and retried, see retry, so they don't
+// hold back the schedules due after them. Returns false if no schedule is due.
+func runNext(ctx context.Context, db *gorm.DB, now time.Time) (bool, error) {
+	var changed []models.Page
+	ran := false
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var schedule models.PublishSchedule
+		result := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status = ? AND run_at <= ? AND (next_attempt_at IS NULL OR next_attempt_at <= ?)", StatusPending, now, now).
+			Order("run_at, id").Limit(1).Find(&schedule)
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		ran = true
+
+		var failure string
+		// The nested transaction rolls back to a savepoint, keeping the lock on the schedule to record the error
+		err := tx.Transaction(func(tx *gorm.DB) error {
+			var err error
+			changed, failure, err = execute(tx, schedule)
+			return err
+		})
+		if err != nil {
+			fmt.Printf("Failed to execute publish schedule %d: %s\n", schedule.ID, err)
+			changed = nil
+			return tx.Model(&schedule).Updates(retry(schedule, err, now)).Error
+		}
+		updates := map[string]interface{}{
+			"status": StatusDone, "attempts": schedule.Attempts + 1, "next_attempt_at": nil, "executed_at": now,
+			"pages_changed": len(changed), "error": "",
+		}
+		if failure != "" {
+			updates["status"], updates["error"] = StatusFailed, failure
+		}
+		return tx.Model(&schedule).Updates(updates).Error
+	})
+	if err != nil {
+		return false, err
+	}
+
+	// The views of the pages and of their parents, which list public sub-pages, changed
+	pageUUIDs := make([]string, 0, 2*len(changed))
+	for _, page := range changed {
+		pageUUIDs = append(pageUUIDs, page.PageUUID, page.ParentPageUUID)
+	}
+	caching.InvalidatePages(ctx, pageUUIDs...)
+	return ran, nil
+}
+
+// Run executes the due pending schedules. Returns the number of schedules executed, including those that failed
+// and are retried later.
+func Run(ctx context.Context, db *gorm.DB, now time.Time) (int, error) {
+	executed := 0
+	for executed < runBatchSize {
+		if ctx.Err() != nil {
+			return executed, ctx.Err()
+		}
+		ran, err := runNext(ctx, db, now)
+		if err != nil || !ran {
+			return executed, err
+		}
+		executed++
+	}
+	return executed, nil
+}
+
+// RunScheduler executes due schedules every interval until ctx is cancelled.
+// Schedules are stored in the database, so they survive restarts and are executed once due if the app was down.
+func RunScheduler(ctx context.Context, db *gorm.DB, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := Run(ctx, db, time.Now()); err != nil && !errors.Is(err, context.Canceled) {
+			fmt.Println("Failed to run publish schedules: ", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
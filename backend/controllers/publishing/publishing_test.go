@@ -0,0 +1,70 @@
+package publishing
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/opalescencelabs/backend/models"
+)
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{0, BaseBackoff},
+		{1, BaseBackoff},
+		{2, 2 * BaseBackoff},
+		{4, 8 * BaseBackoff},
+		{6, 32 * BaseBackoff},
+		{7, MaxBackoff},
+		{100, MaxBackoff},
+	}
+	for _, tc := range tests {
+		if got := Backoff(tc.attempts); got != tc.want {
+			t.Errorf("Backoff(%d) = %v, want %v", tc.attempts, got, tc.want)
+		}
+	}
+}
+
+func TestRetry(t *testing.T) {
+	now := time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC)
+	errExecute := errors.New("connection reset")
+	tests := []struct {
+		name          string
+		attempts      int
+		wantStatus    interface{}
+		wantNextAfter time.Duration
+	}{
+		{"first failure", 0, nil, BaseBackoff},
+		{"later failure", 2, nil, 4 * BaseBackoff},
+		{"last attempt", MaxAttempts - 1, StatusFailed, 0},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			updates := retry(models.PublishSchedule{Attempts: tc.attempts, Status: StatusPending}, errExecute, now)
+			if updates["attempts"] != tc.attempts+1 {
+				t.Errorf("retry() attempts = %v, want %d", updates["attempts"], tc.attempts+1)
+			}
+			if updates["error"] != errExecute.Error() {
+				t.Errorf("retry() error = %v, want %q", updates["error"], errExecute)
+			}
+			if updates["status"] != tc.wantStatus {
+				t.Errorf("retry() status = %v, want %v", updates["status"], tc.wantStatus)
+			}
+			if tc.wantStatus == StatusFailed {
+				if next, ok := updates["next_attempt_at"]; !ok || next != nil {
+					t.Errorf("retry() next_attempt_at = %v, want nil", next)
+				}
+				if updates["executed_at"] != now {
+					t.Errorf("retry() executed_at = %v, want %v", updates["executed_at"], now)
+				}
+				return
+			}
+			if next := updates["next_attempt_at"]; next != now.Add(tc.wantNextAfter) {
+				t.Errorf("retry() next_attempt_at = %v, want %v", next, now.Add(tc.wantNextAfter))
+			}
+		})
+	}
+}
@@ -0,0 +1,47 @@
+package ratelimit
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/opalescencelabs/backend/api/caching"
+)
+
+// Middleware limits each client IP to limit requests per window on the routes it is used on.
+// Routes sharing a name share the limit. Requests over the limit are rejected with 429 and a Retry-After header.
+// Requests are let through if the limiter fails, rate limiting is not worth an outage.
+func Middleware(name string, limit int64, window time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		allowed, retryAfter, err := caching.DefaultLimiter.Allow(c, name+":"+c.ClientIP(), limit, window)
+		if err != nil {
+			fmt.Printf("Failed to rate limit %s: %s\n", name, err)
+			c.Next()
+			return
+		}
+		if !allowed {
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": "Too many requests"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// GetTrustedProxies returns the proxies, as IPs or CIDRs, trusted to set the client IP through X-Forwarded-For.
+// The client IP limits requests, identifies visitors in page views and is recorded in the audit log.
+// No proxy is trusted unless TRUSTED_PROXIES lists them comma separated, so the header can't be spoofed.
+func GetTrustedProxies() []string {
+	var proxies []string
+	for _, proxy := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		if proxy = strings.TrimSpace(proxy); proxy != "" {
+			proxies = append(proxies, proxy)
+		}
+	}
+	return proxies
+}
@@ -0,0 +1,80 @@
+package ratelimit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/opalescencelabs/backend/api/caching"
+)
+
+func TestGetTrustedProxies(t *testing.T) {
+	tests := []struct {
+		env  string
+		want []string
+	}{
+		{"", nil},
+		{" , ", nil},
+		{"10.0.0.1", []string{"10.0.0.1"}},
+		{"10.0.0.0/8, 192.168.1.1", []string{"10.0.0.0/8", "192.168.1.1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.env, func(t *testing.T) {
+			t.Setenv("TRUSTED_PROXIES", tt.env)
+			got := GetTrustedProxies()
+			if len(got) != len(tt.want) {
+				t.Fatalf("GetTrustedProxies() = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("GetTrustedProxies() = %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	defaultLimiter := caching.DefaultLimiter
+	t.Cleanup(func() { caching.DefaultLimiter = defaultLimiter })
+
+	tests := []struct {
+		name    string
+		proxies string
+		// Statuses of requests from the same proxy, each with its own X-Forwarded-For
+		want []int
+	}{
+		{"spoofed header is ignored", "", []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests}},
+		{"header of trusted proxy is used", "192.0.2.1", []int{http.StatusOK, http.StatusOK, http.StatusOK}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			caching.DefaultLimiter = caching.NewMemoryLimiter()
+			t.Setenv("TRUSTED_PROXIES", tt.proxies)
+			r := gin.New()
+			if err := r.SetTrustedProxies(GetTrustedProxies()); err != nil {
+				t.Fatal(err)
+			}
+			r.GET("/limited", Middleware("test", 2, time.Minute), func(c *gin.Context) {
+				c.Status(http.StatusOK)
+			})
+
+			for i, want := range tt.want {
+				req := httptest.NewRequest(http.MethodGet, "/limited", nil)
+				req.RemoteAddr = "192.0.2.1:1234"
+				req.Header.Set("X-Forwarded-For", "203.0.113."+string(rune('1'+i)))
+				w := httptest.NewRecorder()
+				r.ServeHTTP(w, req)
+				if w.Code != want {
+					t.Errorf("request %d: status = %d, want %d", i+1, w.Code, want)
+				}
+				if w.Code == http.StatusTooManyRequests && w.Header().Get("Retry-After") == "" {
+					t.Errorf("request %d: Retry-After is missing", i+1)
+				}
+			}
+		})
+	}
+}
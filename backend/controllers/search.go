@@ -0,0 +1,142 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/opalescencelabs/backend/api"
+	"github.com/opalescencelabs/backend/controllers/auth"
+	"github.com/opalescencelabs/backend/controllers/search"
+	"github.com/opalescencelabs/backend/database"
+	"github.com/opalescencelabs/backend/models"
+)
+
+// Bounds of the number of search results per request.
+const (
+	defaultSearchLimit = 20
+	maxSearchLimit     = 100
+)
+
+// Public search is rate limited per client IP, see ratelimit.Middleware.
+const (
+	PublicSearchRateLimit  = 30
+	PublicSearchRateWindow = time.Minute
+)
+
+// normalizeSearchPagination defaults the limit, and responds with 400 if the limit or offset is out of bounds.
+// Returns false if the request was responded to.
+func normalizeSearchPagination(c *gin.Context, limit *int, offset int) bool {
+	if *limit <= 0 {
+		*limit = defaultSearchLimit
+	}
+	if *limit > maxSearchLimit || offset < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Limit must be at most %d and offset positive", maxSearchLimit)})
+		return false
+	}
+	return true
+}
+
+// toPageSearchMatches converts the matching elements of a search result to their response.
+func toPageSearchMatches(matches []search.Match) []api.PageSearchMatch {
+	resp := make([]api.PageSearchMatch, len(matches))
+	for i, match := range matches {
+		resp[i] = api.PageSearchMatch{ElementUUID: match.ElementUUID, Type: match.Type, Snippet: match.Snippet}
+	}
+	return resp
+}
+
+// toPageSearchResults converts search results to their response.
+func toPageSearchResults(results []search.Result) []api.PageSearchResult {
+	resp := make([]api.PageSearchResult, len(results))
+	for i, result := range results {
+		resp[i] = api.PageSearchResult{
+			PageUUID:       result.PageUUID,
+			PageName:       result.PageName,
+			ParentPageUUID: result.ParentPageUUID,
+			PublicPage:     result.PublicPage,
+			IsFavourite:    result.IsFavourite,
+			Rank:           result.Rank,
+			Matches:        toPageSearchMatches(result.Matches),
+		}
+	}
+	return resp
+}
+
+// PageSearch is the handler for GET /page-search.
+// Searches the names and element text of the current user's pages, the last word matching as a prefix.
+// Results are ranked, with highlighted snippets of the matching elements.
+// Returns 200 on success, 400 on bad request, 401 on unauthorized, 500 on error.
+func PageSearch(c *gin.Context) {
+	var request api.PageSearchRequest
+	if err := c.ShouldBindQuery(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "details": err.Error()})
+		return
+	}
+	if !normalizeSearchPagination(c, &request.Limit, request.Offset) {
+		return
+	}
+
+	allTags, err := parseTagMatch(request.TagMatch)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	filters := search.Filters{
+		Public:         request.Public,
+		Favourite:      request.Favourite,
+		ParentPageUUID: request.ParentPageUUID,
+		TagIDs:         request.TagIDs,
+		AllTags:        allTags,
+	}
+	results, err := search.Search(database.DB, auth.MustCurrentUserID(c), request.Query, filters, request.Limit, request.Offset)
+	if err != nil {
+		fmt.Println("Failed to search pages: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to search pages"})
+		return
+	}
+
+	c.JSON(http.StatusOK, api.PageSearchResp{Results: toPageSearchResults(results)})
+}
+
+// PublicPageSearch is the handler for GET /page-search-public.
+// Searches the public pages under a public root page, given by UUID or slug, without authentication.
+// Private pages and their sub-pages are never searched, and a private root is not found, so their existence isn't revealed.
+// Returns 200 on success, 400 on bad request, 404 if the root page is not found, 429 if rate limited, 500 on error.
+func PublicPageSearch(c *gin.Context) {
+	var request api.PublicPageSearchRequest
+	if err := c.ShouldBindQuery(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "details": err.Error()})
+		return
+	}
+	if !normalizeSearchPagination(c, &request.Limit, request.Offset) {
+		return
+	}
+
+	var root models.Page
+	if err := database.DB.Where("(page_uuid = ? OR slug = ?) AND public_page", request.Root, request.Root).First(&root).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Page not found"})
+		return
+	}
+
+	results, err := search.SearchPublic(database.DB, root, request.Query, request.Limit, request.Offset)
+	if err != nil {
+		fmt.Println("Failed to search public pages: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to search pages"})
+		return
+	}
+
+	resp := api.PublicPageSearchResp{Results: make([]api.PublicPageSearchResult, len(results))}
+	for i, result := range results {
+		resp.Results[i] = api.PublicPageSearchResult{
+			PageUUID:       result.PageUUID,
+			PageName:       result.PageName,
+			ParentPageUUID: result.ParentPageUUID,
+			Rank:           result.Rank,
+			Matches:        toPageSearchMatches(result.Matches),
+		}
+	}
+	c.JSON(http.StatusOK, resp)
+}
@@ -0,0 +1,257 @@
+package search
+
+import (
+	"html"
+	"regexp"
+	"strings"
+
+	"github.com/opalescencelabs/backend/controllers/tags"
+	"github.com/opalescencelabs/backend/models"
+	"gorm.io/gorm"
+)
+
+// Config is the Postgres text search configuration pages are indexed with.
+const Config = "english"
+
+// TextTypes are the element types whose text is indexed, other elements (e.g. embeds) hold no searchable text.
+var TextTypes = []string{"Paragraph", "Heading 1", "Heading 2", "Heading 3", "Callout", "Code Block", "Checkbox"}
+
+// headingTypes are weighted above other text when ranking.
+var headingTypes = []string{"Heading 1", "Heading 2", "Heading 3"}
+
+// Markers ts_headline wraps matches in, replaced with <mark> tags once the snippet is HTML escaped.
+const (
+	startMarker = "\x02"
+	stopMarker  = "\x03"
+)
+
+// headlineOptions configures the snippets of matching elements.
+const headlineOptions = "StartSel=" + startMarker + ", StopSel=" + stopMarker + ", MaxWords=25, MinWords=8, MaxFragments=2, FragmentDelimiter=\" … \""
+
+// maxMatchesPerPage bounds the matching elements returned for each page.
+const maxMatchesPerPage = 3
+
+var termPattern = regexp.MustCompile(`[\p{L}\p{N}_]+`)
+
+// Page vectors weight the page name highest, element vectors weight headings above other text
+var (
+	pageVector    = "setweight(to_tsvector('" + Config + "', COALESCE(page_name, '')), 'A')"
+	elementVector = "CASE WHEN type IN @headings THEN setweight(to_tsvector('" + Config + "', COALESCE(content->>'text', '')), 'B')" +
+		" WHEN type IN @types THEN setweight(to_tsvector('" + Config + "', COALESCE(content->>'text', '')), 'C') END"
+)
+
+// IndexPage updates the search vectors of a page and its elements.
+// Call it with the transaction changing the page, so the index is always up to date.
+func IndexPage(tx *gorm.DB, pageUUID string) error {
+	if err := tx.Exec("UPDATE pages SET search_vector = "+pageVector+" WHERE page_uuid = @page",
+		map[string]interface{}{"page": pageUUID}).Error; err != nil {
+		return err
+	}
+	return tx.Exec("UPDATE elements SET search_vector = "+elementVector+" WHERE page_id = (SELECT id FROM pages WHERE page_uuid = @page)",
+		map[string]interface{}{"page": pageUUID, "headings": headingTypes, "types": TextTypes}).Error
+}
+
+// IndexMissing indexes the pages and elements that have never been indexed, e.g. created before search existed.
+func IndexMissing(db *gorm.DB) error {
+	if err := db.Exec("UPDATE pages SET search_vector = " + pageVector + " WHERE search_vector IS NULL").Error; err != nil {
+		return err
+	}
+	return db.Exec("UPDATE elements SET search_vector = "+elementVector+" WHERE search_vector IS NULL AND type IN @types",
+		map[string]interface{}{"headings": headingTypes, "types": TextTypes}).Error
+}
+
+// Query returns the tsquery matching every term of the search text, the last term as a prefix so results
+// show up while typing. Returns an empty string if the text has no terms.
+func Query(text string) string {
+	terms := termPattern.FindAllString(strings.ToLower(text), 16)
+	if len(terms) == 0 {
+		return ""
+	}
+	for i, term := range terms {
+		terms[i] = "'" + term + "'"
+	}
+	terms[len(terms)-1] += ":*"
+	return strings.Join(terms, " & ")
+}
+
+// Filters restricts a search, nil fields don't filter.
+type Filters struct {
+	Public         *bool
+	Favourite      *bool
+	ParentPageUUID *string
+	// TagIDs restricts the search to pages with any of the tags, or all of them if AllTags is true
+	TagIDs  []uint
+	AllTags bool
+}
+
+// Match is an element of a page matching a search.
+type Match struct {
+	ElementUUID string
+	Type        string
+	// Snippet is the HTML escaped text around the matches, which are wrapped in <mark> tags.
+	Snippet string
+}
+
+// Result is a page matching a search.
+type Result struct {
+	PageUUID       string
+	PageName       string
+	ParentPageUUID string
+	PublicPage     bool
+	IsFavourite    bool
+	Rank           float64
+	// Matches holds the best matching elements of the page, empty if only its name matches.
+	Matches []Match
+}
+
+// scope restricts the pages a search matches.
+type scope struct {
+	// with defines common table expressions the conditions may use, each followed by a comma
+	with  string
+	pages string
+	// elements selects the elements searched: page_id, element_uuid, type, content and search_vector
+	elements string
+	args     map[string]interface{}
+}
+
+// draftElements selects the elements of the user's pages as they are edited.
+const draftElements = "SELECT page_id, element_uuid, type, content, search_vector FROM elements WHERE user_id = @user AND deleted_at IS NULL"
+
+// publishedElements selects the elements of the published versions of the pages in tree, indexed on the fly,
+// so that visitors don't find text the owner hasn't published. Pages that were never published have none.
+var publishedElements = "SELECT page_id, element_uuid, type, content, " + elementVector + ` AS search_vector FROM (
+		SELECT page_snapshots.page_id, element->>'element_uuid' AS element_uuid, element->>'type' AS type, element->'content' AS content
+		FROM page_snapshots, jsonb_array_elements(page_snapshots.elements) AS element
+		WHERE page_snapshots.page_id IN (SELECT id FROM tree) AND jsonb_typeof(page_snapshots.elements) = 'array'
+	) published`
+
+// Search returns the user's pages whose name or element text matches the search text, best matches first.
+func Search(db *gorm.DB, userID uint, text string, filters Filters, limit int, offset int) ([]Result, error) {
+	s := scope{
+		pages:    "pages.user_id = @user",
+		elements: draftElements,
+		args:     map[string]interface{}{"user": userID},
+	}
+	if filters.Public != nil {
+		s.pages += " AND pages.public_page = @public"
+		s.args["public"] = *filters.Public
+	}
+	if filters.Favourite != nil {
+		s.pages += " AND pages.is_favourite = @favourite"
+		s.args["favourite"] = *filters.Favourite
+	}
+	if filters.ParentPageUUID != nil {
+		s.pages += " AND pages.parent_page_uuid = @parent"
+		s.args["parent"] = *filters.ParentPageUUID
+	}
+	if len(filters.TagIDs) > 0 {
+		s.pages += " AND pages.id IN (@tagged)"
+		s.args["tagged"] = tags.PagesWith(db, filters.TagIDs, filters.AllTags)
+	}
+	return search(db, s, text, limit, offset)
+}
+
+// SearchPublic returns the public pages under root (root included) whose name or published element text matches
+// the search text, best matches first. Drafts aren't searched. Sub-pages of private pages are left out even if they are public, as they would reveal
+// the private page through their parent. Returns no results if root isn't public.
+// The parent of root is left out of its result, it may be private.
+func SearchPublic(db *gorm.DB, root models.Page, text string, limit int, offset int) ([]Result, error) {
+	s := scope{
+		with: `tree AS (
+			SELECT id, page_uuid FROM pages WHERE id = @root AND public_page AND deleted_at IS NULL
+			UNION
+			SELECT pages.id, pages.page_uuid FROM pages JOIN tree ON pages.parent_page_uuid = tree.page_uuid
+			WHERE pages.user_id = @user AND pages.public_page AND pages.deleted_at IS NULL
+		),`,
+		pages:    "pages.id IN (SELECT id FROM tree)",
+		elements: publishedElements,
+		args:     map[string]interface{}{"root": root.ID, "user": root.UserID, "headings": headingTypes, "types": TextTypes},
+	}
+	results, err := search(db, s, text, limit, offset)
+	for i := range results {
+		if results[i].PageUUID == root.PageUUID {
+			results[i].ParentPageUUID = ""
+		}
+	}
+	return results, err
+}
+
+// search returns the pages in scope whose name or element text matches the search text, best matches first.
+func search(db *gorm.DB, s scope, text string, limit int, offset int) ([]Result, error) {
+	query := Query(text)
+	if query == "" {
+		return []Result{}, nil
+	}
+	args := map[string]interface{}{"query": query, "limit": limit, "offset": offset, "options": headlineOptions, "max": maxMatchesPerPage}
+	for name, value := range s.args {
+		args[name] = value
+	}
+	// RECURSIVE is allowed whether or not the scope defines a recursive expression
+	with := "WITH RECURSIVE " + s.with + " scoped_elements AS (" + s.elements + "), q AS (SELECT to_tsquery('" + Config + "', @query) AS query)"
+
+	// A page ranks by its name and its best matching element
+	var results []Result
+	if err := db.Raw(with+`,
+		element_ranks AS (
+			SELECT scoped_elements.page_id, MAX(ts_rank(scoped_elements.search_vector, q.query)) AS rank
+			FROM scoped_elements, q
+			WHERE scoped_elements.search_vector @@ q.query
+			GROUP BY scoped_elements.page_id
+		)
+		SELECT pages.page_uuid, COALESCE(pages.page_name, '') AS page_name, COALESCE(pages.parent_page_uuid, '') AS parent_page_uuid,
+			pages.public_page, pages.is_favourite,
+			COALESCE(ts_rank(pages.search_vector, q.query), 0) + COALESCE(element_ranks.rank, 0) AS rank
+		FROM pages
+		CROSS JOIN q
+		LEFT JOIN element_ranks ON element_ranks.page_id = pages.id
+		WHERE `+s.pages+` AND pages.deleted_at IS NULL AND (pages.search_vector @@ q.query OR element_ranks.rank IS NOT NULL)
+		ORDER BY rank DESC, pages.last_updated_at DESC
+		LIMIT @limit OFFSET @offset`, args).Scan(&results).Error; err != nil {
+		return nil, err
+	}
+	if len(results) == 0 {
+		return []Result{}, nil
+	}
+
+	pageUUIDs := make([]string, len(results))
+	byUUID := make(map[string]*Result, len(results))
+	for i := range results {
+		results[i].Matches = []Match{}
+		pageUUIDs[i] = results[i].PageUUID
+		byUUID[results[i].PageUUID] = &results[i]
+	}
+
+	var matches []struct {
+		PageUUID string
+		Match
+	}
+	args["pages"] = pageUUIDs
+	if err := db.Raw(with+`
+		SELECT page_uuid, element_uuid, type, snippet FROM (
+			SELECT pages.page_uuid, scoped_elements.element_uuid, scoped_elements.type,
+				ts_headline('`+Config+`', COALESCE(scoped_elements.content->>'text', ''), q.query, @options) AS snippet,
+				ROW_NUMBER() OVER (PARTITION BY scoped_elements.page_id ORDER BY ts_rank(scoped_elements.search_vector, q.query) DESC) AS position
+			FROM scoped_elements
+			JOIN pages ON pages.id = scoped_elements.page_id
+			CROSS JOIN q
+			WHERE pages.page_uuid IN @pages AND scoped_elements.search_vector @@ q.query
+		) ranked
+		WHERE position <= @max
+		ORDER BY page_uuid, position`, args,
+	).Scan(&matches).Error; err != nil {
+		return nil, err
+	}
+	for _, match := range matches {
+		match.Snippet = highlight(match.Snippet)
+		byUUID[match.PageUUID].Matches = append(byUUID[match.PageUUID].Matches, match.Match)
+	}
+
+	return results, nil
+}
+
+// highlight HTML escapes a snippet and replaces the markers around its matches with <mark> tags.
+func highlight(snippet string) string {
+	snippet = html.EscapeString(snippet)
+	snippet = strings.ReplaceAll(snippet, startMarker, "<mark>")
+	return strings.ReplaceAll(snippet, stopMarker, "</mark>")
+}
@@ -0,0 +1,46 @@
+package search
+
+import "testing"
+
+func TestQuery(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{"empty", "", ""},
+		{"punctuation only", "  !?&| ", ""},
+		{"single term is a prefix", "Welc", "'welc':*"},
+		{"every term must match", "getting Started guide", "'getting' & 'started' & 'guide':*"},
+		{"operators are dropped", "a & b | !c", "'a' & 'b' & 'c':*"},
+		{"quotes can't break out", "it's", "'it' & 's':*"},
+		{"unicode", "Café Über", "'café' & 'über':*"},
+		{"at most 16 terms", "1 2 3 4 5 6 7 8 9 10 11 12 13 14 15 16 17", "'1' & '2' & '3' & '4' & '5' & '6' & '7' & '8' & '9' & '10' & '11' & '12' & '13' & '14' & '15' & '16':*"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := Query(tc.text); got != tc.want {
+				t.Errorf("Query(%q) = %q, want %q", tc.text, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestHighlight(t *testing.T) {
+	tests := []struct {
+		name    string
+		snippet string
+		want    string
+	}{
+		{"no match", "plain text", "plain text"},
+		{"marks matches", "the " + startMarker + "quick" + stopMarker + " fox", "the <mark>quick</mark> fox"},
+		{"escapes html", "<script>" + startMarker + "alert" + stopMarker + "</script>", "&lt;script&gt;<mark>alert</mark>&lt;/script&gt;"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := highlight(tc.snippet); got != tc.want {
+				t.Errorf("highlight(%q) = %q, want %q", tc.snippet, got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,153 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/opalescencelabs/backend/api"
+	"github.com/opalescencelabs/backend/controllers/audit"
+	"github.com/opalescencelabs/backend/controllers/auth"
+	"github.com/opalescencelabs/backend/controllers/notifications"
+	"github.com/opalescencelabs/backend/controllers/plans"
+	"github.com/opalescencelabs/backend/database"
+	"github.com/opalescencelabs/backend/models"
+	"gorm.io/gorm"
+)
+
+// PageShare is the handler for POST /page-share.
+// Shares a page owned by the current user with another user, identified by email.
+// Shared users may read the page, but only the owner may modify it.
+// Returns 200 on success, 400 on bad request, 401 on unauthorized, 402/403 on exceeded plan limits, 404 on not found, 500 on error.
+func PageShare(c *gin.Context) {
+	var request api.PageShareRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "details": err.Error()})
+		return
+	}
+
+	page, _, err := auth.AuthorizePage(c, request.PageUUID, auth.AccessOwner)
+	if err != nil {
+		respondAccessError(c, err)
+		return
+	}
+
+	var user models.User
+	if err := database.DB.Where("email = ?", request.Email).First(&user).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	if user.ID == page.UserID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot share a page with its owner"})
+		return
+	}
+
+	// Enforce the collaborator limit of the owner's plan
+	if respondLimitError(c, plans.CheckCollaborator(database.DB, auth.MustCurrentUser(c), user.ID)) {
+		return
+	}
+
+	share := models.PageShare{PageID: page.ID, UserID: user.ID}
+	created := false
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where(share).FirstOrCreate(&share)
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		created = true
+		return audit.Record(tx, audit.FromRequest(c, audit.ActionPageShared, audit.TargetPage, page.PageUUID,
+			map[string]interface{}{"user_id": user.ID, "email": user.Email}))
+	})
+	if err != nil {
+		fmt.Println("Failed to share page: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to share page"})
+		return
+	}
+	// Only new shares are recorded and notified, not sharing again
+	if created {
+		if err := notifications.PageShared(database.DB, page, auth.MustCurrentUserID(c), user.ID); err != nil {
+			// Not critical, the page is shared
+			fmt.Println("Failed to notify share: ", err)
+		}
+	}
+
+	c.JSON(http.StatusOK, api.PageShareResp{})
+}
+
+// PageUnshare is the handler for POST /page-unshare.
+// Revokes another user's access to a page owned by the current user.
+// Returns 200 on success, 400 on bad request, 401 on unauthorized, 404 on not found, 500 on error.
+func PageUnshare(c *gin.Context) {
+	var request api.PageUnshareRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "details": err.Error()})
+		return
+	}
+
+	page, _, err := auth.AuthorizePage(c, request.PageUUID, auth.AccessOwner)
+	if err != nil {
+		respondAccessError(c, err)
+		return
+	}
+
+	var user models.User
+	if err := database.DB.Where("email = ?", request.Email).First(&user).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Unscoped().Where("page_id = ? AND user_id = ?", page.ID, user.ID).Delete(&models.PageShare{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return audit.Record(tx, audit.FromRequest(c, audit.ActionPageUnshared, audit.TargetPage, page.PageUUID,
+			map[string]interface{}{"user_id": user.ID, "email": user.Email}))
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Page is not shared with this user"})
+		return
+	}
+	if err != nil {
+		fmt.Println("Failed to unshare page: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unshare page"})
+		return
+	}
+
+	c.JSON(http.StatusOK, api.PageUnshareResp{})
+}
+
+// PageShareList is the handler for GET /page-share-list/:page_uuid.
+// Returns the users a page owned by the current user is shared with.
+// Returns 200 on success, 401 on unauthorized, 404 on not found, 500 on error.
+func PageShareList(c *gin.Context) {
+	page, _, err := auth.AuthorizePage(c, c.Param("page_uuid"), auth.AccessOwner)
+	if err != nil {
+		respondAccessError(c, err)
+		return
+	}
+
+	var users []models.User
+	if err := database.DB.Joins("JOIN page_shares ON page_shares.user_id = users.id").
+		Where("page_shares.page_id = ? AND page_shares.deleted_at IS NULL", page.ID).
+		Find(&users).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch shared users"})
+		return
+	}
+
+	usersResp := make([]api.SharedUserResp, len(users))
+	for i, user := range users {
+		usersResp[i] = api.SharedUserResp{
+			ID:      user.ID,
+			Email:   user.Email,
+			Name:    user.Name,
+			Picture: user.Picture,
+		}
+	}
+
+	c.JSON(http.StatusOK, api.PageShareListResp{Users: usersResp})
+}
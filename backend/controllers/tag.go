@@ -0,0 +1,189 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/opalescencelabs/backend/api"
+	"github.com/opalescencelabs/backend/controllers/auth"
+	"github.com/opalescencelabs/backend/controllers/tags"
+	"github.com/opalescencelabs/backend/database"
+	"github.com/opalescencelabs/backend/models"
+)
+
+// respondTagError writes the response for an error returned by the tags package.
+func respondTagError(c *gin.Context, err error, action string) {
+	switch {
+	case errors.Is(err, tags.ErrInvalidName), errors.Is(err, tags.ErrInvalidColor):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, tags.ErrNameTaken):
+		c.JSON(http.StatusConflict, gin.H{"error": "Tag name already in use"})
+	case errors.Is(err, tags.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Tag or page not found"})
+	default:
+		fmt.Printf("Failed to %s: %s\n", action, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to " + action})
+	}
+}
+
+// parseTagMatch returns true if pages must have all of the filtered tags, false if any of them.
+// Returns an error unless match is "all", "any" or empty (all).
+func parseTagMatch(match string) (bool, error) {
+	switch match {
+	case "", "all":
+		return true, nil
+	case "any":
+		return false, nil
+	}
+	return false, errors.New("tag_match must be all or any")
+}
+
+// toTagResp converts a tag to its response.
+func toTagResp(tag models.Tag) api.TagResp {
+	return api.TagResp{ID: tag.ID, Name: tag.Name, Color: tag.Color}
+}
+
+// TagCreate is the handler for POST /tag-create.
+// Creates a tag the user can tag their pages with.
+// Returns 200 on success, 400 on bad request, 401 on unauthorized, 409 if the name is in use, 500 on error.
+func TagCreate(c *gin.Context) {
+	var request api.TagCreateRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "details": err.Error()})
+		return
+	}
+	name, err := tags.NormalizeName(request.Name)
+	if err != nil {
+		respondTagError(c, err, "create tag")
+		return
+	}
+	color, err := tags.NormalizeColor(request.Color)
+	if err != nil {
+		respondTagError(c, err, "create tag")
+		return
+	}
+
+	tag, err := tags.Create(database.DB, auth.MustCurrentUserID(c), name, color)
+	if err != nil {
+		respondTagError(c, err, "create tag")
+		return
+	}
+
+	c.JSON(http.StatusOK, api.TagCreateResp{Tag: toTagResp(tag)})
+}
+
+// TagUpdate is the handler for POST /tag-update.
+// Renames and/or recolours one of the user's tags.
+// Returns 200 on success, 400 on bad request, 401 on unauthorized, 404 on not found, 409 if the name is in use, 500 on error.
+func TagUpdate(c *gin.Context) {
+	var request api.TagUpdateRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "details": err.Error()})
+		return
+	}
+	var name, color string
+	var err error
+	if request.Name != "" {
+		if name, err = tags.NormalizeName(request.Name); err != nil {
+			respondTagError(c, err, "update tag")
+			return
+		}
+	}
+	if request.Color != "" {
+		if color, err = tags.NormalizeColor(request.Color); err != nil {
+			respondTagError(c, err, "update tag")
+			return
+		}
+	}
+
+	tag, err := tags.Update(database.DB, auth.MustCurrentUserID(c), request.TagID, name, color)
+	if err != nil {
+		respondTagError(c, err, "update tag")
+		return
+	}
+
+	c.JSON(http.StatusOK, api.TagUpdateResp{Tag: toTagResp(tag)})
+}
+
+// TagDelete is the handler for POST /tag-delete.
+// Deletes one of the user's tags, untagging its pages.
+// Returns 200 on success, 400 on bad request, 401 on unauthorized, 404 on not found, 500 on error.
+func TagDelete(c *gin.Context) {
+	var request api.TagDeleteRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "details": err.Error()})
+		return
+	}
+
+	tx := database.DB.Begin()
+	if err := tags.Delete(tx, auth.MustCurrentUserID(c), request.TagID); err != nil {
+		tx.Rollback()
+		respondTagError(c, err, "delete tag")
+		return
+	}
+	if err := tx.Commit().Error; err != nil {
+		respondTagError(c, err, "delete tag")
+		return
+	}
+
+	c.JSON(http.StatusOK, api.TagDeleteResp{})
+}
+
+// TagList is the handler for GET /tag-list.
+// Returns the user's tags by name, with the number of pages tagged with each.
+// Returns 200 on success, 401 on unauthorized, 500 on error.
+func TagList(c *gin.Context) {
+	counts, err := tags.List(database.DB, auth.MustCurrentUserID(c))
+	if err != nil {
+		respondTagError(c, err, "list tags")
+		return
+	}
+
+	tagsResp := make([]api.TagCountResp, len(counts))
+	for i, count := range counts {
+		tagsResp[i] = api.TagCountResp{
+			TagResp:   api.TagResp{ID: count.ID, Name: count.Name, Color: count.Color},
+			PageCount: count.PageCount,
+		}
+	}
+
+	c.JSON(http.StatusOK, api.TagListResp{Tags: tagsResp})
+}
+
+// PageTag is the handler for POST /page-tag.
+// Tags each of the given pages with each of the given tags, pages and tags must belong to the user.
+// Returns 200 on success, 400 on bad request, 401 on unauthorized, 404 on not found, 500 on error.
+func PageTag(c *gin.Context) {
+	var request api.PageTagRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "details": err.Error()})
+		return
+	}
+
+	if err := tags.Tag(database.DB, auth.MustCurrentUserID(c), request.PageUUIDs, request.TagIDs); err != nil {
+		respondTagError(c, err, "tag pages")
+		return
+	}
+
+	c.JSON(http.StatusOK, api.PageTagResp{})
+}
+
+// PageUntag is the handler for POST /page-untag.
+// Removes each of the given tags from each of the given pages, pages and tags must belong to the user.
+// Returns 200 on success, 400 on bad request, 401 on unauthorized, 404 on not found, 500 on error.
+func PageUntag(c *gin.Context) {
+	var request api.PageTagRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "details": err.Error()})
+		return
+	}
+
+	if err := tags.Untag(database.DB, auth.MustCurrentUserID(c), request.PageUUIDs, request.TagIDs); err != nil {
+		respondTagError(c, err, "untag pages")
+		return
+	}
+
+	c.JSON(http.StatusOK, api.PageTagResp{})
+}
@@ -0,0 +1,218 @@
+package tags
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+
+	"github.com/opalescencelabs/backend/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// DefaultColor is the colour of tags created without one.
+const DefaultColor = "#9e9e9e"
+
+// MaxNameLength bounds the length of tag names, in characters.
+const MaxNameLength = 32
+
+var colorPattern = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
+var (
+	// ErrInvalidName is returned for tag names that are empty or too long.
+	ErrInvalidName = errors.New("tag name must be 1 to 32 characters")
+	// ErrInvalidColor is returned for colours that aren't hex colours like #4caf50.
+	ErrInvalidColor = errors.New("tag color must be a hex color like #4caf50")
+	// ErrNameTaken is returned when the user already has a tag with the name.
+	ErrNameTaken = errors.New("tag name already in use")
+	// ErrNotFound is returned when a tag or page doesn't exist or belongs to another user.
+	ErrNotFound = errors.New("tag or page not found")
+)
+
+// Count is a tag with the number of pages tagged with it.
+type Count struct {
+	ID        uint
+	Name      string
+	Color     string
+	PageCount int64
+}
+
+// NormalizeName trims the name and checks its length.
+func NormalizeName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || len([]rune(name)) > MaxNameLength {
+		return "", ErrInvalidName
+	}
+	return name, nil
+}
+
+// NormalizeColor lowercases the colour and checks it is a hex colour, DefaultColor if it is empty.
+func NormalizeColor(color string) (string, error) {
+	if color == "" {
+		return DefaultColor, nil
+	}
+	if !colorPattern.MatchString(color) {
+		return "", ErrInvalidColor
+	}
+	return strings.ToLower(color), nil
+}
+
+// Create creates a tag of the user.
+// Returns ErrNameTaken if the user already has a tag with the name, including one created concurrently.
+func Create(db *gorm.DB, userID uint, name string, color string) (models.Tag, error) {
+	tag := models.Tag{UserID: userID, Name: name, Color: color}
+	// The unique index on the user and name decides between concurrent creations
+	result := db.Omit("id").Clauses(clause.OnConflict{DoNothing: true}).Create(&tag)
+	if result.Error != nil {
+		return models.Tag{}, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return models.Tag{}, ErrNameTaken
+	}
+	return tag, nil
+}
+
+// Update renames and/or recolours a tag of the user, empty values are left unchanged.
+// Returns ErrNotFound if the user has no such tag, ErrNameTaken if another of their tags has the name.
+func Update(db *gorm.DB, userID uint, tagID uint, name string, color string) (models.Tag, error) {
+	var tag models.Tag
+	if err := db.Where("id = ? AND user_id = ?", tagID, userID).First(&tag).Error; err != nil {
+		return models.Tag{}, ErrNotFound
+	}
+	if name != "" && name != tag.Name {
+		var count int64
+		if err := db.Model(&models.Tag{}).Where("user_id = ? AND name = ? AND id <> ?", userID, name, tagID).Count(&count).Error; err != nil {
+			return models.Tag{}, err
+		}
+		if count > 0 {
+			return models.Tag{}, ErrNameTaken
+		}
+		tag.Name = name
+	}
+	if color != "" {
+		tag.Color = color
+	}
+	if err := db.Model(&tag).Updates(map[string]interface{}{"name": tag.Name, "color": tag.Color}).Error; err != nil {
+		return models.Tag{}, err
+	}
+	return tag, nil
+}
+
+// Delete deletes a tag of the user and untags its pages.
+// Returns ErrNotFound if the user has no such tag.
+func Delete(tx *gorm.DB, userID uint, tagID uint) error {
+	result := tx.Unscoped().Where("id = ? AND user_id = ?", tagID, userID).Delete(&models.Tag{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return tx.Where("tag_id = ?", tagID).Delete(&models.PageTag{}).Error
+}
+
+// List returns the user's tags by name, with the number of pages tagged with each.
+func List(db *gorm.DB, userID uint) ([]Count, error) {
+	var counts []Count
+	err := db.Model(&models.Tag{}).
+		Select("tags.id, tags.name, tags.color, COUNT(pages.id) AS page_count").
+		Joins("LEFT JOIN page_tags ON page_tags.tag_id = tags.id").
+		Joins("LEFT JOIN pages ON pages.id = page_tags.page_id AND pages.deleted_at IS NULL").
+		Where("tags.user_id = ?", userID).
+		Group("tags.id").
+		Order("tags.name").
+		Scan(&counts).Error
+	return counts, err
+}
+
+// resolve returns the IDs of the user's pages and tags given by UUID and ID.
+// Returns ErrNotFound unless every page and tag exists and belongs to the user.
+func resolve(db *gorm.DB, userID uint, pageUUIDs []string, tagIDs []uint) ([]uint, error) {
+	var pageIDs []uint
+	if err := db.Model(&models.Page{}).Where("page_uuid IN ? AND user_id = ?", pageUUIDs, userID).Pluck("id", &pageIDs).Error; err != nil {
+		return nil, err
+	}
+	var tagCount int64
+	if err := db.Model(&models.Tag{}).Where("id IN ? AND user_id = ?", tagIDs, userID).Count(&tagCount).Error; err != nil {
+		return nil, err
+	}
+	if len(pageIDs) != len(unique(pageUUIDs)) || int(tagCount) != len(unique(tagIDs)) {
+		return nil, ErrNotFound
+	}
+	return pageIDs, nil
+}
+
+// Tag tags each of the user's pages with each of the tags, pages already tagged are left as they are.
+// Returns ErrNotFound unless every page and tag belongs to the user.
+func Tag(tx *gorm.DB, userID uint, pageUUIDs []string, tagIDs []uint) error {
+	pageIDs, err := resolve(tx, userID, pageUUIDs, tagIDs)
+	if err != nil {
+		return err
+	}
+	pageTags := make([]models.PageTag, 0, len(pageIDs)*len(tagIDs))
+	for _, pageID := range pageIDs {
+		for _, tagID := range unique(tagIDs) {
+			pageTags = append(pageTags, models.PageTag{PageID: pageID, TagID: tagID})
+		}
+	}
+	return tx.Omit("id").Clauses(clause.OnConflict{DoNothing: true}).Create(&pageTags).Error
+}
+
+// Untag removes the tags from each of the user's pages.
+// Returns ErrNotFound unless every page and tag belongs to the user.
+func Untag(tx *gorm.DB, userID uint, pageUUIDs []string, tagIDs []uint) error {
+	pageIDs, err := resolve(tx, userID, pageUUIDs, tagIDs)
+	if err != nil {
+		return err
+	}
+	return tx.Where("page_id IN ? AND tag_id IN ?", pageIDs, tagIDs).Delete(&models.PageTag{}).Error
+}
+
+// PageTags returns the tags of each page by page ID, ordered by name.
+func PageTags(db *gorm.DB, pageIDs []uint) (map[uint][]models.Tag, error) {
+	byPage := make(map[uint][]models.Tag)
+	if len(pageIDs) == 0 {
+		return byPage, nil
+	}
+	var rows []struct {
+		PageID uint
+		ID     uint
+		Name   string
+		Color  string
+	}
+	if err := db.Model(&models.Tag{}).
+		Select("page_tags.page_id, tags.id, tags.name, tags.color").
+		Joins("JOIN page_tags ON page_tags.tag_id = tags.id").
+		Where("page_tags.page_id IN ?", pageIDs).
+		Order("tags.name").
+		Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		byPage[row.PageID] = append(byPage[row.PageID], models.Tag{ID: row.ID, Name: row.Name, Color: row.Color})
+	}
+	return byPage, nil
+}
+
+// PagesWith returns a subquery selecting the IDs of the pages tagged with any of the tags,
+// or with all of them if all is true. Use it as pages.id IN (?).
+func PagesWith(db *gorm.DB, tagIDs []uint, all bool) *gorm.DB {
+	query := db.Session(&gorm.Session{NewDB: true}).Model(&models.PageTag{}).Select("page_id").Where("tag_id IN ?", tagIDs).Group("page_id")
+	if all {
+		query = query.Having("COUNT(DISTINCT tag_id) = ?", len(unique(tagIDs)))
+	}
+	return query
+}
+
+// unique returns the values without duplicates.
+func unique[T comparable](values []T) []T {
+	seen := make(map[T]bool, len(values))
+	result := make([]T, 0, len(values))
+	for _, value := range values {
+		if !seen[value] {
+			seen[value] = true
+			result = append(result, value)
+		}
+	}
+	return result
+}
@@ -7,6 +7,7 @@ import (
 
 	"github.com/google/uuid"
 	"github.com/jackc/pgtype"
+	"github.com/opalescencelabs/backend/controllers/search"
 	"github.com/opalescencelabs/backend/models"
 	"gorm.io/gorm"
 )
@@ -57,7 +58,7 @@ func CreateWelcomePage(userID uint, tx *gorm.DB) error {
 		}
 	}
 
-	return nil
+	return search.IndexPage(tx, page.PageUUID)
 }
 
 // ReadTemplateData reads the page and elements from a template directory.
@@ -2,17 +2,22 @@ package controllers
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/opalescencelabs/backend/api"
+	"github.com/opalescencelabs/backend/controllers/account"
+	"github.com/opalescencelabs/backend/controllers/audit"
 	"github.com/opalescencelabs/backend/controllers/auth"
 	"github.com/opalescencelabs/backend/controllers/templates"
 	"github.com/opalescencelabs/backend/database"
 	"github.com/opalescencelabs/backend/models"
+	"gorm.io/gorm"
 )
 
 // UserLogin is the handler for POST /user-login.
@@ -20,7 +25,7 @@ import (
 // User information is fetched from Google's userinfo endpoint,
 // new users are added to the database, returning users have changed
 // information updated in the database.
-// Returns 200 on success, 400 on bad request, 401 on unauthorized, 500 on error.
+// Returns 200 on success, 400 on bad request, 401 on unauthorized, 403 on disabled account, 500 on error.
 func UserLogin(c *gin.Context) {
 	var request api.UserLoginRequest
 
@@ -70,7 +75,7 @@ func UserLogin(c *gin.Context) {
 		}
 		// Using a transaction to ensure that the user and welcome page are created together
 		tx := database.DB.Begin()
-		if err := tx.Omit("id", "status").Create(&user).Error; err != nil {
+		if err := tx.Omit("id", "status", "role").Create(&user).Error; err != nil {
 			fmt.Println("Failed to create new user: ", err.Error())
 			tx.Rollback()
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create new user"})
@@ -84,6 +89,9 @@ func UserLogin(c *gin.Context) {
 		}
 		// Commit the transaction
 		tx.Commit()
+	} else if user.Disabled {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Account disabled"})
+		return
 	} else {
 		// Update user info if it has changed
 		user.Credentials = credentials
@@ -111,6 +119,14 @@ func UserLogin(c *gin.Context) {
 	url = strings.Split(url, ":")[0]
 
 	c.SetCookie("Authorization", tokenString, 3600*24*30, "/", url, os.Getenv("APP_ENV") != "development", true)
+
+	// The user isn't authenticated in this request yet, so the entry is attributed to them explicitly
+	entry := audit.FromRequest(c, audit.ActionUserLogin, audit.TargetUser, fmt.Sprint(user.ID), map[string]interface{}{"new_user": is_new_user})
+	entry.ActorID = &user.ID
+	if err := audit.Record(database.DB, entry); err != nil {
+		// Not critical, the user is logged in
+		fmt.Println("Failed to record login: ", err)
+	}
 	// c.JSON(http.StatusOK, api.UserLoginResp{})
 	c.JSON(http.StatusOK, gin.H{"token": tokenString}) // TODO: Fix issue where cookie is not being set
 }
@@ -120,19 +136,8 @@ func UserLogin(c *gin.Context) {
 // deletes the tokens from the client's browser.
 // Returns 200 on success, 401 on unauthorized, 500 on error.
 func UserLogout(c *gin.Context) {
-	userID, err := auth.AuthenticateUser(c)
-	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
-		return
-	}
-
-	// Find the user in DB
-	var user models.User
-	if err := database.DB.First(&user, userID); err.Error != nil {
-		fmt.Println("ERROR: ", err.Error)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "user does not exist"})
-		return
-	}
+	user := auth.MustCurrentUser(c)
+	userID := user.ID
 
 	var credentials map[string]interface{}
 	if err := json.Unmarshal(user.Credentials, &credentials); err != nil {
@@ -156,6 +161,11 @@ func UserLogout(c *gin.Context) {
 
 	c.SetCookie("Authorization", "", -1, "/", url, os.Getenv("APP_ENV") != "development", true)
 
+	if err := audit.Record(database.DB, audit.FromRequest(c, audit.ActionUserLogout, audit.TargetUser, fmt.Sprint(userID), nil)); err != nil {
+		// Not critical, the user is logged out
+		fmt.Println("Failed to record logout: ", err)
+	}
+
 	fmt.Printf("user-logout: %d\n", userID)
 	c.JSON(http.StatusOK, api.UserLogoutResp{})
 }
@@ -164,26 +174,96 @@ func UserLogout(c *gin.Context) {
 // Returns the user's information.
 // Returns 200 on success, 401 on unauthorized, 500 on error.
 func UserGet(c *gin.Context) {
-	userID, err := auth.AuthenticateUser(c)
-	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized: " + err.Error()})
-		return
-	}
+	user := auth.MustCurrentUser(c)
 
-	var user models.User
-	if err := database.DB.First(&user, uint(userID)).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal Server Error"})
-		return
+	var deletionScheduledFor *time.Time
+	if deletion, ok := account.PendingDeletion(database.DB, user.ID); ok {
+		deletionScheduledFor = &deletion.ScheduledFor
 	}
 
 	// Return user data in the response
 	c.JSON(http.StatusOK, api.UserGetResp{
-		ID:       user.ID,
-		GoogleID: user.GoogleID,
-		Name:     user.Name,
-		Email:    user.Email,
-		Picture:  user.Picture,
-		Status:   user.Status,
+		ID:                   user.ID,
+		GoogleID:             user.GoogleID,
+		Name:                 user.Name,
+		Email:                user.Email,
+		Picture:              user.Picture,
+		Status:               user.Status,
+		DeletionScheduledFor: deletionScheduledFor,
 		// Add other user data as needed
 	})
 }
+
+// UserExport is the handler for GET /user-export.
+// Returns a zip archive of the user's profile, pages and elements.
+// Returns 200 on success, 401 on unauthorized, 500 on error.
+func UserExport(c *gin.Context) {
+	user := auth.MustCurrentUser(c)
+
+	if err := audit.Record(database.DB, audit.FromRequest(c, audit.ActionAccountExport, audit.TargetUser, fmt.Sprint(user.ID), nil)); err != nil {
+		fmt.Println("Failed to record account export: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export account"})
+		return
+	}
+
+	c.Header("Content-Type", "application/zip")
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="opalescence-export-%s.zip"`, time.Now().Format("2006-01-02")))
+	c.Status(http.StatusOK)
+	if err := account.Export(database.DB, user, c.Writer); err != nil {
+		// Headers are already sent, the client receives a truncated archive
+		fmt.Printf("Failed to export account of user %d: %s\n", user.ID, err)
+	}
+}
+
+// UserDelete is the handler for POST /user-delete.
+// Schedules the user's account for deletion after a grace period, during which it can be cancelled.
+// Returns 200 on success, 401 on unauthorized, 409 if a deletion is already pending, 500 on error.
+func UserDelete(c *gin.Context) {
+	user := auth.MustCurrentUser(c)
+
+	var deletion models.AccountDeletion
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if deletion, err = account.RequestDeletion(tx, user.ID); err != nil {
+			return err
+		}
+		return audit.Record(tx, audit.FromRequest(c, audit.ActionAccountDeletionRequested, audit.TargetUser, fmt.Sprint(user.ID),
+			map[string]interface{}{"scheduled_for": deletion.ScheduledFor}))
+	})
+	if errors.Is(err, account.ErrDeletionPending) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Account deletion already pending", "scheduled_for": deletion.ScheduledFor})
+		return
+	}
+	if err != nil {
+		fmt.Println("Failed to request account deletion: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to request account deletion"})
+		return
+	}
+
+	c.JSON(http.StatusOK, api.UserDeleteResp{ScheduledFor: deletion.ScheduledFor})
+}
+
+// UserDeleteCancel is the handler for POST /user-delete-cancel.
+// Cancels the user's pending account deletion.
+// Returns 200 on success, 401 on unauthorized, 404 if no deletion is pending, 500 on error.
+func UserDeleteCancel(c *gin.Context) {
+	user := auth.MustCurrentUser(c)
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := account.CancelDeletion(tx, user.ID); err != nil {
+			return err
+		}
+		return audit.Record(tx, audit.FromRequest(c, audit.ActionAccountDeletionCancelled, audit.TargetUser, fmt.Sprint(user.ID), nil))
+	})
+	if errors.Is(err, account.ErrNoPendingDeletion) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No pending account deletion"})
+		return
+	}
+	if err != nil {
+		fmt.Println("Failed to cancel account deletion: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to cancel account deletion"})
+		return
+	}
+
+	c.JSON(http.StatusOK, api.UserDeleteCancelResp{})
+}
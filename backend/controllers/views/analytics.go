@@ -0,0 +1,193 @@
+package views
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Granularities of an analytics series.
+const (
+	GranularityHour = "hour"
+	GranularityDay  = "day"
+	GranularityWeek = "week"
+)
+
+// MaxBuckets bounds the number of points in an analytics series.
+const MaxBuckets = 1000
+
+// topLimit is the number of entries of each breakdown.
+const topLimit = 10
+
+// ErrInvalidRange is returned when an analytics range is empty, reversed or has too many points.
+var ErrInvalidRange = errors.New("invalid analytics range")
+
+// Point holds the views within one bucket of an analytics series.
+type Point struct {
+	Start          time.Time
+	Views          int64
+	UniqueVisitors int64
+	ExcludedViews  int64
+}
+
+// Breakdown holds the views sharing a referrer, device, country or reason for being excluded.
+type Breakdown struct {
+	Value          string
+	Views          int64
+	UniqueVisitors int64
+}
+
+// Analytics holds the views of pages over a range.
+// Views backfilled from daily totals count towards views but not unique visitors, as their visitors are unknown.
+// Excluded views are only counted in ExcludedViews and the Excluded breakdown.
+type Analytics struct {
+	From           time.Time
+	To             time.Time
+	Granularity    string
+	Views          int64
+	UniqueVisitors int64
+	ExcludedViews  int64
+	// Series has a point for every bucket of the range, including buckets without views.
+	Series       []Point
+	TopReferrers []Breakdown
+	Devices      []Breakdown
+	Countries    []Breakdown
+	// Excluded breaks excluded views down by reason, see Excluded.
+	Excluded []Breakdown
+}
+
+// BucketStart returns the start of the bucket t falls in, in UTC.
+// Weeks start on Monday, like Postgres' date_trunc.
+func BucketStart(t time.Time, granularity string) time.Time {
+	t = t.UTC()
+	switch granularity {
+	case GranularityHour:
+		return t.Truncate(time.Hour)
+	case GranularityWeek:
+		day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+		return day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+	}
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// nextBucket returns the start of the bucket after the one starting at start.
+func nextBucket(start time.Time, granularity string) time.Time {
+	switch granularity {
+	case GranularityHour:
+		return start.Add(time.Hour)
+	case GranularityWeek:
+		return start.AddDate(0, 0, 7)
+	}
+	return start.AddDate(0, 0, 1)
+}
+
+// Buckets returns the start of every bucket of the range [from, to).
+// Returns ErrInvalidRange if the granularity is unknown, the range is empty or it has more than MaxBuckets buckets.
+func Buckets(from time.Time, to time.Time, granularity string) ([]time.Time, error) {
+	switch granularity {
+	case GranularityHour, GranularityDay, GranularityWeek:
+	default:
+		return nil, fmt.Errorf("%w: unknown granularity %q", ErrInvalidRange, granularity)
+	}
+	if !from.Before(to) {
+		return nil, fmt.Errorf("%w: from must be before to", ErrInvalidRange)
+	}
+
+	var buckets []time.Time
+	for start := BucketStart(from, granularity); start.Before(to); start = nextBucket(start, granularity) {
+		if len(buckets) == MaxBuckets {
+			return nil, fmt.Errorf("%w: more than %d %ss", ErrInvalidRange, MaxBuckets, granularity)
+		}
+		buckets = append(buckets, start)
+	}
+	return buckets, nil
+}
+
+// Query returns the views of the pages over the range [from, to), bucketed by granularity.
+func Query(db *gorm.DB, pageIDs []uint, from time.Time, to time.Time, granularity string) (Analytics, error) {
+	buckets, err := Buckets(from, to, granularity)
+	if err != nil {
+		return Analytics{}, err
+	}
+	analytics := Analytics{From: from, To: to, Granularity: granularity}
+
+	// Filters the page views of the range
+	inRange := func() *gorm.DB {
+		return db.Table("page_views").Where("page_id IN ? AND hour >= ? AND hour < ?", pageIDs, from, to)
+	}
+	const aggregates = "COALESCE(SUM(views), 0) AS views, COUNT(DISTINCT NULLIF(visitor_id, '')) AS unique_visitors"
+	const countedAggregates = `COALESCE(SUM(views) FILTER (WHERE excluded = ''), 0) AS views,
+		COUNT(DISTINCT NULLIF(visitor_id, '')) FILTER (WHERE excluded = '') AS unique_visitors,
+		COALESCE(SUM(views) FILTER (WHERE excluded <> ''), 0) AS excluded_views`
+
+	if err := inRange().Select(countedAggregates).Row().
+		Scan(&analytics.Views, &analytics.UniqueVisitors, &analytics.ExcludedViews); err != nil {
+		return Analytics{}, err
+	}
+
+	var points []Point
+	if err := inRange().
+		Select("date_trunc(?, hour AT TIME ZONE 'UTC') AS start, "+countedAggregates, granularity).
+		Group("start").
+		Scan(&points).Error; err != nil {
+		return Analytics{}, err
+	}
+	byStart := make(map[time.Time]Point, len(points))
+	for _, point := range points {
+		byStart[point.Start.UTC()] = point
+	}
+	analytics.Series = make([]Point, len(buckets))
+	for i, start := range buckets {
+		point := byStart[start]
+		point.Start = start
+		analytics.Series[i] = point
+	}
+
+	for _, breakdown := range []struct {
+		column   string
+		excluded bool
+		into     *[]Breakdown
+	}{
+		{"referrer", false, &analytics.TopReferrers},
+		{"device", false, &analytics.Devices},
+		{"country", false, &analytics.Countries},
+		{"excluded", true, &analytics.Excluded},
+	} {
+		if err := inRange().
+			Select(breakdown.column+" AS value, "+aggregates).
+			Where(breakdown.column+" <> ''").
+			Where("(excluded <> '') = ?", breakdown.excluded).
+			Group(breakdown.column).
+			Order("views DESC, value").
+			Limit(topLimit).
+			Scan(breakdown.into).Error; err != nil {
+			return Analytics{}, err
+		}
+	}
+
+	return analytics, nil
+}
+
+// DailyCounts returns the counted views of a page by day, formatted as "2006-01-02".
+// Days without views are omitted.
+func DailyCounts(db *gorm.DB, pageID uint) (map[string]int, error) {
+	var rows []struct {
+		Day   string
+		Views int
+	}
+	if err := db.Table("page_views").
+		Select("to_char(hour AT TIME ZONE 'UTC', 'YYYY-MM-DD') AS day, SUM(views) AS views").
+		Where("page_id = ? AND excluded = ''", pageID).
+		Group("day").
+		Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	counts := make(map[string]int, len(rows))
+	for _, row := range rows {
+		counts[row.Day] = row.Views
+	}
+	return counts, nil
+}
@@ -0,0 +1,154 @@
+package views
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Periods the dashboard ranks pages over, in days.
+var DashboardPeriods = []int{7, 30}
+
+// dashboardTop is the number of trending and least viewed pages.
+const dashboardTop = 5
+
+// PageStats holds the counted views of a published page over a dashboard's period.
+type PageStats struct {
+	PageUUID  string
+	PageName  string
+	ViewCount int64
+	// PeriodViews are the views over the period, Sparkline holds them by day, oldest first.
+	PeriodViews int64
+	Sparkline   []int64
+	// ThisWeek and LastWeek are the views of the last 7 days and of the 7 days before.
+	ThisWeek int64
+	LastWeek int64
+}
+
+// Dashboard holds the views of a user's published pages.
+type Dashboard struct {
+	PeriodDays  int
+	TotalViews  int64
+	PeriodViews int64
+	ThisWeek    int64
+	LastWeek    int64
+	// Trending pages have the most views over the period (pages without views aren't trending),
+	// least viewed pages the fewest.
+	Trending    []PageStats
+	LeastViewed []PageStats
+	// Pages holds every published page, by page name.
+	Pages []PageStats
+}
+
+// WeekOverWeek returns the relative change of views from last week to this week (0.5 is +50%).
+// Returns false if there were no views last week.
+func WeekOverWeek(thisWeek int64, lastWeek int64) (float64, bool) {
+	if lastWeek == 0 {
+		return 0, false
+	}
+	return float64(thisWeek-lastWeek) / float64(lastWeek), true
+}
+
+// GetDashboard returns the views of the user's public pages, ranked over the last periodDays days (today included).
+// If rootPageUUID is set, only the page and its sub-pages are included.
+func GetDashboard(db *gorm.DB, userID uint, rootPageUUID string, periodDays int) (Dashboard, error) {
+	now := time.Now().UTC()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	periodStart := today.AddDate(0, 0, 1-periodDays)
+	weekStart := today.AddDate(0, 0, -6)
+	lastWeekStart := weekStart.AddDate(0, 0, -7)
+	since := periodStart
+	if lastWeekStart.Before(since) {
+		since = lastWeekStart
+	}
+
+	scope := "user_id = @user AND public_page AND deleted_at IS NULL"
+	if rootPageUUID != "" {
+		scope += ` AND page_uuid IN (
+			WITH RECURSIVE subtree AS (
+				SELECT page_uuid FROM pages WHERE page_uuid = @root AND deleted_at IS NULL
+				UNION
+				SELECT p.page_uuid FROM pages p JOIN subtree s ON p.parent_page_uuid = s.page_uuid WHERE p.deleted_at IS NULL
+			)
+			SELECT page_uuid FROM subtree)`
+	}
+
+	// Views are summed by page and day in SQL, every page gets a row per day of the range even without views
+	rows, err := db.Raw(`
+		WITH scoped AS (
+			SELECT id, page_uuid, page_name, view_count FROM pages WHERE `+scope+`
+		), daily AS (
+			SELECT page_id, (hour AT TIME ZONE 'UTC')::date AS day, SUM(views) AS views
+			FROM page_views
+			WHERE page_id IN (SELECT id FROM scoped) AND excluded = '' AND hour >= @since_time
+			GROUP BY page_id, day
+		), grid AS (
+			SELECT scoped.id AS page_id, days.day::date AS day
+			FROM scoped CROSS JOIN generate_series(CAST(@since AS date), CAST(@today AS date), interval '1 day') AS days(day)
+		)
+		SELECT scoped.page_uuid, scoped.page_name, scoped.view_count,
+			COALESCE(SUM(daily.views) FILTER (WHERE grid.day >= CAST(@period_start AS date)), 0),
+			string_agg(COALESCE(daily.views, 0)::text, ',' ORDER BY grid.day) FILTER (WHERE grid.day >= CAST(@period_start AS date)),
+			COALESCE(SUM(daily.views) FILTER (WHERE grid.day >= CAST(@week_start AS date)), 0),
+			COALESCE(SUM(daily.views) FILTER (WHERE grid.day >= CAST(@last_week_start AS date) AND grid.day < CAST(@week_start AS date)), 0)
+		FROM scoped
+		JOIN grid ON grid.page_id = scoped.id
+		LEFT JOIN daily ON daily.page_id = grid.page_id AND daily.day = grid.day
+		GROUP BY scoped.id, scoped.page_uuid, scoped.page_name, scoped.view_count
+		ORDER BY scoped.page_name, scoped.page_uuid`,
+		map[string]interface{}{
+			"user":            userID,
+			"root":            rootPageUUID,
+			"since":           since.Format("2006-01-02"),
+			"since_time":      since,
+			"today":           today.Format("2006-01-02"),
+			"period_start":    periodStart.Format("2006-01-02"),
+			"week_start":      weekStart.Format("2006-01-02"),
+			"last_week_start": lastWeekStart.Format("2006-01-02"),
+		},
+	).Rows()
+	if err != nil {
+		return Dashboard{}, err
+	}
+	defer rows.Close()
+
+	dashboard := Dashboard{PeriodDays: periodDays, Pages: []PageStats{}, Trending: []PageStats{}, LeastViewed: []PageStats{}}
+	for rows.Next() {
+		var stats PageStats
+		var sparkline string
+		if err := rows.Scan(&stats.PageUUID, &stats.PageName, &stats.ViewCount, &stats.PeriodViews, &sparkline, &stats.ThisWeek, &stats.LastWeek); err != nil {
+			return Dashboard{}, err
+		}
+		for _, count := range strings.Split(sparkline, ",") {
+			views, _ := strconv.ParseInt(count, 10, 64)
+			stats.Sparkline = append(stats.Sparkline, views)
+		}
+
+		dashboard.TotalViews += stats.ViewCount
+		dashboard.PeriodViews += stats.PeriodViews
+		dashboard.ThisWeek += stats.ThisWeek
+		dashboard.LastWeek += stats.LastWeek
+		dashboard.Pages = append(dashboard.Pages, stats)
+	}
+	if err := rows.Err(); err != nil {
+		return Dashboard{}, err
+	}
+
+	ranked := make([]PageStats, len(dashboard.Pages))
+	copy(ranked, dashboard.Pages)
+	sort.SliceStable(ranked, func(i, j int) bool { return ranked[i].PeriodViews > ranked[j].PeriodViews })
+	for _, stats := range ranked {
+		if stats.PeriodViews == 0 || len(dashboard.Trending) == dashboardTop {
+			break
+		}
+		dashboard.Trending = append(dashboard.Trending, stats)
+	}
+	for i := len(ranked) - 1; i >= 0 && len(dashboard.LeastViewed) < dashboardTop; i-- {
+		dashboard.LeastViewed = append(dashboard.LeastViewed, ranked[i])
+	}
+
+	return dashboard, nil
+}
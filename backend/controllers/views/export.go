@@ -0,0 +1,87 @@
+package views
+
+import (
+	"encoding/json"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// DailyRow holds the views of a page on one day.
+type DailyRow struct {
+	Day            time.Time
+	PageUUID       string
+	PageName       string
+	Views          int64
+	UniqueVisitors int64
+	ExcludedViews  int64
+	// Referrers holds the counted views by referrer host, most views first.
+	Referrers []Breakdown
+}
+
+// ExportDaily calls fn with the daily views of the pages over the range [from, to), ordered by day then page.
+// Rows are read from the database one at a time, so large ranges aren't held in memory.
+// Days without views are omitted. Returns ErrInvalidRange if the range is empty or longer than MaxBuckets days.
+func ExportDaily(db *gorm.DB, pageIDs []uint, from time.Time, to time.Time, fn func(DailyRow) error) error {
+	if _, err := Buckets(from, to, GranularityDay); err != nil {
+		return err
+	}
+
+	rows, err := db.Raw(`
+		WITH filtered AS (
+			SELECT page_id, date_trunc('day', hour AT TIME ZONE 'UTC') AS day, visitor_id, referrer, excluded, views
+			FROM page_views
+			WHERE page_id IN @pages AND hour >= @from AND hour < @to
+		), daily AS (
+			SELECT page_id, day,
+				COALESCE(SUM(views) FILTER (WHERE excluded = ''), 0) AS views,
+				COUNT(DISTINCT NULLIF(visitor_id, '')) FILTER (WHERE excluded = '') AS unique_visitors,
+				COALESCE(SUM(views) FILTER (WHERE excluded <> ''), 0) AS excluded_views
+			FROM filtered GROUP BY page_id, day
+		), referrers AS (
+			SELECT page_id, day, json_agg(json_build_object('value', referrer, 'views', views) ORDER BY views DESC, referrer) AS referrers
+			FROM (
+				SELECT page_id, day, referrer, SUM(views) AS views
+				FROM filtered WHERE excluded = '' AND referrer <> ''
+				GROUP BY page_id, day, referrer
+			) by_referrer
+			GROUP BY page_id, day
+		)
+		SELECT daily.day, pages.page_uuid, pages.page_name, daily.views, daily.unique_visitors, daily.excluded_views,
+			COALESCE(referrers.referrers, '[]')
+		FROM daily
+		JOIN pages ON pages.id = daily.page_id
+		LEFT JOIN referrers ON referrers.page_id = daily.page_id AND referrers.day = daily.day
+		ORDER BY daily.day, pages.page_uuid`,
+		map[string]interface{}{"pages": pageIDs, "from": from, "to": to},
+	).Rows()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var row DailyRow
+		var referrers []byte
+		if err := rows.Scan(&row.Day, &row.PageUUID, &row.PageName, &row.Views, &row.UniqueVisitors, &row.ExcludedViews, &referrers); err != nil {
+			return err
+		}
+		row.Day = row.Day.UTC()
+		if row.Referrers, err = parseReferrers(referrers); err != nil {
+			return err
+		}
+		if err := fn(row); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// parseReferrers parses the JSON list of referrers aggregated by ExportDaily, keeping its order.
+func parseReferrers(list []byte) ([]Breakdown, error) {
+	referrers := []Breakdown{}
+	if err := json.Unmarshal(list, &referrers); err != nil {
+		return nil, err
+	}
+	return referrers, nil
+}
@@ -0,0 +1,34 @@
+package views
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseReferrers(t *testing.T) {
+	tests := []struct {
+		name string
+		list string
+		want []Breakdown
+	}{
+		{"empty", `[]`, []Breakdown{}},
+		{"single", `[{"value": "news.example.com", "views": 3}]`, []Breakdown{{Value: "news.example.com", Views: 3}}},
+		{"keeps order", `[{"value": "b.example.com", "views": 5}, {"value": "a.example.com", "views": 2}]`, []Breakdown{{Value: "b.example.com", Views: 5}, {Value: "a.example.com", Views: 2}}},
+		{"separators in hosts", `[{"value": "a=b;c.example.com", "views": 1}]`, []Breakdown{{Value: "a=b;c.example.com", Views: 1}}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := parseReferrers([]byte(tc.list))
+			if err != nil {
+				t.Fatalf("parseReferrers(%q) error = %v", tc.list, err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("parseReferrers(%q) = %+v, want %+v", tc.list, got, tc.want)
+			}
+		})
+	}
+
+	if _, err := parseReferrers([]byte(`a.example.com=1`)); err == nil {
+		t.Errorf("parseReferrers() of a malformed list error = nil, want an error")
+	}
+}
@@ -0,0 +1,369 @@
+package views
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/opalescencelabs/backend/api/caching"
+	"github.com/opalescencelabs/backend/controllers/auth"
+	"github.com/opalescencelabs/backend/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// batchRetention is how long flushed batches are remembered to detect repeated flushes.
+const batchRetention = 7 * 24 * time.Hour
+
+// shutdownFlushTimeout bounds the final flush when the worker stops.
+const shutdownFlushTimeout = 10 * time.Second
+
+// Classes of user agents, see Device.
+const (
+	DeviceDesktop = "desktop"
+	DeviceMobile  = "mobile"
+	DeviceTablet  = "tablet"
+	DeviceBot     = "bot"
+	DeviceOther   = "other"
+)
+
+// Reasons a view is excluded from the view count, it is still recorded so the owner can see it.
+const (
+	ExcludedOwner        = "owner"
+	ExcludedCollaborator = "collaborator"
+	ExcludedBot          = "bot"
+	ExcludedRepeat       = "repeat"
+)
+
+// defaultRepeatWindow is how long repeated views by the same visitor are excluded unless VIEW_REPEAT_WINDOW is set.
+const defaultRepeatWindow = 30 * time.Minute
+
+// GetRepeatWindow returns how long after a counted view further views by the same visitor are excluded,
+// from the VIEW_REPEAT_WINDOW environment variable (e.g. "30m"). 0 counts every view.
+func GetRepeatWindow() time.Duration {
+	window, err := time.ParseDuration(os.Getenv("VIEW_REPEAT_WINDOW"))
+	if err != nil || window < 0 {
+		return defaultRepeatWindow
+	}
+	return window
+}
+
+// CountryHeaders are the headers CDNs set to the visitor's country, in order of preference.
+var CountryHeaders = []string{"CF-IPCountry", "CloudFront-Viewer-Country", "X-Country-Code"}
+
+var (
+	botPattern    = regexp.MustCompile(`(?i)bot|crawl|spider|slurp|preview|fetch|scrape|curl|wget|python-requests|headless`)
+	mobilePattern = regexp.MustCompile(`(?i)mobi|iphone|ipod|windows phone`)
+	// Android devices without "Mobile" in their user agent are tablets
+	tabletPattern = regexp.MustCompile(`(?i)ipad|tablet|kindle|silk|playbook|android`)
+	countryCode   = regexp.MustCompile(`^[A-Z]{2}$`)
+)
+
+// Visit is a view of a page, as recorded for analytics.
+type Visit struct {
+	PageID    uint
+	Time      time.Time
+	VisitorID string
+	Referrer  string
+	Device    string
+	Country   string
+	// Excluded is why the visit isn't counted, empty if it is.
+	Excluded string
+	// ViewsResetAt is when the view counts of the page were last reset, see models.Page.
+	ViewsResetAt time.Time
+}
+
+// NewVisit returns the visit of a page by the client of the request, who has the given access to the page.
+// The visitor is identified by a keyed hash of their IP address and user agent, so they can't be recovered from it.
+// Visits by the owner, collaborators and bots, and visits repeated within the repeat window are excluded.
+func NewVisit(c *gin.Context, page models.Page, access auth.Access) Visit {
+	visit := Visit{
+		PageID:    page.ID,
+		Time:      time.Now(),
+		VisitorID: VisitorID(c.ClientIP(), c.Request.UserAgent()),
+		Referrer:  referrerHost(c.Request.Referer(), c.Request.Host),
+		Device:    Device(c.Request.UserAgent()),
+		Country:   country(c),
+		// Flush drops the visit if the view counts are reset again before it is stored
+		ViewsResetAt: page.ViewsResetAt,
+	}
+
+	switch {
+	case access == auth.AccessOwner:
+		visit.Excluded = ExcludedOwner
+	case access == auth.AccessShared:
+		visit.Excluded = ExcludedCollaborator
+	case visit.Device == DeviceBot:
+		visit.Excluded = ExcludedBot
+	case isRepeat(c, visit):
+		visit.Excluded = ExcludedRepeat
+	}
+	return visit
+}
+
+// isRepeat returns true if the visitor's previous counted view of the page is within the repeat window,
+// and starts a new window otherwise. Repeats aren't detected while caching is disabled.
+func isRepeat(ctx context.Context, visit Visit) bool {
+	window := GetRepeatWindow()
+	if window == 0 {
+		return false
+	}
+
+	// Set only if absent, so of concurrent views only one starts the window and is counted
+	key := fmt.Sprintf("/page-view-seen/%d/%s", visit.PageID, visit.VisitorID)
+	started, err := caching.Default.SetNX(ctx, key, "1", window)
+	if err != nil {
+		fmt.Printf("Failed to store %s in cache: %s\n", key, err)
+		return false
+	}
+	return !started
+}
+
+// VisitorID returns the anonymised ID of the visitor with the given IP address and user agent.
+func VisitorID(ip string, userAgent string) string {
+	mac := hmac.New(sha256.New, []byte(auth.GetSecretKey()))
+	mac.Write([]byte(ip))
+	mac.Write([]byte{0})
+	mac.Write([]byte(userAgent))
+	return hex.EncodeToString(mac.Sum(nil))[:16]
+}
+
+// Device returns the class of a user agent.
+func Device(userAgent string) string {
+	switch {
+	case userAgent == "":
+		return DeviceOther
+	case botPattern.MatchString(userAgent):
+		return DeviceBot
+	case mobilePattern.MatchString(userAgent):
+		return DeviceMobile
+	case tabletPattern.MatchString(userAgent):
+		return DeviceTablet
+	case strings.Contains(userAgent, "Mozilla/"):
+		return DeviceDesktop
+	}
+	return DeviceOther
+}
+
+// referrerHost returns the host of the referrer, empty for direct visits and links within the app.
+func referrerHost(referrer string, host string) string {
+	u, err := url.Parse(referrer)
+	if err != nil || u.Hostname() == "" {
+		return ""
+	}
+	referrerHost := strings.ToLower(u.Hostname())
+	if referrerHost == strings.ToLower(strings.Split(host, ":")[0]) {
+		return ""
+	}
+	if frontend, err := url.Parse(auth.GetFrontendURL()); err == nil && strings.EqualFold(frontend.Hostname(), referrerHost) {
+		return ""
+	}
+	return referrerHost
+}
+
+// country returns the visitor's country from the headers set by the CDN, empty if unknown.
+func country(c *gin.Context) string {
+	for _, header := range CountryHeaders {
+		if value := strings.ToUpper(c.GetHeader(header)); countryCode.MatchString(value) && value != "XX" {
+			return value
+		}
+	}
+	return ""
+}
+
+// resetEpoch identifies when the view counts of a page were last reset in counter fields, empty if they never were.
+func resetEpoch(viewsResetAt time.Time) string {
+	if viewsResetAt.IsZero() {
+		return ""
+	}
+	return strconv.FormatInt(viewsResetAt.UnixMicro(), 10)
+}
+
+// field returns the counter field of a visit, visits of the same visitor within an hour share a field.
+func field(visit Visit) string {
+	clean := func(s string) string { return strings.ReplaceAll(s, "|", "") }
+	return strings.Join([]string{
+		strconv.FormatUint(uint64(visit.PageID), 10),
+		strconv.FormatInt(visit.Time.UTC().Truncate(time.Hour).Unix(), 10),
+		clean(visit.VisitorID),
+		clean(visit.Referrer),
+		clean(visit.Device),
+		clean(visit.Country),
+		clean(visit.Excluded),
+		resetEpoch(visit.ViewsResetAt),
+	}, "|")
+}
+
+// parseField returns the page views counted in a counter field, and the reset epoch of the page they were recorded in.
+// Fields recorded before the epoch was added have 7 parts and the epoch of pages never reset.
+func parseField(f string) (models.PageView, string, error) {
+	parts := strings.Split(f, "|")
+	if len(parts) == 7 {
+		parts = append(parts, "")
+	}
+	if len(parts) != 8 {
+		return models.PageView{}, "", fmt.Errorf("invalid view counter field %q", f)
+	}
+	pageID, err := strconv.ParseUint(parts[0], 10, 64)
+	if err != nil {
+		return models.PageView{}, "", fmt.Errorf("invalid view counter field %q", f)
+	}
+	hour, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return models.PageView{}, "", fmt.Errorf("invalid view counter field %q", f)
+	}
+	return models.PageView{
+		PageID:    uint(pageID),
+		Hour:      time.Unix(hour, 0).UTC(),
+		VisitorID: parts[2],
+		Referrer:  parts[3],
+		Device:    parts[4],
+		Country:   parts[5],
+		Excluded:  parts[6],
+	}, parts[7], nil
+}
+
+// Record counts a visit of a page.
+// Visits are buffered in counter and stored by Flush, so recording a visit doesn't write to the database.
+func Record(ctx context.Context, counter caching.Counter, visit Visit) error {
+	return counter.Incr(ctx, field(visit), 1)
+}
+
+// Flush stores the visits buffered in counter and adds them to the pages' view counts, one batch at a time until none is left.
+// Each batch is applied in a single transaction and at most once, even if it is drained again after a failure.
+// Visits recorded before the view counts of their page were reset, e.g. when it was made private, are dropped.
+func Flush(ctx context.Context, db *gorm.DB, counter caching.Counter) error {
+	for {
+		batch, err := counter.Drain(ctx)
+		if err != nil {
+			return err
+		}
+		if batch.ID == "" {
+			return nil
+		}
+
+		if err := applyBatch(db, batch); err != nil {
+			return err
+		}
+		if err := counter.Ack(ctx, batch); err != nil {
+			// The batch is drained again, and skipped as it has already been applied
+			return err
+		}
+	}
+}
+
+// applyBatch stores the visits of a batch and adds them to the pages, unless the batch has already been applied.
+func applyBatch(db *gorm.DB, batch caching.Batch) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		record := models.PageViewBatch{BatchID: batch.ID}
+		insert := tx.Clauses(clause.OnConflict{DoNothing: true}).Omit("id").Create(&record)
+		if insert.Error != nil {
+			return insert.Error
+		}
+		if insert.RowsAffected == 0 {
+			return nil
+		}
+
+		pageViews := make([]models.PageView, 0, len(batch.Counts))
+		epochs := make([]string, 0, len(batch.Counts))
+		var pageIDs []uint
+		for f, count := range batch.Counts {
+			pageView, epoch, err := parseField(f)
+			if err != nil {
+				// Don't block the other counts on a malformed field
+				fmt.Println("Skipping view count: ", err)
+				continue
+			}
+			pageView.Views = count
+			pageViews = append(pageViews, pageView)
+			epochs = append(epochs, epoch)
+			pageIDs = append(pageIDs, pageView.PageID)
+		}
+		if len(pageViews) == 0 {
+			return nil
+		}
+
+		// Locked so a concurrent reset either waits for the views to be added, or drops them
+		var pages []models.Page
+		if err := tx.Unscoped().Clauses(clause.Locking{Strength: "UPDATE"}).Select("id", "views_reset_at").
+			Where("id IN ?", pageIDs).Order("id").Find(&pages).Error; err != nil {
+			return err
+		}
+		currentEpochs := make(map[uint]string, len(pages))
+		for _, page := range pages {
+			currentEpochs[page.ID] = resetEpoch(page.ViewsResetAt)
+		}
+
+		kept := pageViews[:0]
+		type totals struct{ counted, excluded int64 }
+		pageTotals := make(map[uint]totals)
+		for i, pageView := range pageViews {
+			if current, ok := currentEpochs[pageView.PageID]; ok && current != epochs[i] {
+				continue
+			}
+			kept = append(kept, pageView)
+			count := pageView.Views
+			pageTotal := pageTotals[pageView.PageID]
+			if pageView.Excluded == "" {
+				pageTotal.counted += count
+			} else {
+				pageTotal.excluded += count
+			}
+			pageTotals[pageView.PageID] = pageTotal
+		}
+		if len(kept) == 0 {
+			return nil
+		}
+
+		if err := tx.Omit("id").CreateInBatches(&kept, 500).Error; err != nil {
+			return err
+		}
+		for pageID, total := range pageTotals {
+			// Incremented in place so concurrent flushes and page updates don't overwrite each other,
+			// and without touching updated_at as views don't modify the page
+			if err := tx.Model(&models.Page{}).Where("id = ?", pageID).UpdateColumns(map[string]interface{}{
+				"view_count":          gorm.Expr("view_count + ?", total.counted),
+				"excluded_view_count": gorm.Expr("excluded_view_count + ?", total.excluded),
+			}).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// RunFlushWorker flushes the visits buffered in counter every interval until ctx is cancelled,
+// then flushes once more so visits recorded before shutdown aren't lost.
+func RunFlushWorker(ctx context.Context, db *gorm.DB, counter caching.Counter, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			flushCtx, cancel := context.WithTimeout(context.Background(), shutdownFlushTimeout)
+			defer cancel()
+			if err := Flush(flushCtx, db, counter); err != nil {
+				fmt.Println("Failed to flush view counts on shutdown: ", err)
+			}
+			return
+		case <-ticker.C:
+		}
+
+		if err := Flush(ctx, db, counter); err != nil {
+			fmt.Println("Failed to flush view counts: ", err)
+		}
+		if err := db.Where("created_at < ?", time.Now().Add(-batchRetention)).Delete(&models.PageViewBatch{}).Error; err != nil {
+			fmt.Println("Failed to prune flushed view batches: ", err)
+		}
+	}
+}
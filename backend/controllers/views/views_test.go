@@ -0,0 +1,145 @@
+package views
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/opalescencelabs/backend/api/caching"
+)
+
+func TestDevice(t *testing.T) {
+	tests := []struct {
+		name      string
+		userAgent string
+		want      string
+	}{
+		{"empty", "", DeviceOther},
+		{"desktop chrome", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0 Safari/537.36", DeviceDesktop},
+		{"desktop safari", "Mozilla/5.0 (Macintosh; Intel Mac OS X 14_0) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.0 Safari/605.1.15", DeviceDesktop},
+		{"iphone", "Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Mobile/15E148", DeviceMobile},
+		{"android phone", "Mozilla/5.0 (Linux; Android 14; Pixel 8) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0 Mobile Safari/537.36", DeviceMobile},
+		{"android tablet", "Mozilla/5.0 (Linux; Android 13; SM-X700) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0 Safari/537.36", DeviceTablet},
+		{"ipad", "Mozilla/5.0 (iPad; CPU OS 17_0 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.0 Safari/604.1", DeviceTablet},
+		{"googlebot", "Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)", DeviceBot},
+		{"mobile bot", "Mozilla/5.0 (Linux; Android 6.0.1; Nexus 5X) AppleWebKit/537.36 (KHTML, like Gecko) Mobile Safari/537.36 (compatible; Googlebot/2.1)", DeviceBot},
+		{"link preview", "Slackbot-LinkExpanding 1.0 (+https://api.slack.com/robots)", DeviceBot},
+		{"curl", "curl/8.4.0", DeviceBot},
+		{"headless chrome", "Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) HeadlessChrome/120.0 Safari/537.36", DeviceBot},
+		{"unknown client", "SomeClient/1.0", DeviceOther},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := Device(tc.userAgent); got != tc.want {
+				t.Errorf("Device(%q) = %q, want %q", tc.userAgent, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestFieldRoundTrip(t *testing.T) {
+	tests := []struct {
+		name  string
+		visit Visit
+	}{
+		{"counted", Visit{PageID: 42, Time: time.Date(2024, 3, 1, 10, 59, 59, 0, time.UTC), VisitorID: "abcdef0123456789", Referrer: "news.example.com", Device: DeviceMobile, Country: "FR"}},
+		{"excluded without referrer and country", Visit{PageID: 7, Time: time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC), VisitorID: "0123456789abcdef", Device: DeviceBot, Excluded: ExcludedBot}},
+		{"separator in referrer", Visit{PageID: 1, Time: time.Date(2024, 3, 1, 0, 30, 0, 0, time.UTC), VisitorID: "v", Referrer: "a|b.example.com", Device: DeviceDesktop}},
+		{"page with reset views", Visit{PageID: 3, Time: time.Date(2024, 3, 1, 0, 30, 0, 0, time.UTC), VisitorID: "v", Device: DeviceDesktop, ViewsResetAt: time.Date(2024, 2, 1, 12, 0, 0, 123000, time.UTC)}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			pageView, epoch, err := parseField(field(tc.visit))
+			if err != nil {
+				t.Fatalf("parseField() = %v", err)
+			}
+			if pageView.PageID != tc.visit.PageID || pageView.VisitorID != tc.visit.VisitorID ||
+				pageView.Device != tc.visit.Device || pageView.Country != tc.visit.Country || pageView.Excluded != tc.visit.Excluded {
+				t.Errorf("parseField() = %+v, want the fields of %+v", pageView, tc.visit)
+			}
+			if want := strings.ReplaceAll(tc.visit.Referrer, "|", ""); pageView.Referrer != want {
+				t.Errorf("parseField() referrer = %q, want %q", pageView.Referrer, want)
+			}
+			if want := tc.visit.Time.Truncate(time.Hour); !pageView.Hour.Equal(want) {
+				t.Errorf("parseField() hour = %v, want %v", pageView.Hour, want)
+			}
+			if want := resetEpoch(tc.visit.ViewsResetAt); epoch != want {
+				t.Errorf("parseField() epoch = %q, want %q", epoch, want)
+			}
+		})
+	}
+}
+
+func TestFieldSharedWithinAnHour(t *testing.T) {
+	visit := Visit{PageID: 1, Time: time.Date(2024, 3, 1, 10, 5, 0, 0, time.UTC), VisitorID: "v", Device: DeviceDesktop}
+	later := visit
+	later.Time = visit.Time.Add(50 * time.Minute)
+	nextHour := visit
+	nextHour.Time = visit.Time.Add(time.Hour)
+
+	if field(visit) != field(later) {
+		t.Errorf("visits within the hour have different fields %q and %q", field(visit), field(later))
+	}
+	if field(visit) == field(nextHour) {
+		t.Errorf("visits in different hours share the field %q", field(visit))
+	}
+}
+
+func TestParseFieldWithoutEpoch(t *testing.T) {
+	pageView, epoch, err := parseField("1|1700000000|v|r|desktop|FR|")
+	if err != nil || pageView.PageID != 1 || epoch != "" {
+		t.Errorf("parseField() = %+v, %q, %v, want page 1 without epoch", pageView, epoch, err)
+	}
+}
+
+func TestParseFieldInvalid(t *testing.T) {
+	for _, f := range []string{"", "1|2|3", "x|1700000000|v|||desktop||", "1|yesterday|v|r|desktop|FR|", "1|1700000000|v|r|desktop|FR||1700000000000000|extra"} {
+		if _, _, err := parseField(f); err == nil {
+			t.Errorf("parseField(%q) = nil, want an error", f)
+		}
+	}
+}
+
+func TestIsRepeatCountsConcurrentViewsOnce(t *testing.T) {
+	previous := caching.Default
+	caching.Default = caching.NewMemory(100)
+	defer func() { caching.Default = previous }()
+	t.Setenv("VIEW_REPEAT_WINDOW", "1m")
+
+	visit := Visit{PageID: 1, VisitorID: "concurrent"}
+	var counted atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if !isRepeat(context.Background(), visit) {
+				counted.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if n := counted.Load(); n != 1 {
+		t.Errorf("%d concurrent views counted, want 1", n)
+	}
+	other := Visit{PageID: 2, VisitorID: "concurrent"}
+	if isRepeat(context.Background(), other) {
+		t.Error("first view of another page is a repeat")
+	}
+}
+
+func TestIsRepeatDisabled(t *testing.T) {
+	previous := caching.Default
+	caching.Default = caching.NewMemory(100)
+	defer func() { caching.Default = previous }()
+	t.Setenv("VIEW_REPEAT_WINDOW", "0s")
+
+	visit := Visit{PageID: 1, VisitorID: "disabled"}
+	if isRepeat(context.Background(), visit) || isRepeat(context.Background(), visit) {
+		t.Error("isRepeat() = true with a zero window")
+	}
+}
@@ -0,0 +1,218 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/opalescencelabs/backend/api"
+	"github.com/opalescencelabs/backend/controllers/auth"
+	"github.com/opalescencelabs/backend/controllers/webhooks"
+	"github.com/opalescencelabs/backend/database"
+	"github.com/opalescencelabs/backend/models"
+)
+
+// Bounds of the number of deliveries listed at once.
+const (
+	defaultDeliveriesLimit = 20
+	maxDeliveriesLimit     = 100
+)
+
+// respondWebhookError writes the response for an error returned by the webhooks package.
+func respondWebhookError(c *gin.Context, err error, action string) {
+	switch {
+	case errors.Is(err, webhooks.ErrInvalidURL), errors.Is(err, webhooks.ErrInvalidEvents):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, webhooks.ErrTooManyWebhooks):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, webhooks.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Webhook not found"})
+	default:
+		fmt.Printf("Failed to %s: %s\n", action, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to " + action})
+	}
+}
+
+// toWebhookResp converts a webhook to its response, without its secret.
+func toWebhookResp(webhook models.Webhook) api.WebhookResp {
+	return api.WebhookResp{
+		ID:        webhook.ID,
+		URL:       webhook.URL,
+		Events:    webhooks.SubscribedEvents(webhook),
+		Active:    webhook.Active,
+		CreatedAt: webhook.CreatedAt,
+		UpdatedAt: webhook.UpdatedAt,
+	}
+}
+
+// toWebhookDeliveryResp converts a delivery to its response.
+func toWebhookDeliveryResp(delivery models.WebhookDelivery) api.WebhookDeliveryResp {
+	return api.WebhookDeliveryResp{
+		ID:             delivery.ID,
+		EventID:        delivery.EventID,
+		Event:          delivery.Event,
+		Payload:        json.RawMessage(delivery.Payload.Bytes),
+		Status:         delivery.Status,
+		Attempts:       delivery.Attempts,
+		NextAttemptAt:  delivery.NextAttemptAt,
+		ResponseStatus: delivery.ResponseStatus,
+		ResponseBody:   delivery.ResponseBody,
+		Error:          delivery.Error,
+		CreatedAt:      delivery.CreatedAt,
+		DeliveredAt:    delivery.DeliveredAt,
+	}
+}
+
+// WebhookCreate is the handler for POST /webhook-create.
+// Registers a URL to receive the events of the user's pages it subscribes to.
+// The response holds the secret payloads are signed with, it is not returned again.
+// Returns 200 on success, 400 on bad request, 401 on unauthorized, 403 on too many webhooks, 500 on error.
+func WebhookCreate(c *gin.Context) {
+	var request api.WebhookCreateRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "details": err.Error()})
+		return
+	}
+
+	webhook, err := webhooks.Create(database.DB, auth.MustCurrentUserID(c), request.URL, request.Events)
+	if err != nil {
+		respondWebhookError(c, err, "create webhook")
+		return
+	}
+
+	c.JSON(http.StatusOK, api.WebhookCreateResp{Webhook: toWebhookResp(webhook), Secret: webhook.Secret})
+}
+
+// WebhookUpdate is the handler for POST /webhook-update.
+// Changes the URL or events of a webhook, or deactivates it. Missing fields are left as they are.
+// Returns 200 on success, 400 on bad request, 401 on unauthorized, 404 on not found, 500 on error.
+func WebhookUpdate(c *gin.Context) {
+	var request api.WebhookUpdateRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "details": err.Error()})
+		return
+	}
+
+	webhook, err := webhooks.Get(database.DB, auth.MustCurrentUserID(c), request.WebhookID)
+	if err != nil {
+		respondWebhookError(c, err, "update webhook")
+		return
+	}
+	if webhook, err = webhooks.Update(database.DB, webhook, request.URL, request.Events, request.Active); err != nil {
+		respondWebhookError(c, err, "update webhook")
+		return
+	}
+
+	c.JSON(http.StatusOK, api.WebhookUpdateResp{Webhook: toWebhookResp(webhook)})
+}
+
+// WebhookDelete is the handler for POST /webhook-delete.
+// Deletes a webhook and its delivery log, pending deliveries are dropped.
+// Returns 200 on success, 400 on bad request, 401 on unauthorized, 404 on not found, 500 on error.
+func WebhookDelete(c *gin.Context) {
+	var request api.WebhookDeleteRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "details": err.Error()})
+		return
+	}
+
+	webhook, err := webhooks.Get(database.DB, auth.MustCurrentUserID(c), request.WebhookID)
+	if err != nil {
+		respondWebhookError(c, err, "delete webhook")
+		return
+	}
+	if err := webhooks.Delete(database.DB, webhook); err != nil {
+		respondWebhookError(c, err, "delete webhook")
+		return
+	}
+
+	c.JSON(http.StatusOK, api.WebhookDeleteResp{})
+}
+
+// WebhookList is the handler for GET /webhook-list.
+// Returns the user's webhooks and the events they may subscribe to.
+// Returns 200 on success, 401 on unauthorized, 500 on error.
+func WebhookList(c *gin.Context) {
+	list, err := webhooks.List(database.DB, auth.MustCurrentUserID(c))
+	if err != nil {
+		respondWebhookError(c, err, "list webhooks")
+		return
+	}
+
+	resp := api.WebhookListResp{Webhooks: make([]api.WebhookResp, len(list)), Events: webhooks.Events}
+	for i, webhook := range list {
+		resp.Webhooks[i] = toWebhookResp(webhook)
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// WebhookDeliveries is the handler for GET /webhook-deliveries/:webhook_id.
+// Returns the delivery log of a webhook, newest first, paginated with limit (default 20, at most 100) and offset.
+// Returns 200 on success, 400 on bad request, 401 on unauthorized, 404 on not found, 500 on error.
+func WebhookDeliveries(c *gin.Context) {
+	var request api.WebhookDeliveriesRequest
+	if err := c.ShouldBindQuery(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "details": err.Error()})
+		return
+	}
+	if request.Limit <= 0 {
+		request.Limit = defaultDeliveriesLimit
+	}
+	if request.Limit > maxDeliveriesLimit || request.Offset < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Limit must be at most %d and offset positive", maxDeliveriesLimit)})
+		return
+	}
+	webhookID, err := strconv.ParseUint(c.Param("webhook_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid webhook ID"})
+		return
+	}
+
+	webhook, err := webhooks.Get(database.DB, auth.MustCurrentUserID(c), uint(webhookID))
+	if err != nil {
+		respondWebhookError(c, err, "list deliveries")
+		return
+	}
+	deliveries, total, err := webhooks.Deliveries(database.DB, webhook.ID, request.Limit, request.Offset)
+	if err != nil {
+		respondWebhookError(c, err, "list deliveries")
+		return
+	}
+
+	resp := api.WebhookDeliveriesResp{Deliveries: make([]api.WebhookDeliveryResp, len(deliveries)), Total: total}
+	for i, delivery := range deliveries {
+		resp.Deliveries[i] = toWebhookDeliveryResp(delivery)
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// WebhookRedeliver is the handler for POST /webhook-redeliver.
+// Delivers the event of a delivery again, e.g. after fixing the receiving end. The webhook must be active.
+// Returns 200 on success, 400 on bad request, 401 on unauthorized, 404 on not found, 409 on inactive webhook, 500 on error.
+func WebhookRedeliver(c *gin.Context) {
+	var request api.WebhookRedeliverRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request", "details": err.Error()})
+		return
+	}
+
+	delivery, webhook, err := webhooks.GetDelivery(database.DB, auth.MustCurrentUserID(c), request.DeliveryID)
+	if err != nil {
+		respondWebhookError(c, err, "redeliver")
+		return
+	}
+	if !webhook.Active {
+		c.JSON(http.StatusConflict, gin.H{"error": "Webhook is inactive"})
+		return
+	}
+	redelivery, err := webhooks.Redeliver(database.DB, delivery)
+	if err != nil {
+		respondWebhookError(c, err, "redeliver")
+		return
+	}
+
+	c.JSON(http.StatusOK, api.WebhookRedeliverResp{Delivery: toWebhookDeliveryResp(redelivery)})
+}
@@ -0,0 +1,240 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/opalescencelabs/backend/models"
+	"gorm.io/gorm"
+)
+
+// Headers of deliveries.
+const (
+	EventHeader    = "Opalescence-Event"
+	DeliveryHeader = "Opalescence-Delivery"
+	// SignatureHeader holds "t=<unix time>,v1=<hex HMAC-SHA256 of "<unix time>.<body>" keyed with the webhook secret>",
+	// the scheme of the payment provider's webhooks, see Sign.
+	SignatureHeader = "Opalescence-Signature"
+)
+
+// MaxAttempts bounds the number of attempts of a delivery, retried with exponential backoff.
+const MaxAttempts = 10
+
+// Bounds of the delay before retrying a delivery, doubled after every attempt.
+const (
+	BaseBackoff = 30 * time.Second
+	MaxBackoff  = 6 * time.Hour
+)
+
+// Timeout bounds the duration of an attempt.
+const Timeout = 10 * time.Second
+
+// dispatchBatchSize bounds the number of deliveries attempted per run of the dispatcher.
+const dispatchBatchSize = 50
+
+// maxResponseBody bounds the length of the response body kept in the delivery log.
+const maxResponseBody = 1024
+
+// ErrPrivateAddress is returned when a webhook URL resolves to an address in a private network.
+var ErrPrivateAddress = errors.New("webhook address is in a private network")
+
+// GetAllowPrivateNetworks returns true if webhooks may be delivered to private networks, e.g. to localhost in development.
+func GetAllowPrivateNetworks() bool {
+	return os.Getenv("WEBHOOK_ALLOW_PRIVATE_NETWORKS") == "true"
+}
+
+// NewClient returns the HTTP client delivering webhooks. Redirects are not followed, and unless allowPrivate is true,
+// connections to loopback, private and link-local addresses are refused, so webhooks can't reach internal services.
+func NewClient(allowPrivate bool) *http.Client {
+	dialer := &net.Dialer{Timeout: Timeout}
+	if !allowPrivate {
+		// Checked on the resolved address, so DNS names pointing to private networks are refused too
+		dialer.Control = func(network string, address string, c syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			ip := net.ParseIP(host)
+			if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsLinkLocalUnicast() ||
+				ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() || ip.IsMulticast() {
+				return ErrPrivateAddress
+			}
+			return nil
+		}
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = dialer.DialContext
+	transport.Proxy = nil
+	return &http.Client{
+		Timeout:   Timeout,
+		Transport: transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// Backoff returns the delay before the attempt following the given number of attempts.
+func Backoff(attempts int) time.Duration {
+	delay := BaseBackoff
+	for i := 1; i < attempts && delay < MaxBackoff; i++ {
+		delay *= 2
+	}
+	return min(delay, MaxBackoff)
+}
+
+// claim returns the due pending deliveries and postpones them by a lease, so other instances of the app don't attempt them too.
+// A delivery whose attempt was interrupted, e.g. by a restart, is attempted again once the lease expires.
+func claim(db *gorm.DB, now time.Time) ([]models.WebhookDelivery, error) {
+	var deliveries []models.WebhookDelivery
+	err := db.Raw(`
+		UPDATE webhook_deliveries SET next_attempt_at = @lease, updated_at = @now
+		WHERE id IN (
+			SELECT id FROM webhook_deliveries
+			WHERE status = @pending AND next_attempt_at <= @now
+			ORDER BY next_attempt_at
+			LIMIT @limit
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING *`,
+		map[string]interface{}{"lease": now.Add(2 * Timeout * dispatchBatchSize), "now": now, "pending": StatusPending, "limit": dispatchBatchSize}).
+		Scan(&deliveries).Error
+	return deliveries, err
+}
+
+// Dispatch attempts the due pending deliveries. Failed attempts are retried after Backoff until MaxAttempts.
+// Returns the number of deliveries attempted.
+func Dispatch(ctx context.Context, db *gorm.DB, client *http.Client) (int, error) {
+	deliveries, err := claim(db, time.Now())
+	if err != nil || len(deliveries) == 0 {
+		return 0, err
+	}
+
+	webhookIDs := make([]uint, len(deliveries))
+	for i, delivery := range deliveries {
+		webhookIDs[i] = delivery.WebhookID
+	}
+	var webhooks []models.Webhook
+	if err := db.Where("id IN ?", webhookIDs).Find(&webhooks).Error; err != nil {
+		return 0, err
+	}
+	byID := make(map[uint]models.Webhook, len(webhooks))
+	for _, webhook := range webhooks {
+		byID[webhook.ID] = webhook
+	}
+
+	attempted := 0
+	for _, delivery := range deliveries {
+		if ctx.Err() != nil {
+			// Attempted again once the lease expires
+			return attempted, ctx.Err()
+		}
+		webhook, ok := byID[delivery.WebhookID]
+		var updates map[string]interface{}
+		if !ok || !webhook.Active {
+			updates = map[string]interface{}{"status": StatusFailed, "next_attempt_at": nil, "error": "webhook deactivated"}
+		} else {
+			updates = attempt(ctx, client, webhook, delivery)
+			if ctx.Err() != nil {
+				// Interrupted attempts don't count
+				return attempted, ctx.Err()
+			}
+			attempted++
+		}
+		if err := db.Model(&models.WebhookDelivery{}).Where("id = ?", delivery.ID).Updates(updates).Error; err != nil {
+			return attempted, err
+		}
+	}
+	return attempted, nil
+}
+
+// attempt posts the payload of a delivery to its webhook, and returns the updates of the delivery.
+func attempt(ctx context.Context, client *http.Client, webhook models.Webhook, delivery models.WebhookDelivery) map[string]interface{} {
+	attempts := delivery.Attempts + 1
+	updates := map[string]interface{}{"attempts": attempts, "response_status": 0, "response_body": "", "error": ""}
+
+	status, body, err := post(ctx, client, webhook, delivery)
+	now := time.Now()
+	if err == nil && status >= 200 && status < 300 {
+		updates["status"], updates["next_attempt_at"], updates["delivered_at"] = StatusSucceeded, nil, now
+		updates["response_status"], updates["response_body"] = status, body
+		return updates
+	}
+
+	if err != nil {
+		updates["error"] = err.Error()
+	} else {
+		updates["response_status"], updates["response_body"] = status, body
+		updates["error"] = fmt.Sprintf("unexpected status %d", status)
+	}
+	if attempts >= MaxAttempts {
+		updates["status"], updates["next_attempt_at"] = StatusFailed, nil
+	} else {
+		updates["next_attempt_at"] = now.Add(Backoff(attempts))
+	}
+	return updates
+}
+
+// Sign returns the SignatureHeader value for a payload signed with a webhook secret at the given time.
+func Sign(payload []byte, secret string, timestamp time.Time) string {
+	t := strconv.FormatInt(timestamp.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(t + "."))
+	mac.Write(payload)
+	return "t=" + t + ",v1=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// post sends a signed delivery, and returns the response status and the beginning of the response body.
+func post(ctx context.Context, client *http.Client, webhook models.Webhook, delivery models.WebhookDelivery) (int, string, error) {
+	payload := delivery.Payload.Bytes
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader(payload))
+	if err != nil {
+		return 0, "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Opalescence-Webhooks/1.0")
+	req.Header.Set(EventHeader, delivery.Event)
+	req.Header.Set(DeliveryHeader, strconv.FormatUint(uint64(delivery.ID), 10))
+	req.Header.Set(SignatureHeader, Sign(payload, webhook.Secret, time.Now()))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, "", err
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxResponseBody))
+	// Stored as text, which can't hold invalid UTF-8 or NUL characters
+	return resp.StatusCode, strings.ReplaceAll(string(bytes.ToValidUTF8(body, nil)), "\x00", ""), nil
+}
+
+// RunDispatcher attempts due deliveries every interval until ctx is cancelled.
+// Deliveries are stored in the database, so pending deliveries survive restarts.
+func RunDispatcher(ctx context.Context, db *gorm.DB, client *http.Client, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := Dispatch(ctx, db, client); err != nil && !errors.Is(err, context.Canceled) {
+			fmt.Println("Failed to dispatch webhooks: ", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
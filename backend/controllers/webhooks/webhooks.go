@@ -0,0 +1,294 @@
+package webhooks
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgtype"
+	"github.com/opalescencelabs/backend/models"
+	"gorm.io/gorm"
+)
+
+// Events delivered to webhooks.
+const (
+	EventPageCreated     = "page.created"
+	EventPageUpdated     = "page.updated"
+	EventPagePublished   = "page.published"
+	EventPageUnpublished = "page.unpublished"
+	EventPageDeleted     = "page.deleted"
+	// EventElementChanged lists the elements of a page created, updated and deleted by an update.
+	EventElementChanged = "element.changed"
+)
+
+// Events lists every event webhooks may subscribe to.
+var Events = []string{EventPageCreated, EventPageUpdated, EventPagePublished, EventPageUnpublished, EventPageDeleted, EventElementChanged}
+
+// Statuses of deliveries.
+const (
+	// StatusPending deliveries are attempted at NextAttemptAt.
+	StatusPending   = "pending"
+	StatusSucceeded = "succeeded"
+	// StatusFailed deliveries ran out of attempts, or their webhook was deactivated.
+	StatusFailed = "failed"
+)
+
+// MaxWebhooks bounds the number of webhooks of a user.
+const MaxWebhooks = 10
+
+var (
+	// ErrInvalidURL is returned for URLs that aren't absolute http or https URLs.
+	ErrInvalidURL = errors.New("url must be an absolute http or https url of at most 2048 characters")
+	// ErrInvalidEvents is returned for unknown events, or when no event is subscribed to.
+	ErrInvalidEvents = errors.New("events must be one or more of page.created, page.updated, page.published, page.unpublished, page.deleted and element.changed")
+	// ErrTooManyWebhooks is returned when the user already has MaxWebhooks webhooks.
+	ErrTooManyWebhooks = errors.New("at most 10 webhooks per user")
+	// ErrNotFound is returned for webhooks and deliveries that don't exist or belong to another user.
+	ErrNotFound = errors.New("webhook not found")
+)
+
+// Payload is the JSON body delivered to webhooks.
+type Payload struct {
+	// ID identifies the event, redeliveries have the same ID so receivers may skip events they already handled
+	ID        string      `json:"id"`
+	Event     string      `json:"event"`
+	CreatedAt time.Time   `json:"created_at"`
+	Data      interface{} `json:"data"`
+}
+
+// ElementChanges are the elements of a page changed by an update, by element UUID.
+type ElementChanges struct {
+	Created []string `json:"created"`
+	Updated []string `json:"updated"`
+	Deleted []string `json:"deleted"`
+}
+
+// Empty returns true if no element changed.
+func (e ElementChanges) Empty() bool {
+	return len(e.Created) == 0 && len(e.Updated) == 0 && len(e.Deleted) == 0
+}
+
+// PageData returns the data of page events.
+func PageData(page models.Page) map[string]interface{} {
+	data := map[string]interface{}{
+		"page_uuid":        page.PageUUID,
+		"page_name":        page.PageName,
+		"is_root":          page.IsRoot,
+		"parent_page_uuid": page.ParentPageUUID,
+		"public_page":      page.PublicPage,
+		"last_updated_at":  page.LastUpdatedAt,
+	}
+	if page.Slug != nil {
+		data["slug"] = *page.Slug
+	}
+	return data
+}
+
+// NormalizeURL trims the URL and checks it is an absolute http or https URL.
+// Addresses in private networks are refused when delivering, see NewClient.
+func NormalizeURL(raw string) (string, error) {
+	raw = strings.TrimSpace(raw)
+	parsed, err := url.Parse(raw)
+	if err != nil || len(raw) > 2048 || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return "", ErrInvalidURL
+	}
+	return raw, nil
+}
+
+// normalizeEvents checks the events and removes duplicates.
+func normalizeEvents(events []string) ([]string, error) {
+	var normalized []string
+	for _, event := range events {
+		if !slices.Contains(Events, event) {
+			return nil, ErrInvalidEvents
+		}
+		if !slices.Contains(normalized, event) {
+			normalized = append(normalized, event)
+		}
+	}
+	if len(normalized) == 0 {
+		return nil, ErrInvalidEvents
+	}
+	return normalized, nil
+}
+
+// SubscribedEvents returns the events a webhook is subscribed to.
+func SubscribedEvents(webhook models.Webhook) []string {
+	events := []string{}
+	if webhook.Events.Status == pgtype.Present {
+		json.Unmarshal(webhook.Events.Bytes, &events)
+	}
+	return events
+}
+
+// encodeEvents returns the events as stored in Webhook.Events.
+func encodeEvents(events []string) (pgtype.JSONB, error) {
+	var encoded pgtype.JSONB
+	err := encoded.Set(events)
+	return encoded, err
+}
+
+// Create registers an active webhook of the user, with a new secret to sign its payloads.
+func Create(db *gorm.DB, userID uint, rawURL string, events []string) (models.Webhook, error) {
+	webhookURL, err := NormalizeURL(rawURL)
+	if err != nil {
+		return models.Webhook{}, err
+	}
+	if events, err = normalizeEvents(events); err != nil {
+		return models.Webhook{}, err
+	}
+	var count int64
+	if err := db.Model(&models.Webhook{}).Where("user_id = ?", userID).Count(&count).Error; err != nil {
+		return models.Webhook{}, err
+	}
+	if count >= MaxWebhooks {
+		return models.Webhook{}, ErrTooManyWebhooks
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return models.Webhook{}, err
+	}
+	webhook := models.Webhook{UserID: userID, URL: webhookURL, Secret: "whsec_" + hex.EncodeToString(secret), Active: true}
+	if webhook.Events, err = encodeEvents(events); err != nil {
+		return models.Webhook{}, err
+	}
+	if err := db.Omit("id").Create(&webhook).Error; err != nil {
+		return models.Webhook{}, err
+	}
+	return webhook, nil
+}
+
+// Get returns a webhook of the user.
+func Get(db *gorm.DB, userID uint, webhookID uint) (models.Webhook, error) {
+	var webhook models.Webhook
+	if err := db.Where("id = ? AND user_id = ?", webhookID, userID).First(&webhook).Error; err != nil {
+		return models.Webhook{}, ErrNotFound
+	}
+	return webhook, nil
+}
+
+// Update changes the URL, events and whether a webhook is active, nil values are left as they are.
+// Pending deliveries of a deactivated webhook fail.
+func Update(db *gorm.DB, webhook models.Webhook, rawURL *string, events []string, active *bool) (models.Webhook, error) {
+	var err error
+	if rawURL != nil {
+		if webhook.URL, err = NormalizeURL(*rawURL); err != nil {
+			return models.Webhook{}, err
+		}
+	}
+	if events != nil {
+		if events, err = normalizeEvents(events); err != nil {
+			return models.Webhook{}, err
+		}
+		if webhook.Events, err = encodeEvents(events); err != nil {
+			return models.Webhook{}, err
+		}
+	}
+	if active != nil {
+		webhook.Active = *active
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&webhook).Select("url", "events", "active").Updates(&webhook).Error; err != nil {
+			return err
+		}
+		if webhook.Active {
+			return nil
+		}
+		return tx.Model(&models.WebhookDelivery{}).
+			Where("webhook_id = ? AND status = ?", webhook.ID, StatusPending).
+			Updates(map[string]interface{}{"status": StatusFailed, "next_attempt_at": nil, "error": "webhook deactivated"}).Error
+	})
+	return webhook, err
+}
+
+// Delete deletes a webhook and its deliveries.
+func Delete(db *gorm.DB, webhook models.Webhook) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("webhook_id = ?", webhook.ID).Delete(&models.WebhookDelivery{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&webhook).Error
+	})
+}
+
+// List returns the user's webhooks, oldest first.
+func List(db *gorm.DB, userID uint) ([]models.Webhook, error) {
+	var webhooks []models.Webhook
+	err := db.Where("user_id = ?", userID).Order("id").Find(&webhooks).Error
+	return webhooks, err
+}
+
+// Enqueue queues the delivery of an event to the user's active webhooks subscribed to it.
+// Call it with the transaction making the change, so events are only delivered for committed changes.
+func Enqueue(tx *gorm.DB, userID uint, event string, data interface{}) error {
+	var webhooks []models.Webhook
+	if err := tx.Where("user_id = ? AND active AND events @> ?::jsonb", userID, `["`+event+`"]`).Find(&webhooks).Error; err != nil {
+		return err
+	}
+	if len(webhooks) == 0 {
+		return nil
+	}
+
+	now := time.Now()
+	eventID := uuid.New().String()
+	payload, err := json.Marshal(Payload{ID: eventID, Event: event, CreatedAt: now, Data: data})
+	if err != nil {
+		return err
+	}
+	encoded := pgtype.JSONB{Bytes: payload, Status: pgtype.Present}
+
+	deliveries := make([]models.WebhookDelivery, len(webhooks))
+	for i, webhook := range webhooks {
+		deliveries[i] = models.WebhookDelivery{
+			WebhookID: webhook.ID, EventID: eventID, Event: event, Payload: encoded, Status: StatusPending, NextAttemptAt: &now,
+		}
+	}
+	return tx.Omit("id").Create(&deliveries).Error
+}
+
+// Deliveries returns the deliveries of a webhook, newest first, and their total.
+func Deliveries(db *gorm.DB, webhookID uint, limit int, offset int) ([]models.WebhookDelivery, int64, error) {
+	query := db.Model(&models.WebhookDelivery{}).Where("webhook_id = ?", webhookID)
+	var total int64
+	if err := query.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var deliveries []models.WebhookDelivery
+	err := query.Order("id DESC").Limit(limit).Offset(offset).Find(&deliveries).Error
+	return deliveries, total, err
+}
+
+// GetDelivery returns a delivery to one of the user's webhooks, with the webhook.
+func GetDelivery(db *gorm.DB, userID uint, deliveryID uint) (models.WebhookDelivery, models.Webhook, error) {
+	var delivery models.WebhookDelivery
+	if err := db.First(&delivery, "id = ?", deliveryID).Error; err != nil {
+		return models.WebhookDelivery{}, models.Webhook{}, ErrNotFound
+	}
+	webhook, err := Get(db, userID, delivery.WebhookID)
+	if err != nil {
+		return models.WebhookDelivery{}, models.Webhook{}, err
+	}
+	return delivery, webhook, nil
+}
+
+// Redeliver queues a new delivery of the event of a delivery, attempted right away.
+// The payload is the same, including the event ID.
+func Redeliver(db *gorm.DB, delivery models.WebhookDelivery) (models.WebhookDelivery, error) {
+	now := time.Now()
+	redelivery := models.WebhookDelivery{
+		WebhookID: delivery.WebhookID, EventID: delivery.EventID, Event: delivery.Event, Payload: delivery.Payload,
+		Status: StatusPending, NextAttemptAt: &now,
+	}
+	if err := db.Omit("id").Create(&redelivery).Error; err != nil {
+		return models.WebhookDelivery{}, err
+	}
+	return redelivery, nil
+}
@@ -0,0 +1,190 @@
+package webhooks
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgtype"
+	"github.com/opalescencelabs/backend/models"
+)
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{0, BaseBackoff},
+		{1, BaseBackoff},
+		{2, 2 * BaseBackoff},
+		{3, 4 * BaseBackoff},
+		{9, 256 * BaseBackoff},
+		{10, 512 * BaseBackoff},
+		{11, MaxBackoff},
+		{100, MaxBackoff},
+	}
+	for _, tc := range tests {
+		if got := Backoff(tc.attempts); got != tc.want {
+			t.Errorf("Backoff(%d) = %v, want %v", tc.attempts, got, tc.want)
+		}
+	}
+}
+
+func TestSign(t *testing.T) {
+	payload := []byte(`{"event":"page.updated"}`)
+	timestamp := time.Unix(1700000000, 0)
+
+	mac := hmac.New(sha256.New, []byte("whsec"))
+	mac.Write([]byte("1700000000." + string(payload)))
+	want := "t=1700000000,v1=" + hex.EncodeToString(mac.Sum(nil))
+	if got := Sign(payload, "whsec", timestamp); got != want {
+		t.Errorf("Sign() = %q, want %q", got, want)
+	}
+	if Sign(payload, "other", timestamp) == want {
+		t.Error("Sign() doesn't depend on the secret")
+	}
+	if Sign(payload, "whsec", timestamp.Add(time.Second)) == want {
+		t.Error("Sign() doesn't depend on the timestamp")
+	}
+}
+
+func TestNormalizeURL(t *testing.T) {
+	tests := []struct {
+		raw     string
+		want    string
+		wantErr error
+	}{
+		{"https://example.com/hooks", "https://example.com/hooks", nil},
+		{"  http://example.com:8080/hooks?x=1 ", "http://example.com:8080/hooks?x=1", nil},
+		{"ftp://example.com/hook", "", ErrInvalidURL},
+		{"/hooks", "", ErrInvalidURL},
+		{"https://", "", ErrInvalidURL},
+		{"https://example.com/" + strings.Repeat("a", 2048), "", ErrInvalidURL},
+	}
+	for _, tc := range tests {
+		got, err := NormalizeURL(tc.raw)
+		if got != tc.want || !errors.Is(err, tc.wantErr) {
+			t.Errorf("NormalizeURL(%q) = %q, %v, want %q, %v", tc.raw, got, err, tc.want, tc.wantErr)
+		}
+	}
+}
+
+func TestNormalizeEvents(t *testing.T) {
+	got, err := normalizeEvents([]string{EventPageUpdated, EventPageDeleted, EventPageUpdated})
+	if err != nil || !reflect.DeepEqual(got, []string{EventPageUpdated, EventPageDeleted}) {
+		t.Errorf("normalizeEvents() = %v, %v, want the events without duplicates", got, err)
+	}
+	for _, events := range [][]string{nil, {}, {"page.viewed"}, {EventPageUpdated, "page.viewed"}} {
+		if _, err := normalizeEvents(events); !errors.Is(err, ErrInvalidEvents) {
+			t.Errorf("normalizeEvents(%v) = %v, want ErrInvalidEvents", events, err)
+		}
+	}
+}
+
+// testDelivery returns a webhook posting to url and a delivery of it.
+func testDelivery(t *testing.T, url string, attempts int) (models.Webhook, models.WebhookDelivery) {
+	t.Helper()
+	var payload pgtype.JSONB
+	if err := payload.Set(map[string]interface{}{"event": EventPageUpdated}); err != nil {
+		t.Fatal(err)
+	}
+	return models.Webhook{ID: 1, URL: url, Secret: "whsec", Active: true},
+		models.WebhookDelivery{ID: 7, WebhookID: 1, Event: EventPageUpdated, Payload: payload, Attempts: attempts}
+}
+
+func TestAttemptSucceeds(t *testing.T) {
+	var header http.Header
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header.Clone()
+		body, _ = io.ReadAll(r.Body)
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	webhook, delivery := testDelivery(t, server.URL, 0)
+	updates := attempt(context.Background(), NewClient(true), webhook, delivery)
+
+	if updates["status"] != StatusSucceeded || updates["attempts"] != 1 || updates["response_status"] != 200 || updates["response_body"] != "ok" {
+		t.Errorf("attempt() = %v, want a successful attempt", updates)
+	}
+	if header.Get(EventHeader) != EventPageUpdated || header.Get(DeliveryHeader) != "7" {
+		t.Errorf("headers = %v", header)
+	}
+	// The signature covers the exact body received
+	timestamp, err := strconv.ParseInt(strings.TrimPrefix(strings.Split(header.Get(SignatureHeader), ",")[0], "t="), 10, 64)
+	if err != nil {
+		t.Fatalf("signature %q has no timestamp", header.Get(SignatureHeader))
+	}
+	if header.Get(SignatureHeader) != Sign(body, "whsec", time.Unix(timestamp, 0)) {
+		t.Errorf("signature %q doesn't match the body", header.Get(SignatureHeader))
+	}
+}
+
+func TestAttemptFails(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte("invalid \xff utf-8 \x00"))
+	}))
+	defer server.Close()
+
+	webhook, delivery := testDelivery(t, server.URL, 2)
+	updates := attempt(context.Background(), NewClient(true), webhook, delivery)
+	if updates["attempts"] != 3 || updates["response_status"] != 500 || updates["error"] != "unexpected status 500" || updates["status"] != nil {
+		t.Errorf("attempt() = %v, want a failed attempt to retry", updates)
+	}
+	if next, ok := updates["next_attempt_at"].(time.Time); !ok || time.Until(next) < Backoff(3)-time.Minute {
+		t.Errorf("next attempt at %v, want after Backoff(3)", updates["next_attempt_at"])
+	}
+	if body := updates["response_body"].(string); strings.ContainsRune(body, 0) || !strings.HasPrefix(body, "invalid ") {
+		t.Errorf("response body %q isn't stored as text", body)
+	}
+
+	// The last attempt fails the delivery
+	webhook, delivery = testDelivery(t, server.URL, MaxAttempts-1)
+	updates = attempt(context.Background(), NewClient(true), webhook, delivery)
+	if updates["status"] != StatusFailed || updates["next_attempt_at"] != nil {
+		t.Errorf("last attempt() = %v, want the delivery failed", updates)
+	}
+}
+
+func TestNewClientRefusesPrivateNetworks(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	_, err := NewClient(false).Get(server.URL)
+	if !errors.Is(err, ErrPrivateAddress) {
+		t.Errorf("Get() of a loopback address = %v, want ErrPrivateAddress", err)
+	}
+	resp, err := NewClient(true).Get(server.URL)
+	if err != nil {
+		t.Fatalf("Get() with private networks allowed = %v", err)
+	}
+	resp.Body.Close()
+}
+
+func TestNewClientDoesNotFollowRedirects(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "http://169.254.169.254/latest/meta-data", http.StatusFound)
+	}))
+	defer server.Close()
+
+	resp, err := NewClient(true).Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusFound {
+		t.Errorf("status = %d, want the redirect itself", resp.StatusCode)
+	}
+}
@@ -0,0 +1,46 @@
+package database
+
+// protectAuditEvents makes the audit_events table append-only: a trigger rejects deletions, and updates
+// unless they anonymise entries, so recorded entries can't be altered by the app.
+// Updates are only accepted within a transaction that set opalescence.audit_anonymise, see audit.Anonymise,
+// and may only clear the actor, IP, user agent and details of entries.
+func protectAuditEvents() error {
+	if err := DB.Exec(`
+		CREATE OR REPLACE FUNCTION audit_events_append_only() RETURNS trigger AS $$
+		BEGIN
+			RAISE EXCEPTION 'audit_events is append-only';
+		END;
+		$$ LANGUAGE plpgsql`).Error; err != nil {
+		return err
+	}
+	if err := DB.Exec(`
+		CREATE OR REPLACE FUNCTION audit_events_anonymise_only() RETURNS trigger AS $$
+		BEGIN
+			IF current_setting('opalescence.audit_anonymise', true) IS DISTINCT FROM 'on'
+				OR (NEW.id, NEW.created_at, NEW.action, NEW.target_type, NEW.target_id)
+					IS DISTINCT FROM (OLD.id, OLD.created_at, OLD.action, OLD.target_type, OLD.target_id)
+				OR (NEW.actor_id IS NOT NULL AND NEW.actor_id IS DISTINCT FROM OLD.actor_id)
+				OR (NEW.ip <> '' AND NEW.ip <> OLD.ip)
+				OR (NEW.user_agent <> '' AND NEW.user_agent <> OLD.user_agent)
+				OR (NEW.details IS DISTINCT FROM '{}'::jsonb AND NEW.details IS DISTINCT FROM OLD.details) THEN
+				RAISE EXCEPTION 'audit_events is append-only';
+			END IF;
+			RETURN NEW;
+		END;
+		$$ LANGUAGE plpgsql`).Error; err != nil {
+		return err
+	}
+	for _, trigger := range []string{"audit_events_append_only", "audit_events_anonymise_only"} {
+		if err := DB.Exec("DROP TRIGGER IF EXISTS " + trigger + " ON audit_events").Error; err != nil {
+			return err
+		}
+	}
+	if err := DB.Exec(`
+		CREATE TRIGGER audit_events_append_only BEFORE DELETE OR TRUNCATE ON audit_events
+		FOR EACH STATEMENT EXECUTE FUNCTION audit_events_append_only()`).Error; err != nil {
+		return err
+	}
+	return DB.Exec(`
+		CREATE TRIGGER audit_events_anonymise_only BEFORE UPDATE ON audit_events
+		FOR EACH ROW EXECUTE FUNCTION audit_events_anonymise_only()`).Error
+}
@@ -0,0 +1,43 @@
+package database
+
+import "gorm.io/gorm"
+
+// backfillPageViews moves the daily view counts embedded in pages.date_view_count to the page_views table.
+// The counts are stored at midnight UTC of their day without a visitor, and date_view_count is cleared
+// in the same transaction, so each page is backfilled once.
+func backfillPageViews() error {
+	const backfilled = "date_view_count IS NOT NULL AND jsonb_typeof(date_view_count) = 'object' AND date_view_count <> '{}'::jsonb"
+
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec(`
+			INSERT INTO page_views (page_id, hour, views)
+			SELECT pages.id, (counts.key || ' 00:00:00+00')::timestamptz, counts.value::bigint
+			FROM pages, jsonb_each_text(pages.date_view_count) counts
+			WHERE ` + backfilled + `
+				AND counts.key ~ '^\d{4}-\d{2}-\d{2}$'
+				AND counts.value ~ '^\d+$' AND counts.value::bigint > 0`).Error; err != nil {
+			return err
+		}
+		return tx.Exec("UPDATE pages SET date_view_count = NULL WHERE " + backfilled).Error
+	})
+}
+
+// backfillPageSnapshots publishes the current elements of the public pages that were never published,
+// e.g. made public before drafts existed, so their visitors don't find them empty.
+// The elements are stored as api.ElementsResponseObject, in the order of the page's element positions.
+func backfillPageSnapshots() error {
+	return DB.Exec(`
+		INSERT INTO page_snapshots (created_at, updated_at, page_id, user_id, elements, published_at)
+		SELECT NOW(), NOW(), pages.id, pages.user_id, COALESCE((
+			SELECT jsonb_agg(jsonb_build_object(
+				'id', elements.id, 'element_uuid', elements.element_uuid, 'type', elements.type,
+				'content', elements.content, 'etc', elements.etc, 'size', COALESCE(elements.size, '')
+			) ORDER BY COALESCE(array_position(ARRAY(
+				SELECT jsonb_array_elements_text(CASE WHEN jsonb_typeof(pages.element_positions) = 'array' THEN pages.element_positions ELSE '[]'::jsonb END)
+			), elements.element_uuid), 0), elements.id)
+			FROM elements WHERE elements.page_id = pages.id AND elements.deleted_at IS NULL
+		), '[]'::jsonb), NOW()
+		FROM pages
+		WHERE pages.public_page AND pages.deleted_at IS NULL
+			AND NOT EXISTS (SELECT 1 FROM page_snapshots WHERE page_snapshots.page_id = pages.id)`).Error
+}
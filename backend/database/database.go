@@ -24,13 +24,44 @@ func Connect(dsn string) error {
 }
 
 // Migrate the database
-// AutoMigrate the Element, User, and Page models.
+// AutoMigrate the application models, make the audit log append-only, then backfill data moved to new tables
+// and the published versions of public pages.
 // Returns error if migration fails, nil otherwise.
 func Migrate() error {
 	var err error
-	err = DB.AutoMigrate(&models.Element{}, &models.User{}, &models.Page{})
+	err = DB.AutoMigrate(
+		&models.Element{},
+		&models.User{},
+		&models.Page{},
+		&models.PageShare{},
+		&models.BillingEvent{},
+		&models.BillingSubscription{},
+		&models.AuditEvent{},
+		&models.AccountDeletion{},
+		&models.PageViewBatch{},
+		&models.PageView{},
+		&models.Tag{},
+		&models.PageTag{},
+		&models.PageLink{},
+		&models.Comment{},
+		&models.Notification{},
+		&models.NotificationMute{},
+		&models.EmailPreference{},
+		&models.PageFollow{},
+		&models.Webhook{},
+		&models.WebhookDelivery{},
+		&models.PublishSchedule{},
+		&models.PageSnapshot{},
+		&models.CustomDomain{},
+	)
 	if err != nil {
 		return err
 	}
-	return nil
+	if err := protectAuditEvents(); err != nil {
+		return err
+	}
+	if err := backfillPageViews(); err != nil {
+		return err
+	}
+	return backfillPageSnapshots()
 }
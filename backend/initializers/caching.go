@@ -1,26 +1,62 @@
 package initializers
 
 import (
+	"context"
 	"log"
 	"os"
 	"strconv"
+	"time"
 
 	"github.com/opalescencelabs/backend/api/caching"
 )
 
-// InitializeRedis initializes the Redis client.
-func InitializeRedis() {
+// InitializeCache sets up the cache used by the handlers, selected by CACHE_DRIVER:
+//   - "redis" (default): Redis at REDIS_ADDR, degrading to an in-memory cache while it is unreachable
+//   - "memory": in-memory LRU cache holding at most CACHE_MEMORY_SIZE entries
+//   - "none": no caching
+//
+// Page views are counted and requests rate limited in Redis with the "redis" driver, and in memory otherwise.
+// The app still runs without a cache, so misconfiguration is logged rather than fatal.
+func InitializeCache() {
+	memorySize, err := strconv.Atoi(os.Getenv("CACHE_MEMORY_SIZE"))
+	if err != nil || memorySize < 1 {
+		memorySize = 1000
+	}
+
+	switch driver := os.Getenv("CACHE_DRIVER"); driver {
+	case "none":
+		caching.Default = caching.NewNoop()
+		log.Println("Caching disabled")
+	case "memory":
+		caching.Default = caching.NewMemory(memorySize)
+		log.Println("Using in-memory cache")
+	default:
+		if driver != "" && driver != "redis" {
+			log.Printf("Unknown CACHE_DRIVER %q, using redis", driver)
+		}
+		initializeRedis(memorySize)
+	}
+}
+
+// initializeRedis initializes the Redis cache with an in-memory fallback.
+func initializeRedis(memorySize int) {
 	log.Println("Connecting to Redis cache...")
 	rdAddr := os.Getenv("REDIS_ADDR")
 	rdPassword := os.Getenv("REDIS_PASSWORD")
 	rdDB, err := strconv.Atoi(os.Getenv("REDIS_DB"))
 	if err != nil {
-		log.Fatalf("Error parsing REDIS_DB to int: %v, using default database 0", err)
+		log.Printf("Error parsing REDIS_DB to int: %v, using default database 0", err)
 		rdDB = 0
 	}
-	if err := caching.InitializeClient(rdAddr, rdPassword, rdDB); err != nil {
-		log.Fatalf("Error connecting to Redis: %v", err)
-		// Not panic because the app can still run without cache
+
+	redisCache := caching.NewRedis(rdAddr, rdPassword, rdDB)
+	cache := caching.NewFallback(context.Background(), redisCache, caching.NewMemory(memorySize), 30*time.Second)
+	caching.Default = cache
+	caching.DefaultCounter = caching.NewRedisCounter(redisCache.Client, "page-views")
+	caching.DefaultLimiter = caching.NewRedisLimiter(redisCache.Client)
+	if cache.Degraded() {
+		// Not fatal because the app can still run with the in-memory cache
+		log.Println("Redis Cache unreachable, using in-memory cache until it recovers")
 	} else {
 		log.Println("Redis Cache connected successfully")
 	}
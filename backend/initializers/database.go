@@ -5,6 +5,8 @@ import (
 
 	"fmt"
 	"os"
+	"github.com/opalescencelabs/backend/controllers/links"
+	"github.com/opalescencelabs/backend/controllers/search"
 	"github.com/opalescencelabs/backend/database"
 )
 
@@ -30,4 +32,13 @@ func ConnectToDB() {
 		panic("Table migration failed")
 	}
 	log.Println("Tables migrated successfully")
+
+	// Pages created before search existed
+	if err := search.IndexMissing(database.DB); err != nil {
+		panic("Search indexing failed")
+	}
+	// Links of pages created before backlinks existed
+	if err := links.IndexMissing(database.DB); err != nil {
+		panic("Link indexing failed")
+	}
 }
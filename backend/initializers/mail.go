@@ -0,0 +1,25 @@
+package initializers
+
+import (
+	"log"
+	"os"
+
+	"github.com/opalescencelabs/backend/controllers/mail"
+)
+
+// InitializeMailer sets up the mailer of notification emails and digests.
+// Emails are sent from MAIL_FROM through the SMTP server at SMTP_ADDR, e.g. "localhost:1025" for a local sink like Mailpit,
+// authenticated with SMTP_USERNAME and SMTP_PASSWORD if set. Without SMTP_ADDR emails are only logged.
+func InitializeMailer() {
+	addr := os.Getenv("SMTP_ADDR")
+	if addr == "" {
+		log.Println("SMTP_ADDR not set, emails are logged instead of sent")
+		return
+	}
+	from := os.Getenv("MAIL_FROM")
+	if from == "" {
+		from = "Opalescence <no-reply@localhost>"
+	}
+	mail.Default = mail.NewSMTP(addr, os.Getenv("SMTP_USERNAME"), os.Getenv("SMTP_PASSWORD"), from)
+	log.Printf("Sending emails through %s", addr)
+}
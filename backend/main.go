@@ -1,43 +1,209 @@
 package main
 
 import (
-	"github.com/gin-contrib/cors"
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
 	"github.com/gin-gonic/gin"
+	"github.com/opalescencelabs/backend/api/caching"
 	"github.com/opalescencelabs/backend/controllers"
+	"github.com/opalescencelabs/backend/controllers/account"
+	"github.com/opalescencelabs/backend/controllers/admin"
 	"github.com/opalescencelabs/backend/controllers/auth"
+	"github.com/opalescencelabs/backend/controllers/domains"
+	"github.com/opalescencelabs/backend/controllers/mail"
+	"github.com/opalescencelabs/backend/controllers/notifications"
+	"github.com/opalescencelabs/backend/controllers/publishing"
+	"github.com/opalescencelabs/backend/controllers/ratelimit"
+	"github.com/opalescencelabs/backend/controllers/views"
+	"github.com/opalescencelabs/backend/controllers/webhooks"
+	"github.com/opalescencelabs/backend/database"
 	"github.com/opalescencelabs/backend/initializers"
 )
 
-// Initialize environment variables, connections to database and Redis
+// Initialize environment variables, connections to database and cache
 func init() {
 	initializers.LoadEnvVariables()
 	initializers.ConnectToDB()
-	initializers.InitializeRedis()
+	initializers.InitializeCache()
+	initializers.InitializeMailer()
 }
 
 // Start application
 func main() {
+	// Background workers run until the server has shut down
+	workers, stopWorkers := context.WithCancel(context.Background())
+
+	// Delete accounts whose deletion grace period has elapsed
+	go account.RunDeletionWorker(workers, database.DB, time.Hour)
+
+	// Flush buffered page views, the worker flushes once more when stopped
+	viewsFlushed := make(chan struct{})
+	go func() {
+		views.RunFlushWorker(workers, database.DB, caching.DefaultCounter, 10*time.Second)
+		close(viewsFlushed)
+	}()
+
+	// Email notifications left unread and digests of followed pages
+	go notifications.RunEmailWorker(workers, database.DB, mail.Default, time.Minute)
+
+	// Deliver page events to webhooks, retrying failed deliveries
+	go webhooks.RunDispatcher(workers, database.DB, webhooks.NewClient(webhooks.GetAllowPrivateNetworks()), 10*time.Second)
+
+	// Make pages public or private when scheduled
+	go publishing.RunScheduler(workers, database.DB, 30*time.Second)
+
+	// Route and allow the custom domains verified through any instance of the app
+	if err := domains.Refresh(database.DB); err != nil {
+		log.Println("Failed to load custom domains: ", err)
+	}
+	go domains.RunRefresher(workers, database.DB, time.Minute)
+
 	r := gin.Default()
 
+	// Only trust X-Forwarded-For from the configured proxies, the client IP is rate limited and audited
+	if err := r.SetTrustedProxies(ratelimit.GetTrustedProxies()); err != nil {
+		panic("Invalid TRUSTED_PROXIES: " + err.Error())
+	}
+
 	// Use CORS middleware
-	config := cors.DefaultConfig()
-	config.AllowOrigins = []string{auth.GetFrontendURL(), auth.GetDomain()}
-	config.AllowCredentials = true
-	config.AllowHeaders = append(config.AllowHeaders, "Authorization")
-	r.Use(cors.New(config))
-
-	r.POST("/user-login", controllers.UserLogin)
-	r.POST("/user-logout", controllers.UserLogout)
-	r.GET("/user-get", controllers.UserGet)
-
-	r.POST("/page-create", controllers.PageCreate)
-	r.POST("/page-update", controllers.PageUpdate)
-	r.GET("/page-get/:page_uuid", controllers.PageGet)
-	r.GET("/page-list", controllers.PageList)
-	r.POST("/page-delete", controllers.PageDelete)
-
-	if err := r.Run(); err != nil {
-		panic("Router failed to start Gin: " + err.Error())
+	// The frontend and the app with credentials, the verified custom domains on the public page routes without
+	r.Use(controllers.CORS(auth.GetFrontendURL(), auth.GetDomain()))
+
+	// Requests for custom domains are served their page tree instead of the routes below
+	r.Use(controllers.CustomDomainRouter())
+
+	// Public routes
+	public := r.Group("/")
+	{
+		public.POST("/user-login", controllers.UserLogin)
+		// Signed by the payment provider, see controllers/billing
+		public.POST("/billing-webhook", controllers.BillingWebhook)
+		// The user is resolved if the request is authenticated, so owners get the full page
+		public.GET("/page-get/:page_uuid", auth.OptionalAuthenticateMiddleware(), admin.ImpersonationMiddleware(), controllers.PageGet)
+		// Signed with SECRET, see controllers/mail
+		public.GET("/email-unsubscribe", controllers.EmailUnsubscribe)
+		public.POST("/email-unsubscribe", controllers.EmailUnsubscribe)
+		public.GET("/page-search-public", ratelimit.Middleware("page-search-public", controllers.PublicSearchRateLimit, controllers.PublicSearchRateWindow), controllers.PublicPageSearch)
+	}
+
+	// Authenticated routes, requests without a valid session are rejected
+	// Admins may impersonate users read-only, see admin.ImpersonateHeader
+	authenticated := r.Group("/", auth.AuthenticateMiddleware(), admin.ImpersonationMiddleware())
+	{
+		authenticated.POST("/user-logout", controllers.UserLogout)
+		authenticated.GET("/user-get", controllers.UserGet)
+		authenticated.GET("/user-export", controllers.UserExport)
+		authenticated.POST("/user-delete", controllers.UserDelete)
+		authenticated.POST("/user-delete-cancel", controllers.UserDeleteCancel)
+		authenticated.GET("/plan-usage", controllers.PlanUsage)
+		authenticated.GET("/page-analytics/:page_uuid", controllers.PageAnalytics)
+		authenticated.GET("/page-analytics-export", controllers.PageAnalyticsExport)
+		authenticated.GET("/analytics-dashboard", controllers.AnalyticsDashboard)
+
+		authenticated.POST("/page-create", controllers.PageCreate)
+		authenticated.POST("/page-update", controllers.PageUpdate)
+		authenticated.GET("/page-list", controllers.PageList)
+		authenticated.POST("/page-delete", controllers.PageDelete)
+		authenticated.GET("/page-search", controllers.PageSearch)
+		authenticated.GET("/page-backlinks/:page_uuid", controllers.PageBacklinks)
+
+		authenticated.POST("/tag-create", controllers.TagCreate)
+		authenticated.POST("/tag-update", controllers.TagUpdate)
+		authenticated.POST("/tag-delete", controllers.TagDelete)
+		authenticated.GET("/tag-list", controllers.TagList)
+		authenticated.POST("/page-tag", controllers.PageTag)
+		authenticated.POST("/page-untag", controllers.PageUntag)
+
+		authenticated.POST("/comment-create", controllers.CommentCreate)
+		authenticated.POST("/comment-update", controllers.CommentUpdate)
+		authenticated.POST("/comment-resolve", controllers.CommentResolve)
+		authenticated.POST("/comment-delete", controllers.CommentDelete)
+		authenticated.GET("/comment-list/:page_uuid", controllers.CommentList)
+
+		authenticated.GET("/notification-list", controllers.NotificationList)
+		authenticated.POST("/notification-read", controllers.NotificationRead)
+		authenticated.POST("/notification-read-all", controllers.NotificationReadAll)
+		authenticated.GET("/notification-preferences", controllers.NotificationPreferences)
+		authenticated.POST("/notification-preferences-update", controllers.NotificationPreferencesUpdate)
+
+		authenticated.GET("/email-preferences", controllers.EmailPreferences)
+		authenticated.POST("/email-preferences-update", controllers.EmailPreferencesUpdate)
+		authenticated.POST("/page-follow", controllers.PageFollow)
+		authenticated.POST("/page-unfollow", controllers.PageUnfollow)
+
+		authenticated.POST("/webhook-create", controllers.WebhookCreate)
+		authenticated.POST("/webhook-update", controllers.WebhookUpdate)
+		authenticated.POST("/webhook-delete", controllers.WebhookDelete)
+		authenticated.GET("/webhook-list", controllers.WebhookList)
+		authenticated.GET("/webhook-deliveries/:webhook_id", controllers.WebhookDeliveries)
+		authenticated.POST("/webhook-redeliver", controllers.WebhookRedeliver)
+
+		authenticated.POST("/page-publish", controllers.PagePublish)
+		authenticated.POST("/page-discard-draft", controllers.PageDiscardDraft)
+		authenticated.GET("/page-draft-diff/:page_uuid", controllers.PageDraftDiff)
+
+		authenticated.POST("/page-schedule", controllers.PageSchedule)
+		authenticated.POST("/page-schedule-cancel", controllers.PageScheduleCancel)
+		authenticated.GET("/page-schedule-list/:page_uuid", controllers.PageScheduleList)
+
+		authenticated.POST("/domain-create", controllers.DomainCreate)
+		authenticated.POST("/domain-verify", controllers.DomainVerify)
+		authenticated.POST("/domain-delete", controllers.DomainDelete)
+		authenticated.GET("/domain-list", controllers.DomainList)
+
+		authenticated.GET("/page-activity/:page_uuid", controllers.PageActivity)
+		authenticated.GET("/audit-log", controllers.AuditLog)
+		authenticated.GET("/audit-log-export", controllers.AuditLogExport)
+
+		authenticated.POST("/page-share", controllers.PageShare)
+		authenticated.POST("/page-unshare", controllers.PageUnshare)
+		authenticated.GET("/page-share-list/:page_uuid", controllers.PageShareList)
+	}
+
+	// Admin routes, restricted to users with the admin role
+	adminRoutes := r.Group("/admin", auth.AuthenticateMiddleware(), auth.AdminMiddleware())
+	{
+		adminRoutes.GET("/user-search", controllers.AdminUserSearch)
+		adminRoutes.GET("/user-pages/:user_id", controllers.AdminUserPages)
+		adminRoutes.POST("/user-status", controllers.AdminUserStatus)
+		adminRoutes.POST("/user-disable", controllers.AdminUserDisable)
+		adminRoutes.POST("/page-unpublish", controllers.AdminPageUnpublish)
+		adminRoutes.POST("/page-transfer", controllers.AdminPageTransfer)
+	}
+
+	// Listen on PORT like gin's Run
+	addr := ":8080"
+	if port := os.Getenv("PORT"); port != "" {
+		addr = ":" + port
+	}
+	server := &http.Server{Addr: addr, Handler: r}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	go func() {
+		log.Printf("Listening and serving HTTP on %s", addr)
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			panic("Router failed to start Gin: " + err.Error())
+		}
+	}()
+
+	// Shut down gracefully, in-flight requests finish before the workers stop
+	<-ctx.Done()
+	log.Println("Shutting down...")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Println("Server forced to shut down: ", err)
 	}
 
+	stopWorkers()
+	<-viewsFlushed
 }
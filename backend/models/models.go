@@ -19,6 +19,8 @@ type Element struct {
 	Content     pgtype.JSONB `gorm:"type:jsonb;default: '{}'" json:"content"`
 	Etc         pgtype.JSONB `gorm:"type:jsonb;default: '{}'" json:"etc"`
 	Size        string       `gorm:"default:null;check:Size IN (null, 'small', 'medium', 'large')" json:"size"`
+	// Maintained with SQL by the search package, never read or written by gorm
+	SearchVector string `gorm:"type:tsvector;index:idx_element_search,type:gin;->:false;<-:false" json:"-"`
 }
 
 type Page struct {
@@ -37,7 +39,15 @@ type Page struct {
 	LastUpdatedAt    time.Time    `gorm:"default:null" json:"last_updated_at"`
 	Etc              pgtype.JSONB `gorm:"type:jsonb;default: '{}'" json:"etc"`
 	ViewCount        uint         `gorm:"not null;default:0" json:"view_count"`
-	DateViewCount    pgtype.JSONB `gorm:"type:jsonb;default: '{}'" json:"date_view_count"`
+	// Views not counted in ViewCount, e.g. by bots or the owner, see views.Excluded
+	ExcludedViewCount uint         `gorm:"not null;default:0" json:"excluded_view_count"`
+	DateViewCount     pgtype.JSONB `gorm:"type:jsonb;default: '{}'" json:"date_view_count"`
+	// When the view counts were last reset, views buffered before are dropped, see views.Flush
+	ViewsResetAt time.Time `gorm:"default:null" json:"views_reset_at"`
+	// Readable identifier of the page, e.g. to search the public pages under it
+	Slug *string `gorm:"type:text;index:idx_page_slug,unique,where:deleted_at IS NULL" json:"slug"`
+	// Maintained with SQL by the search package, never read or written by gorm
+	SearchVector string `gorm:"type:tsvector;index:idx_page_search,type:gin;->:false;<-:false" json:"-"`
 }
 
 type User struct {
@@ -49,4 +59,241 @@ type User struct {
 	Picture     string `gorm:"not null"`
 	Credentials []byte `gorm:"type:jsonb;default: '{}'"`
 	Status      string `gorm:"not null;default:'freemium';check:Status IN ('freemium', 'premium', 'enterprise')" json:"status"`
+	// Customer ID at the payment provider, set when the user first subscribes
+	BillingCustomerID *string `gorm:"unique;default:null" json:"billing_customer_id"`
+	Role              string  `gorm:"not null;default:'user';check:Role IN ('user', 'admin')" json:"role"`
+	Disabled          bool    `gorm:"not null;default:false" json:"disabled"`
+}
+
+type PageShare struct {
+	gorm.Model
+	ID     uint `gorm:"primaryKey;autoIncrement:true" json:"id"`
+	PageID uint `gorm:"not null;uniqueIndex:idx_page_share" json:"page_id"`
+	Page   Page `gorm:"foreignKey:ID"`
+	UserID uint `gorm:"not null;uniqueIndex:idx_page_share" json:"user_id"`
+	User   User `gorm:"foreignKey:ID"`
+}
+
+type BillingEvent struct {
+	gorm.Model
+	ID             uint         `gorm:"primaryKey;autoIncrement:true" json:"id"`
+	EventID        string       `gorm:"unique;not null" json:"event_id"` // ID assigned by the payment provider, used for idempotency
+	Type           string       `gorm:"not null" json:"type"`
+	UserID         *uint        `gorm:"default:null;index" json:"user_id"`
+	CustomerID     string       `gorm:"not null;default:''" json:"customer_id"`
+	SubscriptionID string       `gorm:"not null;default:''" json:"subscription_id"`
+	PreviousStatus string       `gorm:"not null;default:''" json:"previous_status"`
+	NewStatus      string       `gorm:"not null;default:''" json:"new_status"`
+	Payload        pgtype.JSONB `gorm:"type:jsonb;default: '{}'" json:"payload"`
+}
+
+// BillingSubscription holds the creation time of the last event applied for a subscription,
+// so that events delivered out of order don't undo newer ones.
+type BillingSubscription struct {
+	ID             uint      `gorm:"primaryKey;autoIncrement:true" json:"id"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+	SubscriptionID string    `gorm:"not null;uniqueIndex" json:"subscription_id"`
+	LastEventAt    time.Time `gorm:"not null" json:"last_event_at"`
+}
+
+// AuditEvent is an entry of the append-only audit log, hence it has no UpdatedAt or DeletedAt.
+type AuditEvent struct {
+	ID         uint         `gorm:"primaryKey;autoIncrement:true" json:"id"`
+	CreatedAt  time.Time    `gorm:"not null;index" json:"created_at"`
+	ActorID    *uint        `gorm:"default:null;index" json:"actor_id"` // null for system actions
+	Action     string       `gorm:"not null;index" json:"action"`
+	TargetType string       `gorm:"not null;default:''" json:"target_type"`
+	TargetID   string       `gorm:"not null;default:'';index" json:"target_id"`
+	Details    pgtype.JSONB `gorm:"type:jsonb;default: '{}'" json:"details"`
+	IP         string       `gorm:"not null;default:''" json:"ip"`
+	UserAgent  string       `gorm:"not null;default:''" json:"user_agent"`
+}
+
+type AccountDeletion struct {
+	gorm.Model
+	ID           uint      `gorm:"primaryKey;autoIncrement:true" json:"id"`
+	UserID       uint      `gorm:"not null;index" json:"user_id"`
+	Status       string    `gorm:"not null;default:'pending';check:Status IN ('pending', 'cancelled', 'completed')" json:"status"`
+	ScheduledFor time.Time `gorm:"not null;index" json:"scheduled_for"`
+	CompletedAt  time.Time `gorm:"default:null" json:"completed_at"`
+}
+
+// PageViewBatch records a batch of view counts flushed to the pages, so a batch flushed again isn't counted twice.
+type PageViewBatch struct {
+	ID        uint      `gorm:"primaryKey;autoIncrement:true" json:"id"`
+	CreatedAt time.Time `gorm:"not null;index" json:"created_at"`
+	BatchID   string    `gorm:"unique;not null" json:"batch_id"`
+}
+
+// PageView holds the views of a page by one visitor within an hour, flushed in batches by the views package.
+// Views are aggregated by hour, so the table grows with visitors rather than with every view.
+type PageView struct {
+	ID        uint      `gorm:"primaryKey;autoIncrement:true" json:"id"`
+	PageID    uint      `gorm:"not null;index:idx_page_view_page_hour" json:"page_id"`
+	Hour      time.Time `gorm:"not null;index:idx_page_view_page_hour" json:"hour"` // start of the hour the views were recorded in
+	VisitorID string    `gorm:"not null;default:''" json:"visitor_id"`              // anonymised, empty for views backfilled from daily totals
+	Referrer  string    `gorm:"not null;default:''" json:"referrer"`                // host of the referring site, empty for direct visits
+	Device    string    `gorm:"not null;default:''" json:"device"`                  // class of the user agent, see views.Device
+	Country   string    `gorm:"not null;default:''" json:"country"`                 // ISO 3166 code set by the CDN, empty if unknown
+	Excluded  string    `gorm:"not null;default:''" json:"excluded"`                // why the views aren't counted, empty if they are
+	Views     int64     `gorm:"not null;default:0" json:"views"`
+}
+
+// Tag is a label the user defines to categorise their pages.
+type Tag struct {
+	gorm.Model
+	ID     uint   `gorm:"primaryKey;autoIncrement:true" json:"id"`
+	UserID uint   `gorm:"not null;uniqueIndex:idx_tag_user_name" json:"user_id"`
+	User   User   `gorm:"foreignKey:ID"`
+	Name   string `gorm:"not null;uniqueIndex:idx_tag_user_name" json:"name"`
+	Color  string `gorm:"not null;default:''" json:"color"` // hex colour, e.g. #4caf50
+}
+
+// PageTag tags a page with one of its owner's tags.
+type PageTag struct {
+	ID        uint      `gorm:"primaryKey;autoIncrement:true" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	PageID    uint      `gorm:"not null;uniqueIndex:idx_page_tag" json:"page_id"`
+	TagID     uint      `gorm:"not null;uniqueIndex:idx_page_tag;index" json:"tag_id"`
+}
+
+// PageLink is a reference from an element of a page to another page, maintained by the links package.
+type PageLink struct {
+	ID             uint   `gorm:"primaryKey;autoIncrement:true" json:"id"`
+	SourcePageID   uint   `gorm:"not null;index" json:"source_page_id"`
+	ElementUUID    string `gorm:"not null" json:"element_uuid"`
+	TargetPageUUID string `gorm:"not null;index" json:"target_page_uuid"`
+	Kind           string `gorm:"not null" json:"kind"` // see links.Kind
+}
+
+// Comment is a comment on a page or on one of its elements, see the comments package.
+// Replies belong to the thread of a top-level comment, which is resolved as a whole.
+type Comment struct {
+	gorm.Model
+	ID           uint       `gorm:"primaryKey;autoIncrement:true" json:"id"`
+	PageID       uint       `gorm:"not null;index" json:"page_id"`
+	ElementUUID  string     `gorm:"not null;default:''" json:"element_uuid"` // empty for comments on the page itself
+	UserID       uint       `gorm:"not null;index" json:"user_id"`
+	ParentID     *uint      `gorm:"index" json:"parent_id"` // top-level comment of the thread, nil for top-level comments
+	Body         string     `gorm:"not null" json:"body"`
+	EditedAt     *time.Time `json:"edited_at"`
+	ResolvedAt   *time.Time `json:"resolved_at"` // only set on top-level comments
+	ResolvedByID *uint      `json:"resolved_by_id"`
+}
+
+// Notification is an entry of a user's inbox, e.g. a mention of the user, see the notifications package.
+type Notification struct {
+	ID          uint       `gorm:"primaryKey;autoIncrement:true" json:"id"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UserID      uint       `gorm:"not null;index:idx_notification_user" json:"user_id"`
+	ActorID     uint       `gorm:"not null" json:"actor_id"`
+	Category    string     `gorm:"not null" json:"category"` // see notifications.Category
+	PageID      uint       `gorm:"not null;index" json:"page_id"`
+	ElementUUID string     `gorm:"not null;default:''" json:"element_uuid"`
+	CommentID   *uint      `gorm:"index" json:"comment_id"`
+	ReadAt      *time.Time `gorm:"index:idx_notification_user" json:"read_at"`
+	EmailedAt   *time.Time `json:"emailed_at"`
+}
+
+// NotificationMute mutes a category of notifications for a user.
+type NotificationMute struct {
+	ID        uint      `gorm:"primaryKey;autoIncrement:true" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UserID    uint      `gorm:"not null;uniqueIndex:idx_notification_mute" json:"user_id"`
+	Category  string    `gorm:"not null;uniqueIndex:idx_notification_mute" json:"category"`
+}
+
+// EmailPreference holds which emails a user gets, users without one get notification emails but no digest.
+type EmailPreference struct {
+	ID            uint       `gorm:"primaryKey;autoIncrement:true" json:"id"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+	UserID        uint       `gorm:"not null;uniqueIndex" json:"user_id"`
+	Notifications bool       `gorm:"not null" json:"notifications"`
+	Digest        bool       `gorm:"not null" json:"digest"`
+	DigestSentAt  *time.Time `json:"digest_sent_at"`
+}
+
+// PageFollow subscribes a user to changes of a page in their daily digest.
+type PageFollow struct {
+	ID        uint      `gorm:"primaryKey;autoIncrement:true" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UserID    uint      `gorm:"not null;uniqueIndex:idx_page_follow" json:"user_id"`
+	PageID    uint      `gorm:"not null;uniqueIndex:idx_page_follow;index" json:"page_id"`
+}
+
+// Webhook is a URL a user registered to receive events about their pages, see the webhooks package.
+type Webhook struct {
+	ID        uint         `gorm:"primaryKey;autoIncrement:true" json:"id"`
+	CreatedAt time.Time    `json:"created_at"`
+	UpdatedAt time.Time    `json:"updated_at"`
+	UserID    uint         `gorm:"not null;index" json:"user_id"`
+	URL       string       `gorm:"not null" json:"url"`
+	Secret    string       `gorm:"not null" json:"-"`                              // signs the payloads
+	Events    pgtype.JSONB `gorm:"type:jsonb;not null;default:'[]'" json:"events"` // events subscribed to, see webhooks.Event
+	Active    bool         `gorm:"not null" json:"active"`
+}
+
+// WebhookDelivery is the delivery of an event to a webhook, pending until it succeeds or runs out of attempts.
+type WebhookDelivery struct {
+	ID             uint         `gorm:"primaryKey;autoIncrement:true" json:"id"`
+	CreatedAt      time.Time    `gorm:"index" json:"created_at"`
+	UpdatedAt      time.Time    `json:"updated_at"`
+	WebhookID      uint         `gorm:"not null;index" json:"webhook_id"`
+	EventID        string       `gorm:"not null;index" json:"event_id"` // shared by redeliveries of the event
+	Event          string       `gorm:"not null" json:"event"`
+	Payload        pgtype.JSONB `gorm:"type:jsonb;not null" json:"payload"`
+	Status         string       `gorm:"not null;index:idx_webhook_delivery_due" json:"status"` // see webhooks.Status
+	Attempts       int          `gorm:"not null;default:0" json:"attempts"`
+	NextAttemptAt  *time.Time   `gorm:"index:idx_webhook_delivery_due" json:"next_attempt_at"`
+	ResponseStatus int          `gorm:"not null;default:0" json:"response_status"`
+	ResponseBody   string       `gorm:"not null;default:''" json:"response_body"` // truncated
+	Error          string       `gorm:"not null;default:''" json:"error"`
+	DeliveredAt    *time.Time   `json:"delivered_at"`
+}
+
+// PublishSchedule makes a page, and optionally its sub-pages, public or private at RunAt, see the publishing package.
+type PublishSchedule struct {
+	ID              uint       `gorm:"primaryKey;autoIncrement:true" json:"id"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+	UserID          uint       `gorm:"not null;index" json:"user_id"` // who scheduled the change
+	PageID          uint       `gorm:"not null;index" json:"page_id"`
+	Public          bool       `gorm:"not null" json:"public"` // visibility the pages are given
+	IncludeSubPages bool       `gorm:"not null;default:false" json:"include_sub_pages"`
+	RunAt           time.Time  `gorm:"not null;index:idx_publish_schedule_due" json:"run_at"`
+	Status          string     `gorm:"not null;index:idx_publish_schedule_due" json:"status"` // see publishing.Status
+	Attempts        int        `gorm:"not null;default:0" json:"attempts"`
+	NextAttemptAt   *time.Time `json:"next_attempt_at"` // set while a failed execution is retried
+	ExecutedAt      *time.Time `json:"executed_at"`
+	PagesChanged    int        `gorm:"not null;default:0" json:"pages_changed"`
+	Error           string     `gorm:"not null;default:''" json:"error"`
+}
+
+// PageSnapshot is the published version of the elements of a page, served to visitors of the page while it is public
+// and its owner edits the draft, see the drafts package.
+type PageSnapshot struct {
+	ID          uint         `gorm:"primaryKey;autoIncrement:true" json:"id"`
+	CreatedAt   time.Time    `json:"created_at"`
+	UpdatedAt   time.Time    `json:"updated_at"`
+	PageID      uint         `gorm:"not null;uniqueIndex" json:"page_id"`
+	UserID      uint         `gorm:"not null" json:"user_id"`                          // who published it
+	Elements    pgtype.JSONB `gorm:"type:jsonb;not null;default:'[]'" json:"elements"` // api.ElementsResponseObject in order
+	PublishedAt time.Time    `gorm:"not null" json:"published_at"`
+}
+
+// CustomDomain serves the public page tree of a root page at Hostname once its owner proved they control it,
+// see the domains package.
+type CustomDomain struct {
+	ID        uint      `gorm:"primaryKey;autoIncrement:true" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	UserID    uint      `gorm:"not null;index" json:"user_id"`
+	PageID    uint      `gorm:"not null;index" json:"page_id"` // root page
+	// Lowercase, without port. Several users may claim a hostname until one of them verifies it,
+	// it is unique among verified domains.
+	Hostname          string     `gorm:"not null;index:idx_custom_domain_hostname;uniqueIndex:idx_custom_domain_verified_hostname,where:verified_at IS NOT NULL" json:"hostname"`
+	VerificationToken string     `gorm:"not null" json:"-"` // expected in the TXT record
+	VerifiedAt        *time.Time `json:"verified_at"`       // nil until verified
 }
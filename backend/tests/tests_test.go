@@ -1,15 +1,36 @@
 package tests
 
 import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"os"
 	"strings"
 	"testing"
+	"time"
 
 	"log"
 
+	"github.com/jackc/pgtype"
 	"github.com/joho/godotenv"
+	"github.com/opalescencelabs/backend/api/caching"
+	"github.com/opalescencelabs/backend/controllers/account"
+	"github.com/opalescencelabs/backend/controllers/audit"
+	"github.com/opalescencelabs/backend/controllers/billing"
+	"github.com/opalescencelabs/backend/controllers/domains"
+	"github.com/opalescencelabs/backend/controllers/links"
+	"github.com/opalescencelabs/backend/controllers/notifications"
+	"github.com/opalescencelabs/backend/controllers/plans"
+	"github.com/opalescencelabs/backend/controllers/publishing"
+	"github.com/opalescencelabs/backend/controllers/search"
+	"github.com/opalescencelabs/backend/controllers/tags"
+	"github.com/opalescencelabs/backend/controllers/views"
+	"github.com/opalescencelabs/backend/controllers/webhooks"
 	"github.com/opalescencelabs/backend/models"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
@@ -36,19 +57,19 @@ func init() {
 		dbUser, dbPassword, dbName, dbHost, dbPort, dbSSLMode)
 	DB, err = gorm.Open(postgres.Open(dsn), &gorm.Config{DisableForeignKeyConstraintWhenMigrating: true})
 	if err != nil {
-		return
+		log.Fatal("Error connecting to DB", err.Error())
 	}
 
-	// Check if user with user_id 0 exists in the users table
-	var user models.User
-	result := DB.First(&user, "id = ?", 0)
-
-	if result.Error != nil && result.Error == gorm.ErrRecordNotFound {
-		// User with user_id 1 not found, create a new user
-		err := DB.Exec("INSERT INTO users (id, google_id, email, name, picture, credentials) VALUES (?, ?, ?, ?, ?, ?)", 0, "0000", "opalesencetest@gmail.com", "Opalescence Test", "https://lh3.googleusercontent.com/a-/AOh14Gh", "{}").Error
-		if err != nil {
-			return
-		}
+	// The test token authenticates as the user with id 0, which has to exist in the users table
+	// Create it, or restore it if it was deleted or disabled
+	err = DB.Exec(`INSERT INTO users (id, created_at, updated_at, google_id, email, name, picture, credentials) VALUES (?, NOW(), NOW(), ?, ?, ?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET deleted_at = NULL, disabled = false`,
+		0, "0000", "opalesencetest@gmail.com", "Opalescence Test", "https://lh3.googleusercontent.com/a-/AOh14Gh", "{}").Error
+	if err != nil {
+		log.Fatal("Error creating test user", err.Error())
+	}
+	if err := DB.Model(&models.AccountDeletion{}).Where("user_id = ? AND status = ?", 0, "pending").Update("status", "cancelled").Error; err != nil {
+		log.Fatal("Error cancelling deletion of test user", err.Error())
 	}
 }
 
@@ -533,3 +554,1818 @@ func TestUserGet(t *testing.T) {
 
 	assert.Equal(t, http.StatusOK, resp.StatusCode)
 }
+
+func TestUnauthenticated(t *testing.T) {
+	client := http.Client{}
+
+	req, err := http.NewRequest("GET", os.Getenv("DOMAIN")+"/page-list", nil)
+	if err != nil {
+		t.Error(err)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Error(err)
+	}
+
+	defer resp.Body.Close()
+
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+}
+
+func TestSharePageFail(t *testing.T) {
+
+	token := "Only_for_testing1200332"
+	client := http.Client{}
+
+	body := strings.NewReader(`{"page_uuid":"12234PageSharetest", "page_name":"PageSharetest", "is_root":true, "element_positions":[]}`)
+
+	req, err := http.NewRequest("POST", os.Getenv("DOMAIN")+"/page-create", body)
+	if err != nil {
+		t.Error(err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	cookie := http.Cookie{Name: "Authorization", Value: token, HttpOnly: true, Secure: false, Domain: "localhost", Path: "/"}
+	req.AddCookie(&cookie)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Error(err)
+	}
+
+	client = http.Client{}
+
+	body = strings.NewReader(`{"page_uuid":"12234PageSharetest", "email":"shouldnotexist@example.com"}`)
+
+	req, err = http.NewRequest("POST", os.Getenv("DOMAIN")+"/page-share", body)
+	if err != nil {
+		t.Error(err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	cookie = http.Cookie{Name: "Authorization", Value: token, HttpOnly: true, Secure: false, Domain: "localhost", Path: "/"}
+	req.AddCookie(&cookie)
+
+	resp, err = client.Do(req)
+	if err != nil {
+		t.Error(err)
+	}
+
+	defer resp.Body.Close()
+
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	client = http.Client{}
+
+	body = strings.NewReader(`{ "page_uuid":"12234PageSharetest"}`)
+
+	req, err = http.NewRequest("POST", os.Getenv("DOMAIN")+"/page-delete", body)
+	if err != nil {
+		t.Error(err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	cookie = http.Cookie{Name: "Authorization", Value: token, HttpOnly: true, Secure: false, Domain: "localhost", Path: "/"}
+	req.AddCookie(&cookie)
+
+	resp, err = client.Do(req)
+	if err != nil {
+		t.Error(err)
+	}
+
+	defer resp.Body.Close()
+}
+
+func TestPlanUsage(t *testing.T) {
+	token := "Only_for_testing1200332"
+	client := http.Client{}
+
+	req, err := http.NewRequest("GET", os.Getenv("DOMAIN")+"/plan-usage", nil)
+	if err != nil {
+		t.Error(err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	cookie := http.Cookie{Name: "Authorization", Value: token, HttpOnly: true, Secure: false, Domain: "localhost", Path: "/"}
+	req.AddCookie(&cookie)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Error(err)
+	}
+
+	defer resp.Body.Close()
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestPlanLimitExceeded(t *testing.T) {
+	resp, _ := doRequest(t, "POST", "/page-create", `{"page_uuid":"1234PlanLimitTest", "page_name":"PlanLimitTest", "is_root":true, "element_positions":[]}`, true)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	defer doRequest(t, "POST", "/page-delete", `{"page_uuid":"1234PlanLimitTest", "force":true}`, true)
+
+	// The test user is on the freemium plan, premium allows more elements per page
+	limit := plans.LimitsFor("freemium").ElementsPerPage
+	elements := make([]string, limit+1)
+	for i := range elements {
+		elements[i] = fmt.Sprintf(`{"element_uuid":"1234PlanLimitTest-%d", "type":"Paragraph", "content":{"text":""}, "etc":{}}`, i)
+	}
+	resp, body := doRequest(t, "POST", "/page-update", `{"page": {"page_uuid":"1234PlanLimitTest"}, "elements": [`+strings.Join(elements, ",")+`]}`, true)
+	assert.Equal(t, http.StatusPaymentRequired, resp.StatusCode)
+	assert.Equal(t, plans.LimitElementsPerPage, body["limit"])
+	assert.Equal(t, float64(limit), body["max"])
+	assert.Equal(t, float64(limit+1), body["current"])
+
+	resp, _ = doRequest(t, "POST", "/page-update", `{"page": {"page_uuid":"1234PlanLimitTest"}, "elements": [`+strings.Join(elements[:limit], ",")+`]}`, true)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestBillingWebhook(t *testing.T) {
+	simulator := billing.NewSimulator(os.Getenv("DOMAIN")+"/billing-webhook", os.Getenv("BILLING_WEBHOOK_SECRET"))
+
+	event := simulator.NewEvent(billing.EventSubscriptionUpdated, billing.Subscription{
+		ID:       "sub_test",
+		Customer: "cus_shouldnotexist",
+		Status:   "active",
+		Metadata: map[string]string{"plan": "premium"},
+	})
+
+	resp, err := simulator.Send(event)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// Redelivery of the same event is acknowledged
+	resp, err = simulator.Send(event)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestBillingWebhookFail(t *testing.T) {
+	simulator := billing.NewSimulator(os.Getenv("DOMAIN")+"/billing-webhook", "wrongSecret")
+
+	resp, err := simulator.Send(simulator.NewEvent(billing.EventSubscriptionCancelled, billing.Subscription{ID: "sub_test"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestUserDeleteCancel(t *testing.T) {
+	token := "Only_for_testing1200332"
+	client := http.Client{}
+
+	req, err := http.NewRequest("POST", os.Getenv("DOMAIN")+"/user-delete", nil)
+	if err != nil {
+		t.Error(err)
+	}
+
+	cookie := http.Cookie{Name: "Authorization", Value: token, HttpOnly: true, Secure: false, Domain: "localhost", Path: "/"}
+	req.AddCookie(&cookie)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Error(err)
+	}
+
+	defer resp.Body.Close()
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	client = http.Client{}
+
+	req, err = http.NewRequest("POST", os.Getenv("DOMAIN")+"/user-delete-cancel", nil)
+	if err != nil {
+		t.Error(err)
+	}
+
+	cookie = http.Cookie{Name: "Authorization", Value: token, HttpOnly: true, Secure: false, Domain: "localhost", Path: "/"}
+	req.AddCookie(&cookie)
+
+	resp, err = client.Do(req)
+	if err != nil {
+		t.Error(err)
+	}
+
+	defer resp.Body.Close()
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestUserExport(t *testing.T) {
+	token := "Only_for_testing1200332"
+	client := http.Client{}
+
+	req, err := http.NewRequest("GET", os.Getenv("DOMAIN")+"/user-export", nil)
+	if err != nil {
+		t.Error(err)
+	}
+
+	cookie := http.Cookie{Name: "Authorization", Value: token, HttpOnly: true, Secure: false, Domain: "localhost", Path: "/"}
+	req.AddCookie(&cookie)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Error(err)
+	}
+
+	defer resp.Body.Close()
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "application/zip", resp.Header.Get("Content-Type"))
+}
+
+func TestUserExportContainsPages(t *testing.T) {
+	const pageUUID = "6f1c1d2e-8a4b-4c1d-9e2f-0a1b2c3d4e21"
+	resp, _ := doRequest(t, "POST", "/page-create", `{"page_uuid":"`+pageUUID+`", "page_name":"ExportedPage", "is_root":true, "element_positions":[]}`, true)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	defer doRequest(t, "POST", "/page-delete", `{"page_uuid":"`+pageUUID+`", "force":true}`, true)
+	resp, _ = doRequest(t, "POST", "/page-update", `{
+		"page": {"page_uuid":"`+pageUUID+`"},
+		"elements": [{"element_uuid":"6f1c1d2e-8a4b-4c1d-9e2f-0a1b2c3d4e22", "type":"Paragraph", "content":{"text":"Exported text"}, "etc":{}}]
+	}`, true)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	req, err := http.NewRequest("GET", os.Getenv("DOMAIN")+"/user-export", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.AddCookie(&http.Cookie{Name: "Authorization", Value: "Only_for_testing1200332", HttpOnly: true, Secure: false, Domain: "localhost", Path: "/"})
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	archive, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files := make(map[string]*zip.File)
+	for _, file := range archive.File {
+		files[file.Name] = file
+	}
+	assert.Contains(t, files, "profile.json")
+	file, ok := files["pages/"+pageUUID+".json"]
+	if !assert.True(t, ok, "the page is missing from the export") {
+		return
+	}
+	reader, err := file.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	var exported struct {
+		Page struct {
+			PageName string `json:"page_name"`
+		} `json:"page"`
+		Elements []struct {
+			Content map[string]interface{} `json:"content"`
+		} `json:"elements"`
+	}
+	if err := json.NewDecoder(reader).Decode(&exported); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "ExportedPage", exported.Page.PageName)
+	if assert.Len(t, exported.Elements, 1) {
+		assert.Equal(t, "Exported text", exported.Elements[0].Content["text"])
+	}
+}
+
+func TestDeleteAccountRemovesContent(t *testing.T) {
+	const userID = uint(999996)
+	jsonb := func(s string) pgtype.JSONB { return pgtype.JSONB{Bytes: []byte(s), Status: pgtype.Present} }
+	create := func(value interface{}) {
+		t.Helper()
+		if err := DB.Omit("id").Create(value).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := DB.Exec(`INSERT INTO users (id, created_at, updated_at, google_id, email, name, picture, credentials) VALUES (?, NOW(), NOW(), ?, ?, ?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET deleted_at = NULL`,
+		userID, "delete-account-test", "delete-account-test@example.com", "Delete Account Test", "", "{}").Error; err != nil {
+		t.Fatal(err)
+	}
+	defer DB.Unscoped().Delete(&models.User{}, userID)
+
+	page := models.Page{UserID: userID, PageUUID: "1234DeleteAccountTest", PageName: "DeleteAccountTest",
+		ElementPositions: jsonb(`[]`), Etc: jsonb(`{}`), DateViewCount: jsonb(`{}`)}
+	create(&page)
+	create(&models.Element{ElementUUID: "1234DeleteAccountTestElement", UserID: userID, PageID: page.ID, Type: "Paragraph",
+		Content: jsonb(`{"text":"Personal"}`), Etc: jsonb(`{}`)})
+	create(&models.PageView{PageID: page.ID, Hour: time.Now().UTC().Truncate(time.Hour), Views: 1})
+	create(&models.PageShare{PageID: page.ID, UserID: 0})
+	create(&models.PageLink{SourcePageID: page.ID, ElementUUID: "1234DeleteAccountTestElement", TargetPageUUID: "1234DeleteAccountTest", Kind: links.KindLink})
+	comment := models.Comment{PageID: page.ID, UserID: userID, Body: "Personal"}
+	create(&comment)
+	create(&models.Notification{UserID: userID, ActorID: 0, Category: notifications.CategoryReply, PageID: page.ID, CommentID: &comment.ID})
+	create(&models.NotificationMute{UserID: userID, Category: notifications.CategoryReply})
+	create(&models.EmailPreference{UserID: userID, Notifications: true, Digest: true})
+	create(&models.PageFollow{UserID: userID, PageID: page.ID})
+	tag := models.Tag{UserID: userID, Name: "Personal"}
+	create(&tag)
+	create(&models.PageTag{PageID: page.ID, TagID: tag.ID})
+	webhook := models.Webhook{UserID: userID, URL: "https://hooks.example.com", Secret: "secret", Events: jsonb(`[]`), Active: true}
+	create(&webhook)
+	create(&models.WebhookDelivery{WebhookID: webhook.ID, EventID: "delete-account-test", Event: "page.updated", Payload: jsonb(`{}`), Status: webhooks.StatusSucceeded})
+	create(&models.PublishSchedule{UserID: userID, PageID: page.ID, Public: true, RunAt: time.Now().Add(time.Hour), Status: publishing.StatusPending})
+	create(&models.PageSnapshot{PageID: page.ID, UserID: userID, Elements: jsonb(`[]`), PublishedAt: time.Now()})
+	create(&models.CustomDomain{UserID: userID, PageID: page.ID, Hostname: "docs.delete-account-test.example.com", VerificationToken: "token"})
+	create(&models.AccountDeletion{UserID: userID, ScheduledFor: time.Now()})
+
+	var user models.User
+	if err := DB.First(&user, userID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := account.DeleteAccount(context.Background(), DB, user); err != nil {
+		t.Fatal(err)
+	}
+
+	remaining := []struct {
+		model interface{}
+		query string
+	}{
+		{&models.Page{}, "user_id = @user"},
+		{&models.Element{}, "user_id = @user"},
+		{&models.PageView{}, "page_id = @page"},
+		{&models.PageShare{}, "page_id = @page"},
+		{&models.PageLink{}, "source_page_id = @page"},
+		{&models.Comment{}, "user_id = @user OR page_id = @page"},
+		{&models.Notification{}, "user_id = @user OR page_id = @page"},
+		{&models.NotificationMute{}, "user_id = @user"},
+		{&models.EmailPreference{}, "user_id = @user"},
+		{&models.PageFollow{}, "user_id = @user OR page_id = @page"},
+		{&models.Tag{}, "user_id = @user"},
+		{&models.PageTag{}, "page_id = @page"},
+		{&models.Webhook{}, "user_id = @user"},
+		{&models.WebhookDelivery{}, "webhook_id = @webhook"},
+		{&models.PublishSchedule{}, "user_id = @user OR page_id = @page"},
+		{&models.PageSnapshot{}, "page_id = @page"},
+		{&models.CustomDomain{}, "user_id = @user"},
+	}
+	args := map[string]interface{}{"user": userID, "page": page.ID, "webhook": webhook.ID}
+	for _, r := range remaining {
+		var count int64
+		if err := DB.Unscoped().Model(r.model).Where(r.query, args).Count(&count).Error; err != nil {
+			t.Fatal(err)
+		}
+		assert.Zero(t, count, "%T rows left", r.model)
+	}
+
+	// The user row is kept anonymised, and the deletion completed
+	var deleted models.User
+	if err := DB.Unscoped().First(&deleted, userID).Error; err != nil {
+		t.Fatal(err)
+	}
+	assert.True(t, deleted.DeletedAt.Valid)
+	assert.Equal(t, "Deleted user", deleted.Name)
+	assert.NotContains(t, deleted.Email, "delete-account-test")
+	var deletion models.AccountDeletion
+	if err := DB.Where("user_id = ?", userID).Last(&deletion).Error; err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "completed", deletion.Status)
+	DB.Where("user_id = ?", userID).Delete(&models.AccountDeletion{})
+}
+
+func TestAdminForbidden(t *testing.T) {
+	token := "Only_for_testing1200332"
+	client := http.Client{}
+
+	req, err := http.NewRequest("GET", os.Getenv("DOMAIN")+"/admin/user-search?q=opalescence", nil)
+	if err != nil {
+		t.Error(err)
+	}
+
+	cookie := http.Cookie{Name: "Authorization", Value: token, HttpOnly: true, Secure: false, Domain: "localhost", Path: "/"}
+	req.AddCookie(&cookie)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Error(err)
+	}
+
+	defer resp.Body.Close()
+
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+}
+
+func TestPageAnalyticsFail(t *testing.T) {
+	token := "Only_for_testing1200332"
+	client := http.Client{}
+
+	req, err := http.NewRequest("GET", os.Getenv("DOMAIN")+"/page-analytics/shouldnotexist?granularity=day", nil)
+	if err != nil {
+		t.Error(err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	cookie := http.Cookie{Name: "Authorization", Value: token, HttpOnly: true, Secure: false, Domain: "localhost", Path: "/"}
+	req.AddCookie(&cookie)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Error(err)
+	}
+
+	defer resp.Body.Close()
+
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestPageAnalyticsExport(t *testing.T) {
+	token := "Only_for_testing1200332"
+	client := http.Client{}
+
+	req, err := http.NewRequest("GET", os.Getenv("DOMAIN")+"/page-analytics-export?format=csv&from=2024-01-01&to=2024-02-01", nil)
+	if err != nil {
+		t.Error(err)
+	}
+
+	cookie := http.Cookie{Name: "Authorization", Value: token, HttpOnly: true, Secure: false, Domain: "localhost", Path: "/"}
+	req.AddCookie(&cookie)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Error(err)
+	}
+
+	defer resp.Body.Close()
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Contains(t, resp.Header.Get("Content-Type"), "text/csv")
+	assert.Contains(t, resp.Header.Get("Content-Disposition"), `filename="analytics-2024-01-01-2024-02-01.csv"`)
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.True(t, strings.HasPrefix(string(body), "date,page_uuid,page_name,views,unique_visitors,excluded_views,referrers\n"))
+}
+
+func TestPageAnalyticsExportJSON(t *testing.T) {
+	resp, _ := doRequest(t, "POST", "/page-create", `{"page_uuid":"1234AnalyticsExportTest", "page_name":"AnalyticsExportTest", "is_root":true, "element_positions":[]}`, true)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	defer doRequest(t, "POST", "/page-delete", `{"page_uuid":"1234AnalyticsExportTest"}`, true)
+
+	var page models.Page
+	if err := DB.Where("page_uuid = ?", "1234AnalyticsExportTest").First(&page).Error; err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	counter := caching.NewMemoryCounter()
+	now := time.Now().UTC()
+	views.Record(ctx, counter, views.Visit{PageID: page.ID, Time: now, VisitorID: "export-a", Referrer: "news.example.com", Device: views.DeviceDesktop})
+	views.Record(ctx, counter, views.Visit{PageID: page.ID, Time: now, VisitorID: "export-b", Device: views.DeviceMobile})
+	views.Record(ctx, counter, views.Visit{PageID: page.ID, Time: now, VisitorID: "export-bot", Device: views.DeviceBot, Excluded: views.ExcludedBot})
+	if err := views.Flush(ctx, DB, counter); err != nil {
+		t.Fatal(err)
+	}
+
+	from, to := now.Format("2006-01-02"), now.AddDate(0, 0, 1).Format("2006-01-02")
+	req, err := http.NewRequest("GET", os.Getenv("DOMAIN")+"/page-analytics-export?format=json&page_uuid=1234AnalyticsExportTest&from="+from+"&to="+to, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.AddCookie(&http.Cookie{Name: "Authorization", Value: "Only_for_testing1200332", HttpOnly: true, Secure: false, Domain: "localhost", Path: "/"})
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	var rows []map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&rows); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	if assert.Len(t, rows, 1) {
+		assert.Equal(t, from, rows[0]["date"])
+		assert.Equal(t, "1234AnalyticsExportTest", rows[0]["page_uuid"])
+		assert.Equal(t, float64(2), rows[0]["views"])
+		assert.Equal(t, float64(2), rows[0]["unique_visitors"])
+		assert.Equal(t, float64(1), rows[0]["excluded_views"])
+		assert.Equal(t, []interface{}{map[string]interface{}{"referrer": "news.example.com", "views": float64(1)}}, rows[0]["referrers"])
+	}
+}
+
+func TestAnalyticsDashboard(t *testing.T) {
+	token := "Only_for_testing1200332"
+	client := http.Client{}
+
+	req, err := http.NewRequest("GET", os.Getenv("DOMAIN")+"/analytics-dashboard?period=30", nil)
+	if err != nil {
+		t.Error(err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	cookie := http.Cookie{Name: "Authorization", Value: token, HttpOnly: true, Secure: false, Domain: "localhost", Path: "/"}
+	req.AddCookie(&cookie)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Error(err)
+	}
+
+	defer resp.Body.Close()
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+// createAnalyticsPages creates pages of the user directly in the DB, with their page views, and returns them by UUID.
+// The pages and views are deleted when the test ends.
+func createAnalyticsPages(t *testing.T, userID uint, pages []models.Page, pageViews map[string][]models.PageView) map[string]models.Page {
+	t.Helper()
+	jsonb := func(s string) pgtype.JSONB { return pgtype.JSONB{Bytes: []byte(s), Status: pgtype.Present} }
+	created := make(map[string]models.Page)
+	for _, page := range pages {
+		page.UserID = userID
+		page.ElementPositions, page.Etc, page.DateViewCount = jsonb(`[]`), jsonb(`{}`), jsonb(`{}`)
+		if err := DB.Omit("id").Create(&page).Error; err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() {
+			DB.Where("page_id = ?", page.ID).Delete(&models.PageView{})
+			DB.Unscoped().Delete(&models.Page{}, page.ID)
+		})
+		for _, pageView := range pageViews[page.PageUUID] {
+			pageView.PageID = page.ID
+			if err := DB.Omit("id").Create(&pageView).Error; err != nil {
+				t.Fatal(err)
+			}
+		}
+		created[page.PageUUID] = page
+	}
+	return created
+}
+
+func TestAnalyticsQuery(t *testing.T) {
+	day := func(d int, hour int) time.Time { return time.Date(2024, 3, d, hour, 0, 0, 0, time.UTC) }
+	pages := createAnalyticsPages(t, 999995, []models.Page{{PageUUID: "1234AnalyticsQueryTest", PageName: "AnalyticsQueryTest", PublicPage: true}},
+		map[string][]models.PageView{"1234AnalyticsQueryTest": {
+			{Hour: day(4, 10), VisitorID: "a", Referrer: "news.example.com", Device: views.DeviceDesktop, Country: "FR", Views: 3},
+			{Hour: day(4, 15), VisitorID: "b", Device: views.DeviceMobile, Views: 1},
+			{Hour: day(5, 9), VisitorID: "a", Device: views.DeviceDesktop, Country: "FR", Views: 2},
+			{Hour: day(5, 9), VisitorID: "crawler", Device: views.DeviceBot, Excluded: views.ExcludedBot, Views: 4},
+			// Backfilled from daily totals, the visitor is unknown
+			{Hour: day(6, 0), Views: 5},
+			// Outside of the range
+			{Hour: day(8, 0), VisitorID: "c", Device: views.DeviceDesktop, Views: 7},
+		}})
+	pageIDs := []uint{pages["1234AnalyticsQueryTest"].ID}
+
+	analytics, err := views.Query(DB, pageIDs, day(4, 0), day(8, 0), views.GranularityDay)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, int64(11), analytics.Views)
+	assert.Equal(t, int64(2), analytics.UniqueVisitors)
+	assert.Equal(t, int64(4), analytics.ExcludedViews)
+	assert.Equal(t, []views.Point{
+		{Start: day(4, 0), Views: 4, UniqueVisitors: 2},
+		{Start: day(5, 0), Views: 2, UniqueVisitors: 1, ExcludedViews: 4},
+		{Start: day(6, 0), Views: 5},
+		{Start: day(7, 0)},
+	}, analytics.Series)
+	assert.Equal(t, []views.Breakdown{{Value: "news.example.com", Views: 3, UniqueVisitors: 1}}, analytics.TopReferrers)
+	assert.Equal(t, []views.Breakdown{{Value: views.DeviceDesktop, Views: 5, UniqueVisitors: 1}, {Value: views.DeviceMobile, Views: 1, UniqueVisitors: 1}}, analytics.Devices)
+	assert.Equal(t, []views.Breakdown{{Value: "FR", Views: 5, UniqueVisitors: 1}}, analytics.Countries)
+	assert.Equal(t, []views.Breakdown{{Value: views.ExcludedBot, Views: 4, UniqueVisitors: 1}}, analytics.Excluded)
+
+	// 2024-03-04 is a Monday, weeks start on Monday
+	analytics, err = views.Query(DB, pageIDs, day(4, 0), day(18, 0), views.GranularityWeek)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []views.Point{
+		{Start: day(4, 0), Views: 18, UniqueVisitors: 3, ExcludedViews: 4},
+		{Start: day(11, 0)},
+	}, analytics.Series)
+
+	analytics, err = views.Query(DB, pageIDs, day(4, 9), day(4, 12), views.GranularityHour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []views.Point{{Start: day(4, 9)}, {Start: day(4, 10), Views: 3, UniqueVisitors: 1}, {Start: day(4, 11)}}, analytics.Series)
+}
+
+func TestAnalyticsGetDashboard(t *testing.T) {
+	const userID = uint(999995)
+	now := time.Now().UTC()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	daysAgo := func(days int) time.Time { return today.AddDate(0, 0, -days) }
+	createAnalyticsPages(t, userID, []models.Page{
+		{PageUUID: "1234DashboardAlphaTest", PageName: "Alpha", PublicPage: true, ViewCount: 100},
+		{PageUUID: "1234DashboardAlphaChildTest", PageName: "Alpha child", PublicPage: true, ParentPageUUID: "1234DashboardAlphaTest"},
+		{PageUUID: "1234DashboardBetaTest", PageName: "Beta", PublicPage: true, ViewCount: 4},
+		{PageUUID: "1234DashboardPrivateTest", PageName: "Private", ViewCount: 50},
+	}, map[string][]models.PageView{
+		"1234DashboardAlphaTest": {
+			{Hour: daysAgo(0), VisitorID: "a", Views: 3},
+			{Hour: daysAgo(0), VisitorID: "owner", Excluded: views.ExcludedOwner, Views: 10},
+			{Hour: daysAgo(8), VisitorID: "a", Views: 2},
+		},
+		"1234DashboardAlphaChildTest": {{Hour: daysAgo(1), VisitorID: "b", Views: 1}},
+		"1234DashboardBetaTest":       {{Hour: daysAgo(20), VisitorID: "c", Views: 4}},
+		"1234DashboardPrivateTest":    {{Hour: daysAgo(0), VisitorID: "d", Views: 50}},
+	})
+	pageNames := func(pages []views.PageStats) []string {
+		var names []string
+		for _, page := range pages {
+			names = append(names, page.PageName)
+		}
+		return names
+	}
+
+	dashboard, err := views.GetDashboard(DB, userID, "", 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, int64(104), dashboard.TotalViews)
+	assert.Equal(t, int64(4), dashboard.PeriodViews)
+	assert.Equal(t, int64(4), dashboard.ThisWeek)
+	assert.Equal(t, int64(2), dashboard.LastWeek)
+	assert.Equal(t, []string{"Alpha", "Alpha child", "Beta"}, pageNames(dashboard.Pages))
+	assert.Equal(t, []string{"Alpha", "Alpha child"}, pageNames(dashboard.Trending))
+	assert.Equal(t, []string{"Beta", "Alpha child", "Alpha"}, pageNames(dashboard.LeastViewed))
+	if assert.Len(t, dashboard.Pages, 3) {
+		assert.Equal(t, []int64{0, 0, 0, 0, 0, 0, 3}, dashboard.Pages[0].Sparkline)
+		assert.Equal(t, []int64{0, 0, 0, 0, 0, 1, 0}, dashboard.Pages[1].Sparkline)
+		assert.Equal(t, int64(2), dashboard.Pages[0].LastWeek)
+	}
+
+	dashboard, err = views.GetDashboard(DB, userID, "", 30)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, int64(10), dashboard.PeriodViews)
+	assert.Equal(t, []string{"Alpha", "Beta", "Alpha child"}, pageNames(dashboard.Trending))
+	if assert.Len(t, dashboard.Pages, 3) {
+		assert.Len(t, dashboard.Pages[2].Sparkline, 30)
+		assert.Equal(t, int64(4), dashboard.Pages[2].Sparkline[29-20])
+	}
+
+	// Only the root and its sub-pages
+	dashboard, err = views.GetDashboard(DB, userID, "1234DashboardAlphaTest", 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []string{"Alpha", "Alpha child"}, pageNames(dashboard.Pages))
+	assert.Equal(t, int64(100), dashboard.TotalViews)
+}
+
+func TestPageSearch(t *testing.T) {
+	resp, _ := doRequest(t, "POST", "/page-create", `{"page_uuid":"1234PageSearchTest", "page_name":"Zanzibar Handbook", "is_root":true, "element_positions":[]}`, true)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	defer doRequest(t, "POST", "/page-delete", `{"page_uuid":"1234PageSearchTest"}`, true)
+
+	// The last term matches as a prefix
+	resp, body := doRequest(t, "GET", "/page-search?q=zanzibar+hand&limit=10", "", true)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	results, _ := body["results"].([]interface{})
+	if assert.Len(t, results, 1) {
+		result := results[0].(map[string]interface{})
+		assert.Equal(t, "1234PageSearchTest", result["page_uuid"])
+		assert.Equal(t, "Zanzibar Handbook", result["page_name"])
+		assert.Equal(t, []interface{}{}, result["matches"])
+	}
+
+	resp, body = doRequest(t, "GET", "/page-search?q=zanzibar+unrelated", "", true)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, []interface{}{}, body["results"])
+
+	resp, body = doRequest(t, "GET", "/page-search?q=zanzibar&limit=1000", "", true)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.Equal(t, "Limit must be at most 100 and offset positive", body["error"])
+}
+
+func TestPublicPageSearchNotFound(t *testing.T) {
+	resp, body := doRequest(t, "GET", "/page-search-public?root=non-existent-slug&q=welcome", "", false)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	assert.Equal(t, "Page not found", body["error"])
+
+	// Private roots are indistinguishable from missing ones
+	resp, _ = doRequest(t, "POST", "/page-create", `{"page_uuid":"1234PublicSearchPrivateTest", "page_name":"PublicSearchPrivateTest", "is_root":true, "element_positions":[]}`, true)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	defer doRequest(t, "POST", "/page-delete", `{"page_uuid":"1234PublicSearchPrivateTest"}`, true)
+
+	resp, privateBody := doRequest(t, "GET", "/page-search-public?root=1234PublicSearchPrivateTest&q=welcome", "", false)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	assert.Equal(t, body, privateBody)
+}
+
+func TestPublicPageSearchSkipsPrivateSubtrees(t *testing.T) {
+	const userID = uint(999994)
+	jsonb := func(s string) pgtype.JSONB { return pgtype.JSONB{Bytes: []byte(s), Status: pgtype.Present} }
+	// A public root with a public child, and a public grandchild under a private child
+	pages := []models.Page{
+		{PageUUID: "1234PublicSearchRootTest", PageName: "Numbat handbook", PublicPage: true},
+		{PageUUID: "1234PublicSearchChildTest", PageName: "Numbat habitats", PublicPage: true, ParentPageUUID: "1234PublicSearchRootTest"},
+		{PageUUID: "1234PublicSearchPrivateChildTest", PageName: "Numbat drafts", ParentPageUUID: "1234PublicSearchRootTest"},
+		{PageUUID: "1234PublicSearchGrandchildTest", PageName: "Numbat secrets", PublicPage: true, ParentPageUUID: "1234PublicSearchPrivateChildTest"},
+	}
+	for i := range pages {
+		pages[i].UserID = userID
+		pages[i].ElementPositions, pages[i].Etc, pages[i].DateViewCount = jsonb(`[]`), jsonb(`{}`), jsonb(`{}`)
+		if err := DB.Omit("id").Create(&pages[i]).Error; err != nil {
+			t.Fatal(err)
+		}
+		defer DB.Unscoped().Delete(&models.Page{}, pages[i].ID)
+		if err := search.IndexPage(DB, pages[i].PageUUID); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	results, err := search.SearchPublic(DB, pages[0], "numbat", 20, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var found []string
+	for _, result := range results {
+		found = append(found, result.PageUUID)
+	}
+	assert.ElementsMatch(t, []string{"1234PublicSearchRootTest", "1234PublicSearchChildTest"}, found)
+
+	// Searching from the grandchild still finds it, it is a public root of its own
+	results, err = search.SearchPublic(DB, pages[3], "numbat", 20, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if assert.Len(t, results, 1) {
+		assert.Equal(t, "1234PublicSearchGrandchildTest", results[0].PageUUID)
+		assert.Empty(t, results[0].ParentPageUUID)
+	}
+}
+
+func TestPublicPageSearchIgnoresDrafts(t *testing.T) {
+	const pageUUID, targetUUID = "6f1c1d2e-8a4b-4c1d-9e2f-0a1b2c3d4e31", "6f1c1d2e-8a4b-4c1d-9e2f-0a1b2c3d4e32"
+	update := func(text string) {
+		t.Helper()
+		resp, _ := doRequest(t, "POST", "/page-update", `{
+			"page": {"page_uuid":"`+pageUUID+`", "page_name":"PublicSearchDraftTest", "is_root":true},
+			"elements": [{"element_uuid":"6f1c1d2e-8a4b-4c1d-9e2f-0a1b2c3d4e33", "type":"Paragraph", "content":{"text":"`+text+`"}, "etc":{}}]
+		}`, true)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	}
+	// search returns the snippets of the public search results
+	search := func(q string) []string {
+		t.Helper()
+		resp, body := doRequest(t, "GET", "/page-search-public?root="+pageUUID+"&q="+q, "", false)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		snippets := []string{}
+		results, _ := body["results"].([]interface{})
+		for _, result := range results {
+			matches, _ := result.(map[string]interface{})["matches"].([]interface{})
+			for _, match := range matches {
+				snippets = append(snippets, match.(map[string]interface{})["snippet"].(string))
+			}
+		}
+		return snippets
+	}
+
+	for _, uuid := range []string{pageUUID, targetUUID} {
+		resp, _ := doRequest(t, "POST", "/page-create", `{"page_uuid":"`+uuid+`", "page_name":"PublicSearchDraftTest", "is_root":true, "element_positions":[]}`, true)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		defer doRequest(t, "POST", "/page-delete", `{"page_uuid":"`+uuid+`", "force":true}`, true)
+	}
+	update("Quokka sightings")
+	resp, _ := doRequest(t, "POST", "/page-update", `{"page": {"page_uuid":"`+pageUUID+`", "public_page":true}}`, true)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, []string{"<mark>Quokka</mark> sightings"}, search("quokka"))
+
+	// The draft, with a link to another page, isn't visible to visitors until published
+	update("Wombat burrows, see /live/" + targetUUID)
+	assert.Empty(t, search("wombat"))
+	assert.Equal(t, []string{"<mark>Quokka</mark> sightings"}, search("quokka"))
+	visitorID := uint(999999)
+	backlinks, total, err := links.Backlinks(DB, []string{targetUUID}, visitorID)
+	assert.NoError(t, err)
+	assert.Empty(t, backlinks)
+	assert.Equal(t, int64(1), total)
+
+	resp, _ = doRequest(t, "POST", "/page-publish", `{"page_uuid":"`+pageUUID+`"}`, true)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Len(t, search("wombat"), 1)
+	assert.Empty(t, search("quokka"))
+	backlinks, _, err = links.Backlinks(DB, []string{targetUUID}, visitorID)
+	assert.NoError(t, err)
+	if assert.Len(t, backlinks, 1) {
+		assert.Equal(t, pageUUID, backlinks[0].PageUUID)
+	}
+}
+
+func TestTagList(t *testing.T) {
+	token := "Only_for_testing1200332"
+	client := http.Client{}
+
+	req, err := http.NewRequest("GET", os.Getenv("DOMAIN")+"/tag-list", nil)
+	if err != nil {
+		t.Error(err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	cookie := http.Cookie{Name: "Authorization", Value: token, HttpOnly: true, Secure: false, Domain: "localhost", Path: "/"}
+	req.AddCookie(&cookie)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Error(err)
+	}
+
+	defer resp.Body.Close()
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestPageTagNotFound(t *testing.T) {
+	token := "Only_for_testing1200332"
+	client := http.Client{}
+
+	body := strings.NewReader(`{"page_uuids":["00000000-0000-0000-0000-000000000000"], "tag_ids":[1]}`)
+
+	req, err := http.NewRequest("POST", os.Getenv("DOMAIN")+"/page-tag", body)
+	if err != nil {
+		t.Error(err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	cookie := http.Cookie{Name: "Authorization", Value: token, HttpOnly: true, Secure: false, Domain: "localhost", Path: "/"}
+	req.AddCookie(&cookie)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Error(err)
+	}
+
+	defer resp.Body.Close()
+
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestPageTagFilter(t *testing.T) {
+	for _, name := range []string{"PageTagFilterA", "PageTagFilterB", "PageTagFilterC"} {
+		resp, _ := doRequest(t, "POST", "/page-create", `{"page_uuid":"1234`+name+`", "page_name":"`+name+`", "is_root":true, "element_positions":[]}`, true)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		defer doRequest(t, "POST", "/page-delete", `{"page_uuid":"1234`+name+`"}`, true)
+	}
+	tagIDs := make(map[string]string)
+	for _, name := range []string{"PageTagFilterRed", "PageTagFilterBlue"} {
+		resp, body := doRequest(t, "POST", "/tag-create", `{"name":"`+name+`"}`, true)
+		if !assert.Equal(t, http.StatusOK, resp.StatusCode) {
+			return
+		}
+		tagIDs[name] = fmt.Sprint(body["tag"].(map[string]interface{})["id"])
+		defer doRequest(t, "POST", "/tag-delete", `{"tag_id":`+tagIDs[name]+`}`, true)
+	}
+	red, blue := tagIDs["PageTagFilterRed"], tagIDs["PageTagFilterBlue"]
+
+	// Tags are added to several pages at once
+	resp, _ := doRequest(t, "POST", "/page-tag", `{"page_uuids":["1234PageTagFilterA", "1234PageTagFilterB"], "tag_ids":[`+red+`]}`, true)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	resp, _ = doRequest(t, "POST", "/page-tag", `{"page_uuids":["1234PageTagFilterB", "1234PageTagFilterC"], "tag_ids":[`+blue+`]}`, true)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	list := func(query string) []string {
+		t.Helper()
+		resp, body := doRequest(t, "GET", "/page-list?sort=name&name=PageTagFilter&"+query, "", true)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		names := []string{}
+		pages, _ := body["pages"].([]interface{})
+		for _, page := range pages {
+			names = append(names, page.(map[string]interface{})["page_name"].(string))
+		}
+		return names
+	}
+	assert.Equal(t, []string{"PageTagFilterA", "PageTagFilterB"}, list("tag_id="+red))
+	assert.Equal(t, []string{"PageTagFilterB"}, list("tag_id="+red+"&tag_id="+blue))
+	assert.Equal(t, []string{"PageTagFilterA", "PageTagFilterB", "PageTagFilterC"}, list("tag_id="+red+"&tag_id="+blue+"&tag_match=any"))
+
+	resp, _ = doRequest(t, "POST", "/page-untag", `{"page_uuids":["1234PageTagFilterA", "1234PageTagFilterB"], "tag_ids":[`+red+`]}`, true)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Empty(t, list("tag_id="+red))
+}
+
+func TestTagCreateConcurrently(t *testing.T) {
+	const userID = uint(999993)
+	defer DB.Unscoped().Where("user_id = ?", userID).Delete(&models.Tag{})
+
+	const attempts = 10
+	errs := make(chan error, attempts)
+	start := make(chan struct{})
+	for i := 0; i < attempts; i++ {
+		go func() {
+			<-start
+			_, err := tags.Create(DB, userID, "Concurrent", tags.DefaultColor)
+			errs <- err
+		}()
+	}
+	close(start)
+
+	created := 0
+	for i := 0; i < attempts; i++ {
+		if err := <-errs; err == nil {
+			created++
+		} else {
+			assert.ErrorIs(t, err, tags.ErrNameTaken)
+		}
+	}
+	assert.Equal(t, 1, created)
+}
+
+func TestPageListPaginated(t *testing.T) {
+	for _, name := range []string{"PageListPaginatedC", "PageListPaginatedA", "PageListPaginatedB"} {
+		resp, _ := doRequest(t, "POST", "/page-create", `{"page_uuid":"1234`+name+`", "page_name":"`+name+`", "is_root":true, "element_positions":[]}`, true)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		defer doRequest(t, "POST", "/page-delete", `{"page_uuid":"1234`+name+`"}`, true)
+	}
+
+	// Following the cursors lists every matching page once, in order
+	var names []string
+	path := "/page-list?limit=2&sort=name&name=PageListPaginated"
+	for i := 0; i < 3; i++ {
+		resp, body := doRequest(t, "GET", path, "", true)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, float64(3), body["total"])
+		for _, page := range body["pages"].([]interface{}) {
+			names = append(names, page.(map[string]interface{})["page_name"].(string))
+		}
+		next, _ := body["next_cursor"].(string)
+		if next == "" {
+			break
+		}
+		path = "/page-list?limit=2&sort=name&name=PageListPaginated&cursor=" + next
+	}
+	assert.Equal(t, []string{"PageListPaginatedA", "PageListPaginatedB", "PageListPaginatedC"}, names)
+
+	// Cursors only continue lists of the same sort order
+	resp, body := doRequest(t, "GET", "/page-list?limit=2&sort=name&name=PageListPaginated", "", true)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	resp, body = doRequest(t, "GET", "/page-list?limit=2&sort=created&cursor="+body["next_cursor"].(string), "", true)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.Equal(t, "invalid cursor", body["error"])
+}
+
+func TestPageListInvalidCursor(t *testing.T) {
+	resp, body := doRequest(t, "GET", "/page-list?limit=1&cursor=invalid", "", true)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.Equal(t, "invalid cursor", body["error"])
+
+	resp, body = doRequest(t, "GET", "/page-list?sort=popularity", "", true)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.Equal(t, "sort must be default, name, created, updated or views, and order asc or desc", body["error"])
+}
+
+func TestPageBacklinksNotFound(t *testing.T) {
+	token := "Only_for_testing1200332"
+	client := http.Client{}
+
+	req, err := http.NewRequest("GET", os.Getenv("DOMAIN")+"/page-backlinks/non-existent-page", nil)
+	if err != nil {
+		t.Error(err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	cookie := http.Cookie{Name: "Authorization", Value: token, HttpOnly: true, Secure: false, Domain: "localhost", Path: "/"}
+	req.AddCookie(&cookie)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Error(err)
+	}
+
+	defer resp.Body.Close()
+
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestCommentListNotFound(t *testing.T) {
+	resp, body := doRequest(t, "GET", "/comment-list/non-existent-page", "", true)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	assert.Equal(t, "Page not found", body["error"])
+}
+
+func TestCommentCreateInvalidBody(t *testing.T) {
+	resp, body := doRequest(t, "POST", "/comment-create", `{"page_uuid": "non-existent-page", "body": "   "}`, true)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.Equal(t, "comment must be 1 to 10000 characters", body["error"])
+}
+
+func TestCommentThread(t *testing.T) {
+	resp, _ := doRequest(t, "POST", "/page-create", `{"page_uuid":"1234CommentThreadTest", "page_name":"CommentThreadTest", "is_root":true, "element_positions":[]}`, true)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	defer doRequest(t, "POST", "/page-delete", `{"page_uuid":"1234CommentThreadTest"}`, true)
+
+	resp, body := doRequest(t, "POST", "/comment-create", `{"page_uuid":"1234CommentThreadTest", "body":"  First thought  "}`, true)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	thread := body["comment"].(map[string]interface{})
+	assert.Equal(t, "First thought", thread["body"])
+	assert.Equal(t, float64(0), thread["author"].(map[string]interface{})["id"])
+	threadID := fmt.Sprint(thread["id"])
+
+	resp, body = doRequest(t, "POST", "/comment-create", `{"page_uuid":"1234CommentThreadTest", "parent_id":`+threadID+`, "body":"A reply"}`, true)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, thread["id"], body["comment"].(map[string]interface{})["parent_id"])
+
+	resp, body = doRequest(t, "GET", "/comment-list/1234CommentThreadTest", "", true)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	threads := body["threads"].([]interface{})
+	if assert.Len(t, threads, 1) {
+		replies := threads[0].(map[string]interface{})["replies"].([]interface{})
+		if assert.Len(t, replies, 1) {
+			assert.Equal(t, "A reply", replies[0].(map[string]interface{})["body"])
+		}
+	}
+
+	// Resolved threads are only listed on request
+	resp, body = doRequest(t, "POST", "/comment-resolve", `{"comment_id":`+threadID+`, "resolved":true}`, true)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.NotNil(t, body["comment"].(map[string]interface{})["resolved_at"])
+	resp, body = doRequest(t, "GET", "/comment-list/1234CommentThreadTest", "", true)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, []interface{}{}, body["threads"])
+	resp, body = doRequest(t, "GET", "/comment-list/1234CommentThreadTest?include_resolved=true", "", true)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Len(t, body["threads"], 1)
+
+	resp, _ = doRequest(t, "POST", "/comment-delete", `{"comment_id":`+threadID+`}`, true)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	resp, body = doRequest(t, "GET", "/comment-list/1234CommentThreadTest?include_resolved=true", "", true)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, []interface{}{}, body["threads"])
+}
+
+// withNotificationMembers calls fn in a transaction that is rolled back, with a page of owner shared with member.
+// outsider has no access to the page.
+func withNotificationMembers(t *testing.T, fn func(tx *gorm.DB, page models.Page, owner uint, member uint, outsider uint)) {
+	t.Helper()
+	const owner, member, outsider = uint(999990), uint(999991), uint(999992)
+	errRollback := errors.New("rollback")
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		for _, id := range []uint{owner, member, outsider} {
+			if err := tx.Exec("INSERT INTO users (id, created_at, updated_at, google_id, email, name, picture, credentials) VALUES (?, NOW(), NOW(), ?, ?, ?, '', '{}')",
+				id, fmt.Sprintf("notify-test-%d", id), fmt.Sprintf("notify-test-%d@example.com", id), fmt.Sprintf("Notify Test %d", id)).Error; err != nil {
+				return err
+			}
+		}
+		jsonb := func(s string) pgtype.JSONB { return pgtype.JSONB{Bytes: []byte(s), Status: pgtype.Present} }
+		page := models.Page{UserID: owner, PageUUID: "1234NotifyTest", PageName: "NotifyTest",
+			ElementPositions: jsonb(`[]`), Etc: jsonb(`{}`), DateViewCount: jsonb(`{}`)}
+		if err := tx.Omit("id").Create(&page).Error; err != nil {
+			return err
+		}
+		if err := tx.Omit("id").Create(&models.PageShare{PageID: page.ID, UserID: member}).Error; err != nil {
+			return err
+		}
+		fn(tx, page, owner, member, outsider)
+		return errRollback
+	})
+	assert.ErrorIs(t, err, errRollback)
+}
+
+// notificationsOf returns the categories of the user's notifications, oldest first.
+func notificationsOf(t *testing.T, tx *gorm.DB, userID uint) []string {
+	t.Helper()
+	categories := []string{}
+	if err := tx.Model(&models.Notification{}).Where("user_id = ?", userID).Order("id").Pluck("category", &categories).Error; err != nil {
+		t.Fatal(err)
+	}
+	return categories
+}
+
+func TestNotify(t *testing.T) {
+	withNotificationMembers(t, func(tx *gorm.DB, page models.Page, owner uint, member uint, outsider uint) {
+		// Mentions of users without access to the page aren't notified, the owner's mention of themselves neither
+		jsonb := func(s string) pgtype.JSONB { return pgtype.JSONB{Bytes: []byte(s), Status: pgtype.Present} }
+		for _, element := range []models.Element{
+			{ElementUUID: "1234NotifyTestParagraph", Type: "Paragraph",
+				Content: jsonb(fmt.Sprintf(`{"text":"Ask @notify-test-%d@example.com, @notify-test-%d@example.com and @notify-test-%d@example.com"}`, member, outsider, owner))},
+			{ElementUUID: "1234NotifyTestCheckbox", Type: notifications.CheckboxType,
+				Content: jsonb(fmt.Sprintf(`{"text":"@NOTIFY-TEST-%d@example.com to review"}`, member))},
+		} {
+			element.UserID, element.PageID, element.Etc = owner, page.ID, jsonb(`{}`)
+			if err := tx.Omit("id").Create(&element).Error; err != nil {
+				t.Fatal(err)
+			}
+		}
+		assert.NoError(t, notifications.NotifyElementMentions(tx, page, owner, nil))
+		assert.ElementsMatch(t, []string{notifications.CategoryMention, notifications.CategoryTask}, notificationsOf(t, tx, member))
+		assert.Empty(t, notificationsOf(t, tx, outsider))
+		assert.Empty(t, notificationsOf(t, tx, owner))
+
+		// Mentions already notified aren't notified again
+		before, err := notifications.ElementMentions(tx, page.ID)
+		assert.NoError(t, err)
+		assert.NoError(t, notifications.NotifyElementMentions(tx, page, owner, before))
+		assert.Len(t, notificationsOf(t, tx, member), 2)
+
+		// One notification per user and comment, none for the actor
+		commentID := uint(1)
+		comment := models.Notification{UserID: member, ActorID: owner, Category: notifications.CategoryReply, PageID: page.ID, CommentID: &commentID}
+		self := models.Notification{UserID: owner, ActorID: owner, Category: notifications.CategoryReply, PageID: page.ID, CommentID: &commentID}
+		assert.NoError(t, notifications.Notify(tx, comment, comment, self))
+		assert.Equal(t, []string{notifications.CategoryReply}, notificationsOf(t, tx, member)[2:])
+		assert.Empty(t, notificationsOf(t, tx, owner))
+
+		// Muted categories aren't notified, others still are
+		assert.NoError(t, notifications.SetMuted(tx, member, []string{notifications.CategoryShare}))
+		assert.NoError(t, notifications.PageShared(tx, page, owner, member))
+		otherCommentID := uint(2)
+		comment.CommentID = &otherCommentID
+		assert.NoError(t, notifications.Notify(tx, comment))
+		assert.Equal(t, []string{notifications.CategoryReply, notifications.CategoryReply}, notificationsOf(t, tx, member)[2:])
+	})
+}
+
+func TestNotificationMarkRead(t *testing.T) {
+	withNotificationMembers(t, func(tx *gorm.DB, page models.Page, owner uint, member uint, outsider uint) {
+		for i, userID := range []uint{member, member, member, outsider} {
+			commentID := uint(i + 1)
+			assert.NoError(t, notifications.Notify(tx, models.Notification{UserID: userID, ActorID: owner, Category: notifications.CategoryReply, PageID: page.ID, CommentID: &commentID}))
+		}
+		var memberIDs, outsiderIDs []uint
+		tx.Model(&models.Notification{}).Where("user_id = ?", member).Order("id").Pluck("id", &memberIDs)
+		tx.Model(&models.Notification{}).Where("user_id = ?", outsider).Pluck("id", &outsiderIDs)
+		if !assert.Len(t, memberIDs, 3) || !assert.Len(t, outsiderIDs, 1) {
+			return
+		}
+
+		// Notifications of other users are left as they are
+		marked, err := notifications.MarkRead(tx, member, []uint{memberIDs[0], outsiderIDs[0]})
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1), marked)
+		unread, err := notifications.Unread(tx, member)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(2), unread)
+
+		// Notifications already read aren't counted again
+		marked, err = notifications.MarkRead(tx, member, []uint{memberIDs[0], memberIDs[1]})
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1), marked)
+
+		// Without IDs every unread notification of the user is marked
+		marked, err = notifications.MarkRead(tx, member, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1), marked)
+		unread, err = notifications.Unread(tx, member)
+		assert.NoError(t, err)
+		assert.Zero(t, unread)
+		unread, err = notifications.Unread(tx, outsider)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1), unread)
+
+		entries, err := notifications.List(tx, member, true, 10, 0)
+		assert.NoError(t, err)
+		assert.Empty(t, entries)
+	})
+}
+
+func TestNotificationList(t *testing.T) {
+	resp, body := doRequest(t, "GET", "/notification-list?unread=true", "", true)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	notifications, ok := body["notifications"].([]interface{})
+	assert.True(t, ok)
+	// Only unread notifications are listed
+	for _, notification := range notifications {
+		assert.Nil(t, notification.(map[string]interface{})["read_at"])
+	}
+	// Listed up to the default limit, while every unread notification is counted
+	assert.GreaterOrEqual(t, body["unread"], float64(len(notifications)))
+}
+
+func TestNotificationPreferencesInvalidCategory(t *testing.T) {
+	resp, body := doRequest(t, "POST", "/notification-preferences-update", `{"muted": ["everything"]}`, true)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.Equal(t, "category must be mention, task, reply or share", body["error"])
+}
+
+func TestNotificationPreferences(t *testing.T) {
+	defer doRequest(t, "POST", "/notification-preferences-update", `{"muted": []}`, true)
+
+	resp, body := doRequest(t, "POST", "/notification-preferences-update", `{"muted": ["share", "reply", "share"]}`, true)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, []interface{}{"reply", "share"}, body["muted"])
+
+	resp, body = doRequest(t, "GET", "/notification-preferences", "", true)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, []interface{}{"mention", "task", "reply", "share"}, body["categories"])
+	assert.Equal(t, []interface{}{"reply", "share"}, body["muted"])
+}
+
+func TestEmailUnsubscribeInvalidToken(t *testing.T) {
+	resp, body := doRequest(t, "GET", "/email-unsubscribe?token=1.digest.forged", "", false)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.Equal(t, "Invalid unsubscribe link", body["error"])
+}
+
+func TestEmailPreferences(t *testing.T) {
+	resp, body := doRequest(t, "GET", "/email-preferences", "", true)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	notifications, digest := body["notifications"], body["digest"]
+	assert.IsType(t, true, notifications)
+	assert.IsType(t, true, digest)
+	defer doRequest(t, "POST", "/email-preferences-update", fmt.Sprintf(`{"notifications": %v, "digest": %v}`, notifications, digest), true)
+
+	// Omitted preferences are left as they are
+	resp, body = doRequest(t, "POST", "/email-preferences-update", `{"digest": true}`, true)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, true, body["digest"])
+	assert.Equal(t, notifications, body["notifications"])
+
+	resp, body = doRequest(t, "POST", "/email-preferences-update", `{"notifications": false}`, true)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, false, body["notifications"])
+	assert.Equal(t, true, body["digest"])
+}
+
+func TestWebhookList(t *testing.T) {
+	resp, body := doRequest(t, "GET", "/webhook-list", "", true)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.IsType(t, []interface{}{}, body["webhooks"])
+	assert.Equal(t, []interface{}{"page.created", "page.updated", "page.published", "page.unpublished", "page.deleted", "element.changed"}, body["events"])
+}
+
+func TestWebhookCreateInvalidURL(t *testing.T) {
+	resp, body := doRequest(t, "POST", "/webhook-create", `{"url": "ftp://example.com/hook", "events": ["page.updated"]}`, true)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.Equal(t, "url must be an absolute http or https url of at most 2048 characters", body["error"])
+}
+
+func TestWebhookDeliveries(t *testing.T) {
+	resp, body := doRequest(t, "POST", "/webhook-create", `{"url": "https://hooks.example.com/opalescence", "events": ["page.created", "page.created"]}`, true)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	webhook := body["webhook"].(map[string]interface{})
+	webhookID := fmt.Sprint(webhook["id"])
+	defer doRequest(t, "POST", "/webhook-delete", `{"webhook_id":`+webhookID+`}`, true)
+	assert.Equal(t, []interface{}{"page.created"}, webhook["events"])
+	assert.Equal(t, true, webhook["active"])
+	assert.NotEmpty(t, body["secret"])
+
+	resp, _ = doRequest(t, "POST", "/page-create", `{"page_uuid":"1234WebhookDeliveryTest", "page_name":"WebhookDeliveryTest", "is_root":true, "element_positions":[]}`, true)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	defer doRequest(t, "POST", "/page-delete", `{"page_uuid":"1234WebhookDeliveryTest"}`, true)
+
+	// Only the events subscribed to are delivered
+	resp, body = doRequest(t, "GET", "/webhook-deliveries/"+webhookID, "", true)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, float64(1), body["total"])
+	if deliveries, ok := body["deliveries"].([]interface{}); assert.True(t, ok) && assert.Len(t, deliveries, 1) {
+		delivery := deliveries[0].(map[string]interface{})
+		assert.Equal(t, "page.created", delivery["event"])
+		payload := delivery["payload"].(map[string]interface{})
+		assert.Equal(t, "page.created", payload["event"])
+		assert.Equal(t, "1234WebhookDeliveryTest", payload["data"].(map[string]interface{})["page_uuid"])
+	}
+}
+
+func TestAuditLog(t *testing.T) {
+	resp, _ := doRequest(t, "POST", "/page-create", `{"page_uuid":"1234AuditLogTest", "page_name":"AuditLogTest", "is_root":true, "element_positions":[]}`, true)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	defer doRequest(t, "POST", "/page-delete", `{"page_uuid":"1234AuditLogTest"}`, true)
+
+	// An action of another user on the page
+	otherID := uint(999999)
+	err := audit.Record(DB, audit.Entry{
+		ActorID: &otherID, Action: audit.ActionPageUpdated, TargetType: audit.TargetPage, TargetID: "1234AuditLogTest",
+		IP: "203.0.113.7", UserAgent: "OtherBrowser",
+	})
+	assert.NoError(t, err)
+
+	resp, body := doRequest(t, "GET", "/audit-log?from=2024-01-01&action=page.created&action=page.updated&limit=100", "", true)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	events, ok := body["events"].([]interface{})
+	if !assert.True(t, ok) {
+		return
+	}
+	found := map[string]map[string]interface{}{}
+	for _, item := range events {
+		event := item.(map[string]interface{})
+		if event["target_id"] == "1234AuditLogTest" {
+			found[event["action"].(string)] = event
+		}
+	}
+	if created, ok := found["page.created"]; assert.True(t, ok) {
+		// The user's own action, with the client it was performed from
+		assert.NotEmpty(t, created["ip"])
+		assert.Equal(t, "page", created["target_type"])
+	}
+	if updated, ok := found["page.updated"]; assert.True(t, ok) {
+		assert.NotContains(t, updated, "ip")
+		assert.NotContains(t, updated, "user_agent")
+		if actor, ok := updated["actor"].(map[string]interface{}); ok {
+			assert.NotContains(t, actor, "email")
+			assert.NotContains(t, actor, "id")
+		}
+	}
+}
+
+func TestAuditEventsAnonymise(t *testing.T) {
+	errRollback := errors.New("rollback")
+	userID := uint(999998)
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		for _, entry := range []audit.Entry{
+			{ActorID: &userID, Action: audit.ActionUserLogin, TargetType: audit.TargetUser, TargetID: fmt.Sprint(userID), IP: "203.0.113.7", UserAgent: "Browser",
+				Details: map[string]interface{}{"method": "google"}},
+			{Action: audit.ActionPagePublished, TargetType: audit.TargetPage, TargetID: "1234AuditAnonymiseTest", Details: map[string]interface{}{"page_name": "Private"}},
+		} {
+			if err := audit.Record(tx, entry); err != nil {
+				return err
+			}
+		}
+		if err := audit.Anonymise(tx, userID, []string{"1234AuditAnonymiseTest"}); err != nil {
+			return err
+		}
+
+		var events []models.AuditEvent
+		if err := tx.Where("target_id IN ?", []string{fmt.Sprint(userID), "1234AuditAnonymiseTest"}).Find(&events).Error; err != nil {
+			return err
+		}
+		if !assert.Len(t, events, 2) {
+			return errRollback
+		}
+		for _, event := range events {
+			assert.Nil(t, event.ActorID)
+			assert.Empty(t, event.IP)
+			assert.Empty(t, event.UserAgent)
+			assert.JSONEq(t, "{}", string(event.Details.Bytes))
+		}
+
+		// Entries can't be altered outside of Anonymise, the rejected update aborts the transaction
+		assert.Error(t, tx.Exec("UPDATE audit_events SET ip = '' WHERE id = ?", events[0].ID).Error)
+		return errRollback
+	})
+	assert.ErrorIs(t, err, errRollback)
+}
+
+func TestAuditLogExportInvalidRange(t *testing.T) {
+	token := "Only_for_testing1200332"
+	client := http.Client{}
+
+	req, err := http.NewRequest("GET", os.Getenv("DOMAIN")+"/audit-log-export?from=yesterday", nil)
+	if err != nil {
+		t.Error(err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	cookie := http.Cookie{Name: "Authorization", Value: token, HttpOnly: true, Secure: false, Domain: "localhost", Path: "/"}
+	req.AddCookie(&cookie)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Error(err)
+	}
+
+	defer resp.Body.Close()
+
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestPageScheduleNotFound(t *testing.T) {
+	token := "Only_for_testing1200332"
+	client := http.Client{}
+
+	body := strings.NewReader(`{"page_uuid": "00000000-0000-0000-0000-000000000000", "public": true, "run_at": "2020-01-01T00:00:00Z"}`)
+	req, err := http.NewRequest("POST", os.Getenv("DOMAIN")+"/page-schedule", body)
+	if err != nil {
+		t.Error(err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	cookie := http.Cookie{Name: "Authorization", Value: token, HttpOnly: true, Secure: false, Domain: "localhost", Path: "/"}
+	req.AddCookie(&cookie)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Error(err)
+	}
+
+	defer resp.Body.Close()
+
+	// The page doesn't exist
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestPageScheduleRunSkipsRetries(t *testing.T) {
+	resp, _ := doRequest(t, "POST", "/page-create", `{"page_uuid":"1234PageScheduleRunTest", "page_name":"PageScheduleRunTest", "is_root":true, "element_positions":[]}`, true)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	defer doRequest(t, "POST", "/page-delete", `{"page_uuid":"1234PageScheduleRunTest"}`, true)
+
+	runAt := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	resp, body := doRequest(t, "POST", "/page-schedule", `{"page_uuid":"1234PageScheduleRunTest", "public":false, "run_at":"`+runAt+`"}`, true)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	schedule := body["schedule"].(map[string]interface{})
+	assert.Equal(t, "pending", schedule["status"])
+	assert.Equal(t, float64(0), schedule["attempts"])
+	assert.Nil(t, schedule["next_attempt_at"])
+	scheduleID := uint(schedule["id"].(float64))
+
+	// A schedule whose execution failed, retried in an hour
+	var page models.Page
+	assert.NoError(t, DB.First(&page, "page_uuid = ?", "1234PageScheduleRunTest").Error)
+	past, nextAttemptAt := time.Now().Add(-time.Hour), time.Now().Add(time.Hour)
+	retried := models.PublishSchedule{
+		UserID: page.UserID, PageID: page.ID, RunAt: past, Status: publishing.StatusPending, Attempts: 2, NextAttemptAt: &nextAttemptAt,
+	}
+	assert.NoError(t, DB.Omit("id").Create(&retried).Error)
+	assert.NoError(t, DB.Model(&models.PublishSchedule{}).Where("id = ?", scheduleID).Update("run_at", past).Error)
+
+	_, err := publishing.Run(context.Background(), DB, time.Now())
+	assert.NoError(t, err)
+
+	var schedules []models.PublishSchedule
+	assert.NoError(t, DB.Where("page_id = ?", page.ID).Order("id").Find(&schedules).Error)
+	if assert.Len(t, schedules, 2) {
+		// The page is already private, so the schedule is done without changing it
+		assert.Equal(t, publishing.StatusDone, schedules[0].Status)
+		assert.Equal(t, 1, schedules[0].Attempts)
+		assert.Equal(t, 0, schedules[0].PagesChanged)
+		assert.Equal(t, publishing.StatusPending, schedules[1].Status)
+		assert.Equal(t, 2, schedules[1].Attempts)
+	}
+}
+
+func TestPageDraftDiffNotFound(t *testing.T) {
+	token := "Only_for_testing1200332"
+	client := http.Client{}
+
+	req, err := http.NewRequest("GET", os.Getenv("DOMAIN")+"/page-draft-diff/00000000-0000-0000-0000-000000000000", nil)
+	if err != nil {
+		t.Error(err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	cookie := http.Cookie{Name: "Authorization", Value: token, HttpOnly: true, Secure: false, Domain: "localhost", Path: "/"}
+	req.AddCookie(&cookie)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Error(err)
+	}
+
+	defer resp.Body.Close()
+
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestDomainCreateInvalidHostname(t *testing.T) {
+	resp, body := doRequest(t, "POST", "/domain-create", `{"page_uuid":"1234PageCreateTest", "hostname":"localhost:8000"}`, true)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.Equal(t, "hostname must be a domain name, e.g. docs.example.com", body["error"])
+}
+
+func TestDomainVerify(t *testing.T) {
+	domain := models.CustomDomain{UserID: 0, PageID: 0, Hostname: "docs.verify-test.example.com", VerificationToken: "test-token"}
+	if err := DB.Omit("id").Create(&domain).Error; err != nil {
+		t.Fatal(err)
+	}
+	defer DB.Delete(&models.CustomDomain{}, domain.ID)
+
+	resolver := domains.NewFake()
+
+	// Without the record the domain stays unverified
+	_, err := domains.Verify(context.Background(), DB, resolver, domain)
+	assert.ErrorIs(t, err, domains.ErrNotVerified)
+
+	resolver.Set(domains.RecordName(domain), "unrelated", domains.RecordValue(domain))
+	verified, err := domains.Verify(context.Background(), DB, resolver, domain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NotNil(t, verified.VerifiedAt)
+}
+
+func TestDomainVerifyTakesOverClaims(t *testing.T) {
+	const hostname = "docs.takeover-test.example.com"
+	squatter := models.CustomDomain{UserID: 999997, PageID: 0, Hostname: hostname, VerificationToken: "squatter-token"}
+	owner := models.CustomDomain{UserID: 0, PageID: 0, Hostname: hostname, VerificationToken: "owner-token"}
+	// Unverified claims of the same hostname don't block each other
+	for _, domain := range []*models.CustomDomain{&squatter, &owner} {
+		if err := DB.Omit("id").Create(domain).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	defer DB.Where("hostname = ?", hostname).Delete(&models.CustomDomain{})
+
+	resolver := domains.NewFake()
+	resolver.Set(domains.RecordName(owner), domains.RecordValue(owner))
+	var verified models.CustomDomain
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		verified, err = domains.Verify(context.Background(), tx, resolver, owner)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NotNil(t, verified.VerifiedAt)
+
+	// The competing claim is deleted, and the hostname can't be claimed or verified again
+	var claims []models.CustomDomain
+	assert.NoError(t, DB.Where("hostname = ?", hostname).Find(&claims).Error)
+	if assert.Len(t, claims, 1) {
+		assert.Equal(t, owner.ID, claims[0].ID)
+	}
+	_, err = domains.Verify(context.Background(), DB, resolver, squatter)
+	assert.ErrorIs(t, err, domains.ErrNotVerified)
+	resolver.Set(domains.RecordName(squatter), domains.RecordValue(squatter))
+	_, err = domains.Verify(context.Background(), DB, resolver, squatter)
+	assert.ErrorIs(t, err, domains.ErrHostnameTaken)
+	_, err = domains.Create(DB, models.Page{IsRoot: true, PublicPage: true}, 999997, hostname)
+	assert.ErrorIs(t, err, domains.ErrHostnameTaken)
+}
+
+// doRequest sends a request to the server, as the test user if authenticated, and returns the response with its
+// decoded JSON body, nil if it isn't a JSON object.
+func doRequest(t *testing.T, method string, path string, body string, authenticated bool) (*http.Response, map[string]interface{}) {
+	t.Helper()
+	var reader io.Reader
+	if body != "" {
+		reader = strings.NewReader(body)
+	}
+	req, err := http.NewRequest(method, os.Getenv("DOMAIN")+path, reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if authenticated {
+		req.AddCookie(&http.Cookie{Name: "Authorization", Value: "Only_for_testing1200332", HttpOnly: true, Secure: false, Domain: "localhost", Path: "/"})
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	var decoded map[string]interface{}
+	json.NewDecoder(resp.Body).Decode(&decoded)
+	return resp, decoded
+}
+
+func TestPrivatePageAnonymousNotFound(t *testing.T) {
+	resp, _ := doRequest(t, "POST", "/page-create", `{"page_uuid":"1234PrivatePageAnonymousTest", "page_name":"PrivatePageAnonymousTest", "is_root":true, "element_positions":[]}`, true)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	defer doRequest(t, "POST", "/page-delete", `{"page_uuid":"1234PrivatePageAnonymousTest"}`, true)
+
+	// Anonymous requests can't tell private pages from missing ones
+	resp, body := doRequest(t, "GET", "/page-get/1234PrivatePageAnonymousTest", "", false)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	assert.Equal(t, "Page not found", body["error"])
+
+	resp, missingBody := doRequest(t, "GET", "/page-get/1234PageThatDoesNotExist", "", false)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	assert.Equal(t, body, missingBody)
+}
+
+func TestBillingWebhookStaleEvent(t *testing.T) {
+	simulator := billing.NewSimulator(os.Getenv("DOMAIN")+"/billing-webhook", os.Getenv("BILLING_WEBHOOK_SECRET"))
+	subscription := billing.Subscription{ID: "sub_stale_test", Customer: "cus_shouldnotexist", Status: "active", Metadata: map[string]string{"plan": "premium"}}
+
+	cancelled := simulator.NewEvent(billing.EventSubscriptionCancelled, subscription)
+	updated := simulator.NewEvent(billing.EventSubscriptionUpdated, subscription)
+	// The update was created before the cancellation but is delivered after it
+	updated.Created = cancelled.Created - 60
+
+	for _, tc := range []struct {
+		event billing.Event
+		stale bool
+	}{{cancelled, false}, {updated, true}} {
+		resp, err := simulator.Send(tc.event)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var body map[string]interface{}
+		json.NewDecoder(resp.Body).Decode(&body)
+		resp.Body.Close()
+
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, tc.stale, body["stale"] == true)
+	}
+}
+
+func TestAdminImpersonation(t *testing.T) {
+	// The test user is made an admin for the duration of the test
+	if err := DB.Model(&models.User{}).Where("id = ?", 0).Update("role", "admin").Error; err != nil {
+		t.Fatal(err)
+	}
+	defer DB.Model(&models.User{}).Where("id = ?", 0).Update("role", "user")
+
+	// Wildcards in the search term are matched literally
+	resp, body := doRequest(t, "GET", "/admin/user-search?q=%25", "", true)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, float64(0), body["total"])
+
+	req, err := http.NewRequest("GET", os.Getenv("DOMAIN")+"/user-export", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("X-Impersonate-User", "0")
+	req.AddCookie(&http.Cookie{Name: "Authorization", Value: "Only_for_testing1200332", HttpOnly: true, Secure: false, Domain: "localhost", Path: "/"})
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	json.NewDecoder(resp.Body).Decode(&body)
+
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	assert.Equal(t, "Route can't be impersonated", body["error"])
+}
+
+// failingAckCounter is a Counter whose first Ack fails, as if the app crashed after persisting a batch.
+type failingAckCounter struct {
+	*caching.MemoryCounter
+	failed bool
+}
+
+func (f *failingAckCounter) Ack(ctx context.Context, batch caching.Batch) error {
+	if !f.failed {
+		f.failed = true
+		return errors.New("ack failed")
+	}
+	return f.MemoryCounter.Ack(ctx, batch)
+}
+
+func TestViewFlushAppliesBatchOnce(t *testing.T) {
+	resp, _ := doRequest(t, "POST", "/page-create", `{"page_uuid":"1234ViewFlushTest", "page_name":"ViewFlushTest", "is_root":true, "element_positions":[]}`, true)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	defer doRequest(t, "POST", "/page-delete", `{"page_uuid":"1234ViewFlushTest"}`, true)
+
+	var page models.Page
+	if err := DB.Where("page_uuid = ?", "1234ViewFlushTest").First(&page).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	counter := &failingAckCounter{MemoryCounter: caching.NewMemoryCounter()}
+	visit := views.Visit{PageID: page.ID, Time: time.Now(), VisitorID: "flush-test", Device: views.DeviceDesktop}
+	views.Record(ctx, counter, visit)
+	views.Record(ctx, counter, visit)
+
+	// The batch is applied but not acknowledged, so it is drained again and must be skipped
+	assert.Error(t, views.Flush(ctx, DB, counter))
+	assert.NoError(t, views.Flush(ctx, DB, counter))
+
+	if err := DB.First(&page, page.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, uint(2), page.ViewCount)
+	var viewRows int64
+	DB.Model(&models.PageView{}).Where("page_id = ?", page.ID).Count(&viewRows)
+	assert.Equal(t, int64(1), viewRows)
+}
+
+func TestViewFlushDropsViewsBeforeReset(t *testing.T) {
+	resp, _ := doRequest(t, "POST", "/page-create", `{"page_uuid":"1234ViewResetTest", "page_name":"ViewResetTest", "is_root":true, "element_positions":[]}`, true)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	defer doRequest(t, "POST", "/page-delete", `{"page_uuid":"1234ViewResetTest"}`, true)
+	resp, _ = doRequest(t, "POST", "/page-update", `{"page": {"page_uuid":"1234ViewResetTest", "public_page":true}}`, true)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var page models.Page
+	if err := DB.Where("page_uuid = ?", "1234ViewResetTest").First(&page).Error; err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	counter := caching.NewMemoryCounter()
+	views.Record(ctx, counter, views.Visit{PageID: page.ID, Time: time.Now(), VisitorID: "reset-before", Device: views.DeviceDesktop, ViewsResetAt: page.ViewsResetAt})
+
+	// Making the page private resets its views while the visit is still buffered
+	resp, _ = doRequest(t, "POST", "/page-update", `{"page": {"page_uuid":"1234ViewResetTest", "public_page":false}}`, true)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	if err := DB.First(&page, page.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	views.Record(ctx, counter, views.Visit{PageID: page.ID, Time: time.Now(), VisitorID: "reset-after", Device: views.DeviceDesktop, ViewsResetAt: page.ViewsResetAt})
+	assert.NoError(t, views.Flush(ctx, DB, counter))
+
+	if err := DB.First(&page, page.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, uint(1), page.ViewCount)
+	var visitors []string
+	DB.Model(&models.PageView{}).Where("page_id = ?", page.ID).Pluck("visitor_id", &visitors)
+	assert.Equal(t, []string{"reset-after"}, visitors)
+}
+
+func TestDeleteNestedPage(t *testing.T) {
+	const parentUUID, childUUID, linkerUUID = "6f1c1d2e-8a4b-4c1d-9e2f-0a1b2c3d4e01", "6f1c1d2e-8a4b-4c1d-9e2f-0a1b2c3d4e02", "6f1c1d2e-8a4b-4c1d-9e2f-0a1b2c3d4e03"
+
+	// Sub-pages are created the way the editor creates them: the page, then a Nested Page element in its parent
+	resp, _ := doRequest(t, "POST", "/page-create", `{"page_uuid":"`+parentUUID+`", "page_name":"NestedParent", "is_root":true, "element_positions":[]}`, true)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	defer doRequest(t, "POST", "/page-delete", `{"page_uuid":"`+parentUUID+`", "force":true}`, true)
+	resp, _ = doRequest(t, "POST", "/page-create", `{"page_uuid":"`+childUUID+`", "page_name":"Untitled", "is_root":false, "element_positions":[], "public_page":false, "is_favourite":false, "parent_page_uuid":"`+parentUUID+`"}`, true)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	resp, _ = doRequest(t, "POST", "/page-update", `{
+		"page": {"page_uuid":"`+parentUUID+`", "page_name":"NestedParent", "is_root":true},
+		"elements": [{"element_uuid":"6f1c1d2e-8a4b-4c1d-9e2f-0a1b2c3d4e11", "type":"Nested Page", "content":{"text":"Untitled"}, "etc":{"text":"`+childUUID+`"}}]
+	}`, true)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// A link from another page still blocks the deletion, the parent's embedding doesn't
+	resp, _ = doRequest(t, "POST", "/page-create", `{"page_uuid":"`+linkerUUID+`", "page_name":"NestedLinker", "is_root":true, "element_positions":[]}`, true)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	resp, _ = doRequest(t, "POST", "/page-update", `{
+		"page": {"page_uuid":"`+linkerUUID+`", "page_name":"NestedLinker", "is_root":true},
+		"elements": [{"element_uuid":"6f1c1d2e-8a4b-4c1d-9e2f-0a1b2c3d4e12", "type":"Paragraph", "content":{"text":"See /live/`+childUUID+`"}, "etc":{}}]
+	}`, true)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	resp, body := doRequest(t, "POST", "/page-delete", `{"page_uuid":"`+childUUID+`"}`, true)
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+	assert.Equal(t, float64(1), body["inbound_links"])
+	if backlinks, ok := body["backlinks"].([]interface{}); assert.True(t, ok) && assert.Len(t, backlinks, 1) {
+		assert.Equal(t, linkerUUID, backlinks[0].(map[string]interface{})["page_uuid"])
+	}
+
+	resp, _ = doRequest(t, "POST", "/page-delete", `{"page_uuid":"`+linkerUUID+`"}`, true)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// The editor only sends the UUID of the sub-page
+	resp, _ = doRequest(t, "POST", "/page-delete", `{"page_uuid":"`+childUUID+`"}`, true)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	resp, _ = doRequest(t, "GET", "/page-get/"+childUUID, "", true)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	resp, _ = doRequest(t, "GET", "/page-get/"+parentUUID, "", true)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestPageDraftPublish(t *testing.T) {
+	const pageUUID, elementUUID = "6f1c1d2e-8a4b-4c1d-9e2f-0a1b2c3d4e21", "6f1c1d2e-8a4b-4c1d-9e2f-0a1b2c3d4e22"
+	update := func(text string) {
+		t.Helper()
+		resp, _ := doRequest(t, "POST", "/page-update", `{
+			"page": {"page_uuid":"`+pageUUID+`", "page_name":"DraftPublishTest", "is_root":true},
+			"elements": [{"element_uuid":"`+elementUUID+`", "type":"Paragraph", "content":{"text":"`+text+`"}, "etc":{}}]
+		}`, true)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	}
+	// publicText returns the text of the element served to visitors
+	publicText := func() interface{} {
+		t.Helper()
+		resp, body := doRequest(t, "GET", "/page-get/"+pageUUID, "", false)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		elements, ok := body["elements"].([]interface{})
+		if !assert.True(t, ok) || !assert.Len(t, elements, 1) {
+			return nil
+		}
+		return elements[0].(map[string]interface{})["content"].(map[string]interface{})["text"]
+	}
+
+	resp, _ := doRequest(t, "POST", "/page-create", `{"page_uuid":"`+pageUUID+`", "page_name":"DraftPublishTest", "is_root":true, "element_positions":[]}`, true)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	defer doRequest(t, "POST", "/page-delete", `{"page_uuid":"`+pageUUID+`", "force":true}`, true)
+	update("First")
+
+	// Making the page public publishes its draft
+	resp, _ = doRequest(t, "POST", "/page-update", `{"page": {"page_uuid":"`+pageUUID+`", "public_page":true}}`, true)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "First", publicText())
+
+	// Edits stay in the draft until published
+	update("Second")
+	assert.Equal(t, "First", publicText())
+	resp, body := doRequest(t, "GET", "/page-draft-diff/"+pageUUID, "", true)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, true, body["has_changes"])
+	assert.NotNil(t, body["published_at"])
+	if changed, ok := body["changed"].([]interface{}); assert.True(t, ok) && assert.Len(t, changed, 1) {
+		change := changed[0].(map[string]interface{})
+		assert.Equal(t, elementUUID, change["element_uuid"])
+		assert.Equal(t, "First", change["published"].(map[string]interface{})["content"].(map[string]interface{})["text"])
+		assert.Equal(t, "Second", change["draft"].(map[string]interface{})["content"].(map[string]interface{})["text"])
+	}
+
+	resp, body = doRequest(t, "POST", "/page-publish", `{"page_uuid":"`+pageUUID+`"}`, true)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.NotEmpty(t, body["published_at"])
+	assert.Equal(t, "Second", publicText())
+	resp, body = doRequest(t, "GET", "/page-draft-diff/"+pageUUID, "", true)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, false, body["has_changes"])
+
+	// Discarding the draft restores the published version
+	update("Third")
+	resp, _ = doRequest(t, "POST", "/page-discard-draft", `{"page_uuid":"`+pageUUID+`"}`, true)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	resp, body = doRequest(t, "GET", "/page-get/"+pageUUID, "", true)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	if elements, ok := body["elements"].([]interface{}); assert.True(t, ok) && assert.Len(t, elements, 1) {
+		assert.Equal(t, "Second", elements[0].(map[string]interface{})["content"].(map[string]interface{})["text"])
+	}
+}
@@ -25,6 +25,7 @@ import IframeElement from '@/components/OurWebsiteElements/Iframe'
 import NestedPageElement from '@/components/OurWebsiteElements/NestedPage'
 import { usePageCreate } from '@/hooks/Page/usePageCreate'
 import { usePageGet } from '@/hooks/Page/usePageGet'
+import { usePagePublish } from '@/hooks/Page/usePagePublish'
 import { usePageUpdate } from '@/hooks/Page/usePageUpdate'
 import loadingGif from 'public/images/loader.gif'
 import loadingGifDark from 'public/images/loaderNoBackground.gif'
@@ -117,6 +118,7 @@ const PageContent = ({
 
   // Page Endpoints
   const updatePage = usePageUpdate()
+  const publishPage = usePagePublish()
   const createPage = usePageCreate(pages, setPages, false)
   const {
     pageTitle,
@@ -403,6 +405,19 @@ const PageContent = ({
     )
   }
 
+  /**
+   * Save the draft of a public page and publish it, so its visitors see the changes.
+   *
+   * @return {Promise<void>}
+   */
+  const publishChanges = async () => {
+    // Only public pages have visitors, private pages are published when they are made public
+    if (!isEditable || !isPublicPage) return
+
+    await saveChanges()
+    await publishPage(selectedPageUuid)
+  }
+
   /**
    * A function that handles publishing a new page and alerting the user.
    *
@@ -525,6 +540,14 @@ const PageContent = ({
               Save
             </Button>
           )}
+          {/* Publish changes button */}
+          {isEditable && isPublicPage && (
+            <Tooltip title="Save and publish your changes to visitors">
+              <Button onClick={publishChanges} sx={{ border: '2px solid rgb(25, 118, 210)' }}>
+                Publish Changes
+              </Button>
+            </Tooltip>
+          )}
           {/* Publish button */}
           {!isEditable && (
             <Tooltip
@@ -0,0 +1,32 @@
+import { useCallback } from 'react'
+
+/**
+ * Generates a custom hook for publishing the draft of a page, making it the version served to visitors.
+ *
+ * @param {string} page_uuid - The UUID of the page to be published
+ * @return {boolean} Indicates if the draft was successfully published
+ */
+export const usePagePublish = () => {
+  const publishPage = useCallback(async (page_uuid: string) => {
+    try {
+      // Making a POST request to the server to publish the draft
+      const response = await fetch(`${process.env.NEXT_PUBLIC_OPALESCENCE_BASE_URL}/page-publish`, {
+        method: 'POST',
+        body: JSON.stringify({ page_uuid }),
+        credentials: 'include',
+      })
+
+      if (!response.ok) {
+        throw new Error('Page publish failed')
+      }
+
+      console.log('Page published successfully')
+      return true
+    } catch (error) {
+      console.error(`Page publish error: ${error}`)
+      return false
+    }
+  }, [])
+
+  return publishPage
+}